@@ -2,36 +2,49 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go"
 
 	"github.com/rahmanazhar/FoodSupplyChain/internal/gateway"
+	"github.com/rahmanazhar/FoodSupplyChain/internal/gateway/bff"
+	"github.com/rahmanazhar/FoodSupplyChain/internal/gateway/proxy"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/health"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/migrate"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/ratelimit"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
 )
 
 type Config struct {
-	Port             int
-	InventoryService string
-	ShipmentService  string
-	JWTSecret        string
-	TokenTTL         time.Duration
-	CORSOrigin       string
-	ReadTimeout      time.Duration
-	WriteTimeout     time.Duration
-	IdleTimeout      time.Duration
+	Port         int
+	RoutesFile   string
+	JWTSecret    string
+	TokenTTL     time.Duration
+	CORSOrigin   string
+	ClientIP     httpx.ClientIPConfig
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+}
+
+// reservedPaths are served by the gateway itself and may not be proxied.
+var reservedPaths = []string{
+	"/health", "/livez", "/readyz", "/metrics", "/dashboard", "/auth", "/users", "/roles", "/permissions", "/api-keys",
+	"/admin",
 }
 
 // corsMiddleware allows the configured frontend origin.
@@ -40,7 +53,7 @@ func corsMiddleware(origin string) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Read-Consistency")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 			if r.Method == "OPTIONS" {
@@ -54,36 +67,121 @@ func corsMiddleware(origin string) func(http.Handler) http.Handler {
 }
 
 func main() {
+	configPath := flag.String("config", "", "path to the YAML configuration (default: $FSC_CONFIG or configs/config.yaml)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [%s]\n", os.Args[0], migrate.Usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Settings shared with the services come from the YAML file (section
+	// services.gateway), the gateway's own from its gateway: section.
+	shared, err := config.Load(config.GatewayService, *configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// "migrate up|down [n]|status" manages the user schema and exits.
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		if err := gateway.Migrate(context.Background(), shared.DSN(), flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Forwarding headers are believed only from these proxies (e.g. the load
+	// balancer in front of the gateway); by default none are. Load has
+	// already validated them.
+	trusted, _ := httpx.ParseTrustedProxies(shared.Server.TrustedProxies)
 	cfg := &Config{
-		Port:             parsePort(getEnv("PORT", "3000")),
-		InventoryService: getEnv("INVENTORY_SERVICE_URL", "http://localhost:8080"),
-		ShipmentService:  getEnv("SHIPMENT_SERVICE_URL", "http://localhost:8081"),
-		JWTSecret:        getEnv("JWT_SECRET", "your-secret-key-here"),
-		TokenTTL:         parseDuration(getEnv("TOKEN_TTL", "1h"), time.Hour),
-		CORSOrigin:       getEnv("CORS_ALLOW_ORIGIN", "http://localhost:5173"),
-		ReadTimeout:      5 * time.Second,
-		WriteTimeout:     10 * time.Second,
-		IdleTimeout:      120 * time.Second,
+		Port:       shared.Server.Port,
+		RoutesFile: shared.Gateway.RoutesFile,
+		JWTSecret:  shared.Auth.JWTSecret,
+		TokenTTL:   shared.Auth.TokenExpiry,
+		CORSOrigin: shared.Gateway.CORSOrigin,
+		ClientIP: httpx.ClientIPConfig{
+			TrustedProxies: trusted,
+			Header:         shared.Server.ClientIPHeader,
+		},
+		ReadTimeout:  shared.Server.Timeout.Read,
+		WriteTimeout: shared.Server.Timeout.Write,
+		IdleTimeout:  shared.Server.Timeout.Idle,
 	}
 
-	// Structured JSON logging to stdout for the whole process.
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	// Structured logging for the whole process; the level can be changed at
+	// runtime through /admin/log-level.
+	logs, err := logging.New(shared.LoggingConfig())
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logs.Close()
+	logger := logs.Logger
+	for _, w := range shared.Warnings {
+		logger.Warn("insecure configuration", "problem", w)
+	}
 
 	authManager := auth.NewManager(cfg.JWTSecret, cfg.TokenTTL)
 
+	// Tracing: the gateway continues or starts each request's trace and
+	// passes it to the upstreams in traceparent.
+	tracer, err := tracing.Open(getEnv("OTEL_SERVICE_NAME", shared.Service.Name), shared.Tracing.Exporter,
+		shared.Tracing.OTLPEndpoint, shared.Tracing.SampleRatio, os.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Database-backed user authentication. The gateway and shipment service
 	// share JWT_SECRET so gateway-issued tokens validate downstream.
-	gatewayAuth, err := gateway.NewAuth(databaseDSN(), authManager)
+	environment := shared.App.Environment
+	settings := shared.Gateway
+	oidc, err := oidcConfig(settings, cfg)
+	if err != nil {
+		log.Fatalf("Invalid single sign-on settings: %v", err)
+	}
+	resetURL := settings.PasswordReset.URL
+	if resetURL == "" {
+		resetURL = cfg.CORSOrigin + "/reset-password"
+	}
+	gatewayAuth, err := gateway.NewAuth(shared.DSN(), authManager, gateway.Config{
+		Environment:    environment,
+		MigrateOnStart: shared.Database.MigrateOnStart,
+		SeedDemoUsers:  settings.SeedsDemoUsers(environment),
+		Bootstrap: gateway.BootstrapConfig{
+			Username: settings.Bootstrap.Username,
+			Email:    settings.Bootstrap.Email,
+			Password: settings.Bootstrap.Password,
+		},
+		LockoutThreshold: settings.Lockout.Threshold,
+		LockoutDuration:  settings.Lockout.Duration,
+		Mailer:           newMailer(logger, settings.Mail),
+		ResetURL:         resetURL,
+		ResetTokenTTL:    settings.PasswordReset.TTL,
+		MFARequiredRoles: settings.MFA.RequiredRoles,
+		MFAIssuer:        settings.MFA.Issuer,
+		OIDC:             oidc,
+		Logger:           logger,
+		Tracer:           tracer,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialise auth: %v", err)
 	}
 
-	collector := metrics.NewCollector()
+	collector := metrics.NewCollectorWith(metrics.CollectorConfig{Buckets: shared.Metrics.Buckets})
+	if err := gatewayAuth.RegisterMetrics(collector.Registry()); err != nil {
+		log.Fatalf("Failed to register metrics: %v", err)
+	}
 
 	router := mux.NewRouter()
 	// Shared, structured middleware applied to every request. CORS stays last
 	// (closest to the handler) so it can still short-circuit OPTIONS requests.
 	router.Use(httpx.RequestID)
+	router.Use(httpx.ResolveClientIP(cfg.ClientIP))
+	router.Use(tracing.Middleware(tracer))
 	router.Use(httpx.Logger(logger))
 	router.Use(httpx.Recoverer(logger))
 	router.Use(httpx.SecurityHeaders)
@@ -97,12 +195,62 @@ func main() {
 
 	router.Handle("/metrics", collector.Handler()).Methods(http.MethodGet, http.MethodOptions)
 
+	// Rate-limit buckets live in this process, or in NATS so that every
+	// gateway replica enforces the same limits.
+	limits, closeLimits, err := rateLimitStore(settings.RateLimit, shared.NATS.URL)
+	if err != nil {
+		log.Fatalf("Failed to open rate limit store: %v", err)
+	}
+	defer closeLimits()
+
 	// User authentication and management. Login/register are rate-limited per
 	// client IP to blunt credential-stuffing/abuse.
-	loginLimiter := httpx.RateLimit(5, 10)
+	loginLimiter := httpx.RateLimitWith(httpx.RateLimitConfig{
+		Name:   "login",
+		Limit:  ratelimit.Limit{Rate: 5, Burst: 10},
+		Store:  limits,
+		Logger: logger,
+	})
 	gatewayAuth.RegisterRoutes(router, loginLimiter)
 
-	setupProxyRoutes(router, cfg)
+	// Everything else is proxied according to the declarative routes file.
+	routes, err := proxy.NewTable(cfg.RoutesFile, proxy.Options{
+		Auth:     authManager,
+		Reserved: reservedPaths,
+		Limits:   limits,
+		Tracer:   tracer,
+		Logger:   logger,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load routes: %v", err)
+	}
+
+	// Liveness and readiness. /readyz is public and reports only statuses;
+	// operators get check errors and every upstream's instances from
+	// /admin/readiness.
+	checks := health.NewChecker(0)
+	checks.Add("database", gatewayAuth.Ping)
+	router.Handle("/livez", health.LiveHandler()).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/readyz", readinessHandler(checks, routes, false)).Methods(http.MethodGet, http.MethodOptions)
+
+	// The dashboard's backend-for-frontend view reaches the services through
+	// the same upstream pools as proxied traffic (names from the routes file).
+	dashboard := bff.NewDashboard(bff.DashboardConfig{
+		Inventory: routes.Transport("inventory"),
+		Shipments: routes.Transport("shipment"),
+		Tokens:    authManager,
+		Timeout:   settings.DashboardTimeout,
+		Logger:    logger,
+	})
+	router.Handle("/dashboard", authManager.Middleware(dashboard)).Methods(http.MethodGet, http.MethodOptions)
+
+	router.Handle("/admin/log-level", authManager.Middleware(auth.RequirePermission(auth.PermLoggingManage)(logging.LevelHandler(logs.Level)))).
+		Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodOptions)
+	router.Handle("/admin/readiness", authManager.Middleware(auth.RequirePermission(auth.PermSystemRead)(readinessHandler(checks, routes, true)))).
+		Methods(http.MethodGet, http.MethodOptions)
+
+	// Registered last so the gateway's own endpoints take precedence.
+	router.PathPrefix("/").Handler(routes)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
@@ -119,6 +267,17 @@ func main() {
 		}
 	}()
 
+	// SIGHUP reloads the routes file without dropping connections.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := routes.Reload(); err != nil {
+				logger.Error("routes_reload_failed", slog.String("error", err.Error()))
+			}
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -130,85 +289,131 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	routes.Close()
+	if err := tracer.Shutdown(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exited properly")
 }
 
-func setupProxyRoutes(router *mux.Router, cfg *Config) {
-	inventoryURL, err := url.Parse(cfg.InventoryService)
-	if err != nil {
-		log.Fatalf("Invalid inventory service URL: %v", err)
-	}
-	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions}
-
-	// The inventory service owns inventory, products and locations.
-	inventoryProxy := createReverseProxy(inventoryURL, "")
-	router.PathPrefix("/inventory").Handler(inventoryProxy).Methods(methods...)
-	router.PathPrefix("/products").Handler(inventoryProxy).Methods(methods...)
-	router.PathPrefix("/locations").Handler(inventoryProxy).Methods(methods...)
-
-	shipmentURL, err := url.Parse(cfg.ShipmentService)
-	if err != nil {
-		log.Fatalf("Invalid shipment service URL: %v", err)
-	}
-	// The shipment service serves under /api/v1, so /shipments/* is rewritten
-	// to /api/v1/shipments/* before being forwarded.
-	router.PathPrefix("/shipments").Handler(createReverseProxy(shipmentURL, "/api/v1")).Methods(methods...)
+// readinessReport is the gateway's /readyz body: its own checks plus the
+// state of every upstream.
+type readinessReport struct {
+	health.Report
+	Upstreams []proxy.UpstreamStatus `json:"upstreams"`
 }
 
-// createReverseProxy builds a reverse proxy to target. If pathPrefix is set, it
-// is prepended to the request path before forwarding (used to map the gateway's
-// public paths onto a service's internal route prefix).
-func createReverseProxy(target *url.URL, pathPrefix string) *httputil.ReverseProxy {
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		if pathPrefix != "" {
-			req.URL.Path = pathPrefix + req.URL.Path
-		}
-		originalDirector(req)
-		req.Header.Set("X-Proxy-Gateway", "api-gateway")
+// redact strips what only operators should see from the public report: check
+// errors, which name internal hosts and ports, and upstream instance URLs.
+func (rep *readinessReport) redact() {
+	for name, res := range rep.Checks {
+		res.Error = ""
+		rep.Checks[name] = res
 	}
-
-	// The gateway is the single source of CORS headers; strip any set by the
-	// backend so responses don't carry duplicate Access-Control-* headers
-	// (which browsers reject).
-	proxy.ModifyResponse = func(resp *http.Response) error {
-		resp.Header.Del("Access-Control-Allow-Origin")
-		resp.Header.Del("Access-Control-Allow-Methods")
-		resp.Header.Del("Access-Control-Allow-Headers")
-		resp.Header.Del("Access-Control-Allow-Credentials")
-		return nil
+	for i := range rep.Upstreams {
+		rep.Upstreams[i].Instances = nil
 	}
+}
 
-	return proxy
+// readinessHandler reports the gateway ready when its own dependencies are up.
+// Upstream outages mark the report "degraded" but keep the gateway in
+// service, since it still answers (with structured 503s) for the routes it
+// cannot serve and the other routes keep working. Unless detailed, only
+// status values are reported.
+func readinessHandler(checks *health.Checker, routes *proxy.Table, detailed bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := readinessReport{Report: checks.Run(r.Context()), Upstreams: routes.Status()}
+		if !detailed {
+			report.redact()
+		}
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		} else {
+			for _, up := range report.Upstreams {
+				if up.Status != proxy.StatusOK {
+					report.Status = proxy.StatusDegraded
+				}
+			}
+		}
+		health.WriteJSON(w, status, report)
+	})
 }
 
-// databaseDSN builds the Postgres DSN from environment variables, defaulting to
-// the local docker-compose database (Postgres exposed on host port 5433).
-func databaseDSN() string {
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		getEnv("DB_HOST", "localhost"),
-		getEnv("DB_PORT", "5433"),
-		getEnv("DB_USER", "supplychain"),
-		getEnv("DB_PASSWORD", "supplychain123"),
-		getEnv("DB_NAME", "supplychain"),
-	)
+// rateLimitStore opens the store selected by gateway.rate_limit: memory (the
+// default) or nats, a JetStream key-value bucket shared by all replicas.
+func rateLimitStore(rl config.RateLimit, natsURL string) (ratelimit.Store, func(), error) {
+	if rl.Store != config.RateLimitNATS {
+		return ratelimit.NewMemory(rl.MaxKeys), func() {}, nil
+	}
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to NATS: %w", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("get JetStream context: %w", err)
+	}
+	ttl := rl.TTL
+	if ttl == 0 {
+		ttl = ratelimit.DefaultKVTTL
+	}
+	store, err := ratelimit.NewKV(js, rl.Bucket, ttl)
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+	return store, nc.Close, nil
 }
 
-func parseDuration(value string, fallback time.Duration) time.Duration {
-	if d, err := time.ParseDuration(value); err == nil {
-		return d
+// newMailer returns an SMTP mailer when gateway.mail.smtp.host is set, and
+// otherwise one that logs messages (and appends them to mail.log_file, if
+// set); Load has already refused the latter outside development unless
+// mail.log_only is set.
+func newMailer(logger *slog.Logger, mail config.Mail) gateway.Mailer {
+	if mail.SMTP.Host == "" {
+		return &gateway.LogMailer{Logger: logger, Path: mail.LogFile}
+	}
+	return &gateway.SMTPMailer{
+		Host:     mail.SMTP.Host,
+		Port:     mail.SMTP.Port,
+		Username: mail.SMTP.Username,
+		Password: mail.SMTP.Password,
+		From:     mail.From,
 	}
-	return fallback
 }
 
-func parsePort(value string) int {
-	if p, err := strconv.Atoi(value); err == nil && p > 0 {
-		return p
+// oidcConfig returns the single sign-on settings when gateway.oidc.issuer is
+// set, or nil to leave SSO disabled.
+func oidcConfig(settings config.Gateway, cfg *Config) (*gateway.OIDCConfig, error) {
+	o := settings.OIDC
+	if o.Issuer == "" {
+		return nil, nil
+	}
+	groupRoles, err := gateway.ParseGroupRoles(o.GroupRoles)
+	if err != nil {
+		return nil, fmt.Errorf("gateway.oidc.group_roles: %w", err)
+	}
+	redirectURL := o.RedirectURL
+	if redirectURL == "" {
+		redirectURL = fmt.Sprintf("http://localhost:%d/auth/oidc/callback", cfg.Port)
+	}
+	postLoginURL := o.PostLoginURL
+	if postLoginURL == "" {
+		postLoginURL = cfg.CORSOrigin + "/auth/callback"
 	}
-	return 3000
+	return &gateway.OIDCConfig{
+		Issuer:       o.Issuer,
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RedirectURL:  redirectURL,
+		PostLoginURL: postLoginURL,
+		GroupsClaim:  o.GroupsClaim,
+		GroupRoles:   groupRoles,
+		DefaultRole:  o.DefaultRole,
+	}, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -2,39 +2,84 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
-	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/config"
 	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/server"
 	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/service"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/migrate"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
 )
 
 func main() {
-	// Structured JSON logging to stdout for the whole process.
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	configPath := flag.String("config", "", "path to the YAML configuration (default: $FSC_CONFIG or configs/config.yaml)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [%s]\n", os.Args[0], migrate.Usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	// Load configuration
-	cfg, err := config.Load()
+	// Load configuration: this service's section of the shared file, with
+	// environment overrides.
+	cfg, err := config.Load("inventory", *configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// "migrate up|down [n]|status" manages the schema and exits.
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		if err := service.Migrate(context.Background(), cfg, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Structured logging per the logging section; the level can be changed
+	// at runtime through /admin/log-level.
+	logs, err := logging.New(cfg.LoggingConfig())
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logs.Close()
+	for _, w := range cfg.Warnings {
+		logs.Warn("insecure configuration", "problem", w)
+	}
+
+	// Spans go to the configured exporter; trace context propagates even
+	// when it is "none".
+	tracer, err := tracing.Open(getEnv("OTEL_SERVICE_NAME", cfg.Service.Name), cfg.Tracing.Exporter,
+		cfg.Tracing.OTLPEndpoint, cfg.Tracing.SampleRatio, os.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Create service instance
-	svc, err := service.NewInventoryService(cfg)
+	svc, err := service.NewInventoryService(cfg, tracer)
 	if err != nil {
 		log.Fatalf("Failed to create inventory service: %v", err)
 	}
 	defer svc.Close()
 
 	// Create and configure HTTP server
-	srv := server.NewServer(cfg, svc, logger)
+	srv := server.NewServer(cfg, svc, logs.Logger, tracer)
+	svc.RegisterHealthChecks(srv.Health())
+	if err := svc.RegisterMetrics(srv.Metrics()); err != nil {
+		log.Fatalf("Failed to register metrics: %v", err)
+	}
+	srv.HandleLogLevel(logs.Level)
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler:      srv.Router(),
@@ -65,6 +110,16 @@ func main() {
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if err := tracer.Shutdown(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exited properly")
 }
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -9,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
@@ -19,6 +20,7 @@ func main() {
 	subject := flag.String("sub", "test-user", "token subject (user id)")
 	role := flag.String("role", auth.RoleAdmin, "role: admin | manager | operator | viewer")
 	tenant := flag.String("tenant", "tenant-1", "tenant id")
+	perms := flag.String("perms", "", "comma-separated permissions to embed (defaults to the role's built-in set)")
 	ttl := flag.Duration("ttl", time.Hour, "token lifetime")
 	flag.Parse()
 
@@ -27,7 +29,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	token, err := auth.NewManager(*secret, *ttl).GenerateToken(*subject, *role, *tenant)
+	claims := auth.Claims{Subject: *subject, Role: *role, TenantID: *tenant}
+	if *perms != "" {
+		claims.Permissions = strings.Split(*perms, ",")
+	}
+	token, err := auth.NewManager(*secret, *ttl).IssueToken(claims)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		os.Exit(1)
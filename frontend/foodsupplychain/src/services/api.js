@@ -78,4 +78,10 @@ export const shipmentApi = {
   remove: (id) => api.delete(`/shipments/${id}`).then((r) => r.data)
 }
 
+// Aggregated dashboard view served by the gateway. Sources that fail come back
+// as null with a message in `errors` (and `partial: true`).
+export const dashboardApi = {
+  get: () => api.get('/dashboard').then((r) => r.data)
+}
+
 export default api
@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// apiKeySubjectPrefix distinguishes API-key principals from users in claims.
+const apiKeySubjectPrefix = "apikey:"
+
+// lastUsedResolution bounds how often last_used_at is written, so a busy
+// scanner does not turn every authenticated request into a database write.
+const lastUsedResolution = time.Minute
+
+// ValidateAPIKey implements auth.APIKeyValidator. It looks the key up by hash,
+// rejects unknown, revoked or expired keys with auth.ErrInvalidAPIKey and
+// records when the key was last used. Database failures are returned as they
+// are, so callers answer them with a server error rather than a 401.
+func (a *Auth) ValidateAPIKey(ctx context.Context, key string) (*auth.Claims, error) {
+	var k models.APIKey
+	if err := a.db.WithContext(ctx).Preload("Locations").First(&k, "key_hash = ?", auth.HashAPIKey(key)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("auth: failed to look up api key: %w", err)
+	}
+	now := time.Now()
+	if k.RevokedAt != nil || (k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedResolution {
+		a.db.WithContext(ctx).Model(&k).UpdateColumn("last_used_at", now)
+	}
+	claims := &auth.Claims{
+		Subject:     apiKeySubjectPrefix + k.ID,
+		Role:        k.Role,
+		TenantID:    k.TenantID,
+		Permissions: a.permissionsFor(ctx, k.TenantID, k.Role),
+		Locations:   k.LocationIDs(),
+		IssuedAt:    k.CreatedAt.Unix(),
+	}
+	if k.ExpiresAt != nil {
+		claims.ExpiresAt = k.ExpiresAt.Unix()
+	}
+	return claims, nil
+}
+
+// handleCreateAPIKey issues a new API key (admin only). The plaintext key is
+// returned in this response only; it cannot be recovered later. A key for a
+// location-scoped role, such as a warehouse scanner's operator key, names its
+// locations in location_ids.
+func (a *Auth) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name        string   `json:"name"`
+		Role        string   `json:"role"`
+		TenantID    string   `json:"tenant_id"`
+		ExpiresIn   string   `json:"expires_in"`
+		LocationIDs []string `json:"location_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		body.TenantID = claims.TenantID
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		writeJSON(w, http.StatusBadRequest, errBody("name is required"))
+		return
+	}
+	if status, msg := a.checkAssignable(r, body.TenantID, body.Role); status != 0 {
+		writeJSON(w, status, errBody(msg))
+		return
+	}
+	locations, status, msg := a.assignableLocations(r, body.LocationIDs)
+	if status != 0 {
+		writeJSON(w, status, errBody(msg))
+		return
+	}
+
+	now := time.Now()
+	var expiresAt *time.Time
+	if body.ExpiresIn != "" {
+		d, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil || d <= 0 {
+			writeJSON(w, http.StatusBadRequest, errBody("expires_in must be a positive duration such as 720h"))
+			return
+		}
+		t := now.Add(d)
+		expiresAt = &t
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	var createdBy string
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		createdBy = claims.Subject
+	}
+	id := uuid.New().String()
+	record := &models.APIKey{
+		ID:        id,
+		Name:      body.Name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(key),
+		Role:      body.Role,
+		TenantID:  body.TenantID,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, loc := range locations {
+		record.Locations = append(record.Locations, models.APIKeyLocation{APIKeyID: id, LocationID: loc})
+	}
+	if err := a.db.WithContext(r.Context()).Create(record).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"key": key, "api_key": record})
+}
+
+// tenantAPIKeys returns a query over the API keys visible to the caller: those
+// of their own tenant, or every key for a global caller.
+func (a *Auth) tenantAPIKeys(r *http.Request) *gorm.DB {
+	query := a.db.WithContext(r.Context()).Model(&models.APIKey{})
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		query = query.Where("tenant_id = ?", claims.TenantID)
+	}
+	return query
+}
+
+// handleListAPIKeys returns the caller's tenant's API keys, newest first
+// (admin only). Hashes are never serialised.
+func (a *Auth) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	var keys []models.APIKey
+	if err := a.tenantAPIKeys(r).Preload("Locations").Order("created_at desc").Find(&keys).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// handleRevokeAPIKey marks a key as revoked (admin only). The record is kept so
+// the key's history remains visible in the list.
+func (a *Auth) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	var k models.APIKey
+	if err := a.tenantAPIKeys(r).First(&k, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, errBody("api key not found"))
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	if k.RevokedAt == nil {
+		now := time.Now()
+		k.RevokedAt = &now
+		k.UpdatedAt = now
+		if err := a.db.WithContext(r.Context()).Save(&k).Error; err != nil {
+			writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+func TestValidateAPIKey(t *testing.T) {
+	a, _ := newTestAuth(t, Config{})
+	ctx := context.Background()
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := a.db.Create(&models.APIKey{
+		ID: "k1", Name: "scanner", Prefix: prefix, KeyHash: auth.HashAPIKey(key),
+		Role: auth.RoleViewer, CreatedAt: now, UpdatedAt: now,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := a.ValidateAPIKey(ctx, key)
+	if err != nil || claims.Subject != apiKeySubjectPrefix+"k1" || !claims.HasPermission(auth.PermInventoryRead) {
+		t.Fatalf("ValidateAPIKey = %+v, %v", claims, err)
+	}
+	if _, err := a.ValidateAPIKey(ctx, "fsc_unknown"); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("unknown key = %v, want ErrInvalidAPIKey", err)
+	}
+
+	// A database failure is not mistaken for a bad key.
+	sqlDB, _ := a.db.DB()
+	sqlDB.Close()
+	if _, err := a.ValidateAPIKey(ctx, key); err == nil || errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("ValidateAPIKey with the database down = %v, want a lookup error", err)
+	}
+}
+
+func TestAPIKeyAdministrationIsTenantScoped(t *testing.T) {
+	a, router := newTestAuth(t, Config{})
+	mustCreateRole(t, a, "acme", "keys", auth.PermAPIKeysManage, auth.PermInventoryRead)
+	admin := mustCreateUser(t, a, "acme-admin", "keys", "acme")
+	token := tokenFor(t, a, admin)
+	now := time.Now()
+	if err := a.db.Create(&models.APIKey{
+		ID: "globex-key", Name: "globex", Prefix: "fsc_globex", KeyHash: "h1",
+		Role: auth.RoleViewer, TenantID: "globex", CreatedAt: now, UpdatedAt: now,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// A tenant admin's keys are pinned to their tenant, whatever they ask for.
+	for _, tenant := range []string{"", "globex"} {
+		rec := serve(router, http.MethodPost, "/api-keys", token, `{"name":"scanner","role":"keys","tenant_id":"`+tenant+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create with tenant_id %q = %d: %s", tenant, rec.Code, rec.Body)
+		}
+		var body struct {
+			APIKey models.APIKey `json:"api_key"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.APIKey.TenantID != "acme" {
+			t.Errorf("tenant_id %q: key created in tenant %q, want acme", tenant, body.APIKey.TenantID)
+		}
+	}
+
+	rec := serve(router, http.MethodGet, "/api-keys", token, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "globex-key") {
+		t.Errorf("list = %d, shows another tenant's key: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(router, http.MethodDelete, "/api-keys/globex-key", token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke another tenant's key = %d, want 404", rec.Code)
+	}
+	var k models.APIKey
+	a.db.First(&k, "id = ?", "globex-key")
+	if k.RevokedAt != nil {
+		t.Error("another tenant's key was revoked")
+	}
+}
+
+func TestOperatorAPIKeyReachesAssignedLocations(t *testing.T) {
+	a, router := newTestAuth(t, Config{})
+	root := mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	now := time.Now()
+	for _, id := range []string{"wh-1", "wh-2"} {
+		if err := a.db.Create(&models.Location{ID: id, Name: id, Type: "warehouse", CreatedAt: now, UpdatedAt: now}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := tokenFor(t, a, root)
+
+	if rec := serve(router, http.MethodPost, "/api-keys", token, `{"name":"scanner","role":"operator","location_ids":["wh-9"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("key for an unknown location = %d, want 400", rec.Code)
+	}
+	rec := serve(router, http.MethodPost, "/api-keys", token, `{"name":"scanner","role":"operator","location_ids":["wh-1"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	// The gateway authenticates the key and forwards it as a token carrying
+	// its locations, which the services scope writes by.
+	var forwarded *auth.Claims
+	h := a.tokens.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.tokens.ForwardCredential(r.Context(), r.Header); err != nil {
+			t.Fatal(err)
+		}
+		forwarded, _ = a.tokens.ValidateToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/inventory", nil)
+	req.Header.Set(auth.APIKeyHeader, body.Key)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if forwarded == nil {
+		t.Fatal("key was not forwarded as a token")
+	}
+	ctx := auth.ContextWithClaims(context.Background(), forwarded)
+	if !forwarded.HasPermission(auth.PermInventoryAdjust) || !auth.InLocationScope(ctx, "wh-1") {
+		t.Errorf("operator key cannot adjust stock at its location: %+v", forwarded)
+	}
+	if auth.InLocationScope(ctx, "wh-2") {
+		t.Error("operator key reaches a location it was not assigned")
+	}
+}
@@ -3,6 +3,7 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,7 +18,9 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
 )
 
 var (
@@ -25,35 +28,88 @@ var (
 	ErrInvalidCredentials = errors.New("invalid username or password")
 	// ErrUserExists is returned when a username or email is already taken.
 	ErrUserExists = errors.New("username or email already taken")
+	// ErrAccountDisabled is returned when a disabled account tries to sign in.
+	ErrAccountDisabled = errors.New("account disabled")
+)
+
+// Credential length rules shared by registration, invitation and resets.
+const (
+	minUsernameLength = 3
+	minPasswordLength = 6
 )
 
 // Auth provides user registration/authentication and issues JWTs.
 type Auth struct {
 	db     *gorm.DB
 	tokens *auth.Manager
+	cfg    Config
+	oidc   *oidcClient
 }
 
-// NewAuth connects to the database, migrates the users table and seeds a demo
-// account per role on first run so the app is usable out of the box.
-func NewAuth(dsn string, tokens *auth.Manager) (*Auth, error) {
+// NewAuth connects to the database, migrates the users, roles and API key
+// tables (or, without cfg.MigrateOnStart, checks they are migrated), seeds
+// the built-in roles and sets up the initial accounts (demo users in
+// development, otherwise a bootstrap admin). It also registers itself as the
+// token manager's API key validator.
+func NewAuth(dsn string, tokens *auth.Manager, cfg Config) (*Auth, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("auth: failed to connect to database: %w", err)
 	}
-	if err := db.AutoMigrate(&models.User{}); err != nil {
+	if err := db.Use(tracing.GORM(cfg.Tracer)); err != nil {
+		return nil, fmt.Errorf("auth: failed to install query tracing: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("auth: failed to get database instance: %w", err)
+	}
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	if err := migrator.Ensure(context.Background(), cfg.MigrateOnStart); err != nil {
 		return nil, fmt.Errorf("auth: failed to migrate users: %w", err)
 	}
-	a := &Auth{db: db, tokens: tokens}
-	if err := a.seedDemoUsers(); err != nil {
+	a := &Auth{db: db, tokens: tokens, cfg: cfg.withDefaults()}
+	if a.cfg.OIDC != nil {
+		a.oidc = newOIDCClient(*a.cfg.OIDC)
+	}
+	tokens.SetAPIKeyValidator(a)
+	if err := a.seedBuiltinRoles(); err != nil {
+		return nil, err
+	}
+	if err := a.checkOIDCRoles(); err != nil {
+		return nil, err
+	}
+	if err := a.seedAccounts(); err != nil {
 		return nil, err
 	}
 	return a, nil
 }
 
+// Ping checks that the user database is reachable, for readiness probes.
+func (a *Auth) Ping(ctx context.Context) error {
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// RegisterMetrics adds the user database's connection pool metrics.
+func (a *Auth) RegisterMetrics(r *metrics.Registry) error {
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		return err
+	}
+	r.Register(metrics.DBStats(sqlDB))
+	return nil
+}
+
 // RegisterRoutes wires the authentication endpoints onto the router. The
 // loginLimit middleware (e.g. a per-IP rate limiter) is applied to the
-// credential-accepting endpoints (/auth/register and /auth/login) only; pass nil
-// to disable it.
+// credential-accepting endpoints (/auth/register, /auth/login, the password
+// reset flow and password changes) only; pass nil to disable it.
 func (a *Auth) RegisterRoutes(router *mux.Router, loginLimit func(http.Handler) http.Handler) {
 	if loginLimit == nil {
 		loginLimit = func(h http.Handler) http.Handler { return h }
@@ -62,44 +118,72 @@ func (a *Auth) RegisterRoutes(router *mux.Router, loginLimit func(http.Handler)
 		Methods(http.MethodPost, http.MethodOptions)
 	router.Handle("/auth/login", loginLimit(http.HandlerFunc(a.handleLogin))).
 		Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/auth/forgot", loginLimit(http.HandlerFunc(a.handleForgotPassword))).
+		Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/auth/reset", loginLimit(http.HandlerFunc(a.handleResetPassword))).
+		Methods(http.MethodPost, http.MethodOptions)
 	router.Handle("/auth/me", a.tokens.Middleware(http.HandlerFunc(a.handleMe))).
 		Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/auth/me/password", loginLimit(a.tokens.Middleware(http.HandlerFunc(a.handleChangeOwnPassword)))).
+		Methods(http.MethodPut, http.MethodOptions)
+	// Two-factor authentication. The second login step and enrollment accept
+	// the short-lived purpose tokens returned by /auth/login.
+	enroll := a.tokens.MiddlewareAllowing(purposeMFAEnroll)
+	router.Handle("/auth/login/2fa", loginLimit(http.HandlerFunc(a.handleLoginSecondFactor))).
+		Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/auth/2fa/setup", enroll(http.HandlerFunc(a.handleSetupTOTP))).
+		Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/auth/2fa/enable", loginLimit(enroll(http.HandlerFunc(a.handleEnableTOTP)))).
+		Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/auth/2fa/disable", loginLimit(a.tokens.Middleware(http.HandlerFunc(a.handleDisableTOTP)))).
+		Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/auth/2fa/recovery-codes", loginLimit(a.tokens.Middleware(http.HandlerFunc(a.handleRegenerateRecoveryCodes)))).
+		Methods(http.MethodPost, http.MethodOptions)
+	// Single sign-on through the configured OpenID Connect provider.
+	if a.oidc != nil {
+		router.HandleFunc("/auth/oidc/login", a.handleOIDCLogin).Methods(http.MethodGet, http.MethodOptions)
+		router.Handle("/auth/oidc/callback", loginLimit(http.HandlerFunc(a.handleOIDCCallback))).
+			Methods(http.MethodGet, http.MethodOptions)
+		router.Handle("/auth/oidc/link", loginLimit(a.tokens.Middleware(http.HandlerFunc(a.handleOIDCLink)))).
+			Methods(http.MethodPost, http.MethodOptions)
+	}
 	// Refresh requires a currently-valid token and re-issues a fresh one.
 	router.Handle("/auth/refresh", a.tokens.Middleware(http.HandlerFunc(a.handleRefresh))).
 		Methods(http.MethodPost, http.MethodOptions)
 
-	// Admin-only user management. Middleware authenticates, RequireRole gates.
-	admin := func(h http.HandlerFunc) http.Handler {
-		return a.tokens.Middleware(auth.RequireRole(auth.RoleAdmin)(http.HandlerFunc(h)))
+	// Administration. Middleware authenticates, RequirePermission gates; the
+	// built-in admin role holds every permission.
+	admin := func(perm string, h http.HandlerFunc) http.Handler {
+		return a.tokens.Middleware(auth.RequirePermission(perm)(http.HandlerFunc(h)))
 	}
-	router.Handle("/users", admin(a.handleListUsers)).Methods(http.MethodGet, http.MethodOptions)
-	router.Handle("/users/{id}", admin(a.handleUpdateUserRole)).Methods(http.MethodPatch, http.MethodOptions)
-}
+	router.Handle("/users", admin(auth.PermUsersManage, a.handleListUsers)).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/users", admin(auth.PermUsersManage, a.handleInviteUser)).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/users/{id}", admin(auth.PermUsersManage, a.handleUpdateUserRole)).Methods(http.MethodPatch, http.MethodOptions)
+	router.Handle("/users/{id}", admin(auth.PermUsersManage, a.handleDeleteUser)).Methods(http.MethodDelete, http.MethodOptions)
+	router.Handle("/users/{id}/disable", admin(auth.PermUsersManage, a.handleSetUserDisabled(true))).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/users/{id}/enable", admin(auth.PermUsersManage, a.handleSetUserDisabled(false))).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/users/{id}/password", admin(auth.PermUsersManage, a.handleResetUserPassword)).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/users/{id}/2fa/reset", admin(auth.PermUsersManage, a.handleResetUserTOTP)).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/users/{id}/unlock", admin(auth.PermUsersManage, a.handleUnlockUser)).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/auth/login-events", admin(auth.PermUsersManage, a.handleListLoginEvents)).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/users/{id}/locations", admin(auth.PermUsersManage, a.handleGetUserLocations)).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/users/{id}/locations", admin(auth.PermUsersManage, a.handleSetUserLocations)).Methods(http.MethodPut, http.MethodOptions)
 
-// seedDemoUsers creates one known account per role (e.g. admin/admin123) if it
-// does not already exist.
-func (a *Auth) seedDemoUsers() error {
-	demo := []struct{ username, role string }{
-		{"admin", auth.RoleAdmin},
-		{"manager", auth.RoleManager},
-		{"operator", auth.RoleOperator},
-		{"viewer", auth.RoleViewer},
-	}
-	for _, d := range demo {
-		var count int64
-		a.db.Model(&models.User{}).Where("username = ?", d.username).Count(&count)
-		if count > 0 {
-			continue
-		}
-		if _, err := a.createUser(d.username, d.username+"@example.com", d.username+"123", d.role); err != nil {
-			return fmt.Errorf("auth: seed %s: %w", d.username, err)
-		}
-	}
-	return nil
+	// Roles and the permissions they grant.
+	router.Handle("/permissions", admin(auth.PermRolesManage, a.handleListPermissions)).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/roles", admin(auth.PermRolesManage, a.handleListRoles)).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/roles", admin(auth.PermRolesManage, a.handleCreateRole)).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/roles/{id}", admin(auth.PermRolesManage, a.handleUpdateRole)).Methods(http.MethodPut, http.MethodOptions)
+	router.Handle("/roles/{id}", admin(auth.PermRolesManage, a.handleDeleteRole)).Methods(http.MethodDelete, http.MethodOptions)
+
+	// Admin-managed API keys for machine-to-machine clients.
+	router.Handle("/api-keys", admin(auth.PermAPIKeysManage, a.handleListAPIKeys)).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/api-keys", admin(auth.PermAPIKeysManage, a.handleCreateAPIKey)).Methods(http.MethodPost, http.MethodOptions)
+	router.Handle("/api-keys/{id}", admin(auth.PermAPIKeysManage, a.handleRevokeAPIKey)).Methods(http.MethodDelete, http.MethodOptions)
 }
 
-func (a *Auth) createUser(username, email, password, role string) (*models.User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (a *Auth) createUser(username, email, password, role, tenantID string) (*models.User, error) {
+	hash, err := hashPassword(password)
 	if err != nil {
 		return nil, err
 	}
@@ -108,8 +192,9 @@ func (a *Auth) createUser(username, email, password, role string) (*models.User,
 		ID:           uuid.New().String(),
 		Username:     username,
 		Email:        email,
-		PasswordHash: string(hash),
+		PasswordHash: hash,
 		Role:         role,
+		TenantID:     tenantID,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
@@ -119,17 +204,6 @@ func (a *Auth) createUser(username, email, password, role string) (*models.User,
 	return user, nil
 }
 
-func (a *Auth) authenticate(username, password string) (*models.User, error) {
-	var user models.User
-	if err := a.db.First(&user, "username = ?", username).Error; err != nil {
-		return nil, ErrInvalidCredentials
-	}
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, ErrInvalidCredentials
-	}
-	return &user, nil
-}
-
 // Handlers
 
 func (a *Auth) handleRegister(w http.ResponseWriter, r *http.Request) {
@@ -143,21 +217,21 @@ func (a *Auth) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	body.Username = strings.TrimSpace(body.Username)
-	if len(body.Username) < 3 {
+	if len(body.Username) < minUsernameLength {
 		writeJSON(w, http.StatusBadRequest, errBody("username must be at least 3 characters"))
 		return
 	}
-	if len(body.Password) < 6 {
+	if len(body.Password) < minPasswordLength {
 		writeJSON(w, http.StatusBadRequest, errBody("password must be at least 6 characters"))
 		return
 	}
 	// Self-registered users get the least-privileged role.
-	user, err := a.createUser(body.Username, body.Email, body.Password, auth.RoleViewer)
+	user, err := a.createUser(body.Username, body.Email, body.Password, auth.RoleViewer, "")
 	if err != nil {
 		writeJSON(w, http.StatusConflict, errBody(err.Error()))
 		return
 	}
-	a.issueToken(w, user)
+	a.completeLogin(w, r, attemptFrom(r, user.Username), user)
 }
 
 func (a *Auth) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -169,12 +243,17 @@ func (a *Auth) handleLogin(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
 		return
 	}
-	user, err := a.authenticate(strings.TrimSpace(body.Username), body.Password)
+	attempt := attemptFrom(r, strings.TrimSpace(body.Username))
+	user, err := a.authenticate(r.Context(), attempt, body.Password)
 	if err != nil {
+		if errors.Is(err, ErrAccountDisabled) {
+			writeJSON(w, http.StatusForbidden, errBody("account disabled"))
+			return
+		}
 		writeJSON(w, http.StatusUnauthorized, errBody("invalid username or password"))
 		return
 	}
-	a.issueToken(w, user)
+	a.completeLogin(w, r, attempt, user)
 }
 
 func (a *Auth) handleMe(w http.ResponseWriter, r *http.Request) {
@@ -184,7 +263,7 @@ func (a *Auth) handleMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var user models.User
-	if err := a.db.First(&user, "username = ?", claims.Subject).Error; err != nil {
+	if err := a.db.WithContext(r.Context()).First(&user, "username = ?", claims.Subject).Error; err != nil {
 		writeJSON(w, http.StatusOK, map[string]string{"username": claims.Subject, "role": claims.Role})
 		return
 	}
@@ -193,7 +272,7 @@ func (a *Auth) handleMe(w http.ResponseWriter, r *http.Request) {
 
 // handleRefresh re-issues a token for the authenticated caller. The middleware
 // has already validated the inbound token; here we look the user up afresh so
-// the new token reflects the current role.
+// the new token reflects the current role and its permissions.
 func (a *Auth) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	claims, ok := auth.ClaimsFromContext(r.Context())
 	if !ok {
@@ -201,17 +280,34 @@ func (a *Auth) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var user models.User
-	if err := a.db.First(&user, "username = ?", claims.Subject).Error; err != nil {
+	if err := a.db.WithContext(r.Context()).First(&user, "username = ?", claims.Subject).Error; err != nil {
 		writeJSON(w, http.StatusUnauthorized, errBody("user no longer exists"))
 		return
 	}
-	a.issueToken(w, &user)
+	if user.Disabled {
+		writeJSON(w, http.StatusForbidden, errBody("account disabled"))
+		return
+	}
+	if a.mfaRequired(user.Role) && !user.TOTPEnabled && !a.hasExternalIdentity(r.Context(), user.ID) {
+		writeJSON(w, http.StatusForbidden, errBody("two-factor enrollment required; sign in again"))
+		return
+	}
+	a.issueToken(w, r, &user)
+}
+
+// hashPassword returns the bcrypt hash of password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
 }
 
-// issueToken signs a JWT for the user (subject = username) and returns it with
-// the user record.
-func (a *Auth) issueToken(w http.ResponseWriter, user *models.User) {
-	token, err := a.tokens.GenerateToken(user.Username, user.Role, "")
+// issueToken signs a JWT for the user (subject = username, with the
+// permissions of their role embedded) and returns it with the user record.
+func (a *Auth) issueToken(w http.ResponseWriter, r *http.Request, user *models.User) {
+	token, err := a.tokens.IssueToken(a.claimsFor(r.Context(), user))
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
 		return
@@ -0,0 +1,188 @@
+// Package bff holds the gateway's backend-for-frontend endpoints, which
+// aggregate several service calls into one response shaped for a UI view.
+package bff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// Service paths the dashboard reads.
+const (
+	inventorySummaryPath = "/inventory/summary"
+	shipmentSummaryPath  = "/api/v1/shipments/summary"
+)
+
+// Source names, used as keys in the errors map.
+const (
+	sourceInventory = "inventory"
+	sourceShipments = "shipments"
+)
+
+// DefaultTimeout bounds each source when DashboardConfig.Timeout is unset.
+const DefaultTimeout = 3 * time.Second
+
+// DashboardConfig wires the dashboard to the services.
+type DashboardConfig struct {
+	// Inventory and Shipments reach the two services; requests carry only a
+	// path, so a transport that picks the instance (such as
+	// proxy.Table.Transport) is expected.
+	Inventory http.RoundTripper
+	Shipments http.RoundTripper
+	// Tokens exchanges an API-key caller's key for a short-lived bearer token
+	// the services can verify, as the proxy does (see
+	// auth.Manager.ForwardCredential). Without it API keys are not forwarded.
+	Tokens *auth.Manager
+	// Timeout bounds each source independently; a slow source is reported as
+	// an error without holding up the other.
+	Timeout time.Duration
+	Logger  *slog.Logger
+}
+
+// Dashboard serves GET /dashboard: the inventory and shipment summaries
+// fetched concurrently and merged into one payload.
+type Dashboard struct {
+	cfg DashboardConfig
+}
+
+// DashboardResponse is the /dashboard body. A source that failed is null and
+// has an entry in Errors, and Partial is set.
+type DashboardResponse struct {
+	Inventory *models.InventorySummary `json:"inventory"`
+	Shipments *models.ShipmentSummary  `json:"shipments"`
+	// OpenAlerts totals the open alerts of the sources that answered.
+	OpenAlerts  int               `json:"open_alerts"`
+	Partial     bool              `json:"partial"`
+	Errors      map[string]string `json:"errors,omitempty"`
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+// NewDashboard returns the dashboard handler.
+func NewDashboard(cfg DashboardConfig) *Dashboard {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Dashboard{cfg: cfg}
+}
+
+// ServeHTTP answers 200 when at least one source responded (with Partial set
+// if not both did) and 502 when none did.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := DashboardResponse{GeneratedAt: time.Now().UTC()}
+	var inventory models.InventorySummary
+	var shipments models.ShipmentSummary
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = map[string]string{}
+	)
+	fetch := func(name string, rt http.RoundTripper, path string, out interface{}, ok func()) {
+		defer wg.Done()
+		if err := d.fetch(r, rt, path, out); err != nil {
+			d.cfg.Logger.LogAttrs(r.Context(), slog.LevelWarn, "dashboard_source_failed",
+				slog.String("source", name), slog.String("error", err.Error()))
+			mu.Lock()
+			errs[name] = err.Error()
+			mu.Unlock()
+			return
+		}
+		ok()
+	}
+	wg.Add(2)
+	go fetch(sourceInventory, d.cfg.Inventory, inventorySummaryPath, &inventory, func() { resp.Inventory = &inventory })
+	go fetch(sourceShipments, d.cfg.Shipments, shipmentSummaryPath, &shipments, func() { resp.Shipments = &shipments })
+	wg.Wait()
+
+	if resp.Inventory != nil {
+		resp.OpenAlerts += resp.Inventory.OpenAlerts
+	}
+	if resp.Shipments != nil {
+		resp.OpenAlerts += resp.Shipments.OpenAlerts
+	}
+	status := http.StatusOK
+	if len(errs) > 0 {
+		resp.Partial, resp.Errors = true, errs
+		if resp.Inventory == nil && resp.Shipments == nil {
+			status = http.StatusBadGateway
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// fetch GETs path from a service on behalf of the caller and decodes the JSON
+// body into out. The caller's credential and verified identity go along so the
+// service applies the same authorisation and location scope as a direct call.
+func (d *Dashboard) fetch(r *http.Request, rt http.RoundTripper, path string, out interface{}) error {
+	if rt == nil {
+		return errors.New("not configured")
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), d.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://upstream"+path, nil)
+	if err != nil {
+		return err
+	}
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		req.Header.Set("Authorization", authz)
+	}
+	if key := r.Header.Get(auth.APIKeyHeader); key != "" {
+		req.Header.Set(auth.APIKeyHeader, key)
+	}
+	if d.cfg.Tokens != nil {
+		if err := d.cfg.Tokens.ForwardCredential(r.Context(), req.Header); err != nil {
+			return fmt.Errorf("failed to forward credentials: %w", err)
+		}
+	} else {
+		req.Header.Del(auth.APIKeyHeader)
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	auth.SetIdentity(req.Header, claims)
+	if id := httpx.RequestIDFrom(r.Context()); id != "" {
+		req.Header.Set(httpx.RequestIDHeader, id)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", d.cfg.Timeout)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&body)
+		if body.Error != "" {
+			return fmt.Errorf("status %d: %s", res.StatusCode, body.Error)
+		}
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", d.cfg.Timeout)
+		}
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package bff
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// to sends every request to srv, as the gateway's upstream pools do.
+type to struct{ srv *httptest.Server }
+
+func (t to) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(t.srv.URL)
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func serve(t *testing.T, h http.HandlerFunc) to {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return to{srv}
+}
+
+func jsonReply(payload interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(payload)
+	}
+}
+
+func getDashboard(t *testing.T, d http.Handler, r *http.Request) (int, DashboardResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, r)
+	var resp DashboardResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func quiet() *slog.Logger { return slog.New(slog.NewTextHandler(io.Discard, nil)) }
+
+func TestDashboardMergesSources(t *testing.T) {
+	var seenUser, seenAuth string
+	inventory := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != inventorySummaryPath {
+			http.NotFound(w, r)
+			return
+		}
+		seenUser, seenAuth = r.Header.Get(auth.HeaderUser), r.Header.Get("Authorization")
+		jsonReply(models.InventorySummary{Items: 10, StockOuts: 2, OpenAlerts: 3})(w, r)
+	})
+	shipments := serve(t, jsonReply(models.ShipmentSummary{Total: 4, ByStatus: map[string]int{"pending": 3, "delivered": 1}, Late: 1, OpenAlerts: 1}))
+	d := NewDashboard(DashboardConfig{Inventory: inventory, Shipments: shipments, Logger: quiet()})
+	tokens := auth.NewManager("test-secret", time.Hour)
+	token, err := tokens.GenerateToken("alice", auth.RoleViewer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	code, resp := getDashboard(t, tokens.Middleware(d), req)
+
+	if code != http.StatusOK || resp.Partial || len(resp.Errors) != 0 {
+		t.Fatalf("status = %d, partial = %v, errors = %v", code, resp.Partial, resp.Errors)
+	}
+	if resp.Inventory.StockOuts != 2 || resp.Shipments.ByStatus["pending"] != 3 || resp.Shipments.Late != 1 || resp.OpenAlerts != 4 {
+		t.Errorf("response = %+v %+v open=%d", resp.Inventory, resp.Shipments, resp.OpenAlerts)
+	}
+	if seenUser != "alice" || seenAuth != "Bearer "+token {
+		t.Errorf("forwarded identity = %q, authorization = %q", seenUser, seenAuth)
+	}
+}
+
+func TestDashboardReturnsPartialResultsWhenASourceIsSlow(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	inventory := serve(t, jsonReply(models.InventorySummary{Items: 1, OpenAlerts: 2}))
+	shipments := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	d := NewDashboard(DashboardConfig{Inventory: inventory, Shipments: shipments, Timeout: 50 * time.Millisecond, Logger: quiet()})
+
+	start := time.Now()
+	code, resp := getDashboard(t, d, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s; the slow source was not cut off", elapsed)
+	}
+	if code != http.StatusOK || !resp.Partial || resp.Inventory == nil || resp.Shipments != nil {
+		t.Fatalf("status = %d, response = %+v", code, resp)
+	}
+	if resp.Errors[sourceShipments] != "timed out after 50ms" || resp.OpenAlerts != 2 {
+		t.Errorf("errors = %v, open alerts = %d", resp.Errors, resp.OpenAlerts)
+	}
+}
+
+func TestDashboardFailsWhenEverySourceFails(t *testing.T) {
+	failing := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, `{"error":"database unavailable"}`)
+	})
+	d := NewDashboard(DashboardConfig{Inventory: failing, Logger: quiet()})
+	code, resp := getDashboard(t, d, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if code != http.StatusBadGateway || !resp.Partial {
+		t.Fatalf("status = %d, response = %+v", code, resp)
+	}
+	if resp.Errors[sourceInventory] != "status 500: database unavailable" || resp.Errors[sourceShipments] != "not configured" {
+		t.Errorf("errors = %v", resp.Errors)
+	}
+}
+
+// staticKeys accepts one API key as a viewer.
+type staticKeys struct{ key string }
+
+func (k staticKeys) ValidateAPIKey(ctx context.Context, key string) (*auth.Claims, error) {
+	if key != k.key {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	return &auth.Claims{Subject: "apikey:wallboard", Role: auth.RoleViewer, Permissions: []string{auth.PermInventoryRead, auth.PermShipmentRead}}, nil
+}
+
+func TestDashboardForwardsAPIKeyCallersAsTokens(t *testing.T) {
+	// The services share the signing secret but cannot validate API keys.
+	backend := auth.NewManager("test-secret", time.Hour)
+	service := func(payload interface{}) to {
+		return serve(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(auth.APIKeyHeader) != "" {
+				http.Error(w, `{"error":"api key reached the service"}`, http.StatusBadRequest)
+				return
+			}
+			backend.Middleware(jsonReply(payload)).ServeHTTP(w, r)
+		})
+	}
+	tokens := auth.NewManager("test-secret", time.Hour)
+	tokens.SetAPIKeyValidator(staticKeys{"fsc_wallboard"})
+	d := NewDashboard(DashboardConfig{
+		Inventory: service(models.InventorySummary{Items: 1}),
+		Shipments: service(models.ShipmentSummary{Total: 2}),
+		Tokens:    tokens,
+		Logger:    quiet(),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	req.Header.Set(auth.APIKeyHeader, "fsc_wallboard")
+	code, resp := getDashboard(t, tokens.Middleware(d), req)
+
+	if code != http.StatusOK || resp.Partial {
+		t.Fatalf("status = %d, errors = %v", code, resp.Errors)
+	}
+	if resp.Inventory.Items != 1 || resp.Shipments.Total != 2 {
+		t.Errorf("response = %+v %+v", resp.Inventory, resp.Shipments)
+	}
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// demoAccounts are the well-known development accounts; each password is the
+// username followed by "123".
+var demoAccounts = []struct{ username, role string }{
+	{"admin", auth.RoleAdmin},
+	{"manager", auth.RoleManager},
+	{"operator", auth.RoleOperator},
+	{"viewer", auth.RoleViewer},
+}
+
+func demoPassword(username string) string { return username + "123" }
+
+// seedAccounts creates the initial accounts. Demo users are only seeded when
+// configured and only in development; an admin is bootstrapped whenever none
+// exists; and outside development startup fails while any demo account still
+// accepts its default password.
+func (a *Auth) seedAccounts() error {
+	dev := IsDevelopment(a.cfg.Environment)
+	if a.cfg.SeedDemoUsers {
+		if !dev {
+			return fmt.Errorf("auth: refusing to seed demo users in the %q environment", a.cfg.Environment)
+		}
+		if err := a.seedDemoUsers(); err != nil {
+			return err
+		}
+	}
+	if err := a.bootstrapAdmin(); err != nil {
+		return err
+	}
+	if dev {
+		return nil
+	}
+	if weak := a.defaultCredentials(); len(weak) > 0 {
+		return fmt.Errorf("auth: default demo credentials are still active for %s in the %q environment; change their passwords or delete them",
+			strings.Join(weak, ", "), a.cfg.Environment)
+	}
+	return nil
+}
+
+// seedDemoUsers creates one known account per role (e.g. admin/admin123) if it
+// does not already exist.
+func (a *Auth) seedDemoUsers() error {
+	for _, d := range demoAccounts {
+		var count int64
+		a.db.Model(&models.User{}).Where("username = ?", d.username).Count(&count)
+		if count > 0 {
+			continue
+		}
+		if _, err := a.createUser(d.username, d.username+"@example.com", demoPassword(d.username), d.role, ""); err != nil {
+			return fmt.Errorf("auth: seed %s: %w", d.username, err)
+		}
+	}
+	return nil
+}
+
+// bootstrapAdmin creates the first admin account when the database has none.
+// Without a configured password a random one is generated and logged once;
+// it should be changed at first sign-in via PUT /auth/me/password.
+func (a *Auth) bootstrapAdmin() error {
+	var admins int64
+	if err := a.db.Model(&models.User{}).Where("role = ?", auth.RoleAdmin).Count(&admins).Error; err != nil {
+		return fmt.Errorf("auth: count admins: %w", err)
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	b := a.cfg.Bootstrap
+	password, generated := b.Password, false
+	if password == "" {
+		var err error
+		if password, err = generatePassword(); err != nil {
+			return err
+		}
+		generated = true
+	}
+	if len(password) < minPasswordLength {
+		return errors.New("auth: bootstrap admin password must be at least 6 characters")
+	}
+	if !IsDevelopment(a.cfg.Environment) && b.Username == "admin" && password == demoPassword("admin") {
+		return errors.New("auth: bootstrap admin password must not be the demo default")
+	}
+	user, err := a.createUser(b.Username, b.Email, password, auth.RoleAdmin, "")
+	if err != nil {
+		// Another replica starting at the same time may have won the race.
+		if a.db.Model(&models.User{}).Where("role = ?", auth.RoleAdmin).Count(&admins); admins > 0 {
+			return nil
+		}
+		return fmt.Errorf("auth: bootstrap admin %s: %w", b.Username, err)
+	}
+
+	attrs := []slog.Attr{slog.String("username", user.Username)}
+	if generated {
+		attrs = append(attrs, slog.String("password", password),
+			slog.String("note", "generated once; sign in and change it"))
+	}
+	a.cfg.Logger.LogAttrs(context.Background(), slog.LevelWarn, "bootstrap_admin_created", attrs...)
+	return nil
+}
+
+// defaultCredentials returns the demo accounts that still accept their
+// well-known password.
+func (a *Auth) defaultCredentials() []string {
+	var weak []string
+	for _, d := range demoAccounts {
+		var user models.User
+		if err := a.db.First(&user, "username = ?", d.username).Error; err != nil {
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(demoPassword(d.username))) == nil {
+			weak = append(weak, d.username)
+		}
+	}
+	return weak
+}
@@ -0,0 +1,16 @@
+package gateway
+
+import "testing"
+
+func TestDemoSeedingRequiresExplicitDevelopment(t *testing.T) {
+	// An unset environment is production, as pkg/config treats it.
+	a, _ := newTestAuth(t, Config{SeedDemoUsers: true})
+	if err := a.seedAccounts(); err == nil {
+		t.Fatal("demo users seeded with no environment set")
+	}
+
+	a, _ = newTestAuth(t, Config{SeedDemoUsers: true, Environment: "development"})
+	if err := a.seedAccounts(); err != nil {
+		t.Fatalf("seeding in development: %v", err)
+	}
+}
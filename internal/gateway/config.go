@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
+)
+
+// Config tunes the gateway's authentication behaviour. Zero values fall back to
+// the defaults below, so Config{} is a valid configuration.
+type Config struct {
+	// Environment names the deployment (development, staging, production,
+	// ...). Outside development, demo seeding is refused and startup fails
+	// while any demo account still has its well-known password. Unset means
+	// production, as in pkg/config.
+	Environment string
+	// SeedDemoUsers creates one demo account per built-in role
+	// (admin/admin123, ...) on first run. Development only.
+	SeedDemoUsers bool
+	// Bootstrap creates the first admin when no admin account exists.
+	Bootstrap BootstrapConfig
+	// MigrateOnStart applies pending schema migrations in NewAuth; otherwise
+	// NewAuth fails while any are pending.
+	MigrateOnStart bool
+
+	// LockoutThreshold is the number of consecutive failed logins after which
+	// an account is temporarily locked.
+	LockoutThreshold int
+	// LockoutDuration is how long a locked account stays locked.
+	LockoutDuration time.Duration
+
+	// Mailer delivers password reset emails. Defaults to a LogMailer.
+	Mailer Mailer
+	// ResetURL is the frontend page that accepts a reset token; the token is
+	// appended as the "token" query parameter.
+	ResetURL string
+	// ResetTokenTTL is how long an emailed reset link stays valid.
+	ResetTokenTTL time.Duration
+
+	// MFARequiredRoles lists roles whose members must use two-factor
+	// authentication. Members without an authenticator are made to enroll
+	// before they receive an access token.
+	MFARequiredRoles []string
+	// MFAIssuer is the issuer label shown in authenticator apps.
+	MFAIssuer string
+	// MFAChallengeTTL bounds the time between the password step and the
+	// second factor of a login.
+	MFAChallengeTTL time.Duration
+
+	// OIDC enables single sign-on through an OpenID Connect provider when set.
+	OIDC *OIDCConfig
+
+	// Logger receives background errors (e.g. failed reset emails).
+	Logger *slog.Logger
+	// Tracer records a span per database query; nil disables them.
+	Tracer *tracing.Tracer
+}
+
+// BootstrapConfig describes the admin account created on first run. When
+// Password is empty a random one is generated and logged once.
+type BootstrapConfig struct {
+	Username string
+	Email    string
+	Password string
+}
+
+// IsDevelopment reports whether env names a local/development environment.
+func IsDevelopment(env string) bool {
+	return config.IsDevelopment(env)
+}
+
+// Defaults applied by withDefaults.
+const (
+	defaultEnvironment      = "production"
+	defaultBootstrapAdmin   = "admin"
+	defaultLockoutThreshold = 5
+	defaultLockoutDuration  = 15 * time.Minute
+	defaultResetURL         = "http://localhost:5173/reset-password"
+	defaultResetTokenTTL    = time.Hour
+	defaultMFAIssuer        = "FoodSupplyChain"
+	defaultMFAChallengeTTL  = 5 * time.Minute
+)
+
+// withDefaults returns a copy of cfg with unset fields filled in.
+func (cfg Config) withDefaults() Config {
+	if cfg.Environment == "" {
+		cfg.Environment = defaultEnvironment
+	}
+	if cfg.Bootstrap.Username == "" {
+		cfg.Bootstrap.Username = defaultBootstrapAdmin
+	}
+	if cfg.Bootstrap.Email == "" {
+		cfg.Bootstrap.Email = cfg.Bootstrap.Username + "@localhost"
+	}
+	if cfg.LockoutThreshold <= 0 {
+		cfg.LockoutThreshold = defaultLockoutThreshold
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = defaultLockoutDuration
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Mailer == nil {
+		cfg.Mailer = &LogMailer{Logger: cfg.Logger}
+	}
+	if cfg.ResetURL == "" {
+		cfg.ResetURL = defaultResetURL
+	}
+	if cfg.ResetTokenTTL <= 0 {
+		cfg.ResetTokenTTL = defaultResetTokenTTL
+	}
+	if cfg.MFAIssuer == "" {
+		cfg.MFAIssuer = defaultMFAIssuer
+	}
+	if cfg.MFAChallengeTTL <= 0 {
+		cfg.MFAChallengeTTL = defaultMFAChallengeTTL
+	}
+	return cfg
+}
@@ -0,0 +1,186 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// Reasons recorded on failed login events.
+const (
+	reasonBadPassword = "bad_password"
+	reasonBadFactor   = "bad_second_factor"
+	reasonUnknownUser = "unknown_user"
+	reasonLocked      = "locked"
+	reasonDisabled    = "disabled"
+)
+
+// loginAttempt identifies where a login came from, for the audit trail.
+type loginAttempt struct {
+	Username  string
+	IPAddress string
+	UserAgent string
+}
+
+func attemptFrom(r *http.Request, username string) loginAttempt {
+	return loginAttempt{Username: username, IPAddress: httpx.ClientIP(r), UserAgent: r.UserAgent()}
+}
+
+// dummyPasswordHash is compared against for unknown usernames, so a login for
+// an account that does not exist costs the same bcrypt work as a wrong
+// password and response times do not reveal which usernames exist.
+var (
+	dummyHashOnce     sync.Once
+	dummyPasswordHash []byte
+)
+
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+// authenticate verifies a username/password pair, enforcing per-account
+// lockout and recording failed attempts in login_events. Lockout is keyed on
+// the account rather than the client, so rotating IPs does not help an
+// attacker. Every attempt costs one bcrypt comparison and anything short of a
+// correct password on a usable account fails with ErrInvalidCredentials, so
+// neither timing nor status reveals whether an account exists or is locked; a
+// locked account refuses even its correct password the same way, or answers
+// would tell guesses apart during the lock. Only the owner of a disabled
+// account learns that it is disabled. Success is recorded by loginSucceeded
+// once the login completes.
+func (a *Auth) authenticate(ctx context.Context, attempt loginAttempt, password string) (*models.User, error) {
+	var user models.User
+	if err := a.db.WithContext(ctx).First(&user, "username = ?", attempt.Username).Error; err != nil {
+		compareDummyPassword(password)
+		a.recordLogin(ctx, attempt, nil, reasonUnknownUser)
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	matched := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+	switch {
+	case user.LockedUntil != nil && now.Before(*user.LockedUntil):
+		a.recordLogin(ctx, attempt, &user, reasonLocked)
+		return nil, ErrInvalidCredentials
+	case !matched:
+		a.registerFailure(ctx, &user, now)
+		a.recordLogin(ctx, attempt, &user, reasonBadPassword)
+		return nil, ErrInvalidCredentials
+	case user.Disabled:
+		a.recordLogin(ctx, attempt, &user, reasonDisabled)
+		return nil, ErrAccountDisabled
+	}
+	return &user, nil
+}
+
+// loginSucceeded clears the failure counter and records a successful login. It
+// runs once every required factor has been verified; clearing the counter
+// after the password alone would let an attacker who knows the password guess
+// second-factor codes indefinitely.
+func (a *Auth) loginSucceeded(ctx context.Context, attempt loginAttempt, user *models.User) {
+	if user.FailedLogins != 0 || user.LockedUntil != nil {
+		a.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+		user.FailedLogins, user.LockedUntil = 0, nil
+	}
+	a.recordLogin(ctx, attempt, user, "")
+}
+
+// registerFailure increments the account's failure counter and locks the
+// account once the threshold is reached, in a single statement so concurrent
+// failures cannot slip past the threshold between a read and a write. The
+// counter restarts with the lock so that the next window again allows
+// LockoutThreshold attempts.
+func (a *Auth) registerFailure(ctx context.Context, user *models.User, now time.Time) {
+	threshold, until := a.cfg.LockoutThreshold, now.Add(a.cfg.LockoutDuration)
+	a.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"failed_logins": gorm.Expr("CASE WHEN failed_logins + 1 >= ? THEN 0 ELSE failed_logins + 1 END", threshold),
+		"locked_until":  gorm.Expr("CASE WHEN failed_logins + 1 >= ? THEN ? ELSE locked_until END", threshold, until),
+	})
+}
+
+// recordLogin appends a login event. A nil user marks an unknown username; an
+// empty reason marks success. Audit failures never block the login itself.
+func (a *Auth) recordLogin(ctx context.Context, attempt loginAttempt, user *models.User, reason string) {
+	event := &models.LoginEvent{
+		ID:        uuid.New().String(),
+		Username:  attempt.Username,
+		Success:   reason == "",
+		Reason:    reason,
+		IPAddress: attempt.IPAddress,
+		UserAgent: attempt.UserAgent,
+		CreatedAt: time.Now(),
+	}
+	if user != nil {
+		event.UserID = user.ID
+	}
+	a.db.WithContext(ctx).Create(event)
+}
+
+// handleListLoginEvents returns a page of login events, newest first (admin
+// only). Optional filters: username, user_id and success=true|false. Callers
+// pinned to a tenant see only the events of that tenant's users, so attempts
+// on unknown usernames are visible to global admins alone.
+func (a *Auth) handleListLoginEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, offset := httpx.ParsePagination(q)
+
+	base := a.db.WithContext(r.Context()).Model(&models.LoginEvent{})
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		base = base.Where("user_id IN (?)", a.tenantUsers(r).Select("id"))
+	}
+	if username := q.Get("username"); username != "" {
+		base = base.Where("username = ?", username)
+	}
+	if userID := q.Get("user_id"); userID != "" {
+		base = base.Where("user_id = ?", userID)
+	}
+	if v := q.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errBody("success must be true or false"))
+			return
+		}
+		base = base.Where("success = ?", success)
+	}
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	var loginEvents []models.LoginEvent
+	if err := base.Order("created_at desc").Limit(limit).Offset(offset).Find(&loginEvents).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, httpx.Page{Data: loginEvents, Total: int(total), Limit: limit, Offset: offset})
+}
+
+// handleUnlockUser clears a user's lockout and failure counter (admin only).
+func (a *Auth) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.loadUser(w, r)
+	if !ok {
+		return
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	user.UpdatedAt = time.Now()
+	if err := a.db.WithContext(r.Context()).Save(user).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+func login(router http.Handler, username, password string) int {
+	return serve(router, http.MethodPost, "/auth/login", "", `{"username":"`+username+`","password":"`+password+`"}`).Code
+}
+
+func TestLoginLockout(t *testing.T) {
+	a, router := newTestAuth(t, Config{LockoutThreshold: 3, LockoutDuration: time.Hour})
+	user := mustCreateUser(t, a, "clerk", auth.RoleViewer, "")
+	stored := func() models.User {
+		var u models.User
+		if err := a.db.First(&u, "id = ?", user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	// A successful login resets the failure counter.
+	for i := 0; i < 2; i++ {
+		if code := login(router, "clerk", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("bad password = %d, want 401", code)
+		}
+	}
+	if code := login(router, "clerk", "password1"); code != http.StatusOK {
+		t.Fatalf("login = %d, want 200", code)
+	}
+	if u := stored(); u.FailedLogins != 0 || u.LockedUntil != nil {
+		t.Fatalf("after success: failed_logins = %d, locked_until = %v", u.FailedLogins, u.LockedUntil)
+	}
+
+	// The threshold-th consecutive failure locks the account and restarts
+	// the counter. A locked account refuses even the right password, exactly
+	// as it refuses a wrong one, so guesses cannot be told apart.
+	for i := 0; i < 3; i++ {
+		login(router, "clerk", "wrong")
+	}
+	if code := login(router, "clerk", "password1"); code != http.StatusUnauthorized {
+		t.Fatalf("login while locked = %d, want 401", code)
+	}
+	if u := stored(); u.FailedLogins != 0 || u.LockedUntil == nil || !u.LockedUntil.After(time.Now()) {
+		t.Fatalf("after lock: failed_logins = %d, locked_until = %v", u.FailedLogins, u.LockedUntil)
+	}
+
+	// Once the lock expires the account can sign in again.
+	a.db.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("locked_until", time.Now().Add(-time.Minute))
+	if code := login(router, "clerk", "password1"); code != http.StatusOK {
+		t.Fatalf("login after expiry = %d, want 200", code)
+	}
+	if u := stored(); u.LockedUntil != nil {
+		t.Errorf("locked_until = %v after a successful login, want cleared", u.LockedUntil)
+	}
+
+	if code := login(router, "nobody", "password1"); code != http.StatusUnauthorized {
+		t.Errorf("unknown user = %d, want 401", code)
+	}
+
+	// Only the right password reveals that an account is disabled.
+	a.db.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("disabled", true)
+	if code := login(router, "clerk", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("disabled account, wrong password = %d, want 401", code)
+	}
+	if code := login(router, "clerk", "password1"); code != http.StatusForbidden {
+		t.Errorf("disabled account, right password = %d, want 403", code)
+	}
+}
+
+func TestConcurrentFailuresLockAtThreshold(t *testing.T) {
+	a, _ := newTestAuth(t, Config{LockoutThreshold: 5, LockoutDuration: time.Hour})
+	user := mustCreateUser(t, a, "clerk", auth.RoleViewer, "")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.registerFailure(context.Background(), user, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	var u models.User
+	a.db.First(&u, "id = ?", user.ID)
+	if u.LockedUntil == nil || u.FailedLogins != 0 {
+		t.Errorf("after 5 concurrent failures: failed_logins = %d, locked_until = %v; want locked", u.FailedLogins, u.LockedUntil)
+	}
+}
+
+func TestLoginEventsAreTenantScoped(t *testing.T) {
+	a, router := newTestAuth(t, Config{})
+	mustCreateRole(t, a, "acme", "people", auth.PermUsersManage)
+	hr := mustCreateUser(t, a, "acme-hr", "people", "acme")
+	mustCreateUser(t, a, "acme-clerk", auth.RoleViewer, "acme")
+	mustCreateUser(t, a, "globex-clerk", auth.RoleViewer, "globex")
+	for _, username := range []string{"acme-clerk", "globex-clerk", "nobody"} {
+		login(router, username, "wrong")
+	}
+
+	rec := serve(router, http.MethodGet, "/auth/login-events", tokenFor(t, a, hr), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list = %d: %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Data  []models.LoginEvent `json:"data"`
+		Total int                 `json:"total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || len(page.Data) != 1 || page.Data[0].Username != "acme-clerk" {
+		t.Errorf("tenant admin sees %d events %+v, want only acme-clerk's", page.Total, page.Data)
+	}
+}
@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends mail through an SMTP relay. STARTTLS is used when the
+// server offers it, and PLAIN authentication when Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Mailer.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	var a smtp.Auth
+	if m.Username != "" {
+		a = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	// net/smtp has no context support; run it aside so cancellation is honoured.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, a, m.From, []string{msg.To}, buildMessage(m.From, msg, time.Now()))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("mailer: send to %s: %w", msg.To, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMessage renders msg as an RFC 5322 message with CRLF line endings.
+func buildMessage(from string, msg Message, now time.Time) []byte {
+	var b bytes.Buffer
+	header := func(k, v string) {
+		// Strip CR/LF so user-controlled values cannot inject headers.
+		v = strings.NewReplacer("\r", "", "\n", "").Replace(v)
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", msg.Subject)
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// LogMailer is a Mailer for local development and tests. It logs the
+// recipient and subject of each message, and the body only at debug level
+// since it may carry a reset link. When Path is set the whole message is also
+// appended to that file so reset links can be picked up without a mail server.
+type LogMailer struct {
+	Logger *slog.Logger
+	Path   string
+
+	mu sync.Mutex
+}
+
+// Send implements Mailer.
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	logger := m.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(ctx, slog.LevelInfo, "mail_sent",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+	)
+	logger.LogAttrs(ctx, slog.LevelDebug, "mail_body", slog.String("to", msg.To), slog.String("body", msg.Body))
+	if m.Path == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("mailer: open %s: %w", m.Path, err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "To: %s\nSubject: %s\n\n%s\n---\n", msg.To, msg.Subject, msg.Body)
+	return err
+}
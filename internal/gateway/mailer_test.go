@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessageStripsHeaderInjection(t *testing.T) {
+	msg := Message{
+		To:      "user@example.com\r\nBcc: attacker@example.com",
+		Subject: "Reset",
+		Body:    "line one\nline two",
+	}
+	raw := string(buildMessage("noreply@example.com", msg, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	if strings.Contains(raw, "\r\nBcc:") {
+		t.Fatalf("header injection survived:\n%s", raw)
+	}
+	if !strings.Contains(raw, "Subject: Reset\r\n") {
+		t.Fatalf("missing subject header:\n%s", raw)
+	}
+	if !strings.HasSuffix(raw, "\r\n\r\nline one\r\nline two") {
+		t.Fatalf("body not CRLF-normalised:\n%q", raw)
+	}
+}
+
+func TestLogMailerAppendsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := &LogMailer{Path: path}
+
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		if err := m.Send(context.Background(), Message{To: to, Subject: "Hi", Body: "link"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read mail log: %v", err)
+	}
+	got := string(data)
+	if !strings.Contains(got, "To: a@example.com") || !strings.Contains(got, "To: b@example.com") {
+		t.Fatalf("mail log missing recipients:\n%s", got)
+	}
+}
+
+func TestLogMailerKeepsBodyOutOfInfoLogs(t *testing.T) {
+	var buf bytes.Buffer
+	m := &LogMailer{Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))}
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Reset", Body: "https://app/reset?token=secret"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := buf.String(); strings.Contains(got, "secret") || !strings.Contains(got, "a@example.com") {
+		t.Fatalf("info log = %q, want the recipient but not the body", got)
+	}
+}
@@ -0,0 +1,411 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// Token purposes used by the two-step login (see auth.Claims.Purpose).
+const (
+	// purposeMFA tokens prove the password step passed and may only be
+	// exchanged at /auth/login/2fa together with a second factor.
+	purposeMFA = "mfa"
+	// purposeMFAEnroll tokens are issued to users whose role requires 2FA but
+	// who have not enrolled yet; they only reach the enrollment endpoints.
+	purposeMFAEnroll = "mfa_enroll"
+)
+
+// recoveryCodeCount is how many recovery codes are issued at a time.
+const recoveryCodeCount = 10
+
+// errInvalidSecondFactor is returned when a TOTP or recovery code is wrong,
+// already used or replayed.
+var errInvalidSecondFactor = errors.New("invalid verification code")
+
+// mfaRequired reports whether the policy requires 2FA for role.
+func (a *Auth) mfaRequired(role string) bool {
+	for _, r := range a.cfg.MFARequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// completeLogin finishes a login whose password has been verified. Users with
+// 2FA enabled get a challenge token to exchange at /auth/login/2fa; users whose
+// role requires 2FA but who have not enrolled get an enrollment token; everyone
+// else gets an access token straight away.
+func (a *Auth) completeLogin(w http.ResponseWriter, r *http.Request, attempt loginAttempt, user *models.User) {
+	switch {
+	case user.TOTPEnabled:
+		a.issuePurposeToken(w, user, purposeMFA, "mfa_required")
+	case a.mfaRequired(user.Role):
+		a.loginSucceeded(r.Context(), attempt, user)
+		a.issuePurposeToken(w, user, purposeMFAEnroll, "mfa_enrollment_required")
+	default:
+		a.loginSucceeded(r.Context(), attempt, user)
+		a.issueToken(w, r, user)
+	}
+}
+
+func (a *Auth) issuePurposeToken(w http.ResponseWriter, user *models.User, purpose, flag string) {
+	token, err := a.tokens.IssuePurposeToken(auth.Claims{Subject: user.Username, Role: user.Role, TenantID: user.TenantID}, purpose, a.cfg.MFAChallengeTTL)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{flag: true, "mfa_token": token})
+}
+
+// handleLoginSecondFactor completes a two-step login: it exchanges the
+// challenge token from /auth/login plus a TOTP code (or a recovery code) for an
+// access token. Wrong codes count towards the account lockout.
+func (a *Auth) handleLoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	claims, err := a.tokens.ValidatePurposeToken(body.MFAToken, purposeMFA)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errBody("invalid or expired mfa token; sign in again"))
+		return
+	}
+	var user models.User
+	if err := a.db.WithContext(r.Context()).First(&user, "username = ?", claims.Subject).Error; err != nil {
+		writeJSON(w, http.StatusUnauthorized, errBody("invalid or expired mfa token; sign in again"))
+		return
+	}
+	attempt := attemptFrom(r, user.Username)
+	now := time.Now()
+	if user.Disabled {
+		a.recordLogin(r.Context(), attempt, &user, reasonDisabled)
+		writeJSON(w, http.StatusForbidden, errBody("account disabled"))
+		return
+	}
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		a.recordLogin(r.Context(), attempt, &user, reasonLocked)
+		writeJSON(w, http.StatusLocked, errBody("account temporarily locked after repeated failed logins; try again later"))
+		return
+	}
+	if err := a.verifySecondFactor(r.Context(), &user, body.Code, body.RecoveryCode); err != nil {
+		if !errors.Is(err, errInvalidSecondFactor) {
+			writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+			return
+		}
+		a.registerFailure(r.Context(), &user, now)
+		a.recordLogin(r.Context(), attempt, &user, reasonBadFactor)
+		writeJSON(w, http.StatusUnauthorized, errBody(err.Error()))
+		return
+	}
+	a.loginSucceeded(r.Context(), attempt, &user)
+	a.issueToken(w, r, &user)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code. Both are claimed with conditional updates, so a code is accepted at
+// most once even under concurrent requests.
+func (a *Auth) verifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) error {
+	if !user.TOTPEnabled {
+		return errInvalidSecondFactor
+	}
+	db := a.db.WithContext(ctx)
+	if recoveryCode != "" {
+		res := db.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normaliseRecoveryCode(recoveryCode))).
+			UpdateColumn("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	step, ok := auth.VerifyTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return errInvalidSecondFactor
+	}
+	res := db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		UpdateColumn("totp_last_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		return errInvalidSecondFactor
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// currentUser loads the account behind the authenticated caller.
+func (a *Auth) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, errBody("unauthenticated"))
+		return nil, false
+	}
+	var user models.User
+	if err := a.db.WithContext(r.Context()).First(&user, "username = ?", claims.Subject).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, errBody("user not found"))
+		return nil, false
+	}
+	return &user, true
+}
+
+// handleSetupTOTP starts enrollment by generating a new authenticator secret.
+// It is not active until confirmed with a code at /auth/2fa/enable.
+func (a *Auth) handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		writeJSON(w, http.StatusConflict, errBody("two-factor authentication is already enabled"))
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	if err := a.db.WithContext(r.Context()).Model(user).UpdateColumn("totp_secret", secret).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_url": auth.TOTPKeyURI(a.cfg.MFAIssuer, user.Username, secret),
+	})
+}
+
+// handleEnableTOTP confirms enrollment with a code from the authenticator,
+// activates 2FA and returns a fresh set of recovery codes (shown once) along
+// with an access token, which completes a login that required enrollment.
+func (a *Auth) handleEnableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if user.TOTPEnabled {
+		writeJSON(w, http.StatusConflict, errBody("two-factor authentication is already enabled"))
+		return
+	}
+	if user.TOTPSecret == "" {
+		writeJSON(w, http.StatusBadRequest, errBody("call /auth/2fa/setup first"))
+		return
+	}
+	step, valid := auth.VerifyTOTP(user.TOTPSecret, body.Code, time.Now())
+	if !valid {
+		writeJSON(w, http.StatusBadRequest, errBody(errInvalidSecondFactor.Error()))
+		return
+	}
+
+	var codes []string
+	err := a.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).UpdateColumns(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+			"updated_at":     time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	user.TOTPEnabled = true
+
+	token, err := a.tokens.IssueToken(a.claimsFor(r.Context(), user))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes, "token": token, "user": user})
+}
+
+// handleDisableTOTP turns 2FA off for the caller after re-checking both the
+// password and a second factor. Roles covered by the policy cannot opt out.
+func (a *Auth) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if !user.TOTPEnabled {
+		writeJSON(w, http.StatusConflict, errBody("two-factor authentication is not enabled"))
+		return
+	}
+	if a.mfaRequired(user.Role) {
+		writeJSON(w, http.StatusForbidden, errBody("two-factor authentication is required for your role"))
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(body.Password)); err != nil {
+		writeJSON(w, http.StatusForbidden, errBody("password is incorrect"))
+		return
+	}
+	if err := a.verifySecondFactor(r.Context(), user, body.Code, body.RecoveryCode); err != nil {
+		writeJSON(w, http.StatusForbidden, errBody(err.Error()))
+		return
+	}
+	if err := a.clearTOTP(r.Context(), user); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRegenerateRecoveryCodes replaces the caller's recovery codes,
+// invalidating the old set. A current TOTP code is required.
+func (a *Auth) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if err := a.verifySecondFactor(r.Context(), user, body.Code, ""); err != nil {
+		writeJSON(w, http.StatusForbidden, errBody(err.Error()))
+		return
+	}
+	var codes []string
+	err := a.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// handleResetUserTOTP removes a user's 2FA enrollment (admin only), e.g. after
+// a lost device with no recovery codes left. If their role requires 2FA they
+// are asked to enroll again at their next login. Like the other account
+// actions it only reaches users of the caller's tenant whose permissions the
+// caller holds, so it can't be used to strip an admin's second factor.
+func (a *Auth) handleResetUserTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.loadUser(w, r)
+	if !ok {
+		return
+	}
+	if err := a.clearTOTP(r.Context(), user); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// clearTOTP disables 2FA for the user and deletes their recovery codes.
+func (a *Auth) clearTOTP(ctx context.Context, user *models.User) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).UpdateColumns(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+			"updated_at":     time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		user.TOTPEnabled, user.TOTPSecret, user.TOTPLastStep = false, "", 0
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new set,
+// returning the plaintext codes.
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  hashToken(normaliseRecoveryCode(code)),
+			CreatedAt: now,
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCode returns a random code such as "k3v7-q2mx-9fjd-a4tw".
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// normaliseRecoveryCode makes code entry forgiving about case, spaces and
+// dashes before hashing.
+func normaliseRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
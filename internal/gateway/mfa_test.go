@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+func TestRecoveryCodeFormatAndNormalisation(t *testing.T) {
+	code, err := newRecoveryCode()
+	if err != nil {
+		t.Fatalf("newRecoveryCode: %v", err)
+	}
+	if !regexp.MustCompile(`^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`).MatchString(code) {
+		t.Fatalf("code = %q, want xxxx-xxxx-xxxx-xxxx", code)
+	}
+	typed := " " + code[:9] + " " + code[10:] + " "
+	if normaliseRecoveryCode(typed) != normaliseRecoveryCode(code) {
+		t.Errorf("normalised %q != %q", normaliseRecoveryCode(typed), normaliseRecoveryCode(code))
+	}
+	upper := normaliseRecoveryCode("ABCD-EFGH")
+	if upper != "abcdefgh" {
+		t.Errorf("normalised = %q, want abcdefgh", upper)
+	}
+}
+
+func TestResetUserTOTPIsScoped(t *testing.T) {
+	a, router := newTestAuth(t, Config{})
+	admin := mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	mustCreateRole(t, a, "acme", "people", auth.PermUsersManage)
+	manager := mustCreateUser(t, a, "acme-hr", "people", "acme")
+	outsider := mustCreateUser(t, a, "globex-clerk", auth.RoleViewer, "globex")
+	colleague := mustCreateUser(t, a, "acme-clerk", "people", "acme")
+	for _, u := range []*models.User{admin, outsider, colleague} {
+		if err := a.db.Model(u).UpdateColumns(map[string]interface{}{"totp_enabled": true, "totp_secret": "secret"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := tokenFor(t, a, manager)
+
+	if rec := serve(router, http.MethodPost, "/users/"+outsider.ID+"/2fa/reset", token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("cross-tenant 2FA reset = %d, want 404", rec.Code)
+	}
+	if rec := serve(router, http.MethodPost, "/users/"+admin.ID+"/2fa/reset", token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("2FA reset of global admin = %d, want 404", rec.Code)
+	}
+	if rec := serve(router, http.MethodPost, "/users/"+colleague.ID+"/2fa/reset", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("same-tenant 2FA reset = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	// A global user manager still can't clear the second factor of an admin.
+	mustCreateRole(t, a, "", "people", auth.PermUsersManage)
+	global := mustCreateUser(t, a, "hr", "people", "")
+	if rec := serve(router, http.MethodPost, "/users/"+admin.ID+"/2fa/reset", tokenFor(t, a, global), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("2FA reset of admin by manager = %d, want 403", rec.Code)
+	}
+
+	for _, u := range []*models.User{admin, outsider} {
+		var stored models.User
+		if err := a.db.First(&stored, "id = ?", u.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !stored.TOTPEnabled {
+			t.Errorf("%s lost their second factor", u.Username)
+		}
+	}
+}
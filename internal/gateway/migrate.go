@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/migrate"
+)
+
+// migrationFiles holds the users, roles and API key schema.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator returns the migrator for the gateway's schema.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, "gateway", sub)
+}
+
+// Migrate runs the migrate subcommand (up, down [n] or status) against the
+// database at dsn.
+func Migrate(ctx context.Context, dsn string, args []string, w io.Writer) error {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	m, err := NewMigrator(sqlDB)
+	if err != nil {
+		return err
+	}
+	return migrate.Command(ctx, m, args, w)
+}
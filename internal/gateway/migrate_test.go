@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// testDatabaseEnv names a PostgreSQL DSN for tests that need the real
+// database; they are skipped when it is unset.
+const testDatabaseEnv = "FSC_TEST_DATABASE_URL"
+
+// openTestSchema connects to the test database with a fresh schema first on
+// the search path, dropped when the test ends.
+func openTestSchema(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	cfg := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	admin, err := gorm.Open(postgres.Open(dsn), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := gorm.Open(postgres.Open(dsn), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// baselineUser is the users table as AutoMigrate created it before the
+// gateway had migrations.
+type baselineUser struct {
+	ID           string `gorm:"primaryKey"`
+	Username     string `gorm:"uniqueIndex;not null"`
+	Email        string `gorm:"uniqueIndex"`
+	PasswordHash string `gorm:"not null"`
+	Role         string `gorm:"not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+func TestMigrationsAdoptBaselineSchema(t *testing.T) {
+	db := openTestSchema(t)
+	ctx := context.Background()
+	if err := db.AutoMigrate(&baselineUser{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := db.Create(&baselineUser{
+		ID: "u1", Username: "alice", Email: "alice@example.com", PasswordHash: "hash",
+		Role: auth.RoleManager, CreatedAt: now, UpdatedAt: now,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Ensure(ctx, true); err != nil {
+		t.Fatalf("migrating the baseline schema: %v", err)
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", "u1").Error; err != nil {
+		t.Fatalf("reading the existing user: %v", err)
+	}
+	if user.Username != "alice" || user.Disabled || user.FailedLogins != 0 || user.TOTPEnabled || user.TenantID != "" {
+		t.Errorf("migrated user = %+v", user)
+	}
+
+	// The adopted database works like a fresh one.
+	a := &Auth{db: db, tokens: auth.NewManager("test-secret", time.Hour), cfg: Config{}.withDefaults()}
+	if err := a.seedBuiltinRoles(); err != nil {
+		t.Fatal(err)
+	}
+	if perms := a.permissionsFor(ctx, "", auth.RoleManager); !(&auth.Claims{Permissions: perms}).HasPermission(auth.PermInventoryAdjust) {
+		t.Errorf("manager permissions = %v", perms)
+	}
+	user.TenantID, user.FailedLogins = "acme", 2
+	if err := db.Save(&user).Error; err != nil {
+		t.Fatalf("saving a user with the new columns: %v", err)
+	}
+
+	// And every migration rolls back.
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Down(ctx, len(status)); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS login_events;
+DROP TABLE IF EXISTS api_key_locations;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS user_locations;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,127 @@
+-- The gateway schema. Databases set up by the earlier AutoMigrate only have
+-- the users table with id, username, email, password_hash, role and
+-- timestamps: IF NOT EXISTS keeps what is there and the ALTER TABLEs below add
+-- the account columns it lacks before anything indexes them.
+
+CREATE TABLE IF NOT EXISTS users (
+    id             text PRIMARY KEY,
+    username       text NOT NULL,
+    email          text,
+    password_hash  text NOT NULL,
+    role           text NOT NULL,
+    tenant_id      text,
+    disabled       boolean NOT NULL DEFAULT false,
+    failed_logins  bigint NOT NULL DEFAULT 0,
+    locked_until   timestamptz,
+    totp_secret    text,
+    totp_enabled   boolean NOT NULL DEFAULT false,
+    totp_last_step bigint NOT NULL DEFAULT 0,
+    created_at     timestamptz,
+    updated_at     timestamptz
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled boolean NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_logins bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step bigint NOT NULL DEFAULT 0;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_tenant_id ON users (tenant_id);
+
+CREATE TABLE IF NOT EXISTS user_locations (
+    user_id     text,
+    location_id text,
+    created_at  timestamptz,
+    PRIMARY KEY (user_id, location_id)
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id          text PRIMARY KEY,
+    tenant_id   text,
+    name        text NOT NULL,
+    description text,
+    builtin     boolean,
+    created_at  timestamptz,
+    updated_at  timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_tenant_name ON roles (tenant_id, name);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id    text,
+    permission text,
+    PRIMARY KEY (role_id, permission),
+    CONSTRAINT fk_roles_permissions FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           text PRIMARY KEY,
+    name         text NOT NULL,
+    prefix       text NOT NULL,
+    key_hash     text NOT NULL,
+    role         text NOT NULL,
+    tenant_id    text,
+    created_by   text,
+    expires_at   timestamptz,
+    last_used_at timestamptz,
+    revoked_at   timestamptz,
+    created_at   timestamptz,
+    updated_at   timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys (tenant_id);
+
+CREATE TABLE IF NOT EXISTS api_key_locations (
+    api_key_id  text,
+    location_id text,
+    PRIMARY KEY (api_key_id, location_id),
+    CONSTRAINT fk_api_keys_locations FOREIGN KEY (api_key_id) REFERENCES api_keys (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS login_events (
+    id         text PRIMARY KEY,
+    user_id    text,
+    username   text NOT NULL,
+    success    boolean,
+    reason     text,
+    ip_address text,
+    user_agent text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id ON login_events (user_id);
+CREATE INDEX IF NOT EXISTS idx_login_events_username ON login_events (username);
+CREATE INDEX IF NOT EXISTS idx_login_events_created_at ON login_events (created_at);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    code_hash  text NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recovery_codes_code_hash ON recovery_codes (code_hash);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer        text,
+    subject       text,
+    user_id       text NOT NULL,
+    email         text,
+    provisioned   boolean NOT NULL DEFAULT false,
+    created_at    timestamptz,
+    last_login_at timestamptz,
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,419 @@
+package gateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider
+// using the authorization-code flow with PKCE.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL; discovery is read from
+	// Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the gateway's callback, i.e. https://<host>/auth/oidc/callback.
+	RedirectURL string
+	// PostLoginURL is the frontend page the browser returns to after the
+	// callback. The gateway token is passed in the URL fragment
+	// (#token=...), or an error as #error=.... When empty the callback
+	// answers with JSON instead.
+	PostLoginURL string
+	// Scopes requested in addition to "openid". Defaults to profile, email
+	// and groups.
+	Scopes []string
+	// GroupsClaim names the ID token claim listing the user's groups.
+	GroupsClaim string
+	// GroupRoles maps IdP groups to roles. The first entry whose group the
+	// user belongs to decides their role.
+	GroupRoles []OIDCGroupRole
+	// DefaultRole applies when none of the user's groups is mapped. Leave
+	// empty to refuse sign-in to users outside every mapped group.
+	DefaultRole string
+	// HTTPClient is used for discovery, JWKS and token requests.
+	HTTPClient *http.Client
+}
+
+// OIDCGroupRole maps one IdP group to a role.
+type OIDCGroupRole struct {
+	Group string
+	Role  string
+}
+
+func (c OIDCConfig) withDefaults() OIDCConfig {
+	c.Issuer = strings.TrimRight(c.Issuer, "/")
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"profile", "email", "groups"}
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return c
+}
+
+// roleFor returns the role for a user in the given groups, or "" when the
+// user may not sign in.
+func (c OIDCConfig) roleFor(groups []string) string {
+	member := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		member[g] = struct{}{}
+	}
+	for _, m := range c.GroupRoles {
+		if _, ok := member[m.Group]; ok {
+			return m.Role
+		}
+	}
+	return c.DefaultRole
+}
+
+// ParseGroupRoles parses "group=role,group=role" into an ordered mapping.
+func ParseGroupRoles(value string) ([]OIDCGroupRole, error) {
+	var out []OIDCGroupRole
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid group mapping %q (want group=role)", pair)
+		}
+		out = append(out, OIDCGroupRole{Group: group, Role: role})
+	}
+	return out, nil
+}
+
+// oidcIdentity is the verified subset of ID token claims the gateway uses.
+type oidcIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Groups            []string
+}
+
+// oidcDiscovery is the part of the provider metadata the flow needs.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClient talks to one OpenID Connect provider. Discovery and signing keys
+// are fetched lazily and cached, so the gateway starts even while the IdP is
+// unreachable; unknown key IDs trigger a refetch to follow key rotation.
+type oidcClient struct {
+	cfg OIDCConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// jwksMinRefresh stops a flood of tokens with unknown key IDs from turning
+// into a flood of JWKS requests.
+const jwksMinRefresh = time.Minute
+
+func newOIDCClient(cfg OIDCConfig) *oidcClient {
+	return &oidcClient{cfg: cfg.withDefaults(), now: time.Now}
+}
+
+func (c *oidcClient) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func (c *oidcClient) metadata(ctx context.Context) (*oidcDiscovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := c.getJSON(ctx, c.cfg.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != c.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", d.Issuer, c.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	c.discovery = &d
+	return c.discovery, nil
+}
+
+// authCodeURL builds the authorization request URL.
+func (c *oidcClient) authCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := c.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: bad authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.cfg.ClientID)
+	q.Set("redirect_uri", c.cfg.RedirectURL)
+	q.Set("scope", strings.Join(append([]string{"openid"}, c.cfg.Scopes...), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// exchange redeems an authorization code and returns the verified identity
+// from the ID token, which must carry the expected nonce.
+func (c *oidcClient) exchange(ctx context.Context, code, verifier, nonce string) (*oidcIdentity, error) {
+	d, err := c.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", c.cfg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token request: %w", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token request: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("oidc token response: missing id_token")
+	}
+	return c.verifyIDToken(ctx, body.IDToken, nonce)
+}
+
+// verifyIDToken checks an RS256 ID token's signature against the provider's
+// JWKS and validates issuer, audience, expiry and nonce.
+func (c *oidcClient) verifyIDToken(ctx context.Context, token, nonce string) (*oidcIdentity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("oidc: unsupported id token algorithm %q", header.Alg)
+	}
+	key, err := c.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("oidc: malformed id token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errors.New("oidc: invalid id token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != c.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: unexpected issuer %q", iss)
+	}
+	if !audienceContains(claims["aud"], c.cfg.ClientID) {
+		return nil, errors.New("oidc: id token not issued for this client")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != c.cfg.ClientID {
+		return nil, errors.New("oidc: id token authorised for another client")
+	}
+	exp, _ := claims["exp"].(float64)
+	if c.now().Unix() >= int64(exp) {
+		return nil, errors.New("oidc: id token expired")
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("oidc: id token nonce mismatch")
+	}
+
+	id := &oidcIdentity{Issuer: c.cfg.Issuer}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	id.EmailVerified, _ = claims["email_verified"].(bool)
+	id.PreferredUsername, _ = claims["preferred_username"].(string)
+	id.Groups = stringList(claims[c.cfg.GroupsClaim])
+	if id.Subject == "" {
+		return nil, errors.New("oidc: id token has no subject")
+	}
+	return id, nil
+}
+
+// key returns the provider's signing key with the given ID, refreshing the
+// JWKS when the ID is unknown.
+func (c *oidcClient) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	d, err := c.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k, ok := c.lookupKey(kid); ok {
+		return k, nil
+	}
+	if !c.fetchedAt.IsZero() && c.now().Sub(c.fetchedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	c.keys, c.fetchedAt = keys, c.now()
+	if k, ok := c.lookupKey(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key; an empty kid matches when there is exactly one
+// key. The caller holds c.mu.
+func (c *oidcClient) lookupKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, true
+		}
+	}
+	k, ok := c.keys[kid]
+	return k, ok
+}
+
+func decodeSegment(seg string, out interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("oidc: malformed id token")
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return errors.New("oidc: malformed id token")
+	}
+	return nil
+}
+
+// audienceContains handles "aud" as either a string or an array of strings.
+func audienceContains(aud interface{}, clientID string) bool {
+	for _, a := range stringList(aud) {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList converts a JSON string or string array claim into a slice.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// randomString returns n random bytes, base64url encoded.
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// pkceChallenge derives the S256 code challenge for a verifier (RFC 7636).
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,311 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rahmanazhar/FoodSupplyChain/internal/gateway/oidctest"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+const testRedirectURL = "http://gateway.test/auth/oidc/callback"
+
+func newTestOIDC(t *testing.T) (*oidctest.Provider, *oidcClient) {
+	t.Helper()
+	provider := oidctest.NewProvider("fsc-gateway", "s3cret")
+	t.Cleanup(provider.Close)
+	client := newOIDCClient(OIDCConfig{
+		Issuer:       provider.Issuer(),
+		ClientID:     "fsc-gateway",
+		ClientSecret: "s3cret",
+		RedirectURL:  testRedirectURL,
+		HTTPClient:   provider.Client(),
+	})
+	return provider, client
+}
+
+// authorize follows the authorization request to the mock provider and
+// returns the code and state it redirects back with.
+func authorize(t *testing.T, provider *oidctest.Provider, authURL string) (code, state string) {
+	t.Helper()
+	httpClient := provider.Client()
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := httpClient.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want 302", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(loc.String(), testRedirectURL) {
+		t.Fatalf("redirected to %q", resp.Header.Get("Location"))
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	provider, client := newTestOIDC(t)
+	provider.SetUser(oidctest.User{
+		Subject:           "abc-123",
+		Email:             "jane@corp.example",
+		EmailVerified:     true,
+		PreferredUsername: "jane",
+		Groups:            []string{"staff", "fsc-managers"},
+	})
+	ctx := context.Background()
+
+	authURL, err := client.authCodeURL(ctx, "state-1", "nonce-1", "verifier-0123456789012345678901234567890123")
+	if err != nil {
+		t.Fatalf("authCodeURL: %v", err)
+	}
+	code, state := authorize(t, provider, authURL)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+
+	id, err := client.exchange(ctx, code, "verifier-0123456789012345678901234567890123", "nonce-1")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if id.Subject != "abc-123" || id.Email != "jane@corp.example" || !id.EmailVerified || id.PreferredUsername != "jane" {
+		t.Errorf("identity = %+v", id)
+	}
+	if id.Issuer != provider.Issuer() || len(id.Groups) != 2 {
+		t.Errorf("issuer/groups = %q %v", id.Issuer, id.Groups)
+	}
+
+	// Codes are single use.
+	if _, err := client.exchange(ctx, code, "verifier-0123456789012345678901234567890123", "nonce-1"); err == nil {
+		t.Error("redeeming a code twice succeeded")
+	}
+}
+
+func TestOIDCRejectsWrongVerifierAndNonce(t *testing.T) {
+	provider, client := newTestOIDC(t)
+	ctx := context.Background()
+	verifier := "verifier-0123456789012345678901234567890123"
+
+	authURL, _ := client.authCodeURL(ctx, "s", "nonce-1", verifier)
+	code, _ := authorize(t, provider, authURL)
+	if _, err := client.exchange(ctx, code, verifier+"x", "nonce-1"); err == nil {
+		t.Error("wrong PKCE verifier accepted")
+	}
+
+	authURL, _ = client.authCodeURL(ctx, "s", "nonce-1", verifier)
+	code, _ = authorize(t, provider, authURL)
+	if _, err := client.exchange(ctx, code, verifier, "nonce-2"); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("wrong nonce: err = %v", err)
+	}
+}
+
+func TestOIDCRoleMapping(t *testing.T) {
+	mapping, err := ParseGroupRoles("fsc-admins=admin, fsc-managers=manager")
+	if err != nil {
+		t.Fatalf("ParseGroupRoles: %v", err)
+	}
+	cfg := OIDCConfig{GroupRoles: mapping}
+	if got := cfg.roleFor([]string{"fsc-managers", "fsc-admins"}); got != "admin" {
+		t.Errorf("role = %q, want admin (first mapping wins)", got)
+	}
+	if got := cfg.roleFor([]string{"staff"}); got != "" {
+		t.Errorf("unmapped role = %q, want empty", got)
+	}
+	cfg.DefaultRole = "viewer"
+	if got := cfg.roleFor(nil); got != "viewer" {
+		t.Errorf("default role = %q, want viewer", got)
+	}
+	if _, err := ParseGroupRoles("nogroup"); err == nil {
+		t.Error("malformed mapping accepted")
+	}
+}
+
+// newTestSSO returns an Auth with single sign-on through a mock provider that
+// maps the fsc-admins group to admin and everyone else to viewer.
+func newTestSSO(t *testing.T) (*oidctest.Provider, *Auth, *mux.Router) {
+	t.Helper()
+	provider := oidctest.NewProvider("fsc-gateway", "s3cret")
+	t.Cleanup(provider.Close)
+	a, router := newTestAuth(t, Config{OIDC: &OIDCConfig{
+		Issuer:       provider.Issuer(),
+		ClientID:     "fsc-gateway",
+		ClientSecret: "s3cret",
+		RedirectURL:  testRedirectURL,
+		HTTPClient:   provider.Client(),
+		GroupRoles:   []OIDCGroupRole{{Group: "fsc-admins", Role: auth.RoleAdmin}},
+		DefaultRole:  auth.RoleViewer,
+	}})
+	return provider, a, router
+}
+
+// completeSSO follows a started flow (the recorder holding the state cookie)
+// through the provider and returns the gateway's callback response.
+func completeSSO(t *testing.T, provider *oidctest.Provider, router http.Handler, started *httptest.ResponseRecorder, authURL string) *httptest.ResponseRecorder {
+	t.Helper()
+	code, state := authorize(t, provider, authURL)
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	for _, c := range started.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// signInSSO runs a plain single sign-on as the provider's current user.
+func signInSSO(t *testing.T, provider *oidctest.Provider, router http.Handler) *httptest.ResponseRecorder {
+	t.Helper()
+	started := serve(router, http.MethodGet, "/auth/oidc/login", "", "")
+	if started.Code != http.StatusFound {
+		t.Fatalf("login = %d, want 302", started.Code)
+	}
+	return completeSSO(t, provider, router, started, started.Header().Get("Location"))
+}
+
+// linkSSO links the provider's current user to the account behind token.
+func linkSSO(t *testing.T, provider *oidctest.Provider, router http.Handler, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	started := serve(router, http.MethodPost, "/auth/oidc/link", token, `{"current_password":"password1"}`)
+	if started.Code != http.StatusOK {
+		t.Fatalf("link = %d: %s", started.Code, started.Body)
+	}
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(started.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return completeSSO(t, provider, router, started, body.URL)
+}
+
+func TestOIDCDoesNotLinkExistingAccountsByEmail(t *testing.T) {
+	provider, a, router := newTestSSO(t)
+	root := mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	provider.SetUser(oidctest.User{Subject: "evil", Email: "root@example.com", EmailVerified: true, PreferredUsername: "root"})
+
+	if rec := signInSSO(t, provider, router); rec.Code != http.StatusConflict {
+		t.Fatalf("sign-in with a local account's email = %d, want 409", rec.Code)
+	}
+	var n int64
+	a.db.Model(&models.UserIdentity{}).Where("user_id = ?", root.ID).Count(&n)
+	if n != 0 {
+		t.Error("identity was linked to the local account")
+	}
+	var stored models.User
+	a.db.First(&stored, "id = ?", root.ID)
+	if stored.Role != auth.RoleAdmin {
+		t.Errorf("role = %q, want admin", stored.Role)
+	}
+}
+
+func TestOIDCLinkIsConfirmedAndKeepsRole(t *testing.T) {
+	provider, a, router := newTestSSO(t)
+	root := mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	other := mustCreateUser(t, a, "other", auth.RoleViewer, "")
+	provider.SetUser(oidctest.User{Subject: "root-sub", Email: "root@corp.example", EmailVerified: true})
+
+	if rec := serve(router, http.MethodPost, "/auth/oidc/link", tokenFor(t, a, root), `{"current_password":"wrong"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("link with wrong password = %d, want 403", rec.Code)
+	}
+	if rec := serve(router, http.MethodPost, "/auth/oidc/link", "", `{"current_password":"password1"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous link = %d, want 401", rec.Code)
+	}
+	if rec := linkSSO(t, provider, router, tokenFor(t, a, root)); rec.Code != http.StatusOK {
+		t.Fatalf("link = %d: %s", rec.Code, rec.Body)
+	}
+
+	// The IdP maps this identity to viewer; the linked admin keeps their role.
+	rec := signInSSO(t, provider, router)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sign-in = %d: %s", rec.Code, rec.Body)
+	}
+	var stored models.User
+	a.db.First(&stored, "id = ?", root.ID)
+	if stored.Role != auth.RoleAdmin {
+		t.Errorf("role after SSO = %q, want admin", stored.Role)
+	}
+
+	if rec := linkSSO(t, provider, router, tokenFor(t, a, other)); rec.Code != http.StatusConflict {
+		t.Errorf("linking an identity owned by another account = %d, want 409", rec.Code)
+	}
+
+	// A local second factor still applies after single sign-on.
+	a.db.Model(&stored).UpdateColumn("totp_enabled", true)
+	rec = signInSSO(t, provider, router)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"mfa_required":true`) || strings.Contains(rec.Body.String(), `"token"`) {
+		t.Errorf("sign-in with 2FA = %d %s, want an mfa challenge", rec.Code, rec.Body)
+	}
+}
+
+func TestOIDCProvisionedRoleFollowsGroups(t *testing.T) {
+	provider, a, router := newTestSSO(t)
+	provider.SetUser(oidctest.User{Subject: "jane-sub", Email: "jane@corp.example", EmailVerified: true, PreferredUsername: "jane"})
+	if rec := signInSSO(t, provider, router); rec.Code != http.StatusOK {
+		t.Fatalf("first sign-in = %d: %s", rec.Code, rec.Body)
+	}
+	provider.SetUser(oidctest.User{Subject: "jane-sub", Email: "jane@corp.example", EmailVerified: true, PreferredUsername: "jane", Groups: []string{"fsc-admins"}})
+	if rec := signInSSO(t, provider, router); rec.Code != http.StatusOK {
+		t.Fatalf("second sign-in = %d: %s", rec.Code, rec.Body)
+	}
+	var jane models.User
+	if err := a.db.First(&jane, "username = ?", "jane").Error; err != nil {
+		t.Fatal(err)
+	}
+	if jane.Role != auth.RoleAdmin {
+		t.Errorf("provisioned role = %q, want admin from groups", jane.Role)
+	}
+}
+
+func TestOIDCRequiresVerifiedEmail(t *testing.T) {
+	provider, a, router := newTestSSO(t)
+	provider.SetUser(oidctest.User{Subject: "anon", Email: "ceo@corp.example", PreferredUsername: "ceo"})
+
+	if rec := signInSSO(t, provider, router); rec.Code != http.StatusForbidden {
+		t.Fatalf("sign-in with an unverified email = %d, want 403", rec.Code)
+	}
+	var n int64
+	a.db.Model(&models.User{}).Where("email = ?", "ceo@corp.example").Count(&n)
+	if n != 0 {
+		t.Error("an account was created with the unverified email")
+	}
+}
+
+func TestOIDCSignInAfterUserDeleted(t *testing.T) {
+	provider, a, router := newTestSSO(t)
+	root := mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	provider.SetUser(oidctest.User{Subject: "jane-sub", Email: "jane@corp.example", EmailVerified: true, PreferredUsername: "jane"})
+	if rec := signInSSO(t, provider, router); rec.Code != http.StatusOK {
+		t.Fatalf("first sign-in = %d: %s", rec.Code, rec.Body)
+	}
+	var jane models.User
+	if err := a.db.First(&jane, "username = ?", "jane").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serve(router, http.MethodDelete, "/users/"+jane.ID, tokenFor(t, a, root), ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d: %s", rec.Code, rec.Body)
+	}
+	var links int64
+	a.db.Model(&models.UserIdentity{}).Where("user_id = ?", jane.ID).Count(&links)
+	if links != 0 {
+		t.Errorf("%d identity links outlived the user", links)
+	}
+	if rec := signInSSO(t, provider, router); rec.Code != http.StatusOK {
+		t.Fatalf("sign-in after delete = %d: %s", rec.Code, rec.Body)
+	}
+
+	// A link orphaned some other way is treated as unlinked too.
+	a.db.Delete(&models.User{}, "username = ?", "jane")
+	if rec := signInSSO(t, provider, router); rec.Code != http.StatusOK {
+		t.Fatalf("sign-in with an orphaned link = %d: %s", rec.Code, rec.Body)
+	}
+}
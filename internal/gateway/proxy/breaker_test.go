@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.record(false)
+	if !b.allow() {
+		t.Fatal("opened before reaching the threshold")
+	}
+	b.record(false)
+	if b.allow() || b.State() != breakerOpen {
+		t.Fatalf("state = %v, want open", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() || b.State() != breakerHalfOpen {
+		t.Fatalf("state = %v, want a half-open trial", b.State())
+	}
+	if b.allow() {
+		t.Error("second request admitted while half-open")
+	}
+	b.record(false)
+	if b.State() != breakerOpen || b.allow() {
+		t.Fatalf("failed trial: state = %v, want open", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	b.allow()
+	b.record(true)
+	if b.State() != breakerClosed || !b.allow() {
+		t.Errorf("successful trial: state = %v, want closed", b.State())
+	}
+}
+
+func TestBreakerAbandonedTrialAllowsAnother(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(1, time.Second)
+	b.now = func() time.Time { return now }
+	b.record(false)
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("trial not admitted after cooldown")
+	}
+	b.abandon()
+	if !b.allow() {
+		t.Error("abandoned trial kept the circuit shut")
+	}
+}
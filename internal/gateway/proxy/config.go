@@ -0,0 +1,277 @@
+// Package proxy implements the gateway's reverse-proxy layer: routes and
+// upstreams are declared in a YAML file, validated, and compiled into a
+// routing table that can be swapped atomically when the file is reloaded.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+)
+
+// File is the on-disk shape of the routes file.
+type File struct {
+	Upstreams map[string]Upstream `yaml:"upstreams"`
+	Routes    []Route             `yaml:"routes"`
+}
+
+// Upstream is a backend service that routes forward to. It may run as several
+// instances, which are load-balanced round-robin.
+type Upstream struct {
+	// URL is a single instance; URLs lists several. Set one or the other.
+	URL  string   `yaml:"url"`
+	URLs []string `yaml:"urls"`
+	// Timeout bounds the wait for an instance's response headers.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is how many other instances an idempotent request (GET, HEAD,
+	// OPTIONS, PUT, DELETE) is retried on after a connection failure or a
+	// 502/503/504. Zero means the default; use -1 to disable retries.
+	Retries        int            `yaml:"retries"`
+	HealthCheck    HealthCheck    `yaml:"health_check"`
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker"`
+}
+
+// HealthCheck configures active health checking of every instance. An
+// instance is taken out of rotation after UnhealthyAfter failed checks in a
+// row and returned after HealthyAfter successes.
+type HealthCheck struct {
+	Disabled       bool          `yaml:"disabled"`
+	Path           string        `yaml:"path"`
+	Interval       time.Duration `yaml:"interval"`
+	Timeout        time.Duration `yaml:"timeout"`
+	UnhealthyAfter int           `yaml:"unhealthy_after"`
+	HealthyAfter   int           `yaml:"healthy_after"`
+}
+
+// CircuitBreaker opens an instance's circuit after Failures consecutive
+// failed requests and lets a trial request through after Cooldown.
+type CircuitBreaker struct {
+	Failures int           `yaml:"failures"`
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// Defaults for upstream settings left unset.
+const (
+	defaultUpstreamTimeout = 30 * time.Second
+	defaultRetries         = 1
+	defaultHealthPath      = "/readyz"
+	defaultHealthInterval  = 10 * time.Second
+	defaultHealthTimeout   = 2 * time.Second
+	defaultUnhealthyAfter  = 3
+	defaultHealthyAfter    = 1
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// withDefaults fills unset settings and folds URL into URLs.
+func (u Upstream) withDefaults() Upstream {
+	if u.URL != "" {
+		u.URLs = append([]string{u.URL}, u.URLs...)
+		u.URL = ""
+	}
+	if u.Timeout <= 0 {
+		u.Timeout = defaultUpstreamTimeout
+	}
+	if u.Retries == 0 {
+		u.Retries = defaultRetries
+	} else if u.Retries < 0 {
+		u.Retries = 0
+	}
+	hc := &u.HealthCheck
+	if hc.Path == "" {
+		hc.Path = defaultHealthPath
+	}
+	if hc.Interval <= 0 {
+		hc.Interval = defaultHealthInterval
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = defaultHealthTimeout
+	}
+	if hc.UnhealthyAfter <= 0 {
+		hc.UnhealthyAfter = defaultUnhealthyAfter
+	}
+	if hc.HealthyAfter <= 0 {
+		hc.HealthyAfter = defaultHealthyAfter
+	}
+	if u.CircuitBreaker.Failures <= 0 {
+		u.CircuitBreaker.Failures = defaultBreakerFailures
+	}
+	if u.CircuitBreaker.Cooldown <= 0 {
+		u.CircuitBreaker.Cooldown = defaultBreakerCooldown
+	}
+	return u
+}
+
+// Route forwards requests whose path starts with Prefix to an upstream.
+type Route struct {
+	// Name identifies the route in logs and errors; defaults to the prefix.
+	Name     string   `yaml:"name"`
+	Prefix   string   `yaml:"prefix"`
+	Upstream string   `yaml:"upstream"`
+	Methods  []string `yaml:"methods"`
+	Rewrite  Rewrite  `yaml:"rewrite"`
+	// Public routes are proxied without authentication. All other routes
+	// require a valid token or API key.
+	Public bool `yaml:"public"`
+	// Roles, when set, restricts the route to callers holding one of them.
+	Roles []string `yaml:"roles"`
+	// RateLimit applies a per-client limit to this route only.
+	RateLimit *RateLimit `yaml:"rate_limit"`
+}
+
+// Rewrite changes the request path before it is forwarded: StripPrefix is
+// removed from the front, then AddPrefix is prepended.
+type Rewrite struct {
+	StripPrefix string `yaml:"strip_prefix"`
+	AddPrefix   string `yaml:"add_prefix"`
+}
+
+// RateLimit is a token bucket: RPS requests per second with bursts of Burst.
+// Key picks who owns a bucket: "caller" (the default) gives each user or API
+// key its own, falling back to the client IP on public routes; "ip" always
+// uses the client IP.
+type RateLimit struct {
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+	Key   string  `yaml:"key"`
+}
+
+// Rate limit keys.
+const (
+	RateLimitByCaller = "caller"
+	RateLimitByIP     = "ip"
+)
+
+// defaultMethods are allowed when a route lists none.
+var defaultMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// LoadFile reads, expands and parses a routes file, then validates it.
+// ${VAR} and ${VAR:-default} references are replaced from the environment
+// before parsing, so upstream URLs can differ per deployment.
+func LoadFile(path string, reserved []string) (*File, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read routes: %w", err)
+	}
+	return Parse(raw, reserved)
+}
+
+// Parse parses and validates routes from YAML. Paths under any of the reserved
+// prefixes (served by the gateway itself) may not be proxied.
+func Parse(raw []byte, reserved []string) (*File, error) {
+	var f File
+	if err := yaml.UnmarshalStrict([]byte(config.ExpandEnv(string(raw))), &f); err != nil {
+		return nil, fmt.Errorf("parse routes: %w", err)
+	}
+	if err := f.Validate(reserved); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Validate checks the whole file and reports every problem at once.
+func (f *File) Validate(reserved []string) error {
+	var errs []error
+	fail := func(format string, args ...interface{}) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	for name, up := range f.Upstreams {
+		if up.URL != "" && len(up.URLs) > 0 {
+			fail("upstream %q: set url or urls, not both", name)
+		}
+		up = up.withDefaults()
+		if len(up.URLs) == 0 {
+			fail("upstream %q: no url", name)
+		}
+		for _, raw := range up.URLs {
+			u, err := url.Parse(raw)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail("upstream %q: url %q must be an absolute http(s) URL", name, raw)
+			}
+		}
+		if !strings.HasPrefix(up.HealthCheck.Path, "/") {
+			fail("upstream %q: health_check path %q must start with /", name, up.HealthCheck.Path)
+		}
+		f.Upstreams[name] = up
+	}
+	if len(f.Routes) == 0 {
+		fail("no routes defined")
+	}
+
+	seen := make(map[string]string)
+	for i := range f.Routes {
+		r := &f.Routes[i]
+		if r.Name == "" {
+			r.Name = r.Prefix
+		}
+		where := fmt.Sprintf("route %d (%s)", i+1, r.Name)
+		if !strings.HasPrefix(r.Prefix, "/") || r.Prefix == "/" {
+			fail("%s: prefix %q must start with / and not be the root", where, r.Prefix)
+		}
+		for _, p := range reserved {
+			if pathUnder(r.Prefix, p) || pathUnder(p, r.Prefix) {
+				fail("%s: prefix %q overlaps gateway path %q", where, r.Prefix, p)
+			}
+		}
+		if _, ok := f.Upstreams[r.Upstream]; !ok {
+			fail("%s: unknown upstream %q", where, r.Upstream)
+		}
+		if len(r.Methods) == 0 {
+			r.Methods = defaultMethods
+		}
+		for j, m := range r.Methods {
+			m = strings.ToUpper(m)
+			r.Methods[j] = m
+			if !knownMethods[m] {
+				fail("%s: unknown method %q", where, m)
+			}
+			key := m + " " + r.Prefix
+			if other, dup := seen[key]; dup {
+				fail("%s: %s %s is already routed by %s", where, m, r.Prefix, other)
+			}
+			seen[key] = r.Name
+		}
+		if r.Rewrite.StripPrefix != "" && !pathUnder(r.Rewrite.StripPrefix, r.Prefix) && !pathUnder(r.Prefix, r.Rewrite.StripPrefix) {
+			fail("%s: strip_prefix %q does not apply to prefix %q", where, r.Rewrite.StripPrefix, r.Prefix)
+		}
+		if r.Rewrite.AddPrefix != "" && !strings.HasPrefix(r.Rewrite.AddPrefix, "/") {
+			fail("%s: add_prefix %q must start with /", where, r.Rewrite.AddPrefix)
+		}
+		if r.Public && len(r.Roles) > 0 {
+			fail("%s: a public route cannot require roles", where)
+		}
+		for _, role := range r.Roles {
+			if strings.TrimSpace(role) == "" {
+				fail("%s: empty role", where)
+			}
+		}
+		if rl := r.RateLimit; rl != nil {
+			if rl.RPS <= 0 || rl.Burst < 1 {
+				fail("%s: rate_limit needs rps > 0 and burst >= 1", where)
+			}
+			switch rl.Key {
+			case "", RateLimitByCaller, RateLimitByIP:
+			default:
+				fail("%s: rate_limit key %q must be %q or %q", where, rl.Key, RateLimitByCaller, RateLimitByIP)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pathUnder reports whether path equals prefix or lies beneath it.
+func pathUnder(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseValidFileAppliesDefaults(t *testing.T) {
+	t.Setenv("TEST_INVENTORY_URL", "http://inventory:8080")
+	f, err := Parse([]byte(`
+upstreams:
+  inventory: { url: "${TEST_INVENTORY_URL}" }
+  shipment:  { url: "${TEST_UNSET_URL:-http://shipment:8081}" }
+routes:
+  - prefix: /inventory
+    upstream: inventory
+  - name: shipments
+    prefix: /shipments
+    upstream: shipment
+    methods: [get, post]
+    rewrite: { add_prefix: /api/v1 }
+`), nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if f.Upstreams["inventory"].URLs[0] != "http://inventory:8080" || f.Upstreams["shipment"].URLs[0] != "http://shipment:8081" {
+		t.Errorf("upstreams not expanded: %+v", f.Upstreams)
+	}
+	if up := f.Upstreams["inventory"]; up.Retries != 1 || up.HealthCheck.Path != "/readyz" || up.CircuitBreaker.Failures != 5 {
+		t.Errorf("upstream defaults not applied: %+v", up)
+	}
+	if f.Routes[0].Name != "/inventory" || len(f.Routes[0].Methods) != len(defaultMethods) {
+		t.Errorf("defaults not applied: %+v", f.Routes[0])
+	}
+	if got := f.Routes[1].Methods; got[0] != "GET" || got[1] != "POST" {
+		t.Errorf("methods = %v, want upper-cased", got)
+	}
+}
+
+func TestParseReportsAllErrors(t *testing.T) {
+	_, err := Parse([]byte(`
+upstreams:
+  bad: { url: "not-a-url" }
+routes:
+  - prefix: inventory
+    upstream: missing
+  - prefix: /auth/sso
+    upstream: bad
+    methods: [FETCH]
+    rate_limit: { rps: 0, burst: 0, key: session }
+`), []string{"/auth"})
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{
+		`upstream "bad"`,
+		`prefix "inventory" must start with /`,
+		`unknown upstream "missing"`,
+		`overlaps gateway path "/auth"`,
+		`unknown method "FETCH"`,
+		"rate_limit needs",
+		`rate_limit key "session"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestParseRejectsUnknownFieldsAndDuplicates(t *testing.T) {
+	if _, err := Parse([]byte("routes:\n  - prefix: /x\n    upstrem: a\n"), nil); err == nil {
+		t.Error("unknown field accepted")
+	}
+	_, err := Parse([]byte(`
+upstreams: { a: { url: "http://a" } }
+routes:
+  - { prefix: /x, upstream: a }
+  - { prefix: /x, upstream: a, methods: [GET] }
+`), nil)
+	if err == nil || !strings.Contains(err.Error(), "already routed") {
+		t.Errorf("duplicate route: err = %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxRetryBody is the largest request body buffered so the request can be
+// retried; larger idempotent requests are sent once.
+const maxRetryBody = 1 << 20
+
+// errNoInstance is returned when every instance is unhealthy or its circuit
+// is open.
+var errNoInstance = errors.New("no healthy upstream instance")
+
+// instance is one backend address of an upstream.
+type instance struct {
+	url     *url.URL
+	breaker *breaker
+	healthy atomic.Bool
+
+	// Consecutive health-check results, owned by the checker goroutine.
+	passes, fails int
+}
+
+// pool load-balances requests over an upstream's instances. It implements
+// http.RoundTripper so it can sit underneath httputil.ReverseProxy, which
+// keeps handling headers, streaming and hop-by-hop details.
+type pool struct {
+	name      string
+	cfg       Upstream
+	instances []*instance
+	transport *http.Transport
+	logger    *slog.Logger
+
+	next atomic.Uint64
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newPool(name string, cfg Upstream, logger *slog.Logger) (*pool, error) {
+	p := &pool{
+		name:   name,
+		cfg:    cfg,
+		logger: logger,
+		stop:   make(chan struct{}),
+		transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: cfg.Timeout,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+	for _, raw := range cfg.URLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		inst := &instance{url: u, breaker: newBreaker(cfg.CircuitBreaker.Failures, cfg.CircuitBreaker.Cooldown)}
+		inst.healthy.Store(true)
+		p.instances = append(p.instances, inst)
+	}
+	return p, nil
+}
+
+// pick returns the first available instance at or after start, skipping
+// unhealthy instances, open circuits and those already tried.
+func (p *pool) pick(start int, tried map[*instance]bool) *instance {
+	n := len(p.instances)
+	for i := 0; i < n; i++ {
+		inst := p.instances[(start+i)%n]
+		if tried[inst] || !inst.healthy.Load() {
+			continue
+		}
+		if inst.breaker.allow() {
+			return inst
+		}
+	}
+	return nil
+}
+
+// RoundTrip sends the request to an instance, retrying idempotent requests on
+// other instances after connection failures and 502/503/504 responses.
+func (p *pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	var body []byte
+	if retryable(req) {
+		attempts += p.cfg.Retries
+		if req.Body != nil && req.Body != http.NoBody {
+			buf, err := io.ReadAll(io.LimitReader(req.Body, maxRetryBody+1))
+			if err != nil {
+				req.Body.Close()
+				return nil, err
+			}
+			if len(buf) > maxRetryBody {
+				// Too large to buffer: send it once, streaming the remainder.
+				attempts = 1
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+			} else {
+				req.Body.Close()
+				body = buf
+			}
+		}
+	}
+
+	// Round robin advances once per request; retries move on from there.
+	start := int((p.next.Add(1) - 1) % uint64(len(p.instances)))
+	tried := make(map[*instance]bool, attempts)
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		inst := p.pick(start, tried)
+		if inst == nil {
+			break
+		}
+		tried[inst] = true
+
+		out := req.Clone(req.Context())
+		out.URL.Scheme = inst.url.Scheme
+		out.URL.Host = inst.url.Host
+		out.URL.Path = joinPath(inst.url.Path, req.URL.Path)
+		out.URL.RawPath = ""
+		if body != nil {
+			out.Body = io.NopCloser(bytes.NewReader(body))
+			out.ContentLength = int64(len(body))
+			out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		}
+
+		resp, err := p.transport.RoundTrip(out)
+		failed := err != nil || isUnavailable(resp.StatusCode)
+		if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+			// The client went away; that says nothing about the instance.
+			inst.breaker.abandon()
+			return nil, err
+		}
+		inst.breaker.record(!failed)
+		if !failed {
+			return resp, nil
+		}
+		if attempt == attempts-1 {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		lastErr = err
+		p.logger.WarnContext(req.Context(), "upstream_retry", slog.String("upstream", p.name),
+			slog.String("instance", inst.url.Host), slog.Int("attempt", attempt+1))
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errNoInstance
+}
+
+// retryable reports whether the request method is idempotent.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isUnavailable reports statuses that indicate the instance, rather than the
+// request, is at fault.
+func isUnavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func joinPath(base, path string) string {
+	if base == "" || base == "/" {
+		return path
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// start launches one health checker per instance unless checks are disabled.
+func (p *pool) start() {
+	if p.cfg.HealthCheck.Disabled {
+		return
+	}
+	client := &http.Client{Transport: p.transport, Timeout: p.cfg.HealthCheck.Timeout}
+	for _, inst := range p.instances {
+		p.wg.Add(1)
+		go func(inst *instance) {
+			defer p.wg.Done()
+			ticker := time.NewTicker(p.cfg.HealthCheck.Interval)
+			defer ticker.Stop()
+			for {
+				p.check(client, inst)
+				select {
+				case <-p.stop:
+					return
+				case <-ticker.C:
+				}
+			}
+		}(inst)
+	}
+}
+
+// check probes one instance and updates its health after enough consecutive
+// results.
+func (p *pool) check(client *http.Client, inst *instance) {
+	target := *inst.url
+	target.Path = joinPath(inst.url.Path, p.cfg.HealthCheck.Path)
+	ok := false
+	if resp, err := client.Get(target.String()); err == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		ok = resp.StatusCode >= 200 && resp.StatusCode < 300
+	}
+	if ok {
+		inst.passes, inst.fails = inst.passes+1, 0
+		if !inst.healthy.Load() && inst.passes >= p.cfg.HealthCheck.HealthyAfter {
+			inst.healthy.Store(true)
+			p.logger.Info("upstream_healthy", slog.String("upstream", p.name), slog.String("instance", inst.url.Host))
+		}
+		return
+	}
+	inst.fails, inst.passes = inst.fails+1, 0
+	if inst.healthy.Load() && inst.fails >= p.cfg.HealthCheck.UnhealthyAfter {
+		inst.healthy.Store(false)
+		p.logger.Warn("upstream_unhealthy", slog.String("upstream", p.name), slog.String("instance", inst.url.Host))
+	}
+}
+
+// close stops the health checkers and drops idle connections.
+func (p *pool) close() {
+	close(p.stop)
+	p.wg.Wait()
+	p.transport.CloseIdleConnections()
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestTable(t *testing.T, routes string) *Table {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRoutes(t, path, routes)
+	table, err := NewTable(path, Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	t.Cleanup(table.Close)
+	return table
+}
+
+// countingUpstream answers with status and counts the requests it receives.
+func countingUpstream(t *testing.T, status int, hits *atomic.Int64) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPoolRetriesIdempotentRequestsOnAnotherInstance(t *testing.T) {
+	var badHits, goodHits atomic.Int64
+	bad := countingUpstream(t, http.StatusServiceUnavailable, &badHits)
+	good := countingUpstream(t, http.StatusOK, &goodHits)
+	table := newTestTable(t, fmt.Sprintf(`
+upstreams:
+  a:
+    urls: [%q, %q]
+    health_check: { disabled: true }
+    circuit_breaker: { failures: 100 }
+routes:
+  - { prefix: /things, upstream: a, public: true }
+`, bad.URL, good.URL))
+
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodPut, "/things/1", strings.NewReader("payload"))
+		rec := httptest.NewRecorder()
+		table.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != "payload" {
+			t.Fatalf("PUT %d = %d %q, want 200 with the body replayed", i, rec.Code, rec.Body.String())
+		}
+	}
+	if goodHits.Load() != 4 || badHits.Load() != 2 {
+		t.Errorf("hits good=%d bad=%d, want 4 and 2 (round robin with one retry)", goodHits.Load(), badHits.Load())
+	}
+
+	// POST is not idempotent: whichever instance is chosen answers.
+	statuses := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader("x"))
+		rec := httptest.NewRecorder()
+		table.ServeHTTP(rec, req)
+		statuses[rec.Code] = true
+	}
+	if !statuses[http.StatusServiceUnavailable] || !statuses[http.StatusOK] {
+		t.Errorf("POST statuses = %v, want one failure passed through", statuses)
+	}
+}
+
+func TestPoolCircuitBreakerReturnsStructuredError(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	table := newTestTable(t, fmt.Sprintf(`
+upstreams:
+  a:
+    url: %q
+    retries: -1
+    health_check: { disabled: true }
+    circuit_breaker: { failures: 2, cooldown: 1h }
+routes:
+  - { prefix: /things, upstream: a, public: true }
+`, down.URL))
+
+	for i := 0; i < 2; i++ {
+		if code, _ := get(t, table, "/things", ""); code != http.StatusBadGateway {
+			t.Fatalf("request %d = %d, want 502", i, code)
+		}
+	}
+	code, body := get(t, table, "/things", "")
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("with open circuit = %d, want 503", code)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(body), &payload); err != nil || payload["upstream"] != "a" || payload["error"] == "" {
+		t.Errorf("error body = %s", body)
+	}
+	if st := table.Status(); len(st) != 1 || st[0].Status != StatusDown || st[0].Instances[0].Circuit != "open" {
+		t.Errorf("status = %+v, want a down upstream with an open circuit", st)
+	}
+}
+
+func TestPoolHealthCheckTakesInstanceOutOfRotation(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	table := newTestTable(t, fmt.Sprintf(`
+upstreams:
+  a:
+    url: %q
+    health_check: { path: /ready, interval: 10ms, unhealthy_after: 1, healthy_after: 1 }
+routes:
+  - { prefix: /things, upstream: a, public: true }
+`, srv.URL))
+
+	waitFor := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			code, _ := get(t, table, "/things", "")
+			if code == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("status = %d, want %d", code, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(http.StatusOK)
+	healthy.Store(false)
+	waitFor(http.StatusServiceUnavailable)
+	healthy.Store(true)
+	waitFor(http.StatusOK)
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import "sort"
+
+// Upstream status values.
+const (
+	StatusOK       = "ok"       // every instance can take traffic
+	StatusDegraded = "degraded" // some instances are out of rotation
+	StatusDown     = "down"     // no instance can take traffic
+)
+
+// UpstreamStatus reports one upstream's instances as the gateway sees them.
+type UpstreamStatus struct {
+	Name      string           `json:"name"`
+	Status    string           `json:"status"`
+	Available int              `json:"available"`
+	Instances []InstanceStatus `json:"instances,omitempty"`
+}
+
+// InstanceStatus reports one instance: its last health-check verdict and its
+// circuit breaker state.
+type InstanceStatus struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	Circuit string `json:"circuit"`
+}
+
+// Status returns the state of every upstream in the live routes, sorted by
+// name.
+func (t *Table) Status() []UpstreamStatus {
+	c := t.current.Load()
+	if c == nil {
+		return nil
+	}
+	out := make([]UpstreamStatus, 0, len(c.pools))
+	for _, p := range c.pools {
+		out = append(out, p.status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (p *pool) status() UpstreamStatus {
+	s := UpstreamStatus{Name: p.name, Instances: make([]InstanceStatus, len(p.instances))}
+	for i, inst := range p.instances {
+		circuit := inst.breaker.State()
+		s.Instances[i] = InstanceStatus{URL: inst.url.String(), Healthy: inst.healthy.Load(), Circuit: circuit.String()}
+		if s.Instances[i].Healthy && circuit != breakerOpen {
+			s.Available++
+		}
+	}
+	switch s.Available {
+	case len(p.instances):
+		s.Status = StatusOK
+	case 0:
+		s.Status = StatusDown
+	default:
+		s.Status = StatusDegraded
+	}
+	return s
+}
@@ -0,0 +1,342 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/ratelimit"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
+)
+
+// Options configures a Table.
+type Options struct {
+	// Auth validates tokens and API keys on every non-public route.
+	Auth *auth.Manager
+	// Reserved lists path prefixes the gateway serves itself; routes may not
+	// shadow them.
+	Reserved []string
+	// Limits holds route rate-limit buckets. Nil keeps them in memory per
+	// gateway process; a shared store (ratelimit.KV) enforces each limit
+	// across all replicas and keeps buckets across reloads.
+	Limits ratelimit.Store
+	// Tracer records a client span per proxied request and passes the trace
+	// on to the upstream; nil forwards the caller's traceparent unchanged.
+	Tracer *tracing.Tracer
+	Logger *slog.Logger
+}
+
+// Table is the live routing table. It serves requests with the most recently
+// loaded routes; Reload swaps in a new set atomically, and an invalid file
+// leaves the current routes in place.
+type Table struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex // serialises reloads
+	current atomic.Pointer[compiled]
+}
+
+// compiled is one loaded version of the routes file.
+type compiled struct {
+	handler http.Handler
+	pools   map[string]*pool
+}
+
+// NewTable loads and compiles the routes file at path.
+func NewTable(path string, opts Options) (*Table, error) {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	t := &Table{path: path, opts: opts}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload re-reads the routes file and, if it is valid, replaces the live
+// routes. In-flight requests finish on the routes they started with.
+func (t *Table) Reload() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, err := LoadFile(t.path, t.opts.Reserved)
+	if err != nil {
+		return err
+	}
+	c, err := t.compile(f)
+	if err != nil {
+		return err
+	}
+	for _, p := range c.pools {
+		p.start()
+	}
+	if old := t.current.Swap(c); old != nil {
+		// Requests already on the old pools keep their transports; only the
+		// health checkers stop.
+		old.close()
+	}
+	t.opts.Logger.Info("routes_loaded", slog.String("file", t.path),
+		slog.Int("routes", len(f.Routes)), slog.Int("upstreams", len(f.Upstreams)))
+	return nil
+}
+
+// ServeHTTP dispatches to the current routes.
+func (t *Table) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := t.current.Load()
+	if c == nil {
+		writeError(w, http.StatusServiceUnavailable, "gateway shutting down")
+		return
+	}
+	c.handler.ServeHTTP(w, r)
+}
+
+// Close stops the upstream health checks.
+func (t *Table) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c := t.current.Swap(nil); c != nil {
+		c.close()
+	}
+}
+
+func (c *compiled) close() {
+	for _, p := range c.pools {
+		p.close()
+	}
+}
+
+// Transport returns a RoundTripper that sends requests to the named upstream
+// of the live routes, with the same instance selection, retries and circuit
+// breaking as proxied traffic. Only the request's path and query are used;
+// scheme and host are filled in per instance. It lets gateway handlers call
+// services without knowing their addresses.
+func (t *Table) Transport(upstream string) http.RoundTripper {
+	return tracing.Transport(t.opts.Tracer, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		c := t.current.Load()
+		if c == nil {
+			return nil, errNoInstance
+		}
+		p, ok := c.pools[upstream]
+		if !ok {
+			return nil, fmt.Errorf("unknown upstream %q", upstream)
+		}
+		return p.RoundTrip(req)
+	}))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// compile turns a validated file into a router.
+func (t *Table) compile(f *File) (*compiled, error) {
+	c := &compiled{pools: make(map[string]*pool, len(f.Upstreams))}
+	proxies := make(map[string]*httputil.ReverseProxy, len(f.Upstreams))
+	for name, up := range f.Upstreams {
+		p, err := newPool(name, up, t.opts.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %w", name, err)
+		}
+		c.pools[name] = p
+		proxies[name] = newReverseProxy(p, t.opts.Tracer)
+	}
+
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no route for "+r.URL.Path)
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+	for _, rt := range f.Routes {
+		var h http.Handler = proxies[rt.Upstream]
+		if rt.Rewrite != (Rewrite{}) {
+			h = rewritePath(rt.Rewrite, h)
+		}
+		h = forwardIdentity(t.opts.Auth, h)
+		// Per-caller limits sit inside authentication so the caller is known;
+		// IP limits (and public routes) sit outside it.
+		byCaller := rt.RateLimit != nil && rt.RateLimit.Key != RateLimitByIP && !rt.Public
+		if byCaller {
+			h = t.rateLimit(rt, auth.RateLimitKey)(h)
+		}
+		if !rt.Public {
+			if t.opts.Auth == nil {
+				return nil, fmt.Errorf("route %s: authentication requires an auth manager", rt.Name)
+			}
+			if len(rt.Roles) > 0 {
+				h = auth.RequireRole(rt.Roles...)(h)
+			}
+			h = t.opts.Auth.Middleware(h)
+		}
+		if rt.RateLimit != nil && !byCaller {
+			h = t.rateLimit(rt, nil)(h)
+		}
+		h = traceRoute(rt, h)
+		// OPTIONS stays routable so CORS preflights reach the gateway's CORS
+		// middleware rather than a 405.
+		methods := append(append([]string{}, rt.Methods...), http.MethodOptions)
+		router.PathPrefix(rt.Prefix).MatcherFunc(underPrefix(rt.Prefix)).Methods(methods...).Handler(h)
+	}
+	c.handler = router
+	return c, nil
+}
+
+// rateLimit builds rt's limiter. Buckets are named after the route so routes
+// sharing a store don't share limits.
+func (t *Table) rateLimit(rt Route, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return httpx.RateLimitWith(httpx.RateLimitConfig{
+		Name:   "route:" + rt.Name,
+		Limit:  ratelimit.Limit{Rate: rt.RateLimit.RPS, Burst: rt.RateLimit.Burst},
+		Store:  t.opts.Limits,
+		Key:    key,
+		Logger: t.opts.Logger,
+	})
+}
+
+// traceRoute names the request's server span and metrics route label after
+// the route, which says more than the gateway's catch-all path.
+func traceRoute(rt Route, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if span := tracing.SpanFrom(r.Context()); span != nil {
+			span.SetName(r.Method + " " + rt.Prefix)
+			span.SetAttr("http.route", rt.Prefix)
+			span.SetAttr("gateway.route", rt.Name)
+			span.SetAttr("gateway.upstream", rt.Upstream)
+		}
+		metrics.SetRoute(r.Context(), rt.Prefix)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// underPrefix stops a route for /inventory from also matching /inventory-x.
+func underPrefix(prefix string) mux.MatcherFunc {
+	return func(r *http.Request, _ *mux.RouteMatch) bool {
+		return pathUnder(r.URL.Path, prefix)
+	}
+}
+
+// forwardIdentity replaces any client-supplied identity headers with the
+// verified caller (none on public routes), swaps an API key for a token the
+// upstream can verify (see auth.Manager.ForwardCredential) and passes the
+// request ID on so upstream logs correlate with the gateway's.
+func forwardIdentity(tokens *auth.Manager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.Clone(r.Context())
+		claims, _ := auth.ClaimsFromContext(r.Context())
+		auth.SetIdentity(r2.Header, claims)
+		if tokens != nil {
+			if err := tokens.ForwardCredential(r.Context(), r2.Header); err != nil {
+				writeError(w, http.StatusInternalServerError, "failed to forward credentials")
+				return
+			}
+		} else {
+			r2.Header.Del(auth.APIKeyHeader)
+		}
+		if id := httpx.RequestIDFrom(r.Context()); id != "" {
+			r2.Header.Set(httpx.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// rewritePath applies a route's rewrite to the request path before forwarding.
+func rewritePath(rw Rewrite, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if rw.StripPrefix != "" && pathUnder(p, rw.StripPrefix) {
+			p = strings.TrimPrefix(p, strings.TrimSuffix(rw.StripPrefix, "/"))
+			if p == "" {
+				p = "/"
+			}
+		}
+		if rw.AddPrefix != "" {
+			p = strings.TrimSuffix(rw.AddPrefix, "/") + p
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = p
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// newReverseProxy builds a reverse proxy whose transport is the upstream's
+// pool, which chooses the instance and retries.
+func newReverseProxy(p *pool, tracer *tracing.Tracer) *httputil.ReverseProxy {
+	proxy := &httputil.ReverseProxy{Transport: tracing.Transport(tracer, p)}
+	proxy.Director = func(req *http.Request) {
+		// The pool fills in scheme and host per attempt; these placeholders
+		// only satisfy ReverseProxy's checks.
+		req.URL.Scheme = "http"
+		req.URL.Host = p.name
+		req.Header.Set("X-Proxy-Gateway", "api-gateway")
+		if _, ok := req.Header["User-Agent"]; !ok {
+			req.Header.Set("User-Agent", "")
+		}
+	}
+
+	// The gateway is the single source of CORS headers; strip any set by the
+	// backend so responses don't carry duplicate Access-Control-* headers
+	// (which browsers reject).
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		resp.Header.Del("Access-Control-Allow-Origin")
+		resp.Header.Del("Access-Control-Allow-Methods")
+		resp.Header.Del("Access-Control-Allow-Headers")
+		resp.Header.Del("Access-Control-Allow-Credentials")
+		return nil
+	}
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		status, msg := http.StatusBadGateway, "upstream request failed"
+		var netErr net.Error
+		switch {
+		case errors.Is(err, context.Canceled):
+			// The client is gone; nobody will read the response.
+			return
+		case errors.Is(err, errNoInstance):
+			status, msg = http.StatusServiceUnavailable, "upstream unavailable"
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			status, msg = http.StatusGatewayTimeout, "upstream timed out"
+		}
+		p.logger.WarnContext(r.Context(), "upstream_error", slog.String("upstream", p.name),
+			slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+		writeUpstreamError(w, r, status, msg, p.name)
+	}
+
+	return proxy
+}
+
+// writeUpstreamError writes the JSON body clients get when the gateway could
+// not obtain a response from an upstream.
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, status int, message, upstream string) {
+	body := map[string]string{"error": message, "upstream": upstream}
+	if id := httpx.RequestIDFrom(r.Context()); id != "" {
+		body["request_id"] = id
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
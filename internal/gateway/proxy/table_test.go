@@ -0,0 +1,311 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
+)
+
+// echoUpstream replies with its name and the path it received.
+func echoUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func writeRoutes(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, h http.Handler, path, token string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestTableRoutesRewritesAndReloads(t *testing.T) {
+	a, b := echoUpstream(t, "a"), echoUpstream(t, "b")
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRoutes(t, path, fmt.Sprintf(`
+upstreams: { a: { url: %q }, b: { url: %q } }
+routes:
+  - { prefix: /things, upstream: a, public: true }
+  - { prefix: /shipments, upstream: b, public: true, rewrite: { add_prefix: /api/v1 } }
+  - { prefix: /legacy, upstream: b, public: true, rewrite: { strip_prefix: /legacy } }
+`, a.URL, b.URL))
+
+	table, err := NewTable(path, Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	t.Cleanup(table.Close)
+	cases := []struct{ path, want string }{
+		{"/things/1", "a /things/1"},
+		{"/shipments/42", "b /api/v1/shipments/42"},
+		{"/legacy/x", "b /x"},
+	}
+	for _, c := range cases {
+		if code, body := get(t, table, c.path, ""); code != http.StatusOK || body != c.want {
+			t.Errorf("GET %s = %d %q, want %q", c.path, code, body, c.want)
+		}
+	}
+	if code, _ := get(t, table, "/thingsx", ""); code != http.StatusNotFound {
+		t.Errorf("GET /thingsx = %d, want 404", code)
+	}
+
+	// A broken file is rejected and the old routes stay live.
+	writeRoutes(t, path, "routes: []\n")
+	if err := table.Reload(); err == nil {
+		t.Fatal("Reload accepted an empty route list")
+	}
+	if code, _ := get(t, table, "/things/1", ""); code != http.StatusOK {
+		t.Errorf("routes lost after failed reload: %d", code)
+	}
+
+	// A valid file replaces them.
+	writeRoutes(t, path, fmt.Sprintf("upstreams: { b: { url: %q } }\nroutes:\n  - { prefix: /things, upstream: b, public: true }\n", b.URL))
+	if err := table.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, body := get(t, table, "/things/1", ""); body != "b /things/1" {
+		t.Errorf("after reload body = %q", body)
+	}
+}
+
+func TestTableEnforcesRolesAndRateLimit(t *testing.T) {
+	a := echoUpstream(t, "a")
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRoutes(t, path, fmt.Sprintf(`
+upstreams: { a: { url: %q } }
+routes:
+  - { prefix: /admin-only, upstream: a, roles: [admin] }
+  - { prefix: /limited, upstream: a, public: true, rate_limit: { rps: 1, burst: 1 } }
+  - { prefix: /per-user, upstream: a, rate_limit: { rps: 1, burst: 1 } }
+`, a.URL))
+	tokens := auth.NewManager("test-secret", time.Hour)
+	table, err := NewTable(path, Options{Auth: tokens, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	t.Cleanup(table.Close)
+
+	admin, _ := tokens.GenerateToken("root", auth.RoleAdmin, "")
+	viewer, _ := tokens.GenerateToken("bob", auth.RoleViewer, "")
+	if code, _ := get(t, table, "/admin-only", ""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous = %d, want 401", code)
+	}
+	if code, _ := get(t, table, "/admin-only", viewer); code != http.StatusForbidden {
+		t.Errorf("viewer = %d, want 403", code)
+	}
+	if code, _ := get(t, table, "/admin-only", admin); code != http.StatusOK {
+		t.Errorf("admin = %d, want 200", code)
+	}
+
+	if code, _ := get(t, table, "/limited", ""); code != http.StatusOK {
+		t.Errorf("first limited request = %d, want 200", code)
+	}
+	if code, _ := get(t, table, "/limited", ""); code != http.StatusTooManyRequests {
+		t.Errorf("second limited request = %d, want 429", code)
+	}
+
+	// Authenticated routes limit each caller separately, even from one IP.
+	if code, _ := get(t, table, "/per-user", viewer); code != http.StatusOK {
+		t.Errorf("first per-user request = %d, want 200", code)
+	}
+	if code, _ := get(t, table, "/per-user", viewer); code != http.StatusTooManyRequests {
+		t.Errorf("second per-user request = %d, want 429", code)
+	}
+	if code, _ := get(t, table, "/per-user", admin); code != http.StatusOK {
+		t.Errorf("other caller = %d, want 200", code)
+	}
+}
+
+func TestTableAuthenticatesAndForwardsIdentity(t *testing.T) {
+	var seen http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+	}))
+	t.Cleanup(upstream.Close)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRoutes(t, path, fmt.Sprintf(`
+upstreams: { a: { url: %q, health_check: { disabled: true } } }
+routes:
+  - { prefix: /private, upstream: a }
+  - { prefix: /open, upstream: a, public: true }
+`, upstream.URL))
+	tokens := auth.NewManager("test-secret", time.Hour)
+	table, err := NewTable(path, Options{Auth: tokens, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	t.Cleanup(table.Close)
+	handler := httpx.RequestID(table)
+
+	forged := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(auth.HeaderUser, "mallory")
+		req.Header.Set(auth.HeaderRole, auth.RoleAdmin)
+		req.Header.Set(httpx.RequestIDHeader, "req-123")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	seen = nil
+	if rec := forged("/private", ""); rec.Code != http.StatusUnauthorized || seen != nil {
+		t.Fatalf("unauthenticated request = %d, reached upstream: %v", rec.Code, seen != nil)
+	}
+
+	token, _ := tokens.GenerateToken("alice", auth.RoleOperator, "t1")
+	if rec := forged("/private", token); rec.Code != http.StatusOK {
+		t.Fatalf("authenticated request = %d", rec.Code)
+	}
+	if seen.Get(auth.HeaderUser) != "alice" || seen.Get(auth.HeaderRole) != auth.RoleOperator || seen.Get(auth.HeaderTenant) != "t1" {
+		t.Errorf("identity headers = %q %q %q", seen.Get(auth.HeaderUser), seen.Get(auth.HeaderRole), seen.Get(auth.HeaderTenant))
+	}
+	if seen.Get(httpx.RequestIDHeader) != "req-123" {
+		t.Errorf("request id = %q, want req-123", seen.Get(httpx.RequestIDHeader))
+	}
+
+	if rec := forged("/open", ""); rec.Code != http.StatusOK {
+		t.Fatalf("public request = %d", rec.Code)
+	}
+	if seen.Get(auth.HeaderUser) != "" || seen.Get(auth.HeaderRole) != "" {
+		t.Errorf("client identity headers reached upstream: %q %q", seen.Get(auth.HeaderUser), seen.Get(auth.HeaderRole))
+	}
+}
+
+// staticKeys accepts one API key as a viewer.
+type staticKeys struct{ key string }
+
+func (k staticKeys) ValidateAPIKey(ctx context.Context, key string) (*auth.Claims, error) {
+	if key != k.key {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	return &auth.Claims{Subject: "apikey:scanner", Role: auth.RoleViewer, Permissions: []string{auth.PermInventoryRead}}, nil
+}
+
+func TestTableForwardsAPIKeyCallersAsTokens(t *testing.T) {
+	// The backend shares the signing secret but, like the services, has no
+	// API key validator of its own.
+	backend := auth.NewManager("test-secret", time.Hour)
+	var seen http.Header
+	upstream := httptest.NewServer(backend.Middleware(auth.RequirePermission(auth.PermInventoryRead)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r.Header.Clone()
+			claims, _ := auth.ClaimsFromContext(r.Context())
+			fmt.Fprint(w, claims.Subject)
+		}))))
+	t.Cleanup(upstream.Close)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRoutes(t, path, fmt.Sprintf(`
+upstreams: { a: { url: %q, health_check: { disabled: true } } }
+routes:
+  - { prefix: /inventory, upstream: a }
+`, upstream.URL))
+	tokens := auth.NewManager("test-secret", time.Hour)
+	tokens.SetAPIKeyValidator(staticKeys{key: "fsc_scanner"})
+	table, err := NewTable(path, Options{Auth: tokens, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	t.Cleanup(table.Close)
+
+	req := httptest.NewRequest(http.MethodGet, "/inventory", nil)
+	req.Header.Set(auth.APIKeyHeader, "fsc_scanner")
+	rec := httptest.NewRecorder()
+	table.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "apikey:scanner" {
+		t.Fatalf("API key request = %d %q, want 200 from the backend", rec.Code, rec.Body)
+	}
+	if seen.Get(auth.APIKeyHeader) != "" {
+		t.Error("the API key reached the backend")
+	}
+}
+
+func TestTablePropagatesTraceContext(t *testing.T) {
+	var seen string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(tracing.TraceparentHeader)
+	}))
+	t.Cleanup(upstream.Close)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRoutes(t, path, fmt.Sprintf(`
+upstreams: { a: { url: %q, health_check: { disabled: true } } }
+routes:
+  - { prefix: /open, upstream: a, public: true }
+`, upstream.URL))
+	// No exporter: the gateway still joins the caller's trace and forwards it.
+	tracer := tracing.New(tracing.Config{})
+	table, err := NewTable(path, Options{Tracer: tracer, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	t.Cleanup(table.Close)
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/open", nil)
+	req.Header.Set(tracing.TraceparentHeader, incoming)
+	tracing.Middleware(tracer)(table).ServeHTTP(httptest.NewRecorder(), req)
+
+	sc, ok := tracing.ParseTraceparent(seen)
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !sc.Sampled() {
+		t.Fatalf("upstream traceparent = %q, want the caller's sampled trace", seen)
+	}
+	if seen == incoming {
+		t.Error("upstream got the caller's span ID rather than the gateway's")
+	}
+}
+
+func TestTableLabelsMetricsByRoutePrefix(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(upstream.Close)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRoutes(t, path, fmt.Sprintf(`
+upstreams: { a: { url: %q, health_check: { disabled: true } } }
+routes:
+  - { prefix: /open, upstream: a, public: true }
+`, upstream.URL))
+	table, err := NewTable(path, Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	t.Cleanup(table.Close)
+
+	collector := metrics.NewCollector()
+	collector.Instrument(table).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/open/items/1", nil))
+
+	rec := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `http_server_requests_total{method="GET",route="/open",status="200"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("metrics missing %s:\n%s", want, rec.Body.String())
+	}
+}
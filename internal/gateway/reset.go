@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// errInvalidResetToken is returned for unknown, used or expired reset tokens.
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// hashToken returns the hex SHA-256 digest stored in place of a random
+// single-use secret (reset tokens, recovery codes).
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newResetToken returns a random URL-safe token.
+func newResetToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// resetLink appends the token to the configured reset page URL.
+func (a *Auth) resetLink(token string) string {
+	u, err := url.Parse(a.cfg.ResetURL)
+	if err != nil {
+		return a.cfg.ResetURL + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// startPasswordReset issues a reset token for the user and emails the link.
+// Earlier unused tokens for the same user are discarded so only the newest
+// link works.
+func (a *Auth) startPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := newResetToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record := &models.PasswordResetToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(a.cfg.ResetTokenTTL),
+		CreatedAt: now,
+	}
+	err = a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return fmt.Errorf("store reset token: %w", err)
+	}
+	return a.cfg.Mailer.Send(ctx, Message{
+		To:      user.Email,
+		Subject: "Reset your Food Supply Chain password",
+		Body: fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account. "+
+			"Use the link below within %s to choose a new password:\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n",
+			user.Username, a.cfg.ResetTokenTTL, a.resetLink(token)),
+	})
+}
+
+// completePasswordReset consumes a reset token and sets the new password. The
+// token is claimed with a conditional update so concurrent use of the same
+// token succeeds at most once.
+func (a *Auth) completePasswordReset(ctx context.Context, token, password string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var record models.PasswordResetToken
+		if err := tx.First(&record, "token_hash = ?", hashToken(token)).Error; err != nil {
+			return errInvalidResetToken
+		}
+		if record.UsedAt != nil || !now.Before(record.ExpiresAt) {
+			return errInvalidResetToken
+		}
+		claimed := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", record.ID).
+			UpdateColumn("used_at", now)
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected != 1 {
+			return errInvalidResetToken
+		}
+
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", record.UserID).Updates(map[string]interface{}{
+			"password_hash": hash,
+			"failed_logins": 0,
+			"locked_until":  nil,
+			"updated_at":    now,
+		}).Error
+	})
+}
+
+// handleForgotPassword starts a reset for the account matching the supplied
+// email or username. It always answers 202 so the endpoint cannot be used to
+// discover which accounts exist, and the email is sent in the background so
+// response timing does not reveal it either.
+func (a *Auth) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	email, username := strings.TrimSpace(body.Email), strings.TrimSpace(body.Username)
+	if email == "" && username == "" {
+		writeJSON(w, http.StatusBadRequest, errBody("email or username is required"))
+		return
+	}
+
+	var user models.User
+	query := a.db.WithContext(r.Context())
+	if email != "" {
+		query = query.Where("LOWER(email) = ?", strings.ToLower(email))
+	} else {
+		query = query.Where("username = ?", username)
+	}
+	if err := query.First(&user).Error; err == nil && !user.Disabled && user.Email != "" {
+		go func(user models.User) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := a.startPasswordReset(ctx, &user); err != nil {
+				a.cfg.Logger.LogAttrs(ctx, slog.LevelError, "password_reset_failed",
+					slog.String("user_id", user.ID), slog.String("error", err.Error()))
+			}
+		}(user)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status": "if an account matches, a reset link has been sent",
+	})
+}
+
+// handleResetPassword sets a new password using an emailed reset token.
+func (a *Auth) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if len(body.Password) < minPasswordLength {
+		writeJSON(w, http.StatusBadRequest, errBody("password must be at least 6 characters"))
+		return
+	}
+	if err := a.completePasswordReset(r.Context(), body.Token, body.Password); err != nil {
+		if errors.Is(err, errInvalidResetToken) {
+			writeJSON(w, http.StatusBadRequest, errBody(err.Error()))
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
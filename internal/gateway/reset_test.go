@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// captureMailer hands sent messages to the test.
+type captureMailer struct{ sent chan Message }
+
+func (m *captureMailer) Send(_ context.Context, msg Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// forgot requests a reset for the username and returns the emailed token.
+func forgot(t *testing.T, router http.Handler, mail *captureMailer, username string) string {
+	t.Helper()
+	if rec := serve(router, http.MethodPost, "/auth/forgot", "", `{"username":"`+username+`"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("forgot = %d: %s", rec.Code, rec.Body)
+	}
+	select {
+	case msg := <-mail.sent:
+		link := regexp.MustCompile(`https?://\S+`).FindString(msg.Body)
+		u, err := url.Parse(link)
+		if err != nil || u.Query().Get("token") == "" {
+			t.Fatalf("no reset link in %q", msg.Body)
+		}
+		return u.Query().Get("token")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset email sent")
+		return ""
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	mail := &captureMailer{sent: make(chan Message, 4)}
+	a, router := newTestAuth(t, Config{Mailer: mail, ResetURL: "https://app.example.com/reset"})
+	mustCreateUser(t, a, "alice", auth.RoleViewer, "")
+
+	// Unknown accounts get the same answer and no email.
+	if rec := serve(router, http.MethodPost, "/auth/forgot", "", `{"username":"nobody"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("forgot unknown = %d, want 202", rec.Code)
+	}
+
+	token := forgot(t, router, mail, "alice")
+	if rec := serve(router, http.MethodPost, "/auth/reset", "", `{"token":"`+token+`","password":"new-password"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("reset = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(router, http.MethodPost, "/auth/login", "", `{"username":"alice","password":"new-password"}`); rec.Code != http.StatusOK {
+		t.Errorf("login with the new password = %d", rec.Code)
+	}
+
+	// A token works once.
+	if rec := serve(router, http.MethodPost, "/auth/reset", "", `{"token":"`+token+`","password":"another-one"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("reusing a token = %d, want 400", rec.Code)
+	}
+
+	// A newer request invalidates the older link.
+	older := forgot(t, router, mail, "alice")
+	newer := forgot(t, router, mail, "alice")
+	if rec := serve(router, http.MethodPost, "/auth/reset", "", `{"token":"`+older+`","password":"another-one"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("superseded token = %d, want 400", rec.Code)
+	}
+
+	// An expired token is refused.
+	if err := a.db.Model(&models.PasswordResetToken{}).Where("token_hash = ?", hashToken(newer)).
+		UpdateColumn("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(router, http.MethodPost, "/auth/reset", "", `{"token":"`+newer+`","password":"another-one"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expired token = %d, want 400", rec.Code)
+	}
+	if rec := serve(router, http.MethodPost, "/auth/login", "", `{"username":"alice","password":"new-password"}`); rec.Code != http.StatusOK {
+		t.Errorf("password changed by a refused token (login = %d)", rec.Code)
+	}
+}
@@ -0,0 +1,329 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// errUnknownRole is returned when a role name does not resolve for a tenant.
+var errUnknownRole = errors.New("unknown role")
+
+// builtinRoleNames lists the global roles seeded on startup, most privileged first.
+var builtinRoleNames = []string{auth.RoleAdmin, auth.RoleManager, auth.RoleOperator, auth.RoleViewer}
+
+// seedBuiltinRoles makes sure the four built-in roles exist as global roles
+// with their default permissions.
+func (a *Auth) seedBuiltinRoles() error {
+	for _, name := range builtinRoleNames {
+		var count int64
+		a.db.Model(&models.Role{}).Where("tenant_id = ? AND name = ?", "", name).Count(&count)
+		if count > 0 {
+			continue
+		}
+		now := time.Now()
+		role := &models.Role{
+			ID:          uuid.New().String(),
+			Name:        name,
+			Description: "Built-in " + name + " role",
+			Builtin:     true,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		for _, p := range auth.DefaultPermissions(name) {
+			role.Permissions = append(role.Permissions, models.RolePermission{RoleID: role.ID, Permission: p})
+		}
+		if err := a.db.Create(role).Error; err != nil {
+			return fmt.Errorf("auth: seed role %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// findRole resolves a role name as seen by a tenant: the tenant's own custom
+// role when one exists, otherwise the global role of that name.
+func (a *Auth) findRole(ctx context.Context, tenantID, name string) (*models.Role, error) {
+	var role models.Role
+	err := a.db.WithContext(ctx).Preload("Permissions").
+		Where("name = ? AND tenant_id IN ?", name, []string{tenantID, ""}).
+		Order("tenant_id desc").
+		First(&role).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errUnknownRole
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// permissionsFor returns the permissions granted by a role within a tenant. If
+// the role cannot be resolved the built-in defaults apply (nil for custom roles).
+func (a *Auth) permissionsFor(ctx context.Context, tenantID, roleName string) []string {
+	role, err := a.findRole(ctx, tenantID, roleName)
+	if err != nil {
+		return auth.DefaultPermissions(roleName)
+	}
+	return role.PermissionNames()
+}
+
+// claimsFor builds the token claims for a user, embedding the permissions and
+// location assignments resolved from the database so downstream services need
+// no lookup.
+func (a *Auth) claimsFor(ctx context.Context, user *models.User) auth.Claims {
+	return auth.Claims{
+		Subject:     user.Username,
+		Role:        user.Role,
+		TenantID:    user.TenantID,
+		Permissions: a.permissionsFor(ctx, user.TenantID, user.Role),
+		Locations:   a.locationsFor(ctx, user.ID),
+	}
+}
+
+// checkAssignable verifies that the caller may hand out the named role in the
+// tenant: the role must exist and the caller must already hold every
+// permission it grants, so nobody can escalate beyond their own privileges.
+func (a *Auth) checkAssignable(r *http.Request, tenantID, roleName string) (int, string) {
+	role, err := a.findRole(r.Context(), tenantID, roleName)
+	if err != nil {
+		if errors.Is(err, errUnknownRole) {
+			return http.StatusBadRequest, fmt.Sprintf("unknown role %q", roleName)
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if !callerCovers(r, role.PermissionNames()) {
+		return http.StatusForbidden, "cannot assign a role with permissions you do not hold"
+	}
+	return 0, ""
+}
+
+// callerCovers reports whether the authenticated caller holds every permission.
+func callerCovers(r *http.Request, perms []string) bool {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return false
+	}
+	for _, p := range perms {
+		if !claims.HasPermission(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalisePermissions validates, de-duplicates and sorts a permission list.
+func normalisePermissions(perms []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(perms))
+	out := make([]string, 0, len(perms))
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if !auth.ValidPermission(p) {
+			return nil, fmt.Errorf("unknown permission %q", p)
+		}
+		if _, dup := seen[p]; dup {
+			continue
+		}
+		seen[p] = struct{}{}
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// roleView is the JSON shape of a role including its permissions.
+type roleView struct {
+	models.Role
+	Permissions []string `json:"permissions"`
+}
+
+func viewRole(role *models.Role) roleView {
+	return roleView{Role: *role, Permissions: role.PermissionNames()}
+}
+
+// handleListPermissions returns the catalogue of assignable permissions.
+func (a *Auth) handleListPermissions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.KnownPermissions)
+}
+
+// handleListRoles returns the global roles plus, when tenant_id is given (or
+// the caller belongs to a tenant), that tenant's custom roles.
+func (a *Auth) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.URL.Query().Get("tenant_id")
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		tenantID = claims.TenantID
+	}
+	var roles []models.Role
+	if err := a.db.WithContext(r.Context()).Preload("Permissions").
+		Where("tenant_id IN ?", []string{tenantID, ""}).
+		Order("builtin desc, name asc").
+		Find(&roles).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	views := make([]roleView, 0, len(roles))
+	for i := range roles {
+		views = append(views, viewRole(&roles[i]))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleCreateRole defines a custom role. Callers bound to a tenant can only
+// create roles in that tenant, and only with permissions they hold themselves.
+func (a *Auth) handleCreateRole(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		TenantID    string   `json:"tenant_id"`
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		body.TenantID = claims.TenantID
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		writeJSON(w, http.StatusBadRequest, errBody("name is required"))
+		return
+	}
+	if auth.IsBuiltinRole(body.Name) {
+		writeJSON(w, http.StatusConflict, errBody("cannot redefine a built-in role"))
+		return
+	}
+	perms, err := normalisePermissions(body.Permissions)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody(err.Error()))
+		return
+	}
+	if !callerCovers(r, perms) {
+		writeJSON(w, http.StatusForbidden, errBody("cannot grant permissions you do not hold"))
+		return
+	}
+
+	now := time.Now()
+	role := &models.Role{
+		ID:          uuid.New().String(),
+		TenantID:    body.TenantID,
+		Name:        body.Name,
+		Description: body.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, p := range perms {
+		role.Permissions = append(role.Permissions, models.RolePermission{RoleID: role.ID, Permission: p})
+	}
+	if err := a.db.WithContext(r.Context()).Create(role).Error; err != nil {
+		writeJSON(w, http.StatusConflict, errBody("role already exists"))
+		return
+	}
+	writeJSON(w, http.StatusCreated, viewRole(role))
+}
+
+// loadCustomRole fetches a role for modification, rejecting built-in roles and
+// roles belonging to another tenant than the caller's.
+func (a *Auth) loadCustomRole(w http.ResponseWriter, r *http.Request) (*models.Role, bool) {
+	var role models.Role
+	if err := a.db.WithContext(r.Context()).Preload("Permissions").First(&role, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, errBody("role not found"))
+			return nil, false
+		}
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return nil, false
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" && claims.TenantID != role.TenantID {
+		writeJSON(w, http.StatusNotFound, errBody("role not found"))
+		return nil, false
+	}
+	if role.Builtin {
+		writeJSON(w, http.StatusConflict, errBody("built-in roles cannot be modified"))
+		return nil, false
+	}
+	return &role, true
+}
+
+// handleUpdateRole replaces a custom role's description and permissions.
+// Tokens already issued keep their embedded permissions until refreshed.
+func (a *Auth) handleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	role, ok := a.loadCustomRole(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Description *string  `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	perms, err := normalisePermissions(body.Permissions)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody(err.Error()))
+		return
+	}
+	if !callerCovers(r, perms) {
+		writeJSON(w, http.StatusForbidden, errBody("cannot grant permissions you do not hold"))
+		return
+	}
+
+	if body.Description != nil {
+		role.Description = *body.Description
+	}
+	role.UpdatedAt = time.Now()
+	role.Permissions = role.Permissions[:0]
+	for _, p := range perms {
+		role.Permissions = append(role.Permissions, models.RolePermission{RoleID: role.ID, Permission: p})
+	}
+	err = a.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Save(role).Error
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, viewRole(role))
+}
+
+// handleDeleteRole removes a custom role that no user or API key still uses.
+func (a *Auth) handleDeleteRole(w http.ResponseWriter, r *http.Request) {
+	role, ok := a.loadCustomRole(w, r)
+	if !ok {
+		return
+	}
+	var users, keys int64
+	a.db.WithContext(r.Context()).Model(&models.User{}).Where("role = ? AND tenant_id = ?", role.Name, role.TenantID).Count(&users)
+	a.db.WithContext(r.Context()).Model(&models.APIKey{}).Where("role = ? AND tenant_id = ? AND revoked_at IS NULL", role.Name, role.TenantID).Count(&keys)
+	if users > 0 || keys > 0 {
+		writeJSON(w, http.StatusConflict, errBody("role is still assigned"))
+		return
+	}
+	err := a.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Role{}, "id = ?", role.ID).Error
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,397 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// oidcStateCookie carries the in-flight login (state, nonce and PKCE
+// verifier) between /auth/oidc/login and the callback. It is signed rather
+// than kept in memory so any gateway replica can complete the flow.
+const (
+	oidcStateCookie = "fsc_oidc"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var (
+	errOIDCState     = errors.New("sign-in session expired or invalid; start again")
+	errOIDCNoRole    = errors.New("your account is not in any group allowed to sign in")
+	errOIDCEmailUsed = errors.New("an account with this email already exists; sign in with your password and link single sign-on from your profile")
+	errOIDCLinked    = errors.New("this identity is already linked to another account")
+	errOIDCNoEmail   = errors.New("your identity provider did not supply a verified email address")
+)
+
+// oidcFlow is the signed content of the state cookie. Link is the ID of the
+// signed-in user who asked to link the identity, empty for a plain sign-in.
+type oidcFlow struct {
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	Link      string `json:"l,omitempty"`
+	ExpiresAt int64  `json:"e"`
+}
+
+func (a *Auth) sealFlow(f oidcFlow) (string, error) {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + a.tokens.MAC(payload), nil
+}
+
+func (a *Auth) openFlow(value string) (*oidcFlow, error) {
+	payload, mac, ok := strings.Cut(value, ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(mac), []byte(a.tokens.MAC(payload))) != 1 {
+		return nil, errOIDCState
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errOIDCState
+	}
+	var f oidcFlow
+	if err := json.Unmarshal(raw, &f); err != nil || time.Now().Unix() >= f.ExpiresAt {
+		return nil, errOIDCState
+	}
+	return &f, nil
+}
+
+// setFlowCookie writes (or, with an empty value, clears) the state cookie. It
+// is scoped to the callback path and sent on the top-level redirect back from
+// the provider thanks to SameSite=Lax.
+func (a *Auth) setFlowCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.cfg.OIDC.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// handleOIDCLogin starts single sign-on: it redirects the browser to the
+// provider with a fresh state, nonce and PKCE challenge.
+func (a *Auth) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if target, ok := a.startOIDCFlow(w, r, ""); ok {
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
+
+// handleOIDCLink starts linking the signed-in user's account to an identity at
+// the provider. The user confirms with their current password; the response
+// carries the authorization URL for the frontend to navigate to, since a
+// browser redirect cannot carry the bearer token.
+func (a *Auth) handleOIDCLink(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, errBody("unauthenticated"))
+		return
+	}
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	var user models.User
+	if err := a.db.WithContext(r.Context()).First(&user, "username = ?", claims.Subject).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, errBody("user not found"))
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(body.CurrentPassword)); err != nil {
+		writeJSON(w, http.StatusForbidden, errBody("current password is incorrect"))
+		return
+	}
+	if target, ok := a.startOIDCFlow(w, r, user.ID); ok {
+		writeJSON(w, http.StatusOK, map[string]string{"url": target})
+	}
+}
+
+// startOIDCFlow seals a fresh state, nonce and PKCE verifier into the state
+// cookie and returns the provider's authorization URL. On failure it writes
+// the error response and returns false.
+func (a *Auth) startOIDCFlow(w http.ResponseWriter, r *http.Request, link string) (string, bool) {
+	flow := oidcFlow{Link: link}
+	for _, p := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		v, err := randomString(32)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+			return "", false
+		}
+		*p = v
+	}
+	flow.ExpiresAt = time.Now().Add(oidcStateTTL).Unix()
+
+	target, err := a.oidc.authCodeURL(r.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		a.cfg.Logger.LogAttrs(r.Context(), slog.LevelError, "oidc_login_failed", slog.String("error", err.Error()))
+		writeJSON(w, http.StatusBadGateway, errBody("identity provider unavailable"))
+		return "", false
+	}
+	sealed, err := a.sealFlow(flow)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return "", false
+	}
+	a.setFlowCookie(w, sealed, int(oidcStateTTL/time.Second))
+	return target, true
+}
+
+// handleOIDCCallback completes single sign-on: it checks the state, redeems
+// the code with the PKCE verifier, provisions, links or updates the local user
+// and hands our own JWT to the frontend. Users with 2FA enabled get a challenge
+// token for /auth/login/2fa instead: the provider replaces the password, not
+// the account's second factor.
+func (a *Auth) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		a.oidcFail(w, r, http.StatusUnauthorized, "identity provider returned "+e)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		a.oidcFail(w, r, http.StatusBadRequest, errOIDCState.Error())
+		return
+	}
+	a.setFlowCookie(w, "", -1)
+	flow, err := a.openFlow(cookie.Value)
+	if err != nil || subtle.ConstantTimeCompare([]byte(flow.State), []byte(q.Get("state"))) != 1 {
+		a.oidcFail(w, r, http.StatusBadRequest, errOIDCState.Error())
+		return
+	}
+
+	identity, err := a.oidc.exchange(r.Context(), q.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		a.cfg.Logger.LogAttrs(r.Context(), slog.LevelWarn, "oidc_callback_failed", slog.String("error", err.Error()))
+		a.oidcFail(w, r, http.StatusUnauthorized, "single sign-on failed")
+		return
+	}
+	role := a.cfg.OIDC.roleFor(identity.Groups)
+	if role == "" {
+		a.oidcFail(w, r, http.StatusForbidden, errOIDCNoRole.Error())
+		return
+	}
+	user, err := a.provisionOIDCUser(r.Context(), identity, role, flow.Link)
+	if err != nil {
+		if errors.Is(err, errOIDCEmailUsed) || errors.Is(err, errOIDCLinked) {
+			a.oidcFail(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, errOIDCNoEmail) {
+			a.oidcFail(w, r, http.StatusForbidden, err.Error())
+			return
+		}
+		a.oidcFail(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	attempt := attemptFrom(r, user.Username)
+	if user.Disabled {
+		a.recordLogin(r.Context(), attempt, user, reasonDisabled)
+		a.oidcFail(w, r, http.StatusForbidden, "account disabled")
+		return
+	}
+	if user.TOTPEnabled {
+		token, err := a.tokens.IssuePurposeToken(auth.Claims{Subject: user.Username, Role: user.Role, TenantID: user.TenantID}, purposeMFA, a.cfg.MFAChallengeTTL)
+		if err != nil {
+			a.oidcFail(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		a.oidcSucceed(w, r, "mfa_token", token, map[string]interface{}{"mfa_required": true, "mfa_token": token})
+		return
+	}
+	a.loginSucceeded(r.Context(), attempt, user)
+
+	token, err := a.tokens.IssueToken(a.claimsFor(r.Context(), user))
+	if err != nil {
+		a.oidcFail(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.oidcSucceed(w, r, "token", token, map[string]interface{}{"token": token, "user": user})
+}
+
+// oidcSucceed hands a token to the frontend under key (in the fragment) or,
+// when no PostLoginURL is configured, answers with body as JSON.
+func (a *Auth) oidcSucceed(w http.ResponseWriter, r *http.Request, key, token string, body map[string]interface{}) {
+	if a.cfg.OIDC.PostLoginURL == "" {
+		writeJSON(w, http.StatusOK, body)
+		return
+	}
+	http.Redirect(w, r, a.cfg.OIDC.PostLoginURL+"#"+url.Values{key: {token}}.Encode(), http.StatusFound)
+}
+
+// oidcFail reports a callback error to the frontend (in the fragment) or, when
+// no PostLoginURL is configured, as JSON.
+func (a *Auth) oidcFail(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if a.cfg.OIDC.PostLoginURL == "" {
+		writeJSON(w, status, errBody(msg))
+		return
+	}
+	http.Redirect(w, r, a.cfg.OIDC.PostLoginURL+"#"+url.Values{"error": {msg}}.Encode(), http.StatusFound)
+}
+
+// provisionOIDCUser returns the local user linked to the external identity,
+// creating it just in time on first sign-in, or links the identity to the
+// user linkUserID who confirmed the link while signed in. The IdP is
+// authoritative for the role of the users it provisioned: it is re-derived
+// from group membership on every login. Linked local accounts keep their own
+// role, and are never linked by email alone.
+func (a *Auth) provisionOIDCUser(ctx context.Context, id *oidcIdentity, role, linkUserID string) (*models.User, error) {
+	var user models.User
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var link models.UserIdentity
+		err := tx.First(&link, "issuer = ? AND subject = ?", id.Issuer, id.Subject).Error
+		if err == nil {
+			// A link left behind by a deleted user counts as no link at all.
+			if err = tx.First(&user, "id = ?", link.UserID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				if err := tx.Delete(&link).Error; err != nil {
+					return err
+				}
+			}
+		}
+		switch {
+		case err == nil:
+			if linkUserID != "" && link.UserID != linkUserID {
+				return errOIDCLinked
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound) && linkUserID != "":
+			if err := tx.First(&user, "id = ?", linkUserID).Error; err != nil {
+				return err
+			}
+			link = models.UserIdentity{Issuer: id.Issuer, Subject: id.Subject, UserID: user.ID, CreatedAt: now}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := a.createOIDCUser(tx, id, role, &user); err != nil {
+				return err
+			}
+			link = models.UserIdentity{Issuer: id.Issuer, Subject: id.Subject, UserID: user.ID, Provisioned: true, CreatedAt: now}
+		default:
+			return err
+		}
+
+		link.Email, link.LastLoginAt = "", now
+		if id.EmailVerified {
+			link.Email = id.Email
+		}
+		if err := tx.Save(&link).Error; err != nil {
+			return err
+		}
+		if link.Provisioned && user.Role != role {
+			user.Role, user.UpdatedAt = role, now
+			return tx.Model(&user).UpdateColumns(map[string]interface{}{"role": role, "updated_at": now}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createOIDCUser creates the local account for a first-time SSO user, which
+// takes the email the provider verified; an unverified address is never
+// stored. An existing account with the same email is left alone: controlling
+// the address at the provider is not proof of owning the local account, which
+// may hold a password, a second factor or a privileged role.
+func (a *Auth) createOIDCUser(tx *gorm.DB, id *oidcIdentity, role string, user *models.User) error {
+	if id.Email == "" || !id.EmailVerified {
+		return errOIDCNoEmail
+	}
+	var existing int64
+	if err := tx.Model(&models.User{}).Where("LOWER(email) = ?", strings.ToLower(id.Email)).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return errOIDCEmailUsed
+	}
+
+	username := oidcUsername(id)
+	var taken int64
+	tx.Model(&models.User{}).Where("username = ?", username).Count(&taken)
+	if taken > 0 {
+		sum := sha256.Sum256([]byte(id.Issuer + "|" + id.Subject))
+		username += "-" + hex.EncodeToString(sum[:3])
+	}
+	// SSO users have no usable local password until an admin or a reset sets one.
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	*user = models.User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		Email:        id.Email,
+		PasswordHash: hash,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return tx.Create(user).Error
+}
+
+// hasExternalIdentity reports whether the user signs in through an identity
+// provider, which then owns second-factor enforcement for users who have not
+// enrolled locally. Identities are only attached at provisioning or through a
+// link confirmed by the signed-in user.
+func (a *Auth) hasExternalIdentity(ctx context.Context, userID string) bool {
+	var n int64
+	a.db.WithContext(ctx).Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&n)
+	return n > 0
+}
+
+// oidcUsername picks a local username for an external identity: the
+// preferred username, else the email, else the subject.
+func oidcUsername(id *oidcIdentity) string {
+	for _, candidate := range []string{id.PreferredUsername, id.Email, id.Subject} {
+		if c := strings.TrimSpace(candidate); len(c) >= minUsernameLength {
+			return c
+		}
+	}
+	return "sso-" + id.Subject
+}
+
+// checkOIDCRoles rejects group mappings that name a role which does not exist
+// as a global role, so a typo fails at startup rather than at first sign-in.
+func (a *Auth) checkOIDCRoles() error {
+	if a.oidc == nil {
+		return nil
+	}
+	roles := []string{a.cfg.OIDC.DefaultRole}
+	for _, m := range a.cfg.OIDC.GroupRoles {
+		roles = append(roles, m.Role)
+	}
+	for _, role := range roles {
+		if role == "" || auth.IsBuiltinRole(role) {
+			continue
+		}
+		if _, err := a.findRole(context.Background(), "", role); err != nil {
+			return fmt.Errorf("auth: oidc group mapping: unknown role %q", role)
+		}
+	}
+	return nil
+}
@@ -1,42 +1,43 @@
 package gateway
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
 )
 
-// validRoles is the set of roles an admin may assign to a user.
-var validRoles = map[string]struct{}{
-	auth.RoleAdmin:    {},
-	auth.RoleManager:  {},
-	auth.RoleOperator: {},
-	auth.RoleViewer:   {},
-}
-
-// handleListUsers returns all users (admin only). The password hash is never
+// handleListUsers returns the users the caller manages: all of them, or those
+// of the caller's tenant for a tenant-pinned caller. The password hash is never
 // serialised thanks to the json:"-" tag on the model.
 func (a *Auth) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	var users []models.User
-	if err := a.db.Order("created_at asc").Find(&users).Error; err != nil {
+	if err := a.tenantUsers(r).Order("created_at asc").Find(&users).Error; err != nil {
 		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
 		return
 	}
 	writeJSON(w, http.StatusOK, users)
 }
 
-// handleUpdateUserRole changes a user's role (admin only). It validates the
-// requested role and 404s when the user does not exist.
+// handleUpdateUserRole changes a user's role (admin only). Both the current
+// role and the new one must grant nothing the caller lacks, and the new role
+// must resolve for the user's tenant; it 404s when the user does not exist.
 func (a *Auth) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-
 	var body struct {
 		Role string `json:"role"`
 	}
@@ -44,26 +45,423 @@ func (a *Auth) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
 		return
 	}
-	if _, ok := validRoles[body.Role]; !ok {
-		writeJSON(w, http.StatusBadRequest, errBody("role must be one of admin, manager, operator, viewer"))
+	user, ok := a.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	if status, msg := a.checkAssignable(r, user.TenantID, body.Role); status != 0 {
+		writeJSON(w, status, errBody(msg))
 		return
 	}
 
+	demoted := body.Role != auth.RoleAdmin
+	user.Role = body.Role
+	user.UpdatedAt = time.Now()
+	err := a.withAdminGuard(r.Context(), user.ID, demoted, func(tx *gorm.DB) error {
+		return tx.Save(user).Error
+	})
+	if err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// errLastAdmin is returned when a change would leave no enabled admin account.
+var errLastAdmin = errors.New("cannot demote, disable or delete the last remaining admin")
+
+// withAdminGuard runs fn in a transaction. When losesAdmin is set and the user
+// is currently an enabled admin, the enabled admin rows are locked first and
+// the change is refused if no other enabled admin would remain, so two admins
+// cannot concurrently demote each other into an admin-less system.
+func (a *Auth) withAdminGuard(ctx context.Context, userID string, losesAdmin bool, fn func(tx *gorm.DB) error) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if losesAdmin {
+			var adminIDs []string
+			if err := tx.Model(&models.User{}).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("role = ? AND disabled = ?", auth.RoleAdmin, false).
+				Pluck("id", &adminIDs).Error; err != nil {
+				return err
+			}
+			for _, adminID := range adminIDs {
+				if adminID == userID && len(adminIDs) == 1 {
+					return errLastAdmin
+				}
+			}
+		}
+		return fn(tx)
+	})
+}
+
+// writeUserError maps errors from user mutations onto HTTP responses.
+func (a *Auth) writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errLastAdmin):
+		writeJSON(w, http.StatusConflict, errBody(err.Error()))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeJSON(w, http.StatusNotFound, errBody("user not found"))
+	default:
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+	}
+}
+
+// tenantUsers queries the users visible to the caller: a caller pinned to a
+// tenant only sees that tenant's users.
+func (a *Auth) tenantUsers(r *http.Request) *gorm.DB {
+	query := a.db.WithContext(r.Context()).Model(&models.User{})
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		query = query.Where("tenant_id = ?", claims.TenantID)
+	}
+	return query
+}
+
+// findUser fetches the user named by the {id} route variable among those
+// visible to the caller, writing a 404 or 500 response and returning false
+// when it cannot.
+func (a *Auth) findUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
 	var user models.User
-	if err := a.db.First(&user, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			writeJSON(w, http.StatusNotFound, errBody("user not found"))
+	if err := a.tenantUsers(r).First(&user, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		a.writeUserError(w, err)
+		return nil, false
+	}
+	return &user, true
+}
+
+// loadUser is findUser for handlers that act on the account. As with
+// checkAssignable, the caller must already hold every permission of the
+// user's role, so nobody can take over an account more privileged than
+// their own; otherwise it writes a 403.
+func (a *Auth) loadUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, ok := a.findUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !callerCovers(r, a.permissionsFor(r.Context(), user.TenantID, user.Role)) {
+		writeJSON(w, http.StatusForbidden, errBody("cannot manage a user with permissions you do not hold"))
+		return nil, false
+	}
+	return user, true
+}
+
+// generatePassword returns a random temporary password for invitations and
+// admin resets.
+func generatePassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// handleInviteUser creates an account on behalf of someone else (admin only).
+// When no password is supplied a temporary one is generated and returned once
+// in the response for the admin to pass on.
+func (a *Auth) handleInviteUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+		TenantID string `json:"tenant_id"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		body.TenantID = claims.TenantID
+	}
+	body.Username = strings.TrimSpace(body.Username)
+	if len(body.Username) < minUsernameLength {
+		writeJSON(w, http.StatusBadRequest, errBody("username must be at least 3 characters"))
+		return
+	}
+	if body.Role == "" {
+		body.Role = auth.RoleViewer
+	}
+	if status, msg := a.checkAssignable(r, body.TenantID, body.Role); status != 0 {
+		writeJSON(w, status, errBody(msg))
+		return
+	}
+
+	password, generated := body.Password, false
+	if password == "" {
+		var err error
+		if password, err = generatePassword(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+			return
+		}
+		generated = true
+	} else if len(password) < minPasswordLength {
+		writeJSON(w, http.StatusBadRequest, errBody("password must be at least 6 characters"))
+		return
+	}
+
+	user, err := a.createUser(body.Username, body.Email, password, body.Role, body.TenantID)
+	if err != nil {
+		writeJSON(w, http.StatusConflict, errBody(err.Error()))
+		return
+	}
+	resp := map[string]interface{}{"user": user}
+	if generated {
+		resp["temporary_password"] = password
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleSetUserDisabled returns a handler that disables or re-enables an
+// account (admin only). Disabled users cannot log in or refresh tokens; tokens
+// already issued remain valid until they expire.
+func (a *Auth) handleSetUserDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := a.loadUser(w, r)
+		if !ok {
+			return
+		}
+		user.Disabled = disabled
+		user.UpdatedAt = time.Now()
+		err := a.withAdminGuard(r.Context(), user.ID, disabled, func(tx *gorm.DB) error {
+			return tx.Save(user).Error
+		})
+		if err != nil {
+			a.writeUserError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+// handleDeleteUser removes an account with its location assignments, SSO
+// links, recovery codes and reset tokens (admin only). Login events are kept
+// for the audit trail.
+func (a *Auth) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.loadUser(w, r)
+	if !ok {
+		return
+	}
+	err := a.withAdminGuard(r.Context(), user.ID, true, func(tx *gorm.DB) error {
+		for _, owned := range []interface{}{&models.UserLocation{}, &models.UserIdentity{}, &models.RecoveryCode{}, &models.PasswordResetToken{}} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(owned).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.User{}, "id = ?", user.ID).Error
+	})
+	if err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResetUserPassword sets a new password for a user (admin only), also
+// clearing any lockout. Without a password in the body a temporary one is
+// generated and returned once.
+func (a *Auth) handleResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Password string `json:"password"`
+	}
+	// An empty body is allowed and means "generate one".
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	user, ok := a.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	password, generated := body.Password, false
+	if password == "" {
+		var err error
+		if password, err = generatePassword(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
 			return
 		}
+		generated = true
+	} else if len(password) < minPasswordLength {
+		writeJSON(w, http.StatusBadRequest, errBody("password must be at least 6 characters"))
+		return
+	}
+
+	if err := a.setPassword(r.Context(), user, password); err != nil {
 		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
 		return
 	}
+	resp := map[string]interface{}{"user": user}
+	if generated {
+		resp["temporary_password"] = password
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	user.Role = body.Role
+// handleChangeOwnPassword lets an authenticated user change their password
+// after re-confirming the current one.
+func (a *Auth) handleChangeOwnPassword(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, errBody("unauthenticated"))
+		return
+	}
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	if len(body.NewPassword) < minPasswordLength {
+		writeJSON(w, http.StatusBadRequest, errBody("password must be at least 6 characters"))
+		return
+	}
+
+	var user models.User
+	if err := a.db.WithContext(r.Context()).First(&user, "username = ?", claims.Subject).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, errBody("user not found"))
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(body.CurrentPassword)); err != nil {
+		writeJSON(w, http.StatusForbidden, errBody("current password is incorrect"))
+		return
+	}
+	if err := a.setPassword(r.Context(), &user, body.NewPassword); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setPassword stores a new password hash for the user and clears any lockout.
+func (a *Auth) setPassword(ctx context.Context, user *models.User, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	user.FailedLogins = 0
+	user.LockedUntil = nil
 	user.UpdatedAt = time.Now()
-	if err := a.db.Save(&user).Error; err != nil {
+	return a.db.WithContext(ctx).Save(user).Error
+}
+
+// locationsFor returns the IDs of the locations assigned to a user, or nil when
+// the user is not restricted to particular locations.
+func (a *Auth) locationsFor(ctx context.Context, userID string) []string {
+	var ids []string
+	a.db.WithContext(ctx).Model(&models.UserLocation{}).
+		Where("user_id = ?", userID).
+		Order("location_id asc").
+		Pluck("location_id", &ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
+
+// handleGetUserLocations lists a user's assigned location IDs (admin only).
+func (a *Auth) handleGetUserLocations(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findUser(w, r)
+	if !ok {
+		return
+	}
+	ids := a.locationsFor(r.Context(), user.ID)
+	if ids == nil {
+		ids = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": user.ID, "location_ids": ids})
+}
+
+// handleSetUserLocations replaces a user's location assignments (admin only).
+// An empty list leaves holders of locations:all unrestricted and everyone else
+// with no location at all. Every ID must name an existing location the caller
+// can reach. The change applies to tokens issued from now on, i.e. at the
+// user's next login or refresh.
+func (a *Auth) handleSetUserLocations(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		LocationIDs []string `json:"location_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errBody("invalid request body"))
+		return
+	}
+	user, ok := a.loadUser(w, r)
+	if !ok {
+		return
+	}
+	id := user.ID
+	ids, status, msg := a.assignableLocations(r, body.LocationIDs)
+	if status != 0 {
+		writeJSON(w, status, errBody(msg))
+		return
+	}
+
+	now := time.Now()
+	assignments := make([]models.UserLocation, 0, len(ids))
+	for _, loc := range ids {
+		assignments = append(assignments, models.UserLocation{UserID: id, LocationID: loc, CreatedAt: now})
+	}
+
+	err := a.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&models.UserLocation{}).Error; err != nil {
+			return err
+		}
+		if len(assignments) == 0 {
+			return nil
+		}
+		return tx.Create(&assignments).Error
+	})
+	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, errBody(err.Error()))
 		return
 	}
-	writeJSON(w, http.StatusOK, user)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": id, "location_ids": ids})
+}
+
+// assignableLocations cleans up requested location IDs (trimmed, without
+// blanks or duplicates) and checks that the caller may hand each one out: it
+// must lie within the caller's own locations and exist. On failure it returns
+// the status and message to answer with.
+func (a *Auth) assignableLocations(r *http.Request, requested []string) ([]string, int, string) {
+	seen := make(map[string]struct{}, len(requested))
+	ids := make([]string, 0, len(requested))
+	for _, loc := range requested {
+		loc = strings.TrimSpace(loc)
+		if loc == "" {
+			continue
+		}
+		if _, dup := seen[loc]; dup {
+			continue
+		}
+		seen[loc] = struct{}{}
+		if !auth.InLocationScope(r.Context(), loc) {
+			return nil, http.StatusForbidden, "cannot assign location " + loc + " outside your own locations"
+		}
+		ids = append(ids, loc)
+	}
+	if status, msg := a.checkLocationsExist(r.Context(), ids); status != 0 {
+		return nil, status, msg
+	}
+	return ids, 0, ""
+}
+
+// checkLocationsExist verifies that every ID names a location. The locations
+// table belongs to the inventory service, which shares the gateway's
+// database.
+func (a *Auth) checkLocationsExist(ctx context.Context, ids []string) (int, string) {
+	if len(ids) == 0 {
+		return 0, ""
+	}
+	var found []string
+	if err := a.db.WithContext(ctx).Model(&models.Location{}).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	for _, id := range ids {
+		if !slices.Contains(found, id) {
+			return http.StatusBadRequest, fmt.Sprintf("unknown location %q", id)
+		}
+	}
+	return 0, ""
 }
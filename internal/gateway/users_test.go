@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// newTestAuth returns an Auth backed by a private in-memory SQLite database
+// with the built-in roles seeded, and a router serving its routes.
+func newTestAuth(t *testing.T, cfg Config) (*Auth, *mux.Router) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One connection keeps every query on the same in-memory database.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.UserLocation{}, &models.UserIdentity{},
+		&models.Role{}, &models.RolePermission{}, &models.APIKey{}, &models.APIKeyLocation{}, &models.LoginEvent{},
+		&models.PasswordResetToken{}, &models.RecoveryCode{}, &models.Location{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := auth.NewManager("test-secret", time.Hour)
+	a := &Auth{db: db, tokens: tokens, cfg: cfg.withDefaults()}
+	if a.cfg.OIDC != nil {
+		a.oidc = newOIDCClient(*a.cfg.OIDC)
+	}
+	tokens.SetAPIKeyValidator(a)
+	if err := a.seedBuiltinRoles(); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	a.RegisterRoutes(router, nil)
+	return a, router
+}
+
+// mustCreateUser creates a user with the password "password1".
+func mustCreateUser(t *testing.T, a *Auth, username, role, tenantID string) *models.User {
+	t.Helper()
+	user, err := a.createUser(username, username+"@example.com", "password1", role, tenantID)
+	if err != nil {
+		t.Fatalf("createUser %s: %v", username, err)
+	}
+	return user
+}
+
+// mustCreateRole creates a tenant role granting perms.
+func mustCreateRole(t *testing.T, a *Auth, tenantID, name string, perms ...string) {
+	t.Helper()
+	role := &models.Role{ID: tenantID + "-" + name, TenantID: tenantID, Name: name}
+	for _, p := range perms {
+		role.Permissions = append(role.Permissions, models.RolePermission{RoleID: role.ID, Permission: p})
+	}
+	if err := a.db.Create(role).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tokenFor issues an access token carrying the user's current claims.
+func tokenFor(t *testing.T, a *Auth, user *models.User) string {
+	t.Helper()
+	token, err := a.tokens.IssueToken(a.claimsFor(context.Background(), user))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serve sends a request with an optional bearer token and JSON body.
+func serve(router http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUserAdministrationIsTenantScoped(t *testing.T) {
+	a, router := newTestAuth(t, Config{})
+	mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	mustCreateRole(t, a, "acme", "people", auth.PermUsersManage)
+	manager := mustCreateUser(t, a, "acme-hr", "people", "acme")
+	colleague := mustCreateUser(t, a, "acme-clerk", "people", "acme")
+	outsider := mustCreateUser(t, a, "globex-clerk", auth.RoleViewer, "globex")
+	token := tokenFor(t, a, manager)
+
+	if rec := serve(router, http.MethodPost, "/users/"+outsider.ID+"/password", token, "{}"); rec.Code != http.StatusNotFound {
+		t.Errorf("cross-tenant password reset = %d, want 404", rec.Code)
+	}
+	for _, path := range []string{"/disable", "/unlock"} {
+		if rec := serve(router, http.MethodPost, "/users/"+outsider.ID+path, token, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("cross-tenant %s = %d, want 404", path, rec.Code)
+		}
+	}
+	if rec := serve(router, http.MethodDelete, "/users/"+outsider.ID, token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("cross-tenant delete = %d, want 404", rec.Code)
+	}
+	if rec := serve(router, http.MethodPost, "/users/"+colleague.ID+"/password", token, "{}"); rec.Code != http.StatusOK {
+		t.Errorf("same-tenant password reset = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	rec := serve(router, http.MethodGet, "/users", token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list users = %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "root") || strings.Contains(body, "globex") {
+		t.Errorf("tenant listing leaks other users: %s", body)
+	}
+}
+
+func TestUserAdministrationRequiresCoveringPermissions(t *testing.T) {
+	a, router := newTestAuth(t, Config{})
+	admin := mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	mustCreateRole(t, a, "", "people", auth.PermUsersManage)
+	manager := mustCreateUser(t, a, "hr", "people", "")
+	token := tokenFor(t, a, manager)
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/users/" + admin.ID + "/password", "{}"},
+		{http.MethodPost, "/users/" + admin.ID + "/disable", ""},
+		{http.MethodPatch, "/users/" + admin.ID, `{"role":"people"}`},
+		{http.MethodDelete, "/users/" + admin.ID, ""},
+	} {
+		if rec := serve(router, tc.method, tc.path, token, tc.body); rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s by manager = %d, want 403", tc.method, tc.path, rec.Code)
+		}
+	}
+	var stored models.User
+	if err := a.db.First(&stored, "id = ?", admin.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.PasswordHash != admin.PasswordHash || stored.Disabled || stored.Role != auth.RoleAdmin {
+		t.Errorf("admin account changed: %+v", stored)
+	}
+
+	// The admin, holding every permission, may manage the manager.
+	if rec := serve(router, http.MethodPost, "/users/"+manager.ID+"/password", tokenFor(t, a, admin), "{}"); rec.Code != http.StatusOK {
+		t.Errorf("admin resetting manager = %d, want 200: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSetUserLocations(t *testing.T) {
+	a, router := newTestAuth(t, Config{})
+	for _, id := range []string{"wh-a", "wh-b"} {
+		if err := a.db.Create(&models.Location{ID: id, Name: id, Type: "warehouse"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin := mustCreateUser(t, a, "root", auth.RoleAdmin, "")
+	operator := mustCreateUser(t, a, "op", auth.RoleOperator, "acme")
+	outsider := mustCreateUser(t, a, "globex-op", auth.RoleOperator, "globex")
+	token := tokenFor(t, a, admin)
+
+	if rec := serve(router, http.MethodPut, "/users/"+operator.ID+"/locations", token, `{"location_ids":["wh-a","wh-x"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown location = %d, want 400", rec.Code)
+	}
+	if rec := serve(router, http.MethodPut, "/users/"+operator.ID+"/locations", token, `{"location_ids":[" wh-a ","wh-a"]}`); rec.Code != http.StatusOK {
+		t.Fatalf("set locations = %d: %s", rec.Code, rec.Body)
+	}
+	if got := a.locationsFor(context.Background(), operator.ID); len(got) != 1 || got[0] != "wh-a" {
+		t.Errorf("locations = %v, want [wh-a]", got)
+	}
+
+	// A tenant user manager confined to wh-a can't reach other tenants or
+	// hand out locations beyond their own.
+	mustCreateRole(t, a, "acme", "supervisor", auth.PermUsersManage, "inventory:*", "shipment:*")
+	supervisor := mustCreateUser(t, a, "acme-lead", "supervisor", "acme")
+	if err := a.db.Create(&models.UserLocation{UserID: supervisor.ID, LocationID: "wh-a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	token = tokenFor(t, a, supervisor)
+	if rec := serve(router, http.MethodPut, "/users/"+outsider.ID+"/locations", token, `{"location_ids":["wh-a"]}`); rec.Code != http.StatusNotFound {
+		t.Errorf("cross-tenant set locations = %d, want 404", rec.Code)
+	}
+	if rec := serve(router, http.MethodPut, "/users/"+operator.ID+"/locations", token, `{"location_ids":["wh-b"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("assigning a location outside the caller's = %d, want 403", rec.Code)
+	}
+	if rec := serve(router, http.MethodPut, "/users/"+operator.ID+"/locations", token, `{"location_ids":[]}`); rec.Code != http.StatusOK {
+		t.Errorf("clearing locations = %d, want 200", rec.Code)
+	}
+	// Without assignments the operator reaches no location.
+	claims := a.claimsFor(context.Background(), operator)
+	if claims.Unrestricted() || claims.CanAccessLocation("wh-a") {
+		t.Errorf("unassigned operator claims %+v should reach no location", claims)
+	}
+}
@@ -10,11 +10,16 @@ import (
 
 	"github.com/gorilla/mux"
 
-	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/config"
 	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/service"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/health"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/replica"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
 )
 
 // InventoryService is the behaviour the HTTP layer requires from the service.
@@ -33,20 +38,28 @@ type InventoryService interface {
 	ListLocations(ctx context.Context) ([]models.Location, error)
 	CreateLocation(ctx context.Context, location *models.Location) error
 	DeleteLocation(ctx context.Context, id string) error
+
+	Summary(ctx context.Context) (*models.InventorySummary, error)
 }
 
 // Server exposes the inventory service over HTTP.
 type Server struct {
 	config  *config.Config
 	service InventoryService
+	auth    *auth.Manager
 	router  *mux.Router
 	logger  *slog.Logger
 	metrics *metrics.Collector
+	health  *health.Checker
+	tracer  *tracing.Tracer
 }
 
-// NewServer wires the routes and returns a ready-to-serve Server. A nil logger
-// falls back to the slog default so tests can construct a server without setup.
-func NewServer(cfg *config.Config, svc InventoryService, logger *slog.Logger) *Server {
+// NewServer wires the routes and returns a ready-to-serve Server. When the
+// configured JWT secret is non-empty the inventory, product and location routes
+// require authentication, and callers assigned to locations are restricted to
+// them. A nil logger falls back to the slog default so tests can construct a
+// server without setup; a nil tracer disables request spans.
+func NewServer(cfg *config.Config, svc InventoryService, logger *slog.Logger, tracer *tracing.Tracer) *Server {
 	if logger == nil {
 		logger = slog.Default()
 	}
@@ -56,11 +69,52 @@ func NewServer(cfg *config.Config, svc InventoryService, logger *slog.Logger) *S
 		router:  mux.NewRouter(),
 		logger:  logger,
 		metrics: metrics.NewCollector(),
+		health:  health.NewChecker(0),
+		tracer:  tracer,
+	}
+	if cfg != nil {
+		s.metrics = metrics.NewCollectorWith(metrics.CollectorConfig{Buckets: cfg.Metrics.Buckets})
+	}
+	if cfg != nil && cfg.Auth.JWTSecret != "" {
+		s.auth = auth.NewManager(cfg.Auth.JWTSecret, cfg.Auth.TokenExpiry)
 	}
 	s.setupRoutes()
 	return s
 }
 
+// Health returns the readiness checker served at /readyz, for the caller to
+// register dependency checks on.
+func (s *Server) Health() *health.Checker {
+	return s.health
+}
+
+// Metrics returns the registry rendered at /metrics after the HTTP metrics,
+// for the caller to register service metrics on.
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics.Registry()
+}
+
+// HandleLogLevel serves /admin/log-level for reading and changing level, to
+// callers holding the logging:manage permission. It is not registered when
+// authentication is disabled.
+func (s *Server) HandleLogLevel(level *slog.LevelVar) {
+	if s.auth == nil {
+		return
+	}
+	s.router.Handle("/admin/log-level", s.auth.Middleware(auth.RequirePermission(auth.PermLoggingManage)(logging.LevelHandler(level)))).
+		Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodOptions)
+}
+
+// clientIPConfig trusts the configured proxies' forwarding headers. The list
+// was validated when the configuration was loaded.
+func (s *Server) clientIPConfig() httpx.ClientIPConfig {
+	if s.config == nil {
+		return httpx.ClientIPConfig{}
+	}
+	trusted, _ := httpx.ParseTrustedProxies(s.config.Server.TrustedProxies)
+	return httpx.ClientIPConfig{TrustedProxies: trusted, Header: s.config.Server.ClientIPHeader}
+}
+
 // Router returns the configured router.
 func (s *Server) Router() *mux.Router {
 	return s.router
@@ -70,6 +124,9 @@ func (s *Server) setupRoutes() {
 	// Shared, structured middleware replaces the previous ad-hoc logging and
 	// atomic request counter.
 	s.router.Use(httpx.RequestID)
+	s.router.Use(replica.Middleware)
+	s.router.Use(httpx.ResolveClientIP(s.clientIPConfig()))
+	s.router.Use(tracing.Middleware(s.tracer))
 	s.router.Use(httpx.Logger(s.logger))
 	s.router.Use(httpx.Recoverer(s.logger))
 	s.router.Use(httpx.SecurityHeaders)
@@ -77,21 +134,42 @@ func (s *Server) setupRoutes() {
 	s.router.Use(s.corsMiddleware)
 
 	s.router.HandleFunc("/health", s.healthCheckHandler).Methods(http.MethodGet, http.MethodOptions)
+	s.router.Handle("/livez", health.LiveHandler()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.Handle("/readyz", s.health.Handler()).Methods(http.MethodGet, http.MethodOptions)
 	s.router.Handle("/metrics", s.metrics.Handler()).Methods(http.MethodGet, http.MethodOptions)
 
-	s.router.HandleFunc("/inventory", s.handleGetInventory).Methods(http.MethodGet, http.MethodOptions)
-	s.router.HandleFunc("/inventory", s.handleCreateInventory).Methods(http.MethodPost, http.MethodOptions)
-	s.router.HandleFunc("/inventory/{id}", s.handleGetInventoryItem).Methods(http.MethodGet, http.MethodOptions)
-	s.router.HandleFunc("/inventory/{id}", s.handleUpdateInventory).Methods(http.MethodPut, http.MethodOptions)
-	s.router.HandleFunc("/inventory/{id}", s.handleDeleteInventory).Methods(http.MethodDelete, http.MethodOptions)
+	// Everything below the health and metrics endpoints shares one subrouter so
+	// that authentication can be applied to it as a unit.
+	api := s.router.NewRoute().Subrouter()
+	if s.auth != nil {
+		api.Use(s.auth.Middleware)
+	}
 
-	s.router.HandleFunc("/products", s.handleGetProducts).Methods(http.MethodGet, http.MethodOptions)
-	s.router.HandleFunc("/products", s.handleCreateProduct).Methods(http.MethodPost, http.MethodOptions)
-	s.router.HandleFunc("/products/{id}", s.handleDeleteProduct).Methods(http.MethodDelete, http.MethodOptions)
+	// Each route requires its permission when authentication is enabled.
+	// Products and locations are part of the inventory catalogue.
+	api.Handle("/inventory", s.permit(auth.PermInventoryRead, s.handleGetInventory)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/inventory", s.permit(auth.PermInventoryWrite, s.handleCreateInventory)).Methods(http.MethodPost, http.MethodOptions)
+	// Registered before /inventory/{id} so "summary" is not taken for an ID.
+	api.Handle("/inventory/summary", s.permit(auth.PermInventoryRead, s.handleInventorySummary)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/inventory/{id}", s.permit(auth.PermInventoryRead, s.handleGetInventoryItem)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/inventory/{id}", s.permit(auth.PermInventoryAdjust, s.handleUpdateInventory)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/inventory/{id}", s.permit(auth.PermInventoryDelete, s.handleDeleteInventory)).Methods(http.MethodDelete, http.MethodOptions)
+
+	api.Handle("/products", s.permit(auth.PermInventoryRead, s.handleGetProducts)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/products", s.permit(auth.PermInventoryWrite, s.handleCreateProduct)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/products/{id}", s.permit(auth.PermInventoryDelete, s.handleDeleteProduct)).Methods(http.MethodDelete, http.MethodOptions)
+
+	api.Handle("/locations", s.permit(auth.PermInventoryRead, s.handleGetLocations)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/locations", s.permit(auth.PermInventoryWrite, s.handleCreateLocation)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/locations/{id}", s.permit(auth.PermInventoryDelete, s.handleDeleteLocation)).Methods(http.MethodDelete, http.MethodOptions)
+}
 
-	s.router.HandleFunc("/locations", s.handleGetLocations).Methods(http.MethodGet, http.MethodOptions)
-	s.router.HandleFunc("/locations", s.handleCreateLocation).Methods(http.MethodPost, http.MethodOptions)
-	s.router.HandleFunc("/locations/{id}", s.handleDeleteLocation).Methods(http.MethodDelete, http.MethodOptions)
+// permit requires perm for h when authentication is enabled.
+func (s *Server) permit(perm string, h http.HandlerFunc) http.Handler {
+	if s.auth == nil {
+		return h
+	}
+	return auth.RequirePermission(perm)(h)
 }
 
 // Middleware
@@ -100,7 +178,7 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+replica.Header)
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -132,6 +210,15 @@ func (s *Server) handleGetInventory(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, httpx.Page{Data: items, Total: total, Limit: limit, Offset: offset})
 }
 
+func (s *Server) handleInventorySummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.service.Summary(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, summary)
+}
+
 func (s *Server) handleCreateInventory(w http.ResponseWriter, r *http.Request) {
 	var inv models.Inventory
 	if err := json.NewDecoder(r.Body).Decode(&inv); err != nil {
@@ -139,7 +226,7 @@ func (s *Server) handleCreateInventory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.service.CreateInventory(r.Context(), &inv); err != nil {
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err, "inventory item not found")
 		return
 	}
 	s.writeJSON(w, http.StatusCreated, inv)
@@ -149,11 +236,7 @@ func (s *Server) handleGetInventoryItem(w http.ResponseWriter, r *http.Request)
 	id := mux.Vars(r)["id"]
 	item, err := s.service.GetInventory(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, service.ErrNotFound) {
-			s.writeError(w, http.StatusNotFound, "inventory item not found")
-			return
-		}
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err, "inventory item not found")
 		return
 	}
 	s.writeJSON(w, http.StatusOK, item)
@@ -169,11 +252,7 @@ func (s *Server) handleUpdateInventory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.service.UpdateInventory(r.Context(), id, body.Quantity); err != nil {
-		if errors.Is(err, service.ErrNotFound) {
-			s.writeError(w, http.StatusNotFound, "inventory item not found")
-			return
-		}
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err, "inventory item not found")
 		return
 	}
 	s.writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "quantity": body.Quantity})
@@ -182,11 +261,7 @@ func (s *Server) handleUpdateInventory(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleDeleteInventory(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	if err := s.service.DeleteInventory(r.Context(), id); err != nil {
-		if errors.Is(err, service.ErrNotFound) {
-			s.writeError(w, http.StatusNotFound, "inventory item not found")
-			return
-		}
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err, "inventory item not found")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -218,11 +293,7 @@ func (s *Server) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
 	if err := s.service.DeleteProduct(r.Context(), mux.Vars(r)["id"]); err != nil {
-		if errors.Is(err, service.ErrNotFound) {
-			s.writeError(w, http.StatusNotFound, "product not found")
-			return
-		}
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err, "product not found")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -246,7 +317,7 @@ func (s *Server) handleCreateLocation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.service.CreateLocation(r.Context(), &location); err != nil {
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err, "location not found")
 		return
 	}
 	s.writeJSON(w, http.StatusCreated, location)
@@ -254,11 +325,7 @@ func (s *Server) handleCreateLocation(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleDeleteLocation(w http.ResponseWriter, r *http.Request) {
 	if err := s.service.DeleteLocation(r.Context(), mux.Vars(r)["id"]); err != nil {
-		if errors.Is(err, service.ErrNotFound) {
-			s.writeError(w, http.StatusNotFound, "location not found")
-			return
-		}
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err, "location not found")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -266,6 +333,19 @@ func (s *Server) handleDeleteLocation(w http.ResponseWriter, r *http.Request) {
 
 // Helpers
 
+// writeServiceError maps service errors onto HTTP statuses: ErrNotFound to 404
+// with the given message, ErrForbidden to 403 and anything else to 500.
+func (s *Server) writeServiceError(w http.ResponseWriter, err error, notFound string) {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, notFound)
+	case errors.Is(err, service.ErrForbidden):
+		s.writeError(w, http.StatusForbidden, "location outside your assigned scope")
+	default:
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 func (s *Server) writeJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
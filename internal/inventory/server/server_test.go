@@ -7,9 +7,11 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/config"
 	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/service"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
 )
 
@@ -62,6 +64,9 @@ func (f *fakeInventoryService) UpdateInventory(ctx context.Context, id string, q
 	if !ok {
 		return service.ErrNotFound
 	}
+	if !auth.InLocationScope(ctx, v.LocationID) {
+		return service.ErrForbidden
+	}
 	v.Quantity = quantity
 	return nil
 }
@@ -98,8 +103,18 @@ func (f *fakeInventoryService) DeleteLocation(ctx context.Context, id string) er
 	return nil
 }
 
+func (f *fakeInventoryService) Summary(ctx context.Context) (*models.InventorySummary, error) {
+	summary := &models.InventorySummary{Items: len(f.items)}
+	for _, v := range f.items {
+		if v.Quantity <= v.MinQuantity {
+			summary.LowStock++
+		}
+	}
+	return summary, nil
+}
+
 func newTestServer(svc InventoryService) *Server {
-	return NewServer(&config.Config{}, svc, nil)
+	return NewServer(&config.Config{}, svc, nil, nil)
 }
 
 func TestListInventory(t *testing.T) {
@@ -165,6 +180,22 @@ func TestGetInventoryItemNotFound(t *testing.T) {
 	}
 }
 
+func TestInventorySummary(t *testing.T) {
+	fake := newFake()
+	fake.items["i1"] = &models.Inventory{ID: "i1", Quantity: 1, MinQuantity: 5}
+	fake.items["i2"] = &models.Inventory{ID: "i2", Quantity: 9, MinQuantity: 5}
+	srv := newTestServer(fake)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/inventory/summary", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var got models.InventorySummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Items != 2 || got.LowStock != 1 {
+		t.Fatalf("summary = %+v (%v)", got, err)
+	}
+}
+
 func TestCreateInventory(t *testing.T) {
 	fake := newFake()
 	srv := newTestServer(fake)
@@ -198,3 +229,104 @@ func TestDeleteInventory(t *testing.T) {
 		t.Fatalf("second delete status = %d, want 404", rec.Code)
 	}
 }
+
+func TestInventoryRequiresAuthWhenConfigured(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.JWTSecret = "test-secret"
+	srv := NewServer(cfg, newFake(), nil, nil)
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/inventory", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("health status = %d, want 200", rec.Code)
+	}
+}
+
+func TestUpdateInventoryOutsideLocationScope(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.JWTSecret = "test-secret"
+	fake := newFake()
+	fake.items["a"] = &models.Inventory{ID: "a", LocationID: "wh-a"}
+	fake.items["b"] = &models.Inventory{ID: "b", LocationID: "wh-b"}
+	srv := NewServer(cfg, fake, nil, nil)
+
+	token, err := auth.NewManager("test-secret", time.Hour).IssueToken(auth.Claims{
+		Subject: "op", Role: auth.RoleOperator, Locations: []string{"wh-a"},
+	})
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	update := func(id string) int {
+		req := httptest.NewRequest(http.MethodPut, "/inventory/"+id, strings.NewReader(`{"quantity":3}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := update("a"); got != http.StatusOK {
+		t.Fatalf("own location status = %d, want 200", got)
+	}
+	if got := update("b"); got != http.StatusForbidden {
+		t.Fatalf("other location status = %d, want 403", got)
+	}
+}
+
+func TestInventoryWritesRequirePermissions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.JWTSecret = "test-secret"
+	fake := newFake()
+	fake.items["a"] = &models.Inventory{ID: "a", LocationID: "wh-a", Quantity: 5}
+	srv := NewServer(cfg, fake, nil, nil)
+	tokens := auth.NewManager("test-secret", time.Hour)
+	tokenFor := func(role string) string {
+		token, err := tokens.IssueToken(auth.Claims{Subject: role, Role: role, Locations: []string{"wh-a"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	do := func(token, method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	viewer := tokenFor(auth.RoleViewer)
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/inventory", `{"id":"b","location_id":"wh-a"}`},
+		{http.MethodPut, "/inventory/a", `{"quantity":0}`},
+		{http.MethodDelete, "/inventory/a", ""},
+		{http.MethodPost, "/products", `{"name":"Milk","sku":"M1"}`},
+		{http.MethodDelete, "/products/p1", ""},
+		{http.MethodPost, "/locations", `{"id":"wh-x","name":"X"}`},
+		{http.MethodDelete, "/locations/wh-a", ""},
+	} {
+		if got := do(viewer, tc.method, tc.path, tc.body); got != http.StatusForbidden {
+			t.Errorf("viewer %s %s = %d, want 403", tc.method, tc.path, got)
+		}
+	}
+	if got := do(viewer, http.MethodGet, "/inventory", ""); got != http.StatusOK {
+		t.Errorf("viewer GET /inventory = %d, want 200", got)
+	}
+	if fake.items["a"].Quantity != 5 || len(fake.items) != 1 {
+		t.Errorf("inventory changed by a viewer: %+v", fake.items)
+	}
+
+	// Operators adjust stock at their location but can't delete it.
+	operator := tokenFor(auth.RoleOperator)
+	if got := do(operator, http.MethodPut, "/inventory/a", `{"quantity":4}`); got != http.StatusOK {
+		t.Errorf("operator PUT = %d, want 200", got)
+	}
+	if got := do(operator, http.MethodDelete, "/inventory/a", ""); got != http.StatusForbidden {
+		t.Errorf("operator DELETE = %d, want 403", got)
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/replica"
+)
+
+// gormStore is the PostgreSQL Store. Writes and Get go to primary; lists and
+// reports go to reader, which is a healthy replica when there is one. Inside
+// Atomic both are the transaction.
+type gormStore struct {
+	primary func(context.Context) *gorm.DB
+	reader  func(context.Context) *gorm.DB
+}
+
+// NewGORMStore returns a Store writing to the primary of replicas and reading
+// lists and reports from its replicas.
+func NewGORMStore(replicas *replica.Set) Store {
+	return &gormStore{primary: replicas.Primary, reader: replicas.Reader}
+}
+
+func (s *gormStore) Products() ProductRepository    { return gormProducts{s} }
+func (s *gormStore) Locations() LocationRepository  { return gormLocations{s} }
+func (s *gormStore) Inventory() InventoryRepository { return gormInventory{s} }
+
+// Atomic implements Store with a database transaction.
+func (s *gormStore) Atomic(ctx context.Context, fn func(Store) error) error {
+	return s.primary(ctx).Transaction(func(tx *gorm.DB) error {
+		db := func(ctx context.Context) *gorm.DB { return tx.WithContext(ctx) }
+		return fn(&gormStore{primary: db, reader: db})
+	})
+}
+
+// deleted maps the result of a delete by ID, reporting ErrNotFound when no row
+// matched.
+func deleted(result *gorm.DB, what string) error {
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete %s: %w", what, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormProducts struct{ *gormStore }
+
+func (s gormProducts) List(ctx context.Context) ([]models.Product, error) {
+	var products []models.Product
+	if err := s.reader(ctx).Order("name asc").Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	return products, nil
+}
+
+func (s gormProducts) Create(ctx context.Context, product *models.Product) error {
+	if err := s.primary(ctx).Create(product).Error; err != nil {
+		return fmt.Errorf("failed to create product: %w", err)
+	}
+	return nil
+}
+
+func (s gormProducts) Delete(ctx context.Context, id string) error {
+	return deleted(s.primary(ctx).Delete(&models.Product{}, "id = ?", id), "product")
+}
+
+type gormLocations struct{ *gormStore }
+
+func (s gormLocations) List(ctx context.Context, scope Scope) ([]models.Location, error) {
+	query := s.reader(ctx).Order("name asc")
+	if scope.Restricted {
+		query = query.Where("id IN ?", scope.Locations)
+	}
+	var locations []models.Location
+	if err := query.Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list locations: %w", err)
+	}
+	return locations, nil
+}
+
+func (s gormLocations) Create(ctx context.Context, location *models.Location) error {
+	if err := s.primary(ctx).Create(location).Error; err != nil {
+		return fmt.Errorf("failed to create location: %w", err)
+	}
+	return nil
+}
+
+func (s gormLocations) Delete(ctx context.Context, id string) error {
+	return deleted(s.primary(ctx).Delete(&models.Location{}, "id = ?", id), "location")
+}
+
+type gormInventory struct{ *gormStore }
+
+// restrict limits an inventory query to the locations in scope.
+func restrict(q *gorm.DB, scope Scope) *gorm.DB {
+	if scope.Restricted {
+		return q.Where("inventories.location_id IN ?", scope.Locations)
+	}
+	return q
+}
+
+func (s gormInventory) List(ctx context.Context, filter InventoryFilter) ([]models.Inventory, int, error) {
+	// Base query joins Product so the search predicate and ordering can use its
+	// columns; Product/Location are still preloaded into the returned items.
+	base := s.reader(ctx).Model(&models.Inventory{}).
+		Joins("LEFT JOIN products ON products.id = inventories.product_id")
+	if filter.Search != "" {
+		like := "%" + strings.ToLower(filter.Search) + "%"
+		base = base.Where("LOWER(products.name) LIKE ? OR LOWER(products.sku) LIKE ?", like, like)
+	}
+	base = restrict(base, filter.Scope)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count inventory: %w", err)
+	}
+
+	var items []models.Inventory
+	if err := base.
+		Preload("Product").
+		Preload("Location").
+		Order("products.name asc").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Find(&items).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list inventory: %w", err)
+	}
+	return items, int(total), nil
+}
+
+func (s gormInventory) Get(ctx context.Context, id string) (*models.Inventory, error) {
+	var item models.Inventory
+	if err := s.primary(ctx).Preload("Product").Preload("Location").First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
+	return &item, nil
+}
+
+func (s gormInventory) Create(ctx context.Context, inv *models.Inventory) error {
+	if err := s.primary(ctx).Omit(clause.Associations).Create(inv).Error; err != nil {
+		return fmt.Errorf("failed to create inventory: %w", err)
+	}
+	return nil
+}
+
+func (s gormInventory) Update(ctx context.Context, inv *models.Inventory) error {
+	if err := s.primary(ctx).Omit(clause.Associations).Save(inv).Error; err != nil {
+		return fmt.Errorf("failed to update inventory: %w", err)
+	}
+	return nil
+}
+
+func (s gormInventory) Delete(ctx context.Context, id string) error {
+	return s.primary(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("inventory_id = ?", id).Delete(&models.InventoryTransaction{}).Error; err != nil {
+			return fmt.Errorf("failed to delete inventory transactions: %w", err)
+		}
+		if err := tx.Where("inventory_id = ?", id).Delete(&models.InventoryAlert{}).Error; err != nil {
+			return fmt.Errorf("failed to delete inventory alerts: %w", err)
+		}
+		return deleted(tx.Delete(&models.Inventory{}, "id = ?", id), "inventory")
+	})
+}
+
+func (s gormInventory) AddTransaction(ctx context.Context, txn *models.InventoryTransaction) error {
+	if err := s.primary(ctx).Omit(clause.Associations).Create(txn).Error; err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+	return nil
+}
+
+func (s gormInventory) AddAlert(ctx context.Context, alert *models.InventoryAlert) error {
+	if err := s.primary(ctx).Omit(clause.Associations).Create(alert).Error; err != nil {
+		return fmt.Errorf("failed to create alert: %w", err)
+	}
+	return nil
+}
+
+func (s gormInventory) Summary(ctx context.Context, scope Scope, previewItems, previewCategories int) (*models.InventorySummary, error) {
+	db := s.reader(ctx)
+
+	var counts struct{ Items, StockOuts, LowStock int }
+	if err := restrict(db.Model(&models.Inventory{}), scope).Select(
+		"COUNT(*) AS items, " +
+			"COALESCE(SUM(CASE WHEN quantity <= 0 THEN 1 ELSE 0 END), 0) AS stock_outs, " +
+			"COALESCE(SUM(CASE WHEN quantity <= min_quantity THEN 1 ELSE 0 END), 0) AS low_stock",
+	).Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count inventory: %w", err)
+	}
+	summary := &models.InventorySummary{Items: counts.Items, StockOuts: counts.StockOuts, LowStock: counts.LowStock}
+
+	var products, alerts int64
+	if err := db.Model(&models.Product{}).Count(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to count products: %w", err)
+	}
+	if err := restrict(db.Model(&models.InventoryAlert{}).
+		Joins("JOIN inventories ON inventories.id = inventory_alerts.inventory_id").
+		Where("inventory_alerts.status <> ?", "resolved"), scope).
+		Count(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count alerts: %w", err)
+	}
+	summary.Products, summary.OpenAlerts = int(products), int(alerts)
+
+	if err := restrict(db.Preload("Product").Preload("Location"), scope).
+		Where("quantity <= min_quantity").
+		Order("quantity - min_quantity asc").
+		Limit(previewItems).
+		Find(&summary.LowStockItems).Error; err != nil {
+		return nil, fmt.Errorf("failed to list low stock: %w", err)
+	}
+
+	const category = "COALESCE(NULLIF(products.category, ''), 'uncategorised')"
+	if err := restrict(db.Model(&models.Inventory{}).
+		Joins("JOIN products ON products.id = inventories.product_id"), scope).
+		Select(category + " AS category, SUM(inventories.quantity) AS quantity").
+		Group(category).
+		Order("quantity desc").
+		Limit(previewCategories).
+		Scan(&summary.ByCategory).Error; err != nil {
+		return nil, fmt.Errorf("failed to total categories: %w", err)
+	}
+	return summary, nil
+}
+
+func (s gormInventory) StockByLocation(ctx context.Context) ([]LocationStock, error) {
+	var rows []LocationStock
+	if err := s.reader(ctx).Model(&models.Location{}).
+		Joins("LEFT JOIN inventories ON inventories.location_id = locations.id").
+		Select("locations.id AS location_id, locations.name, COALESCE(SUM(inventories.quantity), 0) AS units").
+		Group("locations.id, locations.name").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to total stock: %w", err)
+	}
+	return rows, nil
+}
+
+func (s gormInventory) OpenAlerts(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		Type  string
+		Count int
+	}
+	if err := s.reader(ctx).Model(&models.InventoryAlert{}).
+		Where("status <> ?", "resolved").
+		Select("type, COUNT(*) AS count").
+		Group("type").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count alerts: %w", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// Memory is an in-process Store for tests. It enforces the schema's keys
+// (unique IDs and SKUs, references between records) and rolls Atomic back on
+// error, so service logic behaves as it does against PostgreSQL. Records are
+// copied in and out; callers never share them with the store.
+type Memory struct {
+	mu *sync.Mutex
+	// held is set on the Store passed to an Atomic function, whose caller
+	// already holds mu.
+	held bool
+	data *memoryData
+}
+
+type memoryData struct {
+	products     map[string]models.Product
+	locations    map[string]models.Location
+	inventory    map[string]models.Inventory
+	transactions []models.InventoryTransaction
+	alerts       []models.InventoryAlert
+}
+
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		products:     maps.Clone(d.products),
+		locations:    maps.Clone(d.locations),
+		inventory:    maps.Clone(d.inventory),
+		transactions: slices.Clone(d.transactions),
+		alerts:       slices.Clone(d.alerts),
+	}
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		mu: new(sync.Mutex),
+		data: &memoryData{
+			products:  make(map[string]models.Product),
+			locations: make(map[string]models.Location),
+			inventory: make(map[string]models.Inventory),
+		},
+	}
+}
+
+func (m *Memory) lock() func() {
+	if m.held {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+func (m *Memory) Products() ProductRepository    { return memoryProducts{m} }
+func (m *Memory) Locations() LocationRepository  { return memoryLocations{m} }
+func (m *Memory) Inventory() InventoryRepository { return memoryInventory{m} }
+
+// Atomic implements Store. Other callers wait until fn returns; when it fails,
+// the store is restored to its state before fn ran.
+func (m *Memory) Atomic(ctx context.Context, fn func(Store) error) error {
+	defer m.lock()()
+	saved := m.data.clone()
+	if err := fn(&Memory{mu: m.mu, held: true, data: m.data}); err != nil {
+		*m.data = *saved
+		return err
+	}
+	return nil
+}
+
+// Transactions returns the transactions recorded for an inventory record, in
+// the order they were added.
+func (m *Memory) Transactions(inventoryID string) []models.InventoryTransaction {
+	defer m.lock()()
+	var out []models.InventoryTransaction
+	for _, txn := range m.data.transactions {
+		if txn.InventoryID == inventoryID {
+			out = append(out, txn)
+		}
+	}
+	return out
+}
+
+// Alerts returns the alerts raised for an inventory record, in the order they
+// were added.
+func (m *Memory) Alerts(inventoryID string) []models.InventoryAlert {
+	defer m.lock()()
+	var out []models.InventoryAlert
+	for _, alert := range m.data.alerts {
+		if alert.InventoryID == inventoryID {
+			out = append(out, alert)
+		}
+	}
+	return out
+}
+
+// withAssociations fills in the Product and Location of inv.
+func (d *memoryData) withAssociations(inv models.Inventory) models.Inventory {
+	inv.Product = d.products[inv.ProductID]
+	inv.Location = d.locations[inv.LocationID]
+	return inv
+}
+
+type memoryProducts struct{ *Memory }
+
+func (m memoryProducts) List(ctx context.Context) ([]models.Product, error) {
+	defer m.lock()()
+	products := make([]models.Product, 0, len(m.data.products))
+	for _, p := range m.data.products {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].Name < products[j].Name })
+	return products, nil
+}
+
+func (m memoryProducts) Create(ctx context.Context, product *models.Product) error {
+	defer m.lock()()
+	if _, ok := m.data.products[product.ID]; ok {
+		return fmt.Errorf("failed to create product: duplicate id %s", product.ID)
+	}
+	for _, p := range m.data.products {
+		if p.SKU == product.SKU {
+			return fmt.Errorf("failed to create product: duplicate sku %s", product.SKU)
+		}
+	}
+	m.data.products[product.ID] = *product
+	return nil
+}
+
+func (m memoryProducts) Delete(ctx context.Context, id string) error {
+	defer m.lock()()
+	if _, ok := m.data.products[id]; !ok {
+		return ErrNotFound
+	}
+	for _, inv := range m.data.inventory {
+		if inv.ProductID == id {
+			return fmt.Errorf("failed to delete product: referenced by inventory %s", inv.ID)
+		}
+	}
+	delete(m.data.products, id)
+	return nil
+}
+
+type memoryLocations struct{ *Memory }
+
+func (m memoryLocations) List(ctx context.Context, scope Scope) ([]models.Location, error) {
+	defer m.lock()()
+	locations := []models.Location{}
+	for _, l := range m.data.locations {
+		if scope.Includes(l.ID) {
+			locations = append(locations, l)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Name < locations[j].Name })
+	return locations, nil
+}
+
+func (m memoryLocations) Create(ctx context.Context, location *models.Location) error {
+	defer m.lock()()
+	if _, ok := m.data.locations[location.ID]; ok {
+		return fmt.Errorf("failed to create location: duplicate id %s", location.ID)
+	}
+	m.data.locations[location.ID] = *location
+	return nil
+}
+
+func (m memoryLocations) Delete(ctx context.Context, id string) error {
+	defer m.lock()()
+	if _, ok := m.data.locations[id]; !ok {
+		return ErrNotFound
+	}
+	for _, inv := range m.data.inventory {
+		if inv.LocationID == id {
+			return fmt.Errorf("failed to delete location: referenced by inventory %s", inv.ID)
+		}
+	}
+	delete(m.data.locations, id)
+	return nil
+}
+
+type memoryInventory struct{ *Memory }
+
+func (m memoryInventory) List(ctx context.Context, filter InventoryFilter) ([]models.Inventory, int, error) {
+	defer m.lock()()
+	search := strings.ToLower(filter.Search)
+	var items []models.Inventory
+	for _, inv := range m.data.inventory {
+		inv = m.data.withAssociations(inv)
+		if !filter.Scope.Includes(inv.LocationID) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(inv.Product.Name), search) &&
+			!strings.Contains(strings.ToLower(inv.Product.SKU), search) {
+			continue
+		}
+		items = append(items, inv)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Product.Name < items[j].Product.Name })
+
+	total := len(items)
+	items = items[min(filter.Offset, total):]
+	if filter.Limit > 0 && filter.Limit < len(items) {
+		items = items[:filter.Limit]
+	}
+	return items, total, nil
+}
+
+func (m memoryInventory) Get(ctx context.Context, id string) (*models.Inventory, error) {
+	defer m.lock()()
+	inv, ok := m.data.inventory[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	inv = m.data.withAssociations(inv)
+	return &inv, nil
+}
+
+func (m memoryInventory) Create(ctx context.Context, inv *models.Inventory) error {
+	defer m.lock()()
+	if _, ok := m.data.inventory[inv.ID]; ok {
+		return fmt.Errorf("failed to create inventory: duplicate id %s", inv.ID)
+	}
+	if err := m.references(inv); err != nil {
+		return fmt.Errorf("failed to create inventory: %w", err)
+	}
+	m.data.inventory[inv.ID] = stripped(*inv)
+	return nil
+}
+
+func (m memoryInventory) Update(ctx context.Context, inv *models.Inventory) error {
+	defer m.lock()()
+	if _, ok := m.data.inventory[inv.ID]; !ok {
+		return fmt.Errorf("failed to update inventory: %w", ErrNotFound)
+	}
+	if err := m.references(inv); err != nil {
+		return fmt.Errorf("failed to update inventory: %w", err)
+	}
+	m.data.inventory[inv.ID] = stripped(*inv)
+	return nil
+}
+
+// references checks that the product and location of inv exist.
+func (m memoryInventory) references(inv *models.Inventory) error {
+	if _, ok := m.data.products[inv.ProductID]; !ok {
+		return fmt.Errorf("product %s does not exist", inv.ProductID)
+	}
+	if _, ok := m.data.locations[inv.LocationID]; !ok {
+		return fmt.Errorf("location %s does not exist", inv.LocationID)
+	}
+	return nil
+}
+
+// stripped drops the associations of inv, which the store doesn't save.
+func stripped(inv models.Inventory) models.Inventory {
+	inv.Product, inv.Location = models.Product{}, models.Location{}
+	return inv
+}
+
+func (m memoryInventory) Delete(ctx context.Context, id string) error {
+	defer m.lock()()
+	if _, ok := m.data.inventory[id]; !ok {
+		return ErrNotFound
+	}
+	m.data.transactions = slices.DeleteFunc(m.data.transactions, func(txn models.InventoryTransaction) bool {
+		return txn.InventoryID == id
+	})
+	m.data.alerts = slices.DeleteFunc(m.data.alerts, func(alert models.InventoryAlert) bool {
+		return alert.InventoryID == id
+	})
+	delete(m.data.inventory, id)
+	return nil
+}
+
+func (m memoryInventory) AddTransaction(ctx context.Context, txn *models.InventoryTransaction) error {
+	defer m.lock()()
+	if _, ok := m.data.inventory[txn.InventoryID]; !ok {
+		return fmt.Errorf("failed to create transaction: inventory %s does not exist", txn.InventoryID)
+	}
+	saved := *txn
+	saved.Inventory = models.Inventory{}
+	m.data.transactions = append(m.data.transactions, saved)
+	return nil
+}
+
+func (m memoryInventory) AddAlert(ctx context.Context, alert *models.InventoryAlert) error {
+	defer m.lock()()
+	if _, ok := m.data.inventory[alert.InventoryID]; !ok {
+		return fmt.Errorf("failed to create alert: inventory %s does not exist", alert.InventoryID)
+	}
+	saved := *alert
+	saved.Inventory = models.Inventory{}
+	m.data.alerts = append(m.data.alerts, saved)
+	return nil
+}
+
+func (m memoryInventory) Summary(ctx context.Context, scope Scope, previewItems, previewCategories int) (*models.InventorySummary, error) {
+	defer m.lock()()
+	summary := &models.InventorySummary{Products: len(m.data.products)}
+	byCategory := make(map[string]int)
+	var low []models.Inventory
+	for _, inv := range m.data.inventory {
+		if !scope.Includes(inv.LocationID) {
+			continue
+		}
+		inv = m.data.withAssociations(inv)
+		summary.Items++
+		if inv.Quantity <= 0 {
+			summary.StockOuts++
+		}
+		if inv.Quantity <= inv.MinQuantity {
+			summary.LowStock++
+			low = append(low, inv)
+		}
+		if _, ok := m.data.products[inv.ProductID]; ok {
+			category := inv.Product.Category
+			if category == "" {
+				category = "uncategorised"
+			}
+			byCategory[category] += inv.Quantity
+		}
+	}
+	for _, alert := range m.data.alerts {
+		if alert.Status != "resolved" && scope.Includes(m.data.inventory[alert.InventoryID].LocationID) {
+			summary.OpenAlerts++
+		}
+	}
+
+	sort.Slice(low, func(i, j int) bool {
+		return low[i].Quantity-low[i].MinQuantity < low[j].Quantity-low[j].MinQuantity
+	})
+	summary.LowStockItems = low[:min(previewItems, len(low))]
+
+	for category, quantity := range byCategory {
+		summary.ByCategory = append(summary.ByCategory, models.CategoryStock{Category: category, Quantity: quantity})
+	}
+	sort.Slice(summary.ByCategory, func(i, j int) bool {
+		return summary.ByCategory[i].Quantity > summary.ByCategory[j].Quantity
+	})
+	summary.ByCategory = summary.ByCategory[:min(previewCategories, len(summary.ByCategory))]
+	return summary, nil
+}
+
+func (m memoryInventory) StockByLocation(ctx context.Context) ([]LocationStock, error) {
+	defer m.lock()()
+	units := make(map[string]int, len(m.data.locations))
+	for _, inv := range m.data.inventory {
+		units[inv.LocationID] += inv.Quantity
+	}
+	rows := make([]LocationStock, 0, len(m.data.locations))
+	for _, l := range m.data.locations {
+		rows = append(rows, LocationStock{LocationID: l.ID, Name: l.Name, Units: units[l.ID]})
+	}
+	return rows, nil
+}
+
+func (m memoryInventory) OpenAlerts(ctx context.Context) (map[string]int, error) {
+	defer m.lock()()
+	counts := make(map[string]int)
+	for _, alert := range m.data.alerts {
+		if alert.Status != "resolved" {
+			counts[alert.Type]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
+)
+
+// RegisterMetrics adds the service's connection pool, event publish and
+// business metrics. Stock and alert gauges are queried on each scrape and
+// cover every location, regardless of any caller's scope.
+func (s *InventoryService) RegisterMetrics(r *metrics.Registry) error {
+	if s.db != nil {
+		sqlDB, err := s.db.DB()
+		if err != nil {
+			return fmt.Errorf("failed to get database instance: %v", err)
+		}
+		r.Register(metrics.DBStats(sqlDB), s.replicas.Metric())
+	}
+	r.Register(
+		s.publishes,
+		metrics.NewGaugeFunc("inventory_stock_units", "Units in stock per location.",
+			[]string{"location_id", "location"}, s.collectStockUnits),
+		metrics.NewGaugeFunc("inventory_open_alerts", "Inventory alerts not yet resolved, by type.",
+			[]string{"type"}, s.collectOpenAlerts),
+	)
+	return nil
+}
+
+func (s *InventoryService) collectStockUnits(ctx context.Context, set func(float64, ...string)) error {
+	rows, err := s.store.Inventory().StockByLocation(ctx)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		set(float64(row.Units), row.LocationID, row.Name)
+	}
+	return nil
+}
+
+func (s *InventoryService) collectOpenAlerts(ctx context.Context, set func(float64, ...string)) error {
+	counts, err := s.store.Inventory().OpenAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	for typ, count := range counts {
+		set(float64(count), typ)
+	}
+	return nil
+}
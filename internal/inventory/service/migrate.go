@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io"
+	"io/fs"
+
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/migrate"
+)
+
+// migrationFiles holds the inventory schema, one numbered up/down pair per change.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator returns the migrator for the inventory schema.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, "inventory", sub)
+}
+
+// Migrate runs the migrate subcommand (up, down [n] or status) against the
+// configured database, without connecting to NATS.
+func Migrate(ctx context.Context, cfg *config.Config, args []string, w io.Writer) error {
+	_, sqlDB, err := openDB(cfg, cfg.DSN(), nil, &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	m, err := NewMigrator(sqlDB)
+	if err != nil {
+		return err
+	}
+	return migrate.Command(ctx, m, args, w)
+}
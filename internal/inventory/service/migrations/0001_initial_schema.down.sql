@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS inventory_alerts;
+DROP TABLE IF EXISTS inventory_transactions;
+DROP TABLE IF EXISTS inventories;
+DROP TABLE IF EXISTS locations;
+DROP TABLE IF EXISTS products;
@@ -0,0 +1,65 @@
+-- The schema previously created by GORM's AutoMigrate. IF NOT EXISTS lets
+-- databases set up that way adopt migrations without changes.
+
+CREATE TABLE IF NOT EXISTS products (
+    id          text PRIMARY KEY,
+    name        text NOT NULL,
+    sku         text NOT NULL,
+    description text,
+    category    text,
+    unit_price  numeric NOT NULL,
+    created_at  timestamptz,
+    updated_at  timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_sku ON products (sku);
+
+CREATE TABLE IF NOT EXISTS locations (
+    id         text PRIMARY KEY,
+    name       text NOT NULL,
+    type       text NOT NULL,
+    address    text,
+    city       text,
+    country    text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS inventories (
+    id           text PRIMARY KEY,
+    product_id   text NOT NULL,
+    location_id  text NOT NULL,
+    quantity     bigint NOT NULL,
+    min_quantity bigint NOT NULL,
+    max_quantity bigint NOT NULL,
+    created_at   timestamptz,
+    updated_at   timestamptz,
+    CONSTRAINT fk_inventories_product FOREIGN KEY (product_id) REFERENCES products (id),
+    CONSTRAINT fk_inventories_location FOREIGN KEY (location_id) REFERENCES locations (id)
+);
+CREATE INDEX IF NOT EXISTS idx_inventories_product_id ON inventories (product_id);
+CREATE INDEX IF NOT EXISTS idx_inventories_location_id ON inventories (location_id);
+
+CREATE TABLE IF NOT EXISTS inventory_transactions (
+    id           text PRIMARY KEY,
+    inventory_id text NOT NULL,
+    type         text NOT NULL,
+    quantity     bigint NOT NULL,
+    reference    text,
+    notes        text,
+    created_at   timestamptz,
+    updated_at   timestamptz,
+    CONSTRAINT fk_inventory_transactions_inventory FOREIGN KEY (inventory_id) REFERENCES inventories (id)
+);
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_inventory_id ON inventory_transactions (inventory_id);
+
+CREATE TABLE IF NOT EXISTS inventory_alerts (
+    id           text PRIMARY KEY,
+    inventory_id text NOT NULL,
+    type         text NOT NULL,
+    message      text NOT NULL,
+    status       text NOT NULL,
+    created_at   timestamptz,
+    updated_at   timestamptz,
+    CONSTRAINT fk_inventory_alerts_inventory FOREIGN KEY (inventory_id) REFERENCES inventories (id)
+);
+CREATE INDEX IF NOT EXISTS idx_inventory_alerts_inventory_id ON inventory_alerts (inventory_id);
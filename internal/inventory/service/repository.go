@@ -3,14 +3,8 @@ package service
 import (
 	"context"
 	"errors"
-	"fmt"
-	"strings"
-	"time"
 
-	"github.com/google/uuid"
-	"gorm.io/gorm"
-
-	"github.com/rahmanazhar/FoodSupplyChain/pkg/events"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
 )
 
@@ -18,156 +12,105 @@ import (
 // it to an HTTP 404 response.
 var ErrNotFound = errors.New("record not found")
 
-// ListInventory returns a page of inventory records (with their product and
-// location preloaded) and the total number of matching records. When search is
-// non-empty it filters by product name or SKU, case-insensitively.
-func (s *InventoryService) ListInventory(ctx context.Context, limit, offset int, search string) ([]models.Inventory, int, error) {
-	// Base query joins Product so the search predicate and ordering can use its
-	// columns; Product/Location are still preloaded into the returned items.
-	base := s.db.WithContext(ctx).Model(&models.Inventory{}).
-		Joins("LEFT JOIN products ON products.id = inventories.product_id")
-	if search != "" {
-		like := "%" + strings.ToLower(search) + "%"
-		base = base.Where("LOWER(products.name) LIKE ? OR LOWER(products.sku) LIKE ?", like, like)
-	}
+// ErrForbidden is returned when the caller is restricted to particular
+// locations and the record belongs to another one. Handlers map it to 403.
+var ErrForbidden = errors.New("location outside caller's scope")
 
-	var total int64
-	if err := base.Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count inventory: %w", err)
-	}
+// Store gives the service its repositories, one per aggregate. GORM backs it
+// in production (NewGORMStore); Memory backs it in tests.
+type Store interface {
+	Products() ProductRepository
+	Locations() LocationRepository
+	Inventory() InventoryRepository
 
-	var items []models.Inventory
-	if err := base.
-		Preload("Product").
-		Preload("Location").
-		Order("products.name asc").
-		Limit(limit).
-		Offset(offset).
-		Find(&items).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to list inventory: %w", err)
-	}
-	return items, int(total), nil
+	// Atomic runs fn with a Store whose writes are committed together when fn
+	// returns nil and discarded when it returns an error.
+	Atomic(ctx context.Context, fn func(Store) error) error
 }
 
-// GetInventory returns a single inventory record by ID, or ErrNotFound.
-func (s *InventoryService) GetInventory(ctx context.Context, id string) (*models.Inventory, error) {
-	var item models.Inventory
-	if err := s.db.WithContext(ctx).Preload("Product").Preload("Location").First(&item, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrNotFound
-		}
-		return nil, fmt.Errorf("failed to get inventory: %w", err)
-	}
-	return &item, nil
+// Scope restricts queries to the locations a caller is assigned to. The zero
+// Scope is unrestricted.
+type Scope struct {
+	Restricted bool
+	Locations  []string
 }
 
-// ListProducts returns all products.
-func (s *InventoryService) ListProducts(ctx context.Context) ([]models.Product, error) {
-	var products []models.Product
-	if err := s.db.WithContext(ctx).Order("name asc").Find(&products).Error; err != nil {
-		return nil, fmt.Errorf("failed to list products: %w", err)
-	}
-	return products, nil
+// scopeOf returns the location scope of the caller in ctx.
+func scopeOf(ctx context.Context) Scope {
+	ids, scoped := auth.LocationScope(ctx)
+	return Scope{Restricted: scoped, Locations: ids}
 }
 
-// DeleteProduct removes a product by ID, or returns ErrNotFound.
-func (s *InventoryService) DeleteProduct(ctx context.Context, id string) error {
-	result := s.db.WithContext(ctx).Delete(&models.Product{}, "id = ?", id)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete product: %w", result.Error)
+// Includes reports whether the scope covers locationID.
+func (s Scope) Includes(locationID string) bool {
+	if !s.Restricted {
+		return true
 	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
+	for _, id := range s.Locations {
+		if id == locationID {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
-// ListLocations returns all locations.
-func (s *InventoryService) ListLocations(ctx context.Context) ([]models.Location, error) {
-	var locations []models.Location
-	if err := s.db.WithContext(ctx).Order("name asc").Find(&locations).Error; err != nil {
-		return nil, fmt.Errorf("failed to list locations: %w", err)
-	}
-	return locations, nil
+// ProductRepository stores products.
+type ProductRepository interface {
+	// List returns every product ordered by name.
+	List(ctx context.Context) ([]models.Product, error)
+	Create(ctx context.Context, product *models.Product) error
+	// Delete removes a product, or returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
 }
 
-// CreateLocation persists a new location.
-func (s *InventoryService) CreateLocation(ctx context.Context, location *models.Location) error {
-	if location.ID == "" {
-		location.ID = uuid.New().String()
-	}
-	now := time.Now()
-	location.CreatedAt = now
-	location.UpdatedAt = now
-	if err := s.db.WithContext(ctx).Create(location).Error; err != nil {
-		return fmt.Errorf("failed to create location: %w", err)
-	}
-	return nil
+// LocationRepository stores locations.
+type LocationRepository interface {
+	// List returns the locations in scope ordered by name.
+	List(ctx context.Context, scope Scope) ([]models.Location, error)
+	Create(ctx context.Context, location *models.Location) error
+	// Delete removes a location, or returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
 }
 
-// DeleteLocation removes a location by ID, or returns ErrNotFound.
-func (s *InventoryService) DeleteLocation(ctx context.Context, id string) error {
-	result := s.db.WithContext(ctx).Delete(&models.Location{}, "id = ?", id)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete location: %w", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+// InventoryFilter selects a page of inventory records.
+type InventoryFilter struct {
+	// Search matches product names and SKUs, case-insensitively.
+	Search        string
+	Scope         Scope
+	Limit, Offset int
 }
 
-// CreateInventory persists a new inventory record and emits a created event.
-// Associations (Product, Location) are referenced by ID and not upserted here.
-func (s *InventoryService) CreateInventory(ctx context.Context, inv *models.Inventory) error {
-	if inv.ID == "" {
-		inv.ID = uuid.New().String()
-	}
-	now := time.Now()
-	inv.CreatedAt = now
-	inv.UpdatedAt = now
-
-	if err := s.db.WithContext(ctx).Omit("Product", "Location").Create(inv).Error; err != nil {
-		return fmt.Errorf("failed to create inventory: %w", err)
-	}
-
-	event := &events.InventoryEvent{
-		BaseEvent: events.BaseEvent{
-			ID:        uuid.New().String(),
-			Type:      string(events.InventoryCreated),
-			Timestamp: now,
-			Version:   "1.0",
-			Source:    s.config.App.Name,
-		},
-	}
-	event.Data.InventoryID = inv.ID
-	event.Data.ProductID = inv.ProductID
-	event.Data.LocationID = inv.LocationID
-	event.Data.Quantity = inv.Quantity
-
-	if err := s.publishEvent(fmt.Sprintf("%s.inventory.created", s.config.NATS.SubjectPrefix), event); err != nil {
-		return fmt.Errorf("failed to publish inventory created event: %w", err)
-	}
-	return nil
+// LocationStock is the number of units held at one location.
+type LocationStock struct {
+	LocationID string
+	Name       string
+	Units      int
 }
 
-// DeleteInventory removes an inventory record and its dependent transactions
-// and alerts in a single transaction, or returns ErrNotFound.
-func (s *InventoryService) DeleteInventory(ctx context.Context, id string) error {
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("inventory_id = ?", id).Delete(&models.InventoryTransaction{}).Error; err != nil {
-			return fmt.Errorf("failed to delete inventory transactions: %w", err)
-		}
-		if err := tx.Where("inventory_id = ?", id).Delete(&models.InventoryAlert{}).Error; err != nil {
-			return fmt.Errorf("failed to delete inventory alerts: %w", err)
-		}
-		result := tx.Delete(&models.Inventory{}, "id = ?", id)
-		if result.Error != nil {
-			return fmt.Errorf("failed to delete inventory: %w", result.Error)
-		}
-		if result.RowsAffected == 0 {
-			return ErrNotFound
-		}
-		return nil
-	})
+// InventoryRepository stores inventory records together with their
+// transactions and alerts. Records are returned with Product and Location
+// filled in; writes ignore both.
+type InventoryRepository interface {
+	// List returns a page of the records matching filter, ordered by product
+	// name, and the number of matching records.
+	List(ctx context.Context, filter InventoryFilter) ([]models.Inventory, int, error)
+	// Get returns a record, or ErrNotFound. It reads from the primary.
+	Get(ctx context.Context, id string) (*models.Inventory, error)
+	Create(ctx context.Context, inv *models.Inventory) error
+	// Update saves every field of an existing record.
+	Update(ctx context.Context, inv *models.Inventory) error
+	// Delete removes a record with its transactions and alerts, or returns
+	// ErrNotFound.
+	Delete(ctx context.Context, id string) error
+
+	AddTransaction(ctx context.Context, txn *models.InventoryTransaction) error
+	AddAlert(ctx context.Context, alert *models.InventoryAlert) error
+
+	// Summary rolls up the records in scope for the dashboard; LowStockItems
+	// and ByCategory hold at most previewItems and previewCategories entries.
+	Summary(ctx context.Context, scope Scope, previewItems, previewCategories int) (*models.InventorySummary, error)
+	// StockByLocation totals the units at every location, including empty ones.
+	StockByLocation(ctx context.Context) ([]LocationStock, error)
+	// OpenAlerts counts the alerts not yet resolved by type.
+	OpenAlerts(ctx context.Context) (map[string]int, error)
 }
@@ -2,8 +2,8 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -13,56 +13,72 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
-	"github.com/rahmanazhar/FoodSupplyChain/internal/inventory/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/events"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/health"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/replica"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
 )
 
 // InventoryService handles the core business logic for inventory management
 type InventoryService struct {
-	config *config.Config
-	db     *gorm.DB
-	nc     *nats.Conn
-	js     nats.JetStreamContext
+	config    *config.Config
+	store     Store
+	publisher Publisher
+	publishes *metrics.Publishes
+
+	// Connections opened by NewInventoryService; nil for a service from New.
+	// replicas serves the store's read-only queries (lists, reports); its
+	// Reader falls back to db.
+	db       *gorm.DB
+	nc       *nats.Conn
+	replicas *replica.Set
 }
 
-// NewInventoryService creates a new inventory service instance
-func NewInventoryService(cfg *config.Config) (*InventoryService, error) {
-	// Initialize database connection
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Name,
-	)
+// Publisher delivers the service's events.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %v", err)
+// New returns a service keeping its records in store and publishing events
+// through publisher. Tests pair it with a Memory store.
+func New(cfg *config.Config, store Store, publisher Publisher) *InventoryService {
+	return &InventoryService{
+		config:    cfg,
+		store:     store,
+		publisher: publisher,
+		publishes: metrics.NewPublishes(cfg.Metrics.Buckets),
 	}
+}
 
-	// Configure connection pool
-	sqlDB, err := db.DB()
+// NewInventoryService creates a new inventory service instance backed by
+// PostgreSQL and NATS JetStream. Queries and event publishes are traced with
+// tracer, which may be nil.
+func NewInventoryService(cfg *config.Config, tracer *tracing.Tracer) (*InventoryService, error) {
+	db, sqlDB, err := openDB(cfg, cfg.DSN(), tracer, &gorm.Config{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get database instance: %v", err)
+		return nil, err
 	}
 
-	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
-	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
-	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
-
-	// Auto-migrate database schemas
-	if err := db.AutoMigrate(
-		&models.Product{},
-		&models.Location{},
-		&models.Inventory{},
-		&models.InventoryTransaction{},
-		&models.InventoryAlert{},
-	); err != nil {
+	// Bring the schema up to date, or only check that it is when migrations
+	// are run separately (the migrate subcommand).
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.Ensure(context.Background(), cfg.Database.MigrateOnStart); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
 
+	// Lists and reports read from the replicas while they're healthy.
+	replicas, err := openReplicas(cfg, db, tracer)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize NATS connection
 	nc, err := nats.Connect(cfg.NATS.URL)
 	if err != nil {
@@ -81,12 +97,81 @@ func NewInventoryService(cfg *config.Config) (*InventoryService, error) {
 		return nil, err
 	}
 
-	return &InventoryService{
-		config: cfg,
-		db:     db,
-		nc:     nc,
-		js:     js,
-	}, nil
+	s := New(cfg, NewGORMStore(replicas), jetStream{tracer: tracer, js: js})
+	s.db, s.nc, s.replicas = db, nc, replicas
+	return s, nil
+}
+
+// jetStream publishes to NATS JetStream, carrying the trace context of each
+// publish in the message headers.
+type jetStream struct {
+	tracer *tracing.Tracer
+	js     nats.JetStreamContext
+}
+
+func (p jetStream) Publish(ctx context.Context, subject string, data []byte) error {
+	_, err := p.tracer.Publish(ctx, p.js, subject, data)
+	return err
+}
+
+// openDB connects to the database at dsn and configures the connection pool.
+func openDB(cfg *config.Config, dsn string, tracer *tracing.Tracer, gormCfg *gorm.Config) (*gorm.DB, *sql.DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), gormCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	if err := db.Use(tracing.GORM(tracer)); err != nil {
+		return nil, nil, fmt.Errorf("failed to install query tracing: %v", err)
+	}
+
+	// Configure connection pool
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database instance: %v", err)
+	}
+
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	return db, sqlDB, nil
+}
+
+// openReplicas connects to the configured read replicas.
+func openReplicas(cfg *config.Config, primary *gorm.DB, tracer *tracing.Tracer) (*replica.Set, error) {
+	var replicas []replica.Replica
+	for _, host := range cfg.Database.Replicas.Hosts {
+		dsn, err := cfg.ReplicaDSN(host)
+		if err != nil {
+			return nil, err
+		}
+		// Not pinged: a replica that is down starts out of rotation.
+		db, _, err := openDB(cfg, dsn, tracer, &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			return nil, fmt.Errorf("replica %s: %v", host, err)
+		}
+		replicas = append(replicas, replica.Replica{Name: host, DB: db})
+	}
+	return replica.New(primary, replicas, replica.Config{
+		CheckInterval: cfg.Database.Replicas.CheckInterval,
+		MaxLag:        cfg.Database.Replicas.MaxLag,
+	}), nil
+}
+
+// RegisterHealthChecks adds the service's database and NATS readiness checks.
+func (s *InventoryService) RegisterHealthChecks(c *health.Checker) {
+	if s.db != nil {
+		c.Add("database", func(ctx context.Context) error {
+			sqlDB, err := s.db.DB()
+			if err != nil {
+				return err
+			}
+			return health.DB(sqlDB)(ctx)
+		})
+	}
+	if s.nc != nil {
+		c.Add("nats", health.NATS(s.nc))
+	}
 }
 
 // Close closes all connections
@@ -95,6 +180,12 @@ func (s *InventoryService) Close() error {
 		s.nc.Close()
 	}
 
+	if s.replicas != nil {
+		if err := s.replicas.Close(); err != nil {
+			return fmt.Errorf("failed to close replica connections: %v", err)
+		}
+	}
+
 	if s.db != nil {
 		sqlDB, err := s.db.DB()
 		if err != nil {
@@ -108,14 +199,46 @@ func (s *InventoryService) Close() error {
 	return nil
 }
 
+// ListInventory returns a page of inventory records (with their product and
+// location) and the total number of matching records. When search is
+// non-empty it filters by product name or SKU, case-insensitively. Callers
+// scoped to locations only see inventory held at those locations.
+func (s *InventoryService) ListInventory(ctx context.Context, limit, offset int, search string) ([]models.Inventory, int, error) {
+	return s.store.Inventory().List(ctx, InventoryFilter{
+		Search: search,
+		Scope:  scopeOf(ctx),
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// GetInventory returns a single inventory record by ID, or ErrNotFound. Records
+// at locations outside the caller's scope are reported as not found, matching
+// their absence from ListInventory.
+func (s *InventoryService) GetInventory(ctx context.Context, id string) (*models.Inventory, error) {
+	item, err := s.store.Inventory().Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.InLocationScope(ctx, item.LocationID) {
+		return nil, ErrNotFound
+	}
+	return item, nil
+}
+
+// ListProducts returns all products.
+func (s *InventoryService) ListProducts(ctx context.Context) ([]models.Product, error) {
+	return s.store.Products().List(ctx)
+}
+
 // CreateProduct creates a new product
 func (s *InventoryService) CreateProduct(ctx context.Context, product *models.Product) error {
 	product.ID = uuid.New().String()
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = time.Now()
 
-	if err := s.db.Create(product).Error; err != nil {
-		return fmt.Errorf("failed to create product: %v", err)
+	if err := s.store.Products().Create(ctx, product); err != nil {
+		return err
 	}
 
 	// Publish event
@@ -126,52 +249,131 @@ func (s *InventoryService) CreateProduct(ctx context.Context, product *models.Pr
 			Timestamp: time.Now(),
 			Version:   "1.0",
 			Source:    s.config.App.Name,
+			TraceID:   tracing.TraceIDFrom(ctx),
 		},
 	}
 	event.Data.ProductID = product.ID
 
-	if err := s.publishEvent(fmt.Sprintf("%s.product.created", s.config.NATS.SubjectPrefix), event); err != nil {
+	if err := s.publishEvent(ctx, fmt.Sprintf("%s.product.created", s.config.NATS.SubjectPrefix), event); err != nil {
 		return fmt.Errorf("failed to publish product created event: %v", err)
 	}
 
 	return nil
 }
 
-// UpdateInventory updates inventory levels and generates alerts if needed
-func (s *InventoryService) UpdateInventory(ctx context.Context, id string, quantity int) error {
-	var inventory models.Inventory
-	if err := s.db.First(&inventory, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrNotFound
-		}
-		return fmt.Errorf("failed to find inventory: %v", err)
+// DeleteProduct removes a product by ID, or returns ErrNotFound.
+func (s *InventoryService) DeleteProduct(ctx context.Context, id string) error {
+	return s.store.Products().Delete(ctx, id)
+}
+
+// ListLocations returns all locations, or only the assigned ones for callers
+// scoped to locations.
+func (s *InventoryService) ListLocations(ctx context.Context) ([]models.Location, error) {
+	return s.store.Locations().List(ctx, scopeOf(ctx))
+}
+
+// CreateLocation persists a new location. Callers scoped to locations cannot
+// create new ones, since the result would fall outside their scope.
+func (s *InventoryService) CreateLocation(ctx context.Context, location *models.Location) error {
+	if _, scoped := auth.LocationScope(ctx); scoped {
+		return ErrForbidden
+	}
+	if location.ID == "" {
+		location.ID = uuid.New().String()
 	}
+	now := time.Now()
+	location.CreatedAt = now
+	location.UpdatedAt = now
+	return s.store.Locations().Create(ctx, location)
+}
 
-	prevQuantity := inventory.Quantity
-	inventory.Quantity = quantity
-	inventory.UpdatedAt = time.Now()
+// DeleteLocation removes a location by ID, or returns ErrNotFound.
+func (s *InventoryService) DeleteLocation(ctx context.Context, id string) error {
+	if !auth.InLocationScope(ctx, id) {
+		return ErrForbidden
+	}
+	return s.store.Locations().Delete(ctx, id)
+}
 
-	if err := s.db.Save(&inventory).Error; err != nil {
-		return fmt.Errorf("failed to update inventory: %v", err)
+// CreateInventory persists a new inventory record and emits a created event.
+// Associations (Product, Location) are referenced by ID and not upserted here.
+func (s *InventoryService) CreateInventory(ctx context.Context, inv *models.Inventory) error {
+	if !auth.InLocationScope(ctx, inv.LocationID) {
+		return ErrForbidden
+	}
+	if inv.ID == "" {
+		inv.ID = uuid.New().String()
 	}
+	now := time.Now()
+	inv.CreatedAt = now
+	inv.UpdatedAt = now
 
-	// Create transaction record
-	transaction := &models.InventoryTransaction{
-		ID:          uuid.New().String(),
-		InventoryID: inventory.ID,
-		Type:        "adjusted",
-		Quantity:    quantity - prevQuantity,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	if err := s.store.Inventory().Create(ctx, inv); err != nil {
+		return err
 	}
 
-	if err := s.db.Create(transaction).Error; err != nil {
-		return fmt.Errorf("failed to create transaction: %v", err)
+	event := &events.InventoryEvent{
+		BaseEvent: events.BaseEvent{
+			ID:        uuid.New().String(),
+			Type:      string(events.InventoryCreated),
+			Timestamp: now,
+			Version:   "1.0",
+			Source:    s.config.App.Name,
+			TraceID:   tracing.TraceIDFrom(ctx),
+		},
+	}
+	event.Data.InventoryID = inv.ID
+	event.Data.ProductID = inv.ProductID
+	event.Data.LocationID = inv.LocationID
+	event.Data.Quantity = inv.Quantity
+
+	if err := s.publishEvent(ctx, fmt.Sprintf("%s.inventory.created", s.config.NATS.SubjectPrefix), event); err != nil {
+		return fmt.Errorf("failed to publish inventory created event: %w", err)
 	}
+	return nil
+}
+
+// UpdateInventory sets the quantity of an inventory record, records the
+// adjustment as a transaction and raises a low stock alert when the quantity
+// falls to the minimum or below. The three writes commit together; the alert
+// event is published once they have.
+func (s *InventoryService) UpdateInventory(ctx context.Context, id string, quantity int) error {
+	var alert *models.InventoryAlert
+	err := s.store.Atomic(ctx, func(tx Store) error {
+		inventory, err := tx.Inventory().Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !auth.InLocationScope(ctx, inventory.LocationID) {
+			return ErrForbidden
+		}
+
+		prevQuantity := inventory.Quantity
+		inventory.Quantity = quantity
+		inventory.UpdatedAt = time.Now()
 
-	// Check for alerts
-	if quantity <= inventory.MinQuantity {
-		alert := &models.InventoryAlert{
+		if err := tx.Inventory().Update(ctx, inventory); err != nil {
+			return err
+		}
+
+		// Create transaction record
+		transaction := &models.InventoryTransaction{
+			ID:          uuid.New().String(),
+			InventoryID: inventory.ID,
+			Type:        "adjusted",
+			Quantity:    quantity - prevQuantity,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		if err := tx.Inventory().AddTransaction(ctx, transaction); err != nil {
+			return err
+		}
+
+		// Check for alerts
+		if quantity > inventory.MinQuantity {
+			return nil
+		}
+		alert = &models.InventoryAlert{
 			ID:          uuid.New().String(),
 			InventoryID: inventory.ID,
 			Type:        "low_stock",
@@ -180,42 +382,74 @@ func (s *InventoryService) UpdateInventory(ctx context.Context, id string, quant
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 		}
+		return tx.Inventory().AddAlert(ctx, alert)
+	})
+	if err != nil || alert == nil {
+		return err
+	}
 
-		if err := s.db.Create(alert).Error; err != nil {
-			return fmt.Errorf("failed to create alert: %v", err)
-		}
-
-		// Publish alert event
-		alertEvent := &events.InventoryAlertEvent{
-			BaseEvent: events.BaseEvent{
-				ID:        uuid.New().String(),
-				Type:      string(events.LowStockAlert),
-				Timestamp: time.Now(),
-				Version:   "1.0",
-				Source:    s.config.App.Name,
-			},
-		}
-		alertEvent.Data.AlertID = alert.ID
-		alertEvent.Data.InventoryID = inventory.ID
-		alertEvent.Data.AlertType = "low_stock"
-		alertEvent.Data.CurrentLevel = quantity
+	// Publish alert event
+	alertEvent := &events.InventoryAlertEvent{
+		BaseEvent: events.BaseEvent{
+			ID:        uuid.New().String(),
+			Type:      string(events.LowStockAlert),
+			Timestamp: time.Now(),
+			Version:   "1.0",
+			Source:    s.config.App.Name,
+			TraceID:   tracing.TraceIDFrom(ctx),
+		},
+	}
+	alertEvent.Data.AlertID = alert.ID
+	alertEvent.Data.InventoryID = alert.InventoryID
+	alertEvent.Data.AlertType = alert.Type
+	alertEvent.Data.CurrentLevel = quantity
 
-		if err := s.publishEvent(fmt.Sprintf("%s.inventory.alert", s.config.NATS.SubjectPrefix), alertEvent); err != nil {
-			return fmt.Errorf("failed to publish alert event: %v", err)
-		}
+	if err := s.publishEvent(ctx, fmt.Sprintf("%s.inventory.alert", s.config.NATS.SubjectPrefix), alertEvent); err != nil {
+		return fmt.Errorf("failed to publish alert event: %v", err)
 	}
 
 	return nil
 }
 
-// Helper function to publish events
-func (s *InventoryService) publishEvent(subject string, event interface{}) error {
+// DeleteInventory removes an inventory record and its dependent transactions
+// and alerts in a single transaction, or returns ErrNotFound.
+func (s *InventoryService) DeleteInventory(ctx context.Context, id string) error {
+	return s.store.Atomic(ctx, func(tx Store) error {
+		inv, err := tx.Inventory().Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !auth.InLocationScope(ctx, inv.LocationID) {
+			return ErrForbidden
+		}
+		return tx.Inventory().Delete(ctx, id)
+	})
+}
+
+// Sizes of the lists embedded in the dashboard summary.
+const (
+	summaryPreview    = 5
+	summaryCategories = 6
+)
+
+// Summary rolls up the inventory the caller may see for the dashboard: stock
+// counts, open (unresolved) alerts, the lowest-stocked items and the largest
+// categories by quantity.
+func (s *InventoryService) Summary(ctx context.Context) (*models.InventorySummary, error) {
+	return s.store.Inventory().Summary(ctx, scopeOf(ctx), summaryPreview, summaryCategories)
+}
+
+// Helper function to publish events. The trace context of ctx travels in the
+// message headers.
+func (s *InventoryService) publishEvent(ctx context.Context, subject string, event interface{}) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %v", err)
 	}
 
-	_, err = s.js.Publish(subject, data)
+	start := time.Now()
+	err = s.publisher.Publish(ctx, subject, data)
+	s.publishes.Observe(subject, start, err)
 	if err != nil {
 		return fmt.Errorf("failed to publish event: %v", err)
 	}
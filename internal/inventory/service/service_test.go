@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/events"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// published records the events a service publishes.
+type published struct {
+	subjects []string
+	data     [][]byte
+}
+
+func (p *published) Publish(ctx context.Context, subject string, data []byte) error {
+	p.subjects = append(p.subjects, subject)
+	p.data = append(p.data, data)
+	return nil
+}
+
+// newTestService returns a service over a Memory store holding one product
+// stocked at two warehouses: inv-a (wh-a) and inv-b (wh-b), each with 10 units
+// and a minimum of 5.
+func newTestService(t *testing.T) (*InventoryService, *Memory, *published) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.App.Name = "inventory-service"
+	cfg.NATS.SubjectPrefix = "supplychain"
+
+	ctx := context.Background()
+	store := NewMemory()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(store.Products().Create(ctx, &models.Product{ID: "apples", Name: "Apples", SKU: "APL-1", Category: "fruit"}))
+	for _, wh := range []string{"wh-a", "wh-b"} {
+		must(store.Locations().Create(ctx, &models.Location{ID: wh, Name: wh, Type: "warehouse"}))
+		must(store.Inventory().Create(ctx, &models.Inventory{
+			ID: "inv-" + wh[len(wh)-1:], ProductID: "apples", LocationID: wh, Quantity: 10, MinQuantity: 5,
+		}))
+	}
+
+	sent := &published{}
+	return New(cfg, store, sent), store, sent
+}
+
+// scopedTo returns a context for an operator assigned to locations.
+func scopedTo(locations ...string) context.Context {
+	return auth.ContextWithClaims(context.Background(), &auth.Claims{
+		Subject: "op", Role: auth.RoleOperator, Locations: locations,
+	})
+}
+
+func TestUpdateInventoryRecordsAdjustment(t *testing.T) {
+	svc, store, sent := newTestService(t)
+	ctx := context.Background()
+
+	if err := svc.UpdateInventory(ctx, "inv-a", 8); err != nil {
+		t.Fatalf("UpdateInventory: %v", err)
+	}
+	inv, err := svc.GetInventory(ctx, "inv-a")
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if inv.Quantity != 8 || inv.Product.Name != "Apples" {
+		t.Errorf("inventory = %d of %q, want 8 of Apples", inv.Quantity, inv.Product.Name)
+	}
+	txns := store.Transactions("inv-a")
+	if len(txns) != 1 || txns[0].Type != "adjusted" || txns[0].Quantity != -2 {
+		t.Errorf("transactions = %+v, want one adjustment of -2", txns)
+	}
+	if alerts := store.Alerts("inv-a"); len(alerts) != 0 {
+		t.Errorf("alerts = %+v, want none above the minimum", alerts)
+	}
+	if len(sent.subjects) != 0 {
+		t.Errorf("published %v, want nothing", sent.subjects)
+	}
+}
+
+func TestUpdateInventoryRaisesLowStockAlert(t *testing.T) {
+	svc, store, sent := newTestService(t)
+
+	if err := svc.UpdateInventory(context.Background(), "inv-a", 5); err != nil {
+		t.Fatalf("UpdateInventory: %v", err)
+	}
+	alerts := store.Alerts("inv-a")
+	if len(alerts) != 1 || alerts[0].Type != "low_stock" || alerts[0].Status != "new" {
+		t.Fatalf("alerts = %+v, want one new low_stock alert", alerts)
+	}
+	if len(sent.subjects) != 1 || sent.subjects[0] != "supplychain.inventory.alert" {
+		t.Fatalf("published %v, want supplychain.inventory.alert", sent.subjects)
+	}
+	var event events.InventoryAlertEvent
+	if err := json.Unmarshal(sent.data[0], &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Data.AlertID != alerts[0].ID || event.Data.CurrentLevel != 5 || event.Source != "inventory-service" {
+		t.Errorf("event = %+v, want alert %s at level 5", event, alerts[0].ID)
+	}
+}
+
+// failingAlerts is a Store whose AddAlert always fails.
+type failingAlerts struct{ Store }
+
+func (s failingAlerts) Inventory() InventoryRepository {
+	return failingAlertRepository{s.Store.Inventory()}
+}
+
+func (s failingAlerts) Atomic(ctx context.Context, fn func(Store) error) error {
+	return s.Store.Atomic(ctx, func(tx Store) error { return fn(failingAlerts{tx}) })
+}
+
+type failingAlertRepository struct{ InventoryRepository }
+
+func (failingAlertRepository) AddAlert(context.Context, *models.InventoryAlert) error {
+	return errors.New("disk full")
+}
+
+func TestUpdateInventoryRollsBackWhenAlertFails(t *testing.T) {
+	svc, store, sent := newTestService(t)
+	svc.store = failingAlerts{store}
+	ctx := context.Background()
+
+	if err := svc.UpdateInventory(ctx, "inv-a", 1); err == nil {
+		t.Fatal("UpdateInventory succeeded, want the alert's error")
+	}
+	inv, err := store.Inventory().Get(ctx, "inv-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Quantity != 10 {
+		t.Errorf("quantity = %d, want 10 after rollback", inv.Quantity)
+	}
+	if txns := store.Transactions("inv-a"); len(txns) != 0 {
+		t.Errorf("transactions = %+v, want none after rollback", txns)
+	}
+	if len(sent.subjects) != 0 {
+		t.Errorf("published %v, want nothing", sent.subjects)
+	}
+}
+
+func TestLocationScope(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	ctx := scopedTo("wh-a")
+
+	if err := svc.UpdateInventory(ctx, "inv-b", 1); !errors.Is(err, ErrForbidden) {
+		t.Errorf("UpdateInventory outside scope = %v, want ErrForbidden", err)
+	}
+	if err := svc.UpdateInventory(ctx, "missing", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateInventory of missing record = %v, want ErrNotFound", err)
+	}
+	if _, err := svc.GetInventory(ctx, "inv-b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetInventory outside scope = %v, want ErrNotFound", err)
+	}
+	if err := svc.DeleteInventory(ctx, "inv-b"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("DeleteInventory outside scope = %v, want ErrForbidden", err)
+	}
+	if err := svc.CreateLocation(ctx, &models.Location{Name: "new"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("CreateLocation while scoped = %v, want ErrForbidden", err)
+	}
+
+	items, total, err := svc.ListInventory(ctx, 10, 0, "apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(items) != 1 || items[0].ID != "inv-a" {
+		t.Errorf("ListInventory = %d items of %d, want only inv-a", len(items), total)
+	}
+	locations, err := svc.ListLocations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].ID != "wh-a" {
+		t.Errorf("ListLocations = %+v, want only wh-a", locations)
+	}
+}
+
+func TestDeleteInventoryRemovesHistory(t *testing.T) {
+	svc, store, _ := newTestService(t)
+	ctx := context.Background()
+
+	if err := svc.UpdateInventory(ctx, "inv-a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteInventory(ctx, "inv-a"); err != nil {
+		t.Fatalf("DeleteInventory: %v", err)
+	}
+	if len(store.Transactions("inv-a")) != 0 || len(store.Alerts("inv-a")) != 0 {
+		t.Error("transactions or alerts survived their inventory record")
+	}
+	if err := svc.DeleteInventory(ctx, "inv-a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeleteInventory = %v, want ErrNotFound", err)
+	}
+	if err := svc.DeleteLocation(ctx, "wh-b"); err == nil {
+		t.Error("DeleteLocation succeeded while inventory references the location")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	if err := svc.UpdateInventory(context.Background(), "inv-a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := svc.Summary(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Items != 2 || summary.Products != 1 || summary.StockOuts != 1 || summary.LowStock != 1 || summary.OpenAlerts != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(summary.LowStockItems) != 1 || summary.LowStockItems[0].ID != "inv-a" {
+		t.Errorf("low stock items = %+v, want inv-a", summary.LowStockItems)
+	}
+	if len(summary.ByCategory) != 1 || summary.ByCategory[0] != (models.CategoryStock{Category: "fruit", Quantity: 10}) {
+		t.Errorf("by category = %+v, want 10 fruit", summary.ByCategory)
+	}
+
+	scoped, err := svc.Summary(scopedTo("wh-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scoped.Items != 1 || scoped.LowStock != 0 || scoped.OpenAlerts != 0 {
+		t.Errorf("scoped summary = %+v, want wh-b only", scoped)
+	}
+}
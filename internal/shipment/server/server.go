@@ -10,12 +10,16 @@ import (
 
 	"github.com/gorilla/mux"
 
-	"github.com/rahmanazhar/FoodSupplyChain/internal/shipment/config"
 	"github.com/rahmanazhar/FoodSupplyChain/internal/shipment/service"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/health"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/replica"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
 )
 
 // ShipmentService is the behaviour the HTTP layer requires from the service.
@@ -28,6 +32,8 @@ type ShipmentService interface {
 	DeleteShipment(ctx context.Context, id string) error
 	UpdateShipmentStatus(ctx context.Context, id, status, location string) error
 	ListShipmentEvents(ctx context.Context, id string) ([]models.ShipmentEvent, error)
+
+	Summary(ctx context.Context) (*models.ShipmentSummary, error)
 }
 
 // Server exposes the shipment service over HTTP.
@@ -38,12 +44,15 @@ type Server struct {
 	router  *mux.Router
 	logger  *slog.Logger
 	metrics *metrics.Collector
+	health  *health.Checker
+	tracer  *tracing.Tracer
 }
 
 // NewServer wires the routes and returns a ready-to-serve Server. When the
 // configured JWT secret is non-empty the /api/v1 routes require authentication.
-// A nil logger falls back to the slog default so tests need no setup.
-func NewServer(cfg *config.Config, svc ShipmentService, logger *slog.Logger) *Server {
+// A nil logger falls back to the slog default so tests need no setup; a nil
+// tracer disables request spans.
+func NewServer(cfg *config.Config, svc ShipmentService, logger *slog.Logger, tracer *tracing.Tracer) *Server {
 	if logger == nil {
 		logger = slog.Default()
 	}
@@ -53,6 +62,11 @@ func NewServer(cfg *config.Config, svc ShipmentService, logger *slog.Logger) *Se
 		router:  mux.NewRouter(),
 		logger:  logger,
 		metrics: metrics.NewCollector(),
+		health:  health.NewChecker(0),
+		tracer:  tracer,
+	}
+	if cfg != nil {
+		s.metrics = metrics.NewCollectorWith(metrics.CollectorConfig{Buckets: cfg.Metrics.Buckets})
 	}
 	if cfg != nil && cfg.Auth.JWTSecret != "" {
 		s.auth = auth.NewManager(cfg.Auth.JWTSecret, cfg.Auth.TokenExpiry)
@@ -61,6 +75,39 @@ func NewServer(cfg *config.Config, svc ShipmentService, logger *slog.Logger) *Se
 	return s
 }
 
+// Health returns the readiness checker served at /readyz, for the caller to
+// register dependency checks on.
+func (s *Server) Health() *health.Checker {
+	return s.health
+}
+
+// Metrics returns the registry rendered at /metrics after the HTTP metrics,
+// for the caller to register service metrics on.
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics.Registry()
+}
+
+// HandleLogLevel serves /admin/log-level for reading and changing level, to
+// callers holding the logging:manage permission. It is not registered when
+// authentication is disabled.
+func (s *Server) HandleLogLevel(level *slog.LevelVar) {
+	if s.auth == nil {
+		return
+	}
+	s.router.Handle("/admin/log-level", s.auth.Middleware(auth.RequirePermission(auth.PermLoggingManage)(logging.LevelHandler(level)))).
+		Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodOptions)
+}
+
+// clientIPConfig trusts the configured proxies' forwarding headers. The list
+// was validated when the configuration was loaded.
+func (s *Server) clientIPConfig() httpx.ClientIPConfig {
+	if s.config == nil {
+		return httpx.ClientIPConfig{}
+	}
+	trusted, _ := httpx.ParseTrustedProxies(s.config.Server.TrustedProxies)
+	return httpx.ClientIPConfig{TrustedProxies: trusted, Header: s.config.Server.ClientIPHeader}
+}
+
 // Router returns the configured router.
 func (s *Server) Router() *mux.Router {
 	return s.router
@@ -70,6 +117,9 @@ func (s *Server) setupRoutes() {
 	// Shared, structured middleware replaces the previous ad-hoc logging and
 	// atomic request counter.
 	s.router.Use(httpx.RequestID)
+	s.router.Use(replica.Middleware)
+	s.router.Use(httpx.ResolveClientIP(s.clientIPConfig()))
+	s.router.Use(tracing.Middleware(s.tracer))
 	s.router.Use(httpx.Logger(s.logger))
 	s.router.Use(httpx.Recoverer(s.logger))
 	s.router.Use(httpx.SecurityHeaders)
@@ -77,6 +127,8 @@ func (s *Server) setupRoutes() {
 	s.router.Use(s.corsMiddleware)
 
 	s.router.HandleFunc("/health", s.healthCheckHandler).Methods(http.MethodGet, http.MethodOptions)
+	s.router.Handle("/livez", health.LiveHandler()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.Handle("/readyz", s.health.Handler()).Methods(http.MethodGet, http.MethodOptions)
 	s.router.Handle("/metrics", s.metrics.Handler()).Methods(http.MethodGet, http.MethodOptions)
 
 	api := s.router.PathPrefix("/api/v1").Subrouter()
@@ -84,21 +136,24 @@ func (s *Server) setupRoutes() {
 		api.Use(s.auth.Middleware)
 	}
 
-	api.HandleFunc("/shipments", s.handleGetShipments).Methods(http.MethodGet, http.MethodOptions)
-	api.HandleFunc("/shipments", s.handleCreateShipment).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/shipments/{id}", s.handleGetShipment).Methods(http.MethodGet, http.MethodOptions)
-	api.HandleFunc("/shipments/{id}", s.handleUpdateShipment).Methods(http.MethodPut, http.MethodOptions)
-	api.HandleFunc("/shipments/{id}/status", s.handleUpdateShipmentStatus).Methods(http.MethodPut, http.MethodOptions)
-	api.HandleFunc("/shipments/{id}/track", s.handleTrackShipment).Methods(http.MethodGet, http.MethodOptions)
+	// Each route requires its permission when authentication is enabled.
+	api.Handle("/shipments", s.permit(auth.PermShipmentRead, s.handleGetShipments)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/shipments", s.permit(auth.PermShipmentWrite, s.handleCreateShipment)).Methods(http.MethodPost, http.MethodOptions)
+	// Registered before /shipments/{id} so "summary" is not taken for an ID.
+	api.Handle("/shipments/summary", s.permit(auth.PermShipmentRead, s.handleShipmentSummary)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/shipments/{id}", s.permit(auth.PermShipmentRead, s.handleGetShipment)).Methods(http.MethodGet, http.MethodOptions)
+	api.Handle("/shipments/{id}", s.permit(auth.PermShipmentWrite, s.handleUpdateShipment)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/shipments/{id}", s.permit(auth.PermShipmentDelete, s.handleDeleteShipment)).Methods(http.MethodDelete, http.MethodOptions)
+	api.Handle("/shipments/{id}/status", s.permit(auth.PermShipmentWrite, s.handleUpdateShipmentStatus)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/shipments/{id}/track", s.permit(auth.PermShipmentRead, s.handleTrackShipment)).Methods(http.MethodGet, http.MethodOptions)
+}
 
-	// Deletion is restricted to elevated roles when auth is enabled.
-	if s.auth != nil {
-		api.Handle("/shipments/{id}",
-			auth.RequireRole(auth.RoleAdmin, auth.RoleManager)(http.HandlerFunc(s.handleDeleteShipment)),
-		).Methods(http.MethodDelete, http.MethodOptions)
-	} else {
-		api.HandleFunc("/shipments/{id}", s.handleDeleteShipment).Methods(http.MethodDelete, http.MethodOptions)
+// permit requires perm for h when authentication is enabled.
+func (s *Server) permit(perm string, h http.HandlerFunc) http.Handler {
+	if s.auth == nil {
+		return h
 	}
+	return auth.RequirePermission(perm)(h)
 }
 
 // Middleware
@@ -107,7 +162,7 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+replica.Header)
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -140,6 +195,15 @@ func (s *Server) handleGetShipments(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, httpx.Page{Data: shipments, Total: total, Limit: limit, Offset: offset})
 }
 
+func (s *Server) handleShipmentSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.service.Summary(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, summary)
+}
+
 func (s *Server) handleCreateShipment(w http.ResponseWriter, r *http.Request) {
 	var shipment models.Shipment
 	if err := json.NewDecoder(r.Body).Decode(&shipment); err != nil {
@@ -147,7 +211,7 @@ func (s *Server) handleCreateShipment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.service.CreateShipment(r.Context(), &shipment); err != nil {
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		s.writeServiceError(w, err)
 		return
 	}
 	s.writeJSON(w, http.StatusCreated, shipment)
@@ -228,11 +292,14 @@ func (s *Server) handleTrackShipment(w http.ResponseWriter, r *http.Request) {
 // Helpers
 
 func (s *Server) writeServiceError(w http.ResponseWriter, err error) {
-	if errors.Is(err, service.ErrNotFound) {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
 		s.writeError(w, http.StatusNotFound, "shipment not found")
-		return
+	case errors.Is(err, service.ErrForbidden):
+		s.writeError(w, http.StatusForbidden, "shipment outside your assigned locations")
+	default:
+		s.writeError(w, http.StatusInternalServerError, err.Error())
 	}
-	s.writeError(w, http.StatusInternalServerError, err.Error())
 }
 
 func (s *Server) writeJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -3,15 +3,16 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/rahmanazhar/FoodSupplyChain/internal/shipment/config"
 	"github.com/rahmanazhar/FoodSupplyChain/internal/shipment/service"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
 )
 
@@ -98,13 +99,22 @@ func (f *fakeShipmentService) ListShipmentEvents(ctx context.Context, id string)
 	return []models.ShipmentEvent{}, nil
 }
 
+func (f *fakeShipmentService) Summary(ctx context.Context) (*models.ShipmentSummary, error) {
+	summary := &models.ShipmentSummary{ByStatus: map[string]int{}}
+	for _, v := range f.items {
+		summary.ByStatus[v.Status]++
+		summary.Total++
+	}
+	return summary, nil
+}
+
 func errNotFound() error { return service.ErrNotFound }
 
 func newTestServer(svc ShipmentService) *Server {
 	cfg := &config.Config{}
 	cfg.Auth.JWTSecret = testSecret
 	cfg.Auth.TokenExpiry = time.Hour
-	return NewServer(cfg, svc, nil)
+	return NewServer(cfg, svc, nil, nil)
 }
 
 func tokenFor(t *testing.T, role string) string {
@@ -126,6 +136,33 @@ func TestHealthIsPublic(t *testing.T) {
 	}
 }
 
+func TestProbesArePublicAndReadinessReflectsChecks(t *testing.T) {
+	srv := newTestServer(newFake())
+	natsUp := true
+	srv.Health().Add("nats", func(ctx context.Context) error {
+		if !natsUp {
+			return errors.New("nats connection CLOSED")
+		}
+		return nil
+	})
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("readyz = %d, want 200", code)
+	}
+	natsUp = false
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz with NATS down = %d, want 503", code)
+	}
+	if code := probe("/livez"); code != http.StatusOK {
+		t.Errorf("livez with NATS down = %d, want 200", code)
+	}
+}
+
 func TestListShipmentsRequiresAuth(t *testing.T) {
 	srv := newTestServer(newFake())
 	rec := httptest.NewRecorder()
@@ -198,6 +235,24 @@ func TestListShipmentsSearchAndStatus(t *testing.T) {
 	}
 }
 
+func TestShipmentSummaryIsNotTakenForAnID(t *testing.T) {
+	fake := newFake()
+	fake.items["s1"] = &models.Shipment{ID: "s1", Status: "pending"}
+	fake.items["s2"] = &models.Shipment{ID: "s2", Status: "pending"}
+	srv := newTestServer(fake)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/shipments/summary", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenFor(t, auth.RoleViewer))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var got models.ShipmentSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Total != 2 || got.ByStatus["pending"] != 2 {
+		t.Fatalf("summary = %+v (%v)", got, err)
+	}
+}
+
 func TestCreateShipment(t *testing.T) {
 	fake := newFake()
 	srv := newTestServer(fake)
@@ -248,3 +303,27 @@ func TestDeleteRequiresElevatedRole(t *testing.T) {
 		t.Fatalf("admin delete status = %d, want 204", rec.Code)
 	}
 }
+
+func TestViewerCannotWriteShipments(t *testing.T) {
+	fake := newFake()
+	fake.items["s1"] = &models.Shipment{ID: "s1", Status: "pending"}
+	srv := newTestServer(fake)
+	token := tokenFor(t, auth.RoleViewer)
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPost, "/api/v1/shipments"},
+		{http.MethodPut, "/api/v1/shipments/s1"},
+		{http.MethodPut, "/api/v1/shipments/s1/status"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"status":"delivered"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("viewer %s %s = %d, want 403", tc.method, tc.path, rec.Code)
+		}
+	}
+	if fake.items["s1"].Status != "pending" {
+		t.Errorf("status = %q, want pending", fake.items["s1"].Status)
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/replica"
+)
+
+// gormStore is the PostgreSQL Store. Writes and Get go to primary; lists and
+// reports go to reader, which is a healthy replica when there is one. Inside
+// Atomic both are the transaction.
+type gormStore struct {
+	primary func(context.Context) *gorm.DB
+	reader  func(context.Context) *gorm.DB
+}
+
+// NewGORMStore returns a Store writing to the primary of replicas and reading
+// lists and reports from its replicas.
+func NewGORMStore(replicas *replica.Set) Store {
+	return &gormStore{primary: replicas.Primary, reader: replicas.Reader}
+}
+
+func (s *gormStore) Shipments() ShipmentRepository { return gormShipments{s} }
+
+// Atomic implements Store with a database transaction.
+func (s *gormStore) Atomic(ctx context.Context, fn func(Store) error) error {
+	return s.primary(ctx).Transaction(func(tx *gorm.DB) error {
+		db := func(ctx context.Context) *gorm.DB { return tx.WithContext(ctx) }
+		return fn(&gormStore{primary: db, reader: db})
+	})
+}
+
+type gormShipments struct{ *gormStore }
+
+// restrict limits a shipment query to the shipments in scope.
+func restrict(q *gorm.DB, scope Scope) *gorm.DB {
+	if scope.Restricted {
+		return q.Where("shipments.origin_location_id IN ? OR shipments.destination_location_id IN ?", scope.Locations, scope.Locations)
+	}
+	return q
+}
+
+func (s gormShipments) List(ctx context.Context, filter ShipmentFilter) ([]models.Shipment, int, error) {
+	base := s.reader(ctx).Model(&models.Shipment{})
+	if filter.Search != "" {
+		like := "%" + strings.ToLower(filter.Search) + "%"
+		base = base.Where(
+			"LOWER(order_id) LIKE ? OR LOWER(origin) LIKE ? OR LOWER(destination) LIKE ? OR LOWER(id) LIKE ?",
+			like, like, like, like,
+		)
+	}
+	if filter.Status != "" {
+		base = base.Where("status = ?", filter.Status)
+	}
+	base = restrict(base, filter.Scope)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count shipments: %w", err)
+	}
+
+	var shipments []models.Shipment
+	if err := base.
+		Order("created_at desc").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Find(&shipments).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list shipments: %w", err)
+	}
+	return shipments, int(total), nil
+}
+
+func (s gormShipments) Get(ctx context.Context, id string) (*models.Shipment, error) {
+	var shipment models.Shipment
+	if err := s.primary(ctx).First(&shipment, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get shipment: %w", err)
+	}
+	return &shipment, nil
+}
+
+func (s gormShipments) Create(ctx context.Context, shipment *models.Shipment) error {
+	if err := s.primary(ctx).Create(shipment).Error; err != nil {
+		return fmt.Errorf("failed to create shipment: %w", err)
+	}
+	return nil
+}
+
+func (s gormShipments) Update(ctx context.Context, shipment *models.Shipment) error {
+	if err := s.primary(ctx).Save(shipment).Error; err != nil {
+		return fmt.Errorf("failed to update shipment: %w", err)
+	}
+	return nil
+}
+
+func (s gormShipments) Delete(ctx context.Context, id string) error {
+	return s.primary(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("shipment_id = ?", id).Delete(&models.ShipmentEvent{}).Error; err != nil {
+			return fmt.Errorf("failed to delete shipment events: %w", err)
+		}
+		if err := tx.Where("shipment_id = ?", id).Delete(&models.ShipmentAlert{}).Error; err != nil {
+			return fmt.Errorf("failed to delete shipment alerts: %w", err)
+		}
+		result := tx.Delete(&models.Shipment{}, "id = ?", id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete shipment: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s gormShipments) AddEvent(ctx context.Context, event *models.ShipmentEvent) error {
+	if err := s.primary(ctx).Omit(clause.Associations).Create(event).Error; err != nil {
+		return fmt.Errorf("failed to create shipment event: %w", err)
+	}
+	return nil
+}
+
+func (s gormShipments) Events(ctx context.Context, shipmentID string) ([]models.ShipmentEvent, error) {
+	var events []models.ShipmentEvent
+	if err := s.reader(ctx).
+		Where("shipment_id = ?", shipmentID).
+		Order("created_at asc").
+		Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to list shipment events: %w", err)
+	}
+	return events, nil
+}
+
+func (s gormShipments) AddAlert(ctx context.Context, alert *models.ShipmentAlert) error {
+	if err := s.primary(ctx).Omit(clause.Associations).Create(alert).Error; err != nil {
+		return fmt.Errorf("failed to create shipment alert: %w", err)
+	}
+	return nil
+}
+
+func (s gormShipments) Summary(ctx context.Context, scope Scope, preview int) (*models.ShipmentSummary, error) {
+	db := s.reader(ctx)
+
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	if err := restrict(db.Model(&models.Shipment{}), scope).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count shipments: %w", err)
+	}
+	summary := &models.ShipmentSummary{ByStatus: make(map[string]int, len(rows))}
+	for _, row := range rows {
+		summary.ByStatus[row.Status] = row.Count
+		summary.Total += row.Count
+	}
+
+	var late, alerts int64
+	if err := restrict(db.Model(&models.Shipment{}), scope).
+		Where("status NOT IN ?", closedStatuses).
+		Where("estimated_arrival > ? AND estimated_arrival < ?", time.Time{}, time.Now()).
+		Count(&late).Error; err != nil {
+		return nil, fmt.Errorf("failed to count late shipments: %w", err)
+	}
+	if err := restrict(db.Model(&models.ShipmentAlert{}).
+		Joins("JOIN shipments ON shipments.id = shipment_alerts.shipment_id").
+		Where("shipment_alerts.status <> ?", "resolved"), scope).
+		Count(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count alerts: %w", err)
+	}
+	summary.Late, summary.OpenAlerts = int(late), int(alerts)
+
+	if err := restrict(db.Order("created_at desc"), scope).
+		Limit(preview).
+		Find(&summary.Recent).Error; err != nil {
+		return nil, fmt.Errorf("failed to list recent shipments: %w", err)
+	}
+	return summary, nil
+}
+
+func (s gormShipments) CountByStatus(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	if err := s.reader(ctx).Model(&models.Shipment{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count shipments: %w", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+func (s gormShipments) OpenAlerts(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		Type  string
+		Count int
+	}
+	if err := s.reader(ctx).Model(&models.ShipmentAlert{}).
+		Where("status <> ?", "resolved").
+		Select("type, COUNT(*) AS count").
+		Group("type").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count alerts: %w", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+	return counts, nil
+}
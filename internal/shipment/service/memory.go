@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// Memory is an in-process Store for tests. It enforces the schema's keys
+// (unique IDs, events and alerts referencing their shipment) and rolls Atomic
+// back on error, so service logic behaves as it does against PostgreSQL.
+// Records are copied in and out; callers never share them with the store.
+type Memory struct {
+	mu *sync.Mutex
+	// held is set on the Store passed to an Atomic function, whose caller
+	// already holds mu.
+	held bool
+	data *memoryData
+}
+
+type memoryData struct {
+	shipments map[string]models.Shipment
+	events    []models.ShipmentEvent
+	alerts    []models.ShipmentAlert
+}
+
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		shipments: maps.Clone(d.shipments),
+		events:    slices.Clone(d.events),
+		alerts:    slices.Clone(d.alerts),
+	}
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		mu:   new(sync.Mutex),
+		data: &memoryData{shipments: make(map[string]models.Shipment)},
+	}
+}
+
+func (m *Memory) lock() func() {
+	if m.held {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+func (m *Memory) Shipments() ShipmentRepository { return memoryShipments{m} }
+
+// Atomic implements Store. Other callers wait until fn returns; when it fails,
+// the store is restored to its state before fn ran.
+func (m *Memory) Atomic(ctx context.Context, fn func(Store) error) error {
+	defer m.lock()()
+	saved := m.data.clone()
+	if err := fn(&Memory{mu: m.mu, held: true, data: m.data}); err != nil {
+		*m.data = *saved
+		return err
+	}
+	return nil
+}
+
+type memoryShipments struct{ *Memory }
+
+// matches reports whether shipment satisfies the search and status of filter.
+func (f ShipmentFilter) matches(shipment *models.Shipment) bool {
+	if f.Status != "" && shipment.Status != f.Status {
+		return false
+	}
+	if f.Search == "" {
+		return true
+	}
+	search := strings.ToLower(f.Search)
+	for _, field := range []string{shipment.OrderID, shipment.Origin, shipment.Destination, shipment.ID} {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// newestFirst sorts shipments by creation time, newest first.
+func newestFirst(shipments []models.Shipment) {
+	sort.Slice(shipments, func(i, j int) bool { return shipments[i].CreatedAt.After(shipments[j].CreatedAt) })
+}
+
+func (m memoryShipments) List(ctx context.Context, filter ShipmentFilter) ([]models.Shipment, int, error) {
+	defer m.lock()()
+	var shipments []models.Shipment
+	for _, shipment := range m.data.shipments {
+		if filter.Scope.Includes(&shipment) && filter.matches(&shipment) {
+			shipments = append(shipments, shipment)
+		}
+	}
+	newestFirst(shipments)
+
+	total := len(shipments)
+	shipments = shipments[min(filter.Offset, total):]
+	if filter.Limit > 0 && filter.Limit < len(shipments) {
+		shipments = shipments[:filter.Limit]
+	}
+	return shipments, total, nil
+}
+
+func (m memoryShipments) Get(ctx context.Context, id string) (*models.Shipment, error) {
+	defer m.lock()()
+	shipment, ok := m.data.shipments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &shipment, nil
+}
+
+func (m memoryShipments) Create(ctx context.Context, shipment *models.Shipment) error {
+	defer m.lock()()
+	if _, ok := m.data.shipments[shipment.ID]; ok {
+		return fmt.Errorf("failed to create shipment: duplicate id %s", shipment.ID)
+	}
+	m.data.shipments[shipment.ID] = *shipment
+	return nil
+}
+
+func (m memoryShipments) Update(ctx context.Context, shipment *models.Shipment) error {
+	defer m.lock()()
+	if _, ok := m.data.shipments[shipment.ID]; !ok {
+		return fmt.Errorf("failed to update shipment: %w", ErrNotFound)
+	}
+	m.data.shipments[shipment.ID] = *shipment
+	return nil
+}
+
+func (m memoryShipments) Delete(ctx context.Context, id string) error {
+	defer m.lock()()
+	if _, ok := m.data.shipments[id]; !ok {
+		return ErrNotFound
+	}
+	m.data.events = slices.DeleteFunc(m.data.events, func(e models.ShipmentEvent) bool {
+		return e.ShipmentID == id
+	})
+	m.data.alerts = slices.DeleteFunc(m.data.alerts, func(a models.ShipmentAlert) bool {
+		return a.ShipmentID == id
+	})
+	delete(m.data.shipments, id)
+	return nil
+}
+
+func (m memoryShipments) AddEvent(ctx context.Context, event *models.ShipmentEvent) error {
+	defer m.lock()()
+	if _, ok := m.data.shipments[event.ShipmentID]; !ok {
+		return fmt.Errorf("failed to create shipment event: shipment %s does not exist", event.ShipmentID)
+	}
+	saved := *event
+	saved.Shipment = models.Shipment{}
+	m.data.events = append(m.data.events, saved)
+	return nil
+}
+
+func (m memoryShipments) Events(ctx context.Context, shipmentID string) ([]models.ShipmentEvent, error) {
+	defer m.lock()()
+	var events []models.ShipmentEvent
+	for _, e := range m.data.events {
+		if e.ShipmentID == shipmentID {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+	return events, nil
+}
+
+func (m memoryShipments) AddAlert(ctx context.Context, alert *models.ShipmentAlert) error {
+	defer m.lock()()
+	if _, ok := m.data.shipments[alert.ShipmentID]; !ok {
+		return fmt.Errorf("failed to create shipment alert: shipment %s does not exist", alert.ShipmentID)
+	}
+	saved := *alert
+	saved.Shipment = models.Shipment{}
+	m.data.alerts = append(m.data.alerts, saved)
+	return nil
+}
+
+func (m memoryShipments) Summary(ctx context.Context, scope Scope, preview int) (*models.ShipmentSummary, error) {
+	defer m.lock()()
+	summary := &models.ShipmentSummary{ByStatus: make(map[string]int)}
+	now := time.Now()
+	var recent []models.Shipment
+	for _, shipment := range m.data.shipments {
+		if !scope.Includes(&shipment) {
+			continue
+		}
+		summary.ByStatus[shipment.Status]++
+		summary.Total++
+		eta := shipment.EstimatedArrival
+		if !slices.Contains(closedStatuses, shipment.Status) && eta.After(time.Time{}) && eta.Before(now) {
+			summary.Late++
+		}
+		recent = append(recent, shipment)
+	}
+	for _, alert := range m.data.alerts {
+		shipment := m.data.shipments[alert.ShipmentID]
+		if alert.Status != "resolved" && scope.Includes(&shipment) {
+			summary.OpenAlerts++
+		}
+	}
+	newestFirst(recent)
+	summary.Recent = recent[:min(preview, len(recent))]
+	return summary, nil
+}
+
+func (m memoryShipments) CountByStatus(ctx context.Context) (map[string]int, error) {
+	defer m.lock()()
+	counts := make(map[string]int)
+	for _, shipment := range m.data.shipments {
+		counts[shipment.Status]++
+	}
+	return counts, nil
+}
+
+func (m memoryShipments) OpenAlerts(ctx context.Context) (map[string]int, error) {
+	defer m.lock()()
+	counts := make(map[string]int)
+	for _, alert := range m.data.alerts {
+		if alert.Status != "resolved" {
+			counts[alert.Type]++
+		}
+	}
+	return counts, nil
+}
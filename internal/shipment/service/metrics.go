@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
+)
+
+// RegisterMetrics adds the service's connection pool, event publish and
+// business metrics. Shipment and alert gauges are queried on each scrape and
+// cover every location, regardless of any caller's scope.
+func (s *ShipmentService) RegisterMetrics(r *metrics.Registry) error {
+	if s.db != nil {
+		sqlDB, err := s.db.DB()
+		if err != nil {
+			return fmt.Errorf("failed to get database instance: %v", err)
+		}
+		r.Register(metrics.DBStats(sqlDB), s.replicas.Metric())
+	}
+	r.Register(
+		s.publishes,
+		metrics.NewGaugeFunc("shipments", "Shipments by status.",
+			[]string{"status"}, s.collectShipments),
+		metrics.NewGaugeFunc("shipment_open_alerts", "Shipment alerts not yet resolved, by type.",
+			[]string{"type"}, s.collectOpenAlerts),
+	)
+	return nil
+}
+
+func (s *ShipmentService) collectShipments(ctx context.Context, set func(float64, ...string)) error {
+	counts, err := s.store.Shipments().CountByStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for status, count := range counts {
+		set(float64(count), status)
+	}
+	return nil
+}
+
+func (s *ShipmentService) collectOpenAlerts(ctx context.Context, set func(float64, ...string)) error {
+	counts, err := s.store.Shipments().OpenAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	for typ, count := range counts {
+		set(float64(count), typ)
+	}
+	return nil
+}
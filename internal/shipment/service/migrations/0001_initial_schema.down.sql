@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS shipment_alerts;
+DROP TABLE IF EXISTS carriers;
+DROP TABLE IF EXISTS shipment_events;
+DROP TABLE IF EXISTS shipments;
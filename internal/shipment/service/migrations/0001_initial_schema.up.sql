@@ -0,0 +1,54 @@
+-- The schema previously created by GORM's AutoMigrate. IF NOT EXISTS lets
+-- databases set up that way adopt migrations without changes.
+
+CREATE TABLE IF NOT EXISTS shipments (
+    id                text PRIMARY KEY,
+    order_id          text NOT NULL,
+    status            text NOT NULL,
+    origin            text NOT NULL,
+    destination       text NOT NULL,
+    estimated_arrival timestamptz,
+    actual_arrival    timestamptz,
+    carrier_id        text,
+    tracking_number   text,
+    notes             text,
+    created_at        timestamptz,
+    updated_at        timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_shipments_order_id ON shipments (order_id);
+CREATE INDEX IF NOT EXISTS idx_shipments_carrier_id ON shipments (carrier_id);
+
+CREATE TABLE IF NOT EXISTS shipment_events (
+    id          text PRIMARY KEY,
+    shipment_id text NOT NULL,
+    type        text NOT NULL,
+    location    text,
+    description text,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    CONSTRAINT fk_shipment_events_shipment FOREIGN KEY (shipment_id) REFERENCES shipments (id)
+);
+CREATE INDEX IF NOT EXISTS idx_shipment_events_shipment_id ON shipment_events (shipment_id);
+
+CREATE TABLE IF NOT EXISTS carriers (
+    id           text PRIMARY KEY,
+    name         text NOT NULL,
+    code         text NOT NULL,
+    contact_info text,
+    active       boolean DEFAULT true,
+    created_at   timestamptz,
+    updated_at   timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_carriers_code ON carriers (code);
+
+CREATE TABLE IF NOT EXISTS shipment_alerts (
+    id          text PRIMARY KEY,
+    shipment_id text NOT NULL,
+    type        text NOT NULL,
+    message     text NOT NULL,
+    status      text NOT NULL,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    CONSTRAINT fk_shipment_alerts_shipment FOREIGN KEY (shipment_id) REFERENCES shipments (id)
+);
+CREATE INDEX IF NOT EXISTS idx_shipment_alerts_shipment_id ON shipment_alerts (shipment_id);
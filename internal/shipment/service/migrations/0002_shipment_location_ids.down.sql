@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_shipments_destination_location_id;
+DROP INDEX IF EXISTS idx_shipments_origin_location_id;
+ALTER TABLE shipments DROP COLUMN IF EXISTS destination_location_id;
+ALTER TABLE shipments DROP COLUMN IF EXISTS origin_location_id;
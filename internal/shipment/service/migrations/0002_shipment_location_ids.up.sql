@@ -0,0 +1,6 @@
+-- Location IDs of the shipment's ends. Location-scoped callers are matched
+-- against these rather than the free-text origin and destination.
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS origin_location_id text;
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS destination_location_id text;
+CREATE INDEX IF NOT EXISTS idx_shipments_origin_location_id ON shipments (origin_location_id);
+CREATE INDEX IF NOT EXISTS idx_shipments_destination_location_id ON shipments (destination_location_id);
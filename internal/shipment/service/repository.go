@@ -3,12 +3,8 @@ package service
 import (
 	"context"
 	"errors"
-	"fmt"
-	"strings"
-	"time"
-
-	"gorm.io/gorm"
 
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
 )
 
@@ -16,118 +12,93 @@ import (
 // it to an HTTP 404 response.
 var ErrNotFound = errors.New("record not found")
 
-// ListShipments returns a page of shipments and the total number of matching
-// records. When search is non-empty it filters by order_id/origin/destination/id
-// (case-insensitively); when status is non-empty it filters by exact status.
-func (s *ShipmentService) ListShipments(ctx context.Context, limit, offset int, search, status string) ([]models.Shipment, int, error) {
-	base := s.db.WithContext(ctx).Model(&models.Shipment{})
-	if search != "" {
-		like := "%" + strings.ToLower(search) + "%"
-		base = base.Where(
-			"LOWER(order_id) LIKE ? OR LOWER(origin) LIKE ? OR LOWER(destination) LIKE ? OR LOWER(id) LIKE ?",
-			like, like, like, like,
-		)
-	}
-	if status != "" {
-		base = base.Where("status = ?", status)
-	}
+// ErrForbidden is returned when the caller is restricted to particular
+// locations and neither end of the shipment is one of them. Handlers map it to
+// an HTTP 403 response.
+var ErrForbidden = errors.New("shipment outside caller's location scope")
 
-	var total int64
-	if err := base.Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count shipments: %w", err)
-	}
+// inScope reports whether the caller in ctx may access the shipment: callers
+// scoped to locations must be assigned to its origin or destination location.
+func inScope(ctx context.Context, shipment *models.Shipment) bool {
+	return scopeOf(ctx).Includes(shipment)
+}
 
-	var shipments []models.Shipment
-	if err := base.
-		Order("created_at desc").
-		Limit(limit).
-		Offset(offset).
-		Find(&shipments).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to list shipments: %w", err)
-	}
-	return shipments, int(total), nil
+// Store gives the service its repositories. GORM backs it in production
+// (NewGORMStore); Memory backs it in tests.
+type Store interface {
+	Shipments() ShipmentRepository
+
+	// Atomic runs fn with a Store whose writes are committed together when fn
+	// returns nil and discarded when it returns an error.
+	Atomic(ctx context.Context, fn func(Store) error) error
 }
 
-// GetShipment returns a single shipment by ID, or ErrNotFound.
-func (s *ShipmentService) GetShipment(ctx context.Context, id string) (*models.Shipment, error) {
-	var shipment models.Shipment
-	if err := s.db.WithContext(ctx).First(&shipment, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrNotFound
-		}
-		return nil, fmt.Errorf("failed to get shipment: %w", err)
-	}
-	return &shipment, nil
+// Scope restricts queries to shipments from or to the locations a caller is
+// assigned to. The zero Scope is unrestricted.
+type Scope struct {
+	Restricted bool
+	Locations  []string
 }
 
-// UpdateShipment applies the non-empty fields of update to an existing shipment.
-func (s *ShipmentService) UpdateShipment(ctx context.Context, id string, update *models.Shipment) (*models.Shipment, error) {
-	var shipment models.Shipment
-	if err := s.db.WithContext(ctx).First(&shipment, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrNotFound
-		}
-		return nil, fmt.Errorf("failed to get shipment: %w", err)
-	}
+// scopeOf returns the location scope of the caller in ctx.
+func scopeOf(ctx context.Context) Scope {
+	ids, scoped := auth.LocationScope(ctx)
+	return Scope{Restricted: scoped, Locations: ids}
+}
 
-	if update.Status != "" {
-		shipment.Status = update.Status
-	}
-	if update.Origin != "" {
-		shipment.Origin = update.Origin
-	}
-	if update.Destination != "" {
-		shipment.Destination = update.Destination
+// Includes reports whether the scope covers the origin or destination location
+// of shipment. The free-text Origin and Destination are never compared, so a
+// shipment with no location IDs is only visible to unrestricted callers.
+func (s Scope) Includes(shipment *models.Shipment) bool {
+	if !s.Restricted {
+		return true
 	}
-	if update.CarrierID != "" {
-		shipment.CarrierID = update.CarrierID
-	}
-	if update.TrackingNumber != "" {
-		shipment.TrackingNumber = update.TrackingNumber
-	}
-	if update.Notes != "" {
-		shipment.Notes = update.Notes
-	}
-	if !update.EstimatedArrival.IsZero() {
-		shipment.EstimatedArrival = update.EstimatedArrival
-	}
-	shipment.UpdatedAt = time.Now()
-
-	if err := s.db.WithContext(ctx).Save(&shipment).Error; err != nil {
-		return nil, fmt.Errorf("failed to update shipment: %w", err)
+	for _, id := range s.Locations {
+		if id == shipment.OriginLocationID || id == shipment.DestinationLocationID {
+			return true
+		}
 	}
-	return &shipment, nil
+	return false
 }
 
-// DeleteShipment removes a shipment and its dependent events and alerts in a
-// single transaction, or returns ErrNotFound.
-func (s *ShipmentService) DeleteShipment(ctx context.Context, id string) error {
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("shipment_id = ?", id).Delete(&models.ShipmentEvent{}).Error; err != nil {
-			return fmt.Errorf("failed to delete shipment events: %w", err)
-		}
-		if err := tx.Where("shipment_id = ?", id).Delete(&models.ShipmentAlert{}).Error; err != nil {
-			return fmt.Errorf("failed to delete shipment alerts: %w", err)
-		}
-		result := tx.Delete(&models.Shipment{}, "id = ?", id)
-		if result.Error != nil {
-			return fmt.Errorf("failed to delete shipment: %w", result.Error)
-		}
-		if result.RowsAffected == 0 {
-			return ErrNotFound
-		}
-		return nil
-	})
+// ShipmentFilter selects a page of shipments.
+type ShipmentFilter struct {
+	// Search matches order IDs, origins, destinations and shipment IDs,
+	// case-insensitively; Status matches exactly.
+	Search        string
+	Status        string
+	Scope         Scope
+	Limit, Offset int
 }
 
-// ListShipmentEvents returns the lifecycle events for a shipment, oldest first.
-func (s *ShipmentService) ListShipmentEvents(ctx context.Context, shipmentID string) ([]models.ShipmentEvent, error) {
-	var shipmentEvents []models.ShipmentEvent
-	if err := s.db.WithContext(ctx).
-		Where("shipment_id = ?", shipmentID).
-		Order("created_at asc").
-		Find(&shipmentEvents).Error; err != nil {
-		return nil, fmt.Errorf("failed to list shipment events: %w", err)
-	}
-	return shipmentEvents, nil
+// ShipmentRepository stores shipments together with their events and alerts.
+type ShipmentRepository interface {
+	// List returns a page of the shipments matching filter, newest first, and
+	// the number of matching shipments.
+	List(ctx context.Context, filter ShipmentFilter) ([]models.Shipment, int, error)
+	// Get returns a shipment, or ErrNotFound. It reads from the primary.
+	Get(ctx context.Context, id string) (*models.Shipment, error)
+	Create(ctx context.Context, shipment *models.Shipment) error
+	// Update saves every field of an existing shipment.
+	Update(ctx context.Context, shipment *models.Shipment) error
+	// Delete removes a shipment with its events and alerts, or returns
+	// ErrNotFound.
+	Delete(ctx context.Context, id string) error
+
+	AddEvent(ctx context.Context, event *models.ShipmentEvent) error
+	// Events returns the events of a shipment, oldest first.
+	Events(ctx context.Context, shipmentID string) ([]models.ShipmentEvent, error)
+	AddAlert(ctx context.Context, alert *models.ShipmentAlert) error
+
+	// Summary rolls up the shipments in scope for the dashboard; Recent holds
+	// at most preview shipments.
+	Summary(ctx context.Context, scope Scope, preview int) (*models.ShipmentSummary, error)
+	// CountByStatus counts every shipment by status.
+	CountByStatus(ctx context.Context) (map[string]int, error)
+	// OpenAlerts counts the alerts not yet resolved by type.
+	OpenAlerts(ctx context.Context) (map[string]int, error)
 }
+
+// closedStatuses are the statuses of shipments no longer under way, which
+// can't be late.
+var closedStatuses = []string{"delivered", "cancelled"}
@@ -2,8 +2,8 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -13,54 +13,71 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
-	"github.com/rahmanazhar/FoodSupplyChain/internal/shipment/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/health"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
 	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/replica"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
 )
 
 // ShipmentService handles the core business logic for shipment management
 type ShipmentService struct {
-	config *config.Config
-	db     *gorm.DB
-	nc     *nats.Conn
-	js     nats.JetStreamContext
+	config    *config.Config
+	store     Store
+	publisher Publisher
+	publishes *metrics.Publishes
+
+	// Connections opened by NewShipmentService; nil for a service from New.
+	// replicas serves the store's read-only queries (lists, reports,
+	// tracking); its Reader falls back to db.
+	db       *gorm.DB
+	nc       *nats.Conn
+	replicas *replica.Set
 }
 
-// NewShipmentService creates a new shipment service instance
-func NewShipmentService(cfg *config.Config) (*ShipmentService, error) {
-	// Initialize database connection
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Name,
-	)
+// Publisher delivers the service's events.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %v", err)
+// New returns a service keeping its records in store and publishing events
+// through publisher. Tests pair it with a Memory store.
+func New(cfg *config.Config, store Store, publisher Publisher) *ShipmentService {
+	return &ShipmentService{
+		config:    cfg,
+		store:     store,
+		publisher: publisher,
+		publishes: metrics.NewPublishes(cfg.Metrics.Buckets),
 	}
+}
 
-	// Configure connection pool
-	sqlDB, err := db.DB()
+// NewShipmentService creates a new shipment service instance backed by
+// PostgreSQL and NATS JetStream. Queries and event publishes are traced with
+// tracer, which may be nil.
+func NewShipmentService(cfg *config.Config, tracer *tracing.Tracer) (*ShipmentService, error) {
+	db, sqlDB, err := openDB(cfg, cfg.DSN(), tracer, &gorm.Config{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get database instance: %v", err)
+		return nil, err
 	}
 
-	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
-	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
-	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
-
-	// Auto-migrate database schemas
-	if err := db.AutoMigrate(
-		&models.Shipment{},
-		&models.ShipmentEvent{},
-		&models.Carrier{},
-		&models.ShipmentAlert{},
-	); err != nil {
+	// Bring the schema up to date, or only check that it is when migrations
+	// are run separately (the migrate subcommand).
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.Ensure(context.Background(), cfg.Database.MigrateOnStart); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
 
+	// Lists and reports read from the replicas while they're healthy.
+	replicas, err := openReplicas(cfg, db, tracer)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize NATS connection
 	nc, err := nats.Connect(cfg.NATS.URL)
 	if err != nil {
@@ -79,12 +96,81 @@ func NewShipmentService(cfg *config.Config) (*ShipmentService, error) {
 		return nil, err
 	}
 
-	return &ShipmentService{
-		config: cfg,
-		db:     db,
-		nc:     nc,
-		js:     js,
-	}, nil
+	s := New(cfg, NewGORMStore(replicas), jetStream{tracer: tracer, js: js})
+	s.db, s.nc, s.replicas = db, nc, replicas
+	return s, nil
+}
+
+// jetStream publishes to NATS JetStream, carrying the trace context of each
+// publish in the message headers.
+type jetStream struct {
+	tracer *tracing.Tracer
+	js     nats.JetStreamContext
+}
+
+func (p jetStream) Publish(ctx context.Context, subject string, data []byte) error {
+	_, err := p.tracer.Publish(ctx, p.js, subject, data)
+	return err
+}
+
+// openDB connects to the database at dsn and configures the connection pool.
+func openDB(cfg *config.Config, dsn string, tracer *tracing.Tracer, gormCfg *gorm.Config) (*gorm.DB, *sql.DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), gormCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	if err := db.Use(tracing.GORM(tracer)); err != nil {
+		return nil, nil, fmt.Errorf("failed to install query tracing: %v", err)
+	}
+
+	// Configure connection pool
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database instance: %v", err)
+	}
+
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	return db, sqlDB, nil
+}
+
+// openReplicas connects to the configured read replicas.
+func openReplicas(cfg *config.Config, primary *gorm.DB, tracer *tracing.Tracer) (*replica.Set, error) {
+	var replicas []replica.Replica
+	for _, host := range cfg.Database.Replicas.Hosts {
+		dsn, err := cfg.ReplicaDSN(host)
+		if err != nil {
+			return nil, err
+		}
+		// Not pinged: a replica that is down starts out of rotation.
+		db, _, err := openDB(cfg, dsn, tracer, &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			return nil, fmt.Errorf("replica %s: %v", host, err)
+		}
+		replicas = append(replicas, replica.Replica{Name: host, DB: db})
+	}
+	return replica.New(primary, replicas, replica.Config{
+		CheckInterval: cfg.Database.Replicas.CheckInterval,
+		MaxLag:        cfg.Database.Replicas.MaxLag,
+	}), nil
+}
+
+// RegisterHealthChecks adds the service's database and NATS readiness checks.
+func (s *ShipmentService) RegisterHealthChecks(c *health.Checker) {
+	if s.db != nil {
+		c.Add("database", func(ctx context.Context) error {
+			sqlDB, err := s.db.DB()
+			if err != nil {
+				return err
+			}
+			return health.DB(sqlDB)(ctx)
+		})
+	}
+	if s.nc != nil {
+		c.Add("nats", health.NATS(s.nc))
+	}
 }
 
 // Close closes all connections
@@ -93,6 +179,12 @@ func (s *ShipmentService) Close() error {
 		s.nc.Close()
 	}
 
+	if s.replicas != nil {
+		if err := s.replicas.Close(); err != nil {
+			return fmt.Errorf("failed to close replica connections: %v", err)
+		}
+	}
+
 	if s.db != nil {
 		sqlDB, err := s.db.DB()
 		if err != nil {
@@ -106,18 +198,45 @@ func (s *ShipmentService) Close() error {
 	return nil
 }
 
-// CreateShipment creates a new shipment
+// ListShipments returns a page of shipments and the total number of matching
+// records. When search is non-empty it filters by order_id/origin/destination/id
+// (case-insensitively); when status is non-empty it filters by exact status.
+// Callers scoped to locations only see shipments from or to those locations.
+func (s *ShipmentService) ListShipments(ctx context.Context, limit, offset int, search, status string) ([]models.Shipment, int, error) {
+	return s.store.Shipments().List(ctx, ShipmentFilter{
+		Search: search,
+		Status: status,
+		Scope:  scopeOf(ctx),
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// GetShipment returns a single shipment by ID, or ErrNotFound. Shipments
+// outside the caller's location scope are reported as not found.
+func (s *ShipmentService) GetShipment(ctx context.Context, id string) (*models.Shipment, error) {
+	shipment, err := s.store.Shipments().Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !inScope(ctx, shipment) {
+		return nil, ErrNotFound
+	}
+	return shipment, nil
+}
+
+// CreateShipment creates a new shipment together with its "created" event,
+// and publishes the event once both are stored.
 func (s *ShipmentService) CreateShipment(ctx context.Context, shipment *models.Shipment) error {
+	if !inScope(ctx, shipment) {
+		return ErrForbidden
+	}
 	if shipment.ID == "" {
 		shipment.ID = uuid.New().String()
 	}
 	shipment.CreatedAt = time.Now()
 	shipment.UpdatedAt = time.Now()
 
-	if err := s.db.Create(shipment).Error; err != nil {
-		return fmt.Errorf("failed to create shipment: %v", err)
-	}
-
 	// Create initial shipment event
 	event := &models.ShipmentEvent{
 		ID:          uuid.New().String(),
@@ -128,66 +247,163 @@ func (s *ShipmentService) CreateShipment(ctx context.Context, shipment *models.S
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := s.db.Create(event).Error; err != nil {
-		return fmt.Errorf("failed to create shipment event: %v", err)
+	if err := s.store.Atomic(ctx, func(tx Store) error {
+		if err := tx.Shipments().Create(ctx, shipment); err != nil {
+			return err
+		}
+		return tx.Shipments().AddEvent(ctx, event)
+	}); err != nil {
+		return err
 	}
 
 	// Publish event
-	if err := s.publishEvent(fmt.Sprintf("%s.shipment.created", s.config.NATS.SubjectPrefix), event); err != nil {
+	if err := s.publishEvent(ctx, fmt.Sprintf("%s.shipment.created", s.config.NATS.SubjectPrefix), event); err != nil {
 		return fmt.Errorf("failed to publish shipment created event: %v", err)
 	}
 
 	return nil
 }
 
-// UpdateShipmentStatus updates the status of a shipment
-func (s *ShipmentService) UpdateShipmentStatus(ctx context.Context, id string, status string, location string) error {
-	var shipment models.Shipment
-	if err := s.db.First(&shipment, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrNotFound
-		}
-		return fmt.Errorf("failed to find shipment: %v", err)
+// UpdateShipment applies the non-empty fields of update to an existing shipment.
+// A location-scoped caller must be able to access the shipment both before and
+// after the change.
+func (s *ShipmentService) UpdateShipment(ctx context.Context, id string, update *models.Shipment) (*models.Shipment, error) {
+	shipment, err := s.store.Shipments().Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !inScope(ctx, shipment) {
+		return nil, ErrForbidden
 	}
 
-	shipment.Status = status
+	if update.Status != "" {
+		shipment.Status = update.Status
+	}
+	if update.Origin != "" {
+		shipment.Origin = update.Origin
+	}
+	if update.Destination != "" {
+		shipment.Destination = update.Destination
+	}
+	if update.OriginLocationID != "" {
+		shipment.OriginLocationID = update.OriginLocationID
+	}
+	if update.DestinationLocationID != "" {
+		shipment.DestinationLocationID = update.DestinationLocationID
+	}
+	if update.CarrierID != "" {
+		shipment.CarrierID = update.CarrierID
+	}
+	if update.TrackingNumber != "" {
+		shipment.TrackingNumber = update.TrackingNumber
+	}
+	if update.Notes != "" {
+		shipment.Notes = update.Notes
+	}
+	if !update.EstimatedArrival.IsZero() {
+		shipment.EstimatedArrival = update.EstimatedArrival
+	}
+	if !inScope(ctx, shipment) {
+		return nil, ErrForbidden
+	}
 	shipment.UpdatedAt = time.Now()
 
-	if err := s.db.Save(&shipment).Error; err != nil {
-		return fmt.Errorf("failed to update shipment: %v", err)
+	if err := s.store.Shipments().Update(ctx, shipment); err != nil {
+		return nil, err
 	}
+	return shipment, nil
+}
 
-	// Create status update event
-	event := &models.ShipmentEvent{
-		ID:          uuid.New().String(),
-		ShipmentID:  shipment.ID,
-		Type:        "status_changed",
-		Location:    location,
-		Description: fmt.Sprintf("Status updated to: %s", status),
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
+// UpdateShipmentStatus sets the status of a shipment and records the change as
+// a "status_changed" event; both are stored together and the event is
+// published once they are.
+func (s *ShipmentService) UpdateShipmentStatus(ctx context.Context, id string, status string, location string) error {
+	var event *models.ShipmentEvent
+	if err := s.store.Atomic(ctx, func(tx Store) error {
+		shipment, err := tx.Shipments().Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !inScope(ctx, shipment) {
+			return ErrForbidden
+		}
+
+		shipment.Status = status
+		shipment.UpdatedAt = time.Now()
+
+		if err := tx.Shipments().Update(ctx, shipment); err != nil {
+			return err
+		}
 
-	if err := s.db.Create(event).Error; err != nil {
-		return fmt.Errorf("failed to create shipment event: %v", err)
+		// Create status update event
+		event = &models.ShipmentEvent{
+			ID:          uuid.New().String(),
+			ShipmentID:  shipment.ID,
+			Type:        "status_changed",
+			Location:    location,
+			Description: fmt.Sprintf("Status updated to: %s", status),
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		return tx.Shipments().AddEvent(ctx, event)
+	}); err != nil {
+		return err
 	}
 
 	// Publish event
-	if err := s.publishEvent(fmt.Sprintf("%s.shipment.status_updated", s.config.NATS.SubjectPrefix), event); err != nil {
+	if err := s.publishEvent(ctx, fmt.Sprintf("%s.shipment.status_updated", s.config.NATS.SubjectPrefix), event); err != nil {
 		return fmt.Errorf("failed to publish status update event: %v", err)
 	}
 
 	return nil
 }
 
-// Helper function to publish events
-func (s *ShipmentService) publishEvent(subject string, event interface{}) error {
+// DeleteShipment removes a shipment and its dependent events and alerts in a
+// single transaction, or returns ErrNotFound.
+func (s *ShipmentService) DeleteShipment(ctx context.Context, id string) error {
+	return s.store.Atomic(ctx, func(tx Store) error {
+		shipment, err := tx.Shipments().Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !inScope(ctx, shipment) {
+			return ErrForbidden
+		}
+		return tx.Shipments().Delete(ctx, id)
+	})
+}
+
+// ListShipmentEvents returns the lifecycle events for a shipment, oldest first.
+func (s *ShipmentService) ListShipmentEvents(ctx context.Context, shipmentID string) ([]models.ShipmentEvent, error) {
+	if _, scoped := auth.LocationScope(ctx); scoped {
+		if _, err := s.GetShipment(ctx, shipmentID); err != nil {
+			return nil, err
+		}
+	}
+	return s.store.Shipments().Events(ctx, shipmentID)
+}
+
+// summaryPreview bounds the recent-shipments list in the dashboard summary.
+const summaryPreview = 5
+
+// Summary rolls up the shipments the caller may see for the dashboard: counts
+// by status, open shipments past their estimated arrival, open (unresolved)
+// alerts and the most recent shipments.
+func (s *ShipmentService) Summary(ctx context.Context) (*models.ShipmentSummary, error) {
+	return s.store.Shipments().Summary(ctx, scopeOf(ctx), summaryPreview)
+}
+
+// Helper function to publish events. The trace context of ctx travels in the
+// message headers.
+func (s *ShipmentService) publishEvent(ctx context.Context, subject string, event interface{}) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %v", err)
 	}
 
-	_, err = s.js.Publish(subject, data)
+	start := time.Now()
+	err = s.publisher.Publish(ctx, subject, data)
+	s.publishes.Observe(subject, start, err)
 	if err != nil {
 		return fmt.Errorf("failed to publish event: %v", err)
 	}
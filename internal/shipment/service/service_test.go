@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/auth"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/config"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/models"
+)
+
+// published records the events a service publishes.
+type published struct {
+	subjects []string
+	data     [][]byte
+}
+
+func (p *published) Publish(ctx context.Context, subject string, data []byte) error {
+	p.subjects = append(p.subjects, subject)
+	p.data = append(p.data, data)
+	return nil
+}
+
+func newTestService() (*ShipmentService, *Memory, *published) {
+	cfg := &config.Config{}
+	cfg.NATS.SubjectPrefix = "supplychain"
+	store := NewMemory()
+	sent := &published{}
+	return New(cfg, store, sent), store, sent
+}
+
+// scopedTo returns a context for an operator assigned to locations.
+func scopedTo(locations ...string) context.Context {
+	return auth.ContextWithClaims(context.Background(), &auth.Claims{
+		Subject: "op", Role: auth.RoleOperator, Locations: locations,
+	})
+}
+
+func TestCreateShipmentRecordsEvent(t *testing.T) {
+	svc, _, sent := newTestService()
+	ctx := context.Background()
+
+	shipment := &models.Shipment{OrderID: "ORD-1", Status: "pending", Origin: "wh-a", Destination: "store-1"}
+	if err := svc.CreateShipment(ctx, shipment); err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if shipment.ID == "" {
+		t.Fatal("CreateShipment did not assign an ID")
+	}
+	events, err := svc.ListShipmentEvents(ctx, shipment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != "created" {
+		t.Fatalf("events = %+v, want one created event", events)
+	}
+	if len(sent.subjects) != 1 || sent.subjects[0] != "supplychain.shipment.created" {
+		t.Errorf("published %v, want supplychain.shipment.created", sent.subjects)
+	}
+}
+
+func TestUpdateShipmentStatus(t *testing.T) {
+	svc, _, sent := newTestService()
+	ctx := context.Background()
+	shipment := &models.Shipment{OrderID: "ORD-1", Status: "pending", Origin: "wh-a", Destination: "store-1"}
+	if err := svc.CreateShipment(ctx, shipment); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.UpdateShipmentStatus(ctx, shipment.ID, "in_transit", "Depot 4"); err != nil {
+		t.Fatalf("UpdateShipmentStatus: %v", err)
+	}
+	got, err := svc.GetShipment(ctx, shipment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "in_transit" {
+		t.Errorf("status = %q, want in_transit", got.Status)
+	}
+	events, err := svc.ListShipmentEvents(ctx, shipment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].Type != "status_changed" || events[1].Location != "Depot 4" {
+		t.Fatalf("events = %+v, want created then status_changed at Depot 4", events)
+	}
+	if len(sent.subjects) != 2 || sent.subjects[1] != "supplychain.shipment.status_updated" {
+		t.Fatalf("published %v, want a status_updated event", sent.subjects)
+	}
+	var event models.ShipmentEvent
+	if err := json.Unmarshal(sent.data[1], &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != events[1].ID {
+		t.Errorf("published event %s, want %s", event.ID, events[1].ID)
+	}
+
+	if err := svc.UpdateShipmentStatus(ctx, "missing", "delivered", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateShipmentStatus of missing shipment = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocationScope(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+	for _, s := range []models.Shipment{
+		{ID: "in", OrderID: "ORD-1", Status: "pending", Origin: "Warehouse B", Destination: "Warehouse A", OriginLocationID: "wh-b", DestinationLocationID: "wh-a"},
+		{ID: "out", OrderID: "ORD-2", Status: "pending", Origin: "Warehouse B", Destination: "Warehouse C", OriginLocationID: "wh-b", DestinationLocationID: "wh-c"},
+		// Free-text ends that happen to equal a location ID don't grant access.
+		{ID: "text", OrderID: "ORD-3", Status: "pending", Origin: "wh-a", Destination: "wh-a"},
+	} {
+		if err := store.Shipments().Create(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scoped := scopedTo("wh-a")
+
+	if err := svc.CreateShipment(scoped, &models.Shipment{Origin: "wh-a", Destination: "Warehouse C", DestinationLocationID: "wh-c"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("CreateShipment outside scope = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.GetShipment(scoped, "out"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetShipment outside scope = %v, want ErrNotFound", err)
+	}
+	if _, err := svc.ListShipmentEvents(scoped, "out"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ListShipmentEvents outside scope = %v, want ErrNotFound", err)
+	}
+	if err := svc.UpdateShipmentStatus(scoped, "out", "delivered", ""); !errors.Is(err, ErrForbidden) {
+		t.Errorf("UpdateShipmentStatus outside scope = %v, want ErrForbidden", err)
+	}
+	if err := svc.DeleteShipment(scoped, "out"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("DeleteShipment outside scope = %v, want ErrForbidden", err)
+	}
+	// Redirecting a shipment away from the caller's locations is refused too.
+	if _, err := svc.UpdateShipment(scoped, "in", &models.Shipment{DestinationLocationID: "wh-c"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("UpdateShipment out of scope = %v, want ErrForbidden", err)
+	}
+
+	shipments, total, err := svc.ListShipments(scoped, 10, 0, "ord", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(shipments) != 1 || shipments[0].ID != "in" {
+		t.Errorf("ListShipments = %d of %d, want only the inbound shipment", len(shipments), total)
+	}
+
+	// An operator without assignments sees nothing.
+	if shipments, total, err := svc.ListShipments(scopedTo(), 10, 0, "", ""); err != nil || total != 0 {
+		t.Errorf("unassigned ListShipments = %v (%d, %v), want none", shipments, total, err)
+	}
+}
+
+func TestDeleteShipmentRemovesEventsAndAlerts(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+	shipment := &models.Shipment{OrderID: "ORD-1", Status: "pending", Origin: "wh-a", Destination: "store-1"}
+	if err := svc.CreateShipment(ctx, shipment); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Shipments().AddAlert(ctx, &models.ShipmentAlert{ID: "a1", ShipmentID: shipment.ID, Type: "delay", Status: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.DeleteShipment(ctx, shipment.ID); err != nil {
+		t.Fatalf("DeleteShipment: %v", err)
+	}
+	if events, _ := store.Shipments().Events(ctx, shipment.ID); len(events) != 0 {
+		t.Errorf("events = %+v, want none", events)
+	}
+	if alerts, _ := store.Shipments().OpenAlerts(ctx); len(alerts) != 0 {
+		t.Errorf("open alerts = %v, want none", alerts)
+	}
+	if err := svc.DeleteShipment(ctx, shipment.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeleteShipment = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+	for i, s := range []models.Shipment{
+		{ID: "late", Status: "in_transit", Origin: "A", Destination: "s1", OriginLocationID: "wh-a", EstimatedArrival: past},
+		{ID: "done", Status: "delivered", Origin: "B", Destination: "s1", OriginLocationID: "wh-b", EstimatedArrival: past},
+		{ID: "new", Status: "pending", Origin: "B", Destination: "s2", OriginLocationID: "wh-b"},
+	} {
+		s.CreatedAt = past.Add(time.Duration(i) * time.Minute)
+		if err := store.Shipments().Create(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Shipments().AddAlert(ctx, &models.ShipmentAlert{ID: "a1", ShipmentID: "late", Type: "delay", Status: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := svc.Summary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 3 || summary.ByStatus["pending"] != 1 || summary.Late != 1 || summary.OpenAlerts != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(summary.Recent) != 3 || summary.Recent[0].ID != "new" {
+		t.Errorf("recent = %+v, want newest first", summary.Recent)
+	}
+
+	scoped, err := svc.Summary(scopedTo("wh-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scoped.Total != 2 || scoped.Late != 0 || scoped.OpenAlerts != 0 {
+		t.Errorf("scoped summary = %+v, want wh-b only", scoped)
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader is the header machine clients use to present an API key. Keys
+// may also be sent as "Authorization: ApiKey <key>".
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix marks generated keys so they are recognisable in logs and by
+// secret scanners.
+const apiKeyPrefix = "fsc_"
+
+// ErrInvalidAPIKey is returned by an APIKeyValidator for unknown, revoked or
+// expired keys.
+var ErrInvalidAPIKey = errors.New("auth: invalid api key")
+
+// APIKeyValidator resolves a presented API key to the claims of the principal
+// it represents. Implementations own storage (the gateway keeps hashed keys in
+// the database); the Manager only consults it from Middleware.
+type APIKeyValidator interface {
+	ValidateAPIKey(ctx context.Context, key string) (*Claims, error)
+}
+
+// GenerateAPIKey returns a new random API key and its display prefix. The key
+// is shown to the caller once; only HashAPIKey(key) should be stored.
+func GenerateAPIKey() (key, prefix string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
+
+// HashAPIKey returns the hex SHA-256 digest of key. Keys carry 256 bits of
+// randomness, so a fast unsalted hash is sufficient and allows lookup by hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetAPIKeyValidator enables API-key authentication in Middleware. Without a
+// validator, requests presenting an API key are rejected.
+func (m *Manager) SetAPIKeyValidator(v APIKeyValidator) {
+	m.apiKeys = v
+}
+
+// apiKey extracts an API key from the X-API-Key header or an
+// "Authorization: ApiKey <key>" header.
+func apiKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get(APIKeyHeader)); key != "" {
+		return key
+	}
+	return apiKeyAuthorization(r.Header)
+}
+
+// apiKeyAuthorization returns the key of an "Authorization: ApiKey <key>"
+// header in h.
+func apiKeyAuthorization(h http.Header) string {
+	parts := strings.SplitN(h.Get("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "ApiKey") {
+		return strings.TrimSpace(parts[1])
+	}
+	return ""
+}
+
+// delegatedTokenTTL bounds the bearer tokens ForwardCredential mints for
+// API-key callers. They only need to outlive one upstream request.
+const delegatedTokenTTL = 5 * time.Minute
+
+// ForwardCredential prepares h, the headers of a request forwarded upstream on
+// behalf of the caller Middleware authenticated in ctx. Bearer tokens pass
+// through unchanged. API keys can only be validated by the gateway, so a key
+// is removed and, for an authenticated caller, replaced by a short-lived
+// bearer token carrying the key's claims (never outliving the key itself).
+func (m *Manager) ForwardCredential(ctx context.Context, h http.Header) error {
+	inAuthorization := apiKeyAuthorization(h) != ""
+	if h.Get(APIKeyHeader) == "" && !inAuthorization {
+		return nil
+	}
+	h.Del(APIKeyHeader)
+	if inAuthorization {
+		h.Del("Authorization")
+	}
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	ttl := delegatedTokenTTL
+	if claims.ExpiresAt > 0 {
+		if left := time.Unix(claims.ExpiresAt, 0).Sub(m.now()); left < ttl {
+			ttl = left
+		}
+	}
+	delegated := *claims
+	delegated.Purpose = ""
+	token, err := m.issue(delegated, ttl)
+	if err != nil {
+		return err
+	}
+	h.Set("Authorization", "Bearer "+token)
+	return nil
+}
@@ -25,15 +25,22 @@ const (
 var (
 	ErrInvalidToken = errors.New("auth: invalid token")
 	ErrExpiredToken = errors.New("auth: token expired")
+	ErrWrongPurpose = errors.New("auth: token not valid for this purpose")
 )
 
-// Claims is the JWT payload describing an authenticated principal.
+// Claims is the JWT payload describing an authenticated principal. Purpose is
+// empty for ordinary access tokens; a non-empty Purpose restricts the token to
+// one step of a multi-step flow (e.g. the second factor of a login), and
+// Middleware rejects such tokens unless the route explicitly allows them.
 type Claims struct {
-	Subject   string `json:"sub"`
-	Role      string `json:"role"`
-	TenantID  string `json:"tenant,omitempty"`
-	IssuedAt  int64  `json:"iat"`
-	ExpiresAt int64  `json:"exp"`
+	Subject     string   `json:"sub"`
+	Role        string   `json:"role"`
+	TenantID    string   `json:"tenant,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+	Locations   []string `json:"locs,omitempty"`
+	Purpose     string   `json:"purpose,omitempty"`
+	IssuedAt    int64    `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
 }
 
 // jwtHeader is the fixed JOSE header for HS256 tokens.
@@ -44,9 +51,10 @@ type jwtHeader struct {
 
 // Manager issues and validates JWTs using a shared HMAC secret.
 type Manager struct {
-	secret []byte
-	ttl    time.Duration
-	now    func() time.Time
+	secret  []byte
+	ttl     time.Duration
+	now     func() time.Time
+	apiKeys APIKeyValidator
 }
 
 // NewManager creates a token manager. A non-positive ttl defaults to one hour.
@@ -65,19 +73,43 @@ func (m *Manager) sign(signingInput string) string {
 	return encode(mac.Sum(nil))
 }
 
+// MAC returns the base64url HMAC-SHA256 of data under the manager's secret.
+// It lets callers sign small values, such as short-lived cookies, without a
+// separate key.
+func (m *Manager) MAC(data string) string {
+	return m.sign(data)
+}
+
 // GenerateToken issues a signed JWT for the given subject, role and tenant.
 func (m *Manager) GenerateToken(subject, role, tenantID string) (string, error) {
-	if subject == "" {
+	return m.IssueToken(Claims{Subject: subject, Role: role, TenantID: tenantID})
+}
+
+// IssueToken signs claims as a JWT, stamping the issue time and the manager's
+// expiry. Use it when the token must carry more than subject, role and tenant
+// (e.g. resolved permissions).
+func (m *Manager) IssueToken(claims Claims) (string, error) {
+	claims.Purpose = ""
+	return m.issue(claims, m.ttl)
+}
+
+// IssuePurposeToken signs a short-lived token usable only for purpose (see
+// Claims.Purpose), such as completing a two-factor login.
+func (m *Manager) IssuePurposeToken(claims Claims, purpose string, ttl time.Duration) (string, error) {
+	if purpose == "" {
+		return "", errors.New("auth: purpose is required")
+	}
+	claims.Purpose = purpose
+	return m.issue(claims, ttl)
+}
+
+func (m *Manager) issue(claims Claims, ttl time.Duration) (string, error) {
+	if claims.Subject == "" {
 		return "", errors.New("auth: subject is required")
 	}
 	now := m.now()
-	claims := Claims{
-		Subject:   subject,
-		Role:      role,
-		TenantID:  tenantID,
-		IssuedAt:  now.Unix(),
-		ExpiresAt: now.Add(m.ttl).Unix(),
-	}
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
 	headerBytes, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
 	if err != nil {
 		return "", err
@@ -118,3 +150,15 @@ func (m *Manager) ValidateToken(token string) (*Claims, error) {
 
 	return &claims, nil
 }
+
+// ValidatePurposeToken validates a token and checks it was issued for purpose.
+func (m *Manager) ValidatePurposeToken(token, purpose string) (*Claims, error) {
+	claims, err := m.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, ErrWrongPurpose
+	}
+	return claims, nil
+}
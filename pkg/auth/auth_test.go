@@ -1,10 +1,16 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
 )
 
 func TestGenerateAndValidate(t *testing.T) {
@@ -109,6 +115,28 @@ func TestMiddlewareAcceptsValidToken(t *testing.T) {
 	}
 }
 
+func TestMiddlewareAddsCallerToLogScope(t *testing.T) {
+	m := NewManager("test-secret", time.Hour)
+	token, _ := m.GenerateToken("user-1", RoleViewer, "tenant-1")
+
+	var attrs []slog.Attr
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attrs = logging.Attrs(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	ctx := logging.NewContext(req.Context(), slog.Default(), slog.String("request_id", "r1"))
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+	got := map[string]string{}
+	for _, a := range attrs {
+		got[a.Key] = a.Value.String()
+	}
+	if got["request_id"] != "r1" || got["user"] != "user-1" || got["tenant"] != "tenant-1" {
+		t.Errorf("log scope = %v", got)
+	}
+}
+
 func TestRequireRole(t *testing.T) {
 	m := NewManager("test-secret", time.Hour)
 	protected := m.Middleware(RequireRole(RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -133,3 +161,332 @@ func TestRequireRole(t *testing.T) {
 		}
 	}
 }
+
+// fakeKeys is an APIKeyValidator that accepts a single known key.
+type fakeKeys struct{ key string }
+
+func (f fakeKeys) ValidateAPIKey(ctx context.Context, key string) (*Claims, error) {
+	if key != f.key {
+		return nil, ErrInvalidAPIKey
+	}
+	return &Claims{Subject: "apikey:scanner", Role: RoleOperator, TenantID: "tenant-1"}, nil
+}
+
+func TestMiddlewareAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, prefix) || HashAPIKey(key) == key {
+		t.Fatalf("unexpected key/prefix/hash: %q %q", key, prefix)
+	}
+
+	m := NewManager("test-secret", time.Hour)
+	var gotSubject string
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := ClaimsFromContext(r.Context()); ok {
+			gotSubject = claims.Subject
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Without a validator, API keys are refused outright.
+	if got := do(APIKeyHeader, key); got != http.StatusUnauthorized {
+		t.Fatalf("no validator: status = %d, want 401", got)
+	}
+
+	m.SetAPIKeyValidator(fakeKeys{key: key})
+	if got := do(APIKeyHeader, key); got != http.StatusOK {
+		t.Fatalf("X-API-Key: status = %d, want 200", got)
+	}
+	if gotSubject != "apikey:scanner" {
+		t.Fatalf("subject from context = %q, want apikey:scanner", gotSubject)
+	}
+	if got := do("Authorization", "ApiKey "+key); got != http.StatusOK {
+		t.Fatalf("Authorization ApiKey: status = %d, want 200", got)
+	}
+	if got := do(APIKeyHeader, "fsc_wrong"); got != http.StatusUnauthorized {
+		t.Fatalf("wrong key: status = %d, want 401", got)
+	}
+}
+
+// brokenKeys is an APIKeyValidator whose store is unavailable.
+type brokenKeys struct{}
+
+func (brokenKeys) ValidateAPIKey(ctx context.Context, key string) (*Claims, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestMiddlewareAPIKeyStoreFailure(t *testing.T) {
+	m := NewManager("test-secret", time.Hour)
+	m.SetAPIKeyValidator(brokenKeys{})
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(APIKeyHeader, "fsc_key")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 when keys can't be checked", rec.Code)
+	}
+}
+
+func TestForwardCredential(t *testing.T) {
+	m := NewManager("test-secret", time.Hour)
+	expiry := time.Now().Add(time.Minute).Unix()
+	key := &Claims{Subject: "apikey:scanner", Role: RoleOperator, Permissions: []string{PermInventoryRead}, ExpiresAt: expiry}
+	ctx := ContextWithClaims(context.Background(), key)
+
+	h := http.Header{}
+	h.Set(APIKeyHeader, "fsc_key")
+	if err := m.ForwardCredential(ctx, h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Get(APIKeyHeader) != "" {
+		t.Fatal("api key was forwarded")
+	}
+	claims, err := m.ValidateToken(bearerToken(&http.Request{Header: h}))
+	if err != nil {
+		t.Fatalf("forwarded token: %v", err)
+	}
+	if claims.Subject != key.Subject || !claims.HasPermission(PermInventoryRead) || claims.HasPermission(PermInventoryWrite) {
+		t.Errorf("forwarded claims = %+v", claims)
+	}
+	if claims.ExpiresAt > expiry {
+		t.Errorf("forwarded token expires at %d, after the key (%d)", claims.ExpiresAt, expiry)
+	}
+
+	// Without a caller (public routes) the key is dropped and nothing minted.
+	h = http.Header{}
+	h.Set("Authorization", "ApiKey fsc_key")
+	if err := m.ForwardCredential(context.Background(), h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Get("Authorization") != "" {
+		t.Errorf("Authorization = %q, want none", h.Get("Authorization"))
+	}
+
+	// Bearer tokens pass through untouched.
+	h = http.Header{}
+	h.Set("Authorization", "Bearer abc")
+	if err := m.ForwardCredential(ctx, h); err != nil || h.Get("Authorization") != "Bearer abc" {
+		t.Errorf("bearer token changed to %q (%v)", h.Get("Authorization"), err)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	m := NewManager("test-secret", time.Hour)
+	m.SetAPIKeyValidator(fakeKeys{key: "fsc_scanner"})
+	var got string
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RateLimitKey(r)
+	}))
+
+	token, _ := m.GenerateToken("user-1", RoleViewer, "")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "user:user-1" {
+		t.Errorf("bearer key = %q, want user:user-1", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(APIKeyHeader, "fsc_scanner")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if want := "apikey:" + HashAPIKey("fsc_scanner")[:16]; got != want {
+		t.Errorf("api key = %q, want %q", got, want)
+	}
+
+	// Unauthenticated requests have no caller key.
+	if key := RateLimitKey(httptest.NewRequest(http.MethodGet, "/", nil)); key != "" {
+		t.Errorf("anonymous key = %q, want empty", key)
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	cases := []struct {
+		claims Claims
+		perm   string
+		want   bool
+	}{
+		{Claims{Role: RoleAdmin}, PermShipmentDelete, true},
+		{Claims{Role: RoleManager}, PermShipmentDelete, true},
+		{Claims{Role: RoleViewer}, PermShipmentDelete, false},
+		{Claims{Role: RoleViewer}, PermInventoryRead, true},
+		{Claims{Role: RoleAdmin}, PermSystemRead, true},
+		{Claims{Role: RoleManager}, PermSystemRead, false},
+		{Claims{Role: "ops", Permissions: []string{PermLoggingManage}}, PermSystemRead, false},
+		// Explicit permissions override the built-in table, wildcards included.
+		{Claims{Role: "auditor", Permissions: []string{"inventory:*"}}, PermInventoryAdjust, true},
+		{Claims{Role: "auditor", Permissions: []string{"inventory:*"}}, PermShipmentRead, false},
+		{Claims{Role: RoleAdmin, Permissions: []string{PermInventoryRead}}, PermUsersManage, false},
+		{Claims{Role: "unknown"}, PermInventoryRead, false},
+	}
+	for _, tc := range cases {
+		if got := tc.claims.HasPermission(tc.perm); got != tc.want {
+			t.Errorf("%s %v HasPermission(%q) = %v, want %v", tc.claims.Role, tc.claims.Permissions, tc.perm, got, tc.want)
+		}
+	}
+}
+
+func TestValidPermission(t *testing.T) {
+	for _, p := range []string{PermAll, "inventory:*", PermShipmentDelete, PermSystemRead, "system:*"} {
+		if !ValidPermission(p) {
+			t.Errorf("ValidPermission(%q) = false, want true", p)
+		}
+	}
+	for _, p := range []string{"", "inventory", "warehouse:*", "inventory:teleport"} {
+		if ValidPermission(p) {
+			t.Errorf("ValidPermission(%q) = true, want false", p)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	m := NewManager("test-secret", time.Hour)
+	protected := m.Middleware(RequirePermission(PermInventoryAdjust)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	cases := []struct {
+		claims Claims
+		want   int
+	}{
+		{Claims{Subject: "u", Role: RoleOperator}, http.StatusOK},
+		{Claims{Subject: "u", Role: RoleViewer}, http.StatusForbidden},
+		{Claims{Subject: "u", Role: "stock-clerk", Permissions: []string{PermInventoryAdjust}}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		token, err := m.IssueToken(tc.claims)
+		if err != nil {
+			t.Fatalf("IssueToken: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("role %q: status = %d, want %d", tc.claims.Role, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestLocationScope(t *testing.T) {
+	// No claims (auth disabled) means no restriction.
+	if _, scoped := LocationScope(context.Background()); scoped {
+		t.Fatal("request without claims should be unscoped")
+	}
+
+	operator := &Claims{Subject: "op", Role: RoleOperator, Locations: []string{"wh-a"}}
+	ctx := context.WithValue(context.Background(), claimsContextKey, operator)
+	ids, scoped := LocationScope(ctx)
+	if !scoped || len(ids) != 1 || ids[0] != "wh-a" {
+		t.Fatalf("operator scope = %v (scoped=%v), want [wh-a]", ids, scoped)
+	}
+	if !InLocationScope(ctx, "wh-a") || InLocationScope(ctx, "wh-b") {
+		t.Fatal("operator should reach wh-a only")
+	}
+
+	// Admins stay unrestricted even with assignments.
+	admin := &Claims{Subject: "root", Role: RoleAdmin, Locations: []string{"wh-a"}}
+	if !admin.CanAccessLocation("wh-b") {
+		t.Fatal("admin should be unrestricted")
+	}
+	// Unassigned principals are unrestricted only with locations:all.
+	if !(&Claims{Role: RoleManager}).CanAccessLocation("wh-b") {
+		t.Fatal("unassigned manager should be unrestricted")
+	}
+	unassigned := &Claims{Subject: "op", Role: RoleOperator}
+	ctx = context.WithValue(context.Background(), claimsContextKey, unassigned)
+	if ids, scoped := LocationScope(ctx); !scoped || len(ids) != 0 {
+		t.Fatalf("unassigned operator scope = %v (scoped=%v), want no locations", ids, scoped)
+	}
+	if InLocationScope(ctx, "wh-a") {
+		t.Fatal("unassigned operator should reach no location")
+	}
+	custom := &Claims{Role: "picker", Permissions: []string{PermInventoryRead}}
+	if custom.CanAccessLocation("wh-a") {
+		t.Fatal("unassigned custom role without locations:all should reach no location")
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 secret "12345678901234567890"; the reference
+	// values are 8 digits, of which a 6-digit code is the low-order suffix.
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		if got != c.want {
+			t.Errorf("TOTPCode(t=%d) = %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := TOTPCode(secret, TOTPStep(now.Add(-totpPeriod)))
+
+	step, ok := VerifyTOTP(secret, code, now)
+	if !ok || step != TOTPStep(now)-1 {
+		t.Fatalf("previous-period code: ok=%v step=%d", ok, step)
+	}
+	if _, ok := VerifyTOTP(secret, code, now.Add(3*totpPeriod)); ok {
+		t.Error("stale code accepted")
+	}
+	if _, ok := VerifyTOTP(secret, "12345", now); ok {
+		t.Error("short code accepted")
+	}
+	if uri := TOTPKeyURI("FSC", "admin", secret); !strings.HasPrefix(uri, "otpauth://totp/FSC:admin?") {
+		t.Errorf("uri = %s", uri)
+	}
+}
+
+func TestMiddlewareRejectsPurposeTokens(t *testing.T) {
+	m := NewManager("test-secret", time.Hour)
+	token, err := m.IssuePurposeToken(Claims{Subject: "admin", Role: RoleAdmin}, "mfa", time.Minute)
+	if err != nil {
+		t.Fatalf("IssuePurposeToken: %v", err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	m.Middleware(ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Middleware status = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	m.MiddlewareAllowing("mfa")(ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("MiddlewareAllowing status = %d, want 200", rec.Code)
+	}
+
+	if _, err := m.ValidatePurposeToken(token, "other"); err != ErrWrongPurpose {
+		t.Errorf("ValidatePurposeToken err = %v, want ErrWrongPurpose", err)
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import "net/http"
+
+// Identity headers the gateway sets on proxied requests after validating the
+// caller's credentials. Upstreams reachable only through the gateway may rely
+// on them; the gateway always removes client-supplied copies first.
+const (
+	HeaderUser   = "X-Auth-User"
+	HeaderRole   = "X-Auth-Role"
+	HeaderTenant = "X-Auth-Tenant"
+)
+
+// identityHeaders lists every header StripIdentity removes.
+var identityHeaders = []string{HeaderUser, HeaderRole, HeaderTenant}
+
+// StripIdentity removes identity headers from h so a client cannot assert an
+// identity of its own.
+func StripIdentity(h http.Header) {
+	for _, name := range identityHeaders {
+		h.Del(name)
+	}
+}
+
+// SetIdentity replaces the identity headers in h with the verified claims.
+func SetIdentity(h http.Header, claims *Claims) {
+	StripIdentity(h)
+	if claims == nil {
+		return
+	}
+	h.Set(HeaderUser, claims.Subject)
+	h.Set(HeaderRole, claims.Role)
+	if claims.TenantID != "" {
+		h.Set(HeaderTenant, claims.TenantID)
+	}
+}
@@ -3,8 +3,12 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
 )
 
 type contextKey string
@@ -18,6 +22,13 @@ func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
 	return claims, ok
 }
 
+// ContextWithClaims returns ctx carrying claims, as Middleware does for an
+// authenticated request. It lets code below the HTTP layer be exercised on a
+// caller's behalf.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return withClaims(ctx, claims)
+}
+
 // bearerToken extracts a token from an "Authorization: Bearer <token>" header.
 func bearerToken(r *http.Request) string {
 	header := r.Header.Get("Authorization")
@@ -31,10 +42,44 @@ func bearerToken(r *http.Request) string {
 	return ""
 }
 
-// Middleware authenticates requests using a Bearer token. On success the
-// validated claims are stored in the request context; otherwise it responds 401.
+// Middleware authenticates requests using a Bearer token or, when an
+// APIKeyValidator is configured, an API key. On success the validated claims
+// are stored in the request context; otherwise it responds 401. Purpose tokens
+// (see Claims.Purpose) are rejected.
 func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return m.authenticate(next, nil)
+}
+
+// MiddlewareAllowing is Middleware that additionally accepts bearer tokens
+// issued for one of the given purposes, for routes that form part of a
+// multi-step flow (e.g. enrolling a second factor before the first full login).
+func (m *Manager) MiddlewareAllowing(purposes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return m.authenticate(next, purposes)
+	}
+}
+
+func (m *Manager) authenticate(next http.Handler, purposes []string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := apiKey(r); key != "" {
+			if m.apiKeys == nil {
+				writeError(w, http.StatusUnauthorized, "api keys are not accepted")
+				return
+			}
+			claims, err := m.apiKeys.ValidateAPIKey(r.Context(), key)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				writeError(w, http.StatusUnauthorized, "invalid or expired api key")
+				return
+			}
+			if err != nil {
+				logging.FromContext(r.Context()).Error("api key validation failed", "error", err)
+				writeError(w, http.StatusInternalServerError, "failed to validate api key")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+			return
+		}
+
 		token := bearerToken(r)
 		if token == "" {
 			writeError(w, http.StatusUnauthorized, "missing bearer token")
@@ -45,11 +90,35 @@ func (m *Manager) Middleware(next http.Handler) http.Handler {
 			writeError(w, http.StatusUnauthorized, "invalid or expired token")
 			return
 		}
-		ctx := context.WithValue(r.Context(), claimsContextKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if claims.Purpose != "" && !containsString(purposes, claims.Purpose) {
+			writeError(w, http.StatusUnauthorized, "token not valid for this endpoint")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
 	})
 }
 
+// withClaims stores claims in ctx and adds the caller to the request's
+// logging scope, so every line logged for the request names the user and
+// tenant.
+func withClaims(ctx context.Context, claims *Claims) context.Context {
+	attrs := []slog.Attr{slog.String("user", claims.Subject)}
+	if claims.TenantID != "" {
+		attrs = append(attrs, slog.String("tenant", claims.TenantID))
+	}
+	logging.AddAttrs(ctx, attrs...)
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // RequireRole returns middleware that permits a request only if its
 // authenticated claims carry one of the supplied roles. It must be installed
 // after Middleware so that claims are present in the context.
@@ -79,3 +148,21 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
+
+// RateLimitKey identifies the authenticated caller for per-caller rate
+// limiting: "apikey:<hash prefix>" for API-key requests, "user:<subject>" for
+// bearer tokens, or "" when the request has not been authenticated (callers
+// then fall back to the client IP). Use it behind Middleware.
+func RateLimitKey(r *http.Request) string {
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	if key := apiKey(r); key != "" {
+		return "apikey:" + HashAPIKey(key)[:16]
+	}
+	if claims.Subject == "" {
+		return ""
+	}
+	return "user:" + claims.Subject
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Permissions recognised by the services. A permission has the form
+// "resource:action"; "resource:*" grants every action on a resource and "*"
+// grants everything.
+const (
+	PermAll             = "*"
+	PermInventoryRead   = "inventory:read"
+	PermInventoryWrite  = "inventory:write"
+	PermInventoryAdjust = "inventory:adjust"
+	PermInventoryDelete = "inventory:delete"
+	PermShipmentRead    = "shipment:read"
+	PermShipmentWrite   = "shipment:write"
+	PermShipmentDelete  = "shipment:delete"
+	PermUsersManage     = "users:manage"
+	PermRolesManage     = "roles:manage"
+	PermAPIKeysManage   = "apikeys:manage"
+	PermLoggingManage   = "logging:manage"
+	// PermSystemRead shows operational detail (dependency errors, upstream
+	// instances) that the public health endpoints leave out.
+	PermSystemRead = "system:read"
+	// PermLocationsAll lets principals without location assignments act at
+	// every location; without it they are scoped to their (possibly empty)
+	// assignments.
+	PermLocationsAll = "locations:all"
+)
+
+// KnownPermissions lists every concrete permission, for catalogues and
+// validation of custom role definitions.
+var KnownPermissions = []string{
+	PermInventoryRead, PermInventoryWrite, PermInventoryAdjust, PermInventoryDelete,
+	PermShipmentRead, PermShipmentWrite, PermShipmentDelete,
+	PermUsersManage, PermRolesManage, PermAPIKeysManage, PermLoggingManage,
+	PermSystemRead, PermLocationsAll,
+}
+
+// builtinPermissions maps the four built-in roles to their permissions. Tokens
+// that carry no explicit permissions fall back to this table.
+var builtinPermissions = map[string][]string{
+	RoleAdmin:    {PermAll},
+	RoleManager:  {"inventory:*", "shipment:*", PermLocationsAll},
+	RoleOperator: {PermInventoryRead, PermInventoryWrite, PermInventoryAdjust, PermShipmentRead, PermShipmentWrite},
+	RoleViewer:   {PermInventoryRead, PermShipmentRead, PermLocationsAll},
+}
+
+// IsBuiltinRole reports whether role is one of the four fixed roles.
+func IsBuiltinRole(role string) bool {
+	_, ok := builtinPermissions[role]
+	return ok
+}
+
+// DefaultPermissions returns a copy of the permissions granted to a built-in
+// role, or nil for any other role.
+func DefaultPermissions(role string) []string {
+	return append([]string(nil), builtinPermissions[role]...)
+}
+
+// ValidPermission reports whether p is "*", "resource:*" for a known resource,
+// or one of KnownPermissions.
+func ValidPermission(p string) bool {
+	if p == PermAll {
+		return true
+	}
+	for _, known := range KnownPermissions {
+		if p == known || p == resourceOf(known)+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func resourceOf(p string) string {
+	resource, _, _ := strings.Cut(p, ":")
+	return resource
+}
+
+// grants reports whether a granted permission (possibly a wildcard) covers the
+// required one.
+func grants(granted, required string) bool {
+	if granted == PermAll || granted == required {
+		return true
+	}
+	resource, action, ok := strings.Cut(granted, ":")
+	return ok && action == "*" && resource == resourceOf(required)
+}
+
+// HasPermission reports whether the claims grant perm. Tokens without an
+// explicit permission list (e.g. minted before permissions existed) are
+// evaluated against the built-in role table.
+func (c *Claims) HasPermission(perm string) bool {
+	granted := c.Permissions
+	if granted == nil {
+		granted = builtinPermissions[c.Role]
+	}
+	for _, g := range granted {
+		if grants(g, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission returns middleware that permits a request only if its
+// authenticated claims grant every supplied permission. Like RequireRole it
+// must be installed after Middleware.
+func RequirePermission(perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			for _, perm := range perms {
+				if !claims.HasPermission(perm) {
+					writeError(w, http.StatusForbidden, "insufficient permissions")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
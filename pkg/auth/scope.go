@@ -0,0 +1,42 @@
+package auth
+
+import "context"
+
+// Unrestricted reports whether the claims may act on any location: holders of
+// the "*" permission (the admin role) are never scoped, and holders of
+// PermLocationsAll are not scoped until they are assigned locations. Everyone
+// else is scoped, so an operator with no assignments reaches no location.
+func (c *Claims) Unrestricted() bool {
+	return c.HasPermission(PermAll) || (len(c.Locations) == 0 && c.HasPermission(PermLocationsAll))
+}
+
+// CanAccessLocation reports whether the claims permit reads and writes at the
+// given location.
+func (c *Claims) CanAccessLocation(locationID string) bool {
+	if c.Unrestricted() {
+		return true
+	}
+	for _, id := range c.Locations {
+		if id == locationID {
+			return true
+		}
+	}
+	return false
+}
+
+// LocationScope returns the location IDs the authenticated caller is
+// restricted to. scoped is false when no restriction applies, including when
+// the request carries no claims at all (authentication disabled).
+func LocationScope(ctx context.Context) (locationIDs []string, scoped bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.Unrestricted() {
+		return nil, false
+	}
+	return claims.Locations, true
+}
+
+// InLocationScope reports whether the caller in ctx may access locationID.
+func InLocationScope(ctx context.Context, locationID string) bool {
+	claims, ok := ClaimsFromContext(ctx)
+	return !ok || claims.CanAccessLocation(locationID)
+}
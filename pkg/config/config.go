@@ -0,0 +1,254 @@
+// Package config loads the YAML configuration shared by the gateway and the
+// services. One file holds every section; each process selects its own entry
+// from the services: block. Values are resolved in this order:
+//
+//  1. the file, after ${VAR} and ${VAR:-default} expansion;
+//  2. the legacy environment variables (DB_HOST, JWT_SECRET, ...);
+//  3. FSC_ variables named after the key path, e.g. FSC_DATABASE_HOST or
+//     FSC_SERVICES_SHIPMENT_PORT;
+//  4. the selected service's section, whose port (when set) becomes
+//     server.port.
+//
+// Any variable may instead name a file holding its value with a _FILE suffix
+// (DB_PASSWORD_FILE, FSC_AUTH_JWT_SECRET_FILE), for mounted secrets.
+// Validation reports every problem at once; outside development that includes
+// placeholder and low-entropy secrets.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
+)
+
+// Config represents the configuration of one process.
+type Config struct {
+	App      App                `yaml:"app"`
+	Server   Server             `yaml:"server"`
+	Database Database           `yaml:"database"`
+	NATS     NATS               `yaml:"nats"`
+	Auth     Auth               `yaml:"auth"`
+	Services map[string]Service `yaml:"services"`
+	Logging  Logging            `yaml:"logging"`
+	Metrics  Metrics            `yaml:"metrics"`
+	Tracing  Tracing            `yaml:"tracing"`
+	Gateway  Gateway            `yaml:"gateway"`
+
+	// Service is the services: entry selected by Load.
+	Service Service `yaml:"-"`
+	// Warnings lists the secret problems tolerated because app.environment
+	// is a development one; elsewhere they fail Load.
+	Warnings []string `yaml:"-"`
+}
+
+// App identifies the deployment.
+type App struct {
+	Name        string `yaml:"name"`
+	Environment string `yaml:"environment"`
+}
+
+// Server configures the HTTP listener.
+type Server struct {
+	Port    int `yaml:"port"`
+	Timeout struct {
+		Read  time.Duration `yaml:"read"`
+		Write time.Duration `yaml:"write"`
+		Idle  time.Duration `yaml:"idle"`
+	} `yaml:"timeout"`
+	// TrustedProxies lists the CIDRs (or addresses) of the proxies, such as
+	// the gateway, whose ClientIPHeader is believed when resolving the client
+	// IP. ClientIPHeader is X-Forwarded-For (default) or Forwarded.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	ClientIPHeader string   `yaml:"client_ip_header"`
+}
+
+// Database configures the PostgreSQL connection and pool.
+type Database struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// SSLMode is a libpq sslmode: disable, allow, prefer (the default),
+	// require, verify-ca or verify-full. SSLRootCert verifies the server;
+	// SSLCert and SSLKey authenticate the client.
+	SSLMode     string `yaml:"ssl_mode"`
+	SSLRootCert string `yaml:"ssl_root_cert"`
+	SSLCert     string `yaml:"ssl_cert"`
+	SSLKey      string `yaml:"ssl_key"`
+	// StatementTimeout cancels statements running longer; zero leaves the
+	// server's setting.
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	// ApplicationName appears in pg_stat_activity; it defaults to the
+	// service's name.
+	ApplicationName string `yaml:"application_name"`
+	// Replicas receive the services' read-only queries.
+	Replicas Replicas `yaml:"replicas"`
+	// MigrateOnStart applies pending schema migrations at startup; when false
+	// the process only checks that none are pending, and they are applied
+	// with the migrate subcommand.
+	MigrateOnStart bool `yaml:"migrate_on_start"`
+}
+
+// Replicas configures the read replicas, which share every database setting
+// but the address.
+type Replicas struct {
+	// Hosts are the replicas' addresses, "host" or "host:port" (default:
+	// database.port).
+	Hosts []string `yaml:"hosts"`
+	// CheckInterval is the time between health checks; MaxLag, when set,
+	// takes a replica out of rotation while it is further behind.
+	CheckInterval time.Duration `yaml:"check_interval"`
+	MaxLag        time.Duration `yaml:"max_lag"`
+}
+
+// NATS configures the event bus.
+type NATS struct {
+	URL           string `yaml:"url"`
+	ClusterID     string `yaml:"cluster_id"`
+	ClientID      string `yaml:"client_id"`
+	SubjectPrefix string `yaml:"subject_prefix"`
+}
+
+// Auth configures token signing.
+type Auth struct {
+	JWTSecret          string        `yaml:"jwt_secret"`
+	TokenExpiry        time.Duration `yaml:"token_expiry"`
+	RefreshTokenExpiry time.Duration `yaml:"refresh_token_expiry"`
+}
+
+// Service is one entry of the services: block.
+type Service struct {
+	Name                string        `yaml:"name"`
+	Port                int           `yaml:"port"`
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	MetricsPort         int           `yaml:"metrics_port"`
+}
+
+// Logging mirrors logging.Config.
+type Logging struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	// Output is stdout, stderr or a file path; files rotate at max_size_mb,
+	// keeping max_backups old files.
+	Output     string `yaml:"output"`
+	MaxSizeMB  int    `yaml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups"`
+}
+
+// Metrics configures the Prometheus endpoint.
+type Metrics struct {
+	Enabled        bool `yaml:"enabled"`
+	PrometheusPort int  `yaml:"prometheus_port"`
+	// Buckets are the latency histogram upper bounds in seconds; empty means
+	// metrics.DefaultBuckets.
+	Buckets []float64 `yaml:"buckets"`
+}
+
+// Tracing configures span export.
+type Tracing struct {
+	// Exporter is otlp, stdout or none. Trace context is propagated either
+	// way; none just records nothing.
+	Exporter     string  `yaml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+// LoggingConfig returns the logging section in the form logging.New takes.
+func (c *Config) LoggingConfig() logging.Config {
+	return logging.Config{
+		Level:      c.Logging.Level,
+		Format:     c.Logging.Format,
+		Output:     c.Logging.Output,
+		MaxSizeMB:  c.Logging.MaxSizeMB,
+		MaxBackups: c.Logging.MaxBackups,
+	}
+}
+
+// PathEnv names the configuration file when no path is passed to Load.
+const PathEnv = "FSC_CONFIG"
+
+// searchPaths are tried, in order, when neither a path nor PathEnv is given,
+// so binaries find the file from the repository root or a cmd/ directory.
+var searchPaths = []string{
+	"configs/config.yaml",
+	"../configs/config.yaml",
+	"../../configs/config.yaml",
+}
+
+// Load reads the configuration for service (a key of the services: block)
+// from path, or from $FSC_CONFIG or the default search paths when path is
+// empty, applies the environment and validates the result.
+func Load(service, path string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv(PathEnv)
+	}
+	if path == "" {
+		for _, p := range searchPaths {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("config file not found in any of %v (use -config or %s)", searchPaths, PathEnv)
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	cfg, err := Parse(raw, service, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse is Load for raw YAML, reading the environment through lookup. Unknown
+// keys are errors, so typos don't silently fall back to defaults.
+func Parse(raw []byte, service string, lookup func(string) (string, bool)) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict([]byte(expand(string(raw), lookup)), cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+	if cfg.Services == nil {
+		cfg.Services = make(map[string]Service)
+	}
+
+	var errs []error
+	errs = append(errs, applyEnv(cfg, service, lookup)...)
+
+	svc, ok := cfg.Services[service]
+	if !ok {
+		errs = append(errs, fmt.Errorf("services.%s: no such service", service))
+	}
+	cfg.Service = svc
+	if svc.Port != 0 {
+		cfg.Server.Port = svc.Port
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if service == GatewayService {
+		errs = append(errs, cfg.Gateway.validate(cfg.App.Environment)...)
+	}
+	for _, err := range cfg.checkSecrets() {
+		if IsDevelopment(cfg.App.Environment) {
+			cfg.Warnings = append(cfg.Warnings, err.Error())
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
@@ -0,0 +1,451 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `
+app:
+  name: food-supply-chain
+  environment: ${APP_ENVIRONMENT:-development}
+server:
+  port: 8080
+  timeout:
+    read: 5s
+database:
+  host: localhost
+  port: 5433
+  user: supplychain
+  password: ${DB_PASS}
+  name: supplychain
+nats:
+  url: nats://localhost:4222
+services:
+  inventory:
+    name: inventory-service
+  shipment:
+    name: shipment-service
+    port: 8081
+logging:
+  level: info
+`
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestParseSelectsServiceSection(t *testing.T) {
+	cfg, err := Parse([]byte(sample), "shipment", env(nil))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Service.Name != "shipment-service" || cfg.Server.Port != 8081 {
+		t.Errorf("service %+v, port %d; want shipment-service on 8081", cfg.Service, cfg.Server.Port)
+	}
+
+	// Without a port of its own, a service keeps server.port.
+	cfg, err = Parse([]byte(sample), "inventory", env(nil))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Server.Port != 8080 {
+		t.Errorf("inventory port = %d, want 8080", cfg.Server.Port)
+	}
+}
+
+func TestParseExpandsVariables(t *testing.T) {
+	cfg, err := Parse([]byte(sample), "inventory", env(map[string]string{"DB_PASS": "s3cret"}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Database.Password != "s3cret" {
+		t.Errorf("password = %q, want s3cret", cfg.Database.Password)
+	}
+	if cfg.App.Environment != "development" {
+		t.Errorf("environment = %q, want the ${...:-default}", cfg.App.Environment)
+	}
+}
+
+func TestParseAppliesEnvironment(t *testing.T) {
+	cfg, err := Parse([]byte(sample), "shipment", env(map[string]string{
+		"DB_HOST":                    "legacy",
+		"FSC_DATABASE_HOST":          "db.internal",
+		"DB_USER":                    "svc",
+		"FSC_SERVER_TIMEOUT_READ":    "2s",
+		"FSC_SERVER_TRUSTED_PROXIES": "10.0.0.0/8, 192.168.1.1",
+		"FSC_METRICS_BUCKETS":        "0.1,1",
+		"FSC_SERVICES_SHIPMENT_PORT": "9000",
+	}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Database.Host != "db.internal" {
+		t.Errorf("host = %q; FSC_ should win over the legacy variable", cfg.Database.Host)
+	}
+	if cfg.Database.User != "svc" {
+		t.Errorf("user = %q, want svc from DB_USER", cfg.Database.User)
+	}
+	if cfg.Server.Timeout.Read != 2*time.Second {
+		t.Errorf("read timeout = %v, want 2s", cfg.Server.Timeout.Read)
+	}
+	if got := cfg.Server.TrustedProxies; len(got) != 2 || got[1] != "192.168.1.1" {
+		t.Errorf("trusted proxies = %v", got)
+	}
+	if got := cfg.Metrics.Buckets; len(got) != 2 || got[1] != 1 {
+		t.Errorf("buckets = %v", got)
+	}
+	if cfg.Server.Port != 9000 || cfg.Services["shipment"].Port != 9000 {
+		t.Errorf("port = %d, want 9000 from FSC_SERVICES_SHIPMENT_PORT", cfg.Server.Port)
+	}
+}
+
+func TestParseLegacyPortSetsServicePort(t *testing.T) {
+	cfg, err := Parse([]byte(sample), "inventory", env(map[string]string{"SERVER_PORT": "7000"}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Server.Port != 7000 {
+		t.Errorf("port = %d, want 7000", cfg.Server.Port)
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	raw := strings.Replace(sample, "  host: localhost", "  hots: localhost", 1)
+	if _, err := Parse([]byte(raw), "inventory", env(nil)); err == nil {
+		t.Fatal("misspelt key accepted")
+	}
+}
+
+func TestParseListsEveryProblem(t *testing.T) {
+	_, err := Parse([]byte(sample), "gateway", env(map[string]string{
+		"FSC_DATABASE_PORT":    "0",
+		"FSC_TRACING_EXPORTER": "zipkin",
+		"LOG_LEVEL":            "loud",
+		"FSC_NATS_URL":         "",
+		"DB_PORT":              "five",
+	}))
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"services.gateway: no such service",
+		"database.port 0",
+		"tracing.exporter",
+		"logging:",
+		`DB_PORT: invalid integer "five"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadFindsFileThroughEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(sample), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(PathEnv, path)
+	cfg, err := Load("shipment", "")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != 8081 {
+		t.Errorf("port = %d, want 8081", cfg.Server.Port)
+	}
+
+	if _, err := Load("shipment", filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestRepositoryConfigLoads(t *testing.T) {
+	// The shipped file defaults to production, where its placeholder
+	// secrets are refused; local runs set APP_ENV=development.
+	if _, err := Load("gateway", "../../configs/config.yaml"); err == nil || !strings.Contains(err.Error(), "placeholder") {
+		t.Errorf("production defaults accepted placeholder secrets: err = %v", err)
+	}
+	t.Setenv("APP_ENV", "development")
+	for _, service := range []string{"inventory", "shipment", "gateway"} {
+		if _, err := Load(service, "../../configs/config.yaml"); err != nil {
+			t.Errorf("%s: %v", service, err)
+		}
+	}
+}
+
+func TestParseReadsSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	jwt := filepath.Join(dir, "jwt")
+	if err := os.WriteFile(jwt, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db := filepath.Join(dir, "db")
+	if err := os.WriteFile(db, []byte("db-pass"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Parse([]byte(sample), "inventory", env(map[string]string{
+		"JWT_SECRET_FILE":            jwt,
+		"FSC_DATABASE_PASSWORD_FILE": db,
+	}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Auth.JWTSecret != "from-file" {
+		t.Errorf("jwt secret = %q, want the file's contents without the newline", cfg.Auth.JWTSecret)
+	}
+	if cfg.Database.Password != "db-pass" {
+		t.Errorf("password = %q, want db-pass", cfg.Database.Password)
+	}
+
+	_, err = Parse([]byte(sample), "inventory", env(map[string]string{
+		"JWT_SECRET":       "inline",
+		"JWT_SECRET_FILE":  jwt,
+		"DB_PASSWORD_FILE": filepath.Join(dir, "missing"),
+	}))
+	if err == nil {
+		t.Fatal("conflicting and unreadable secrets accepted")
+	}
+	for _, want := range []string{"set only one of JWT_SECRET and JWT_SECRET_FILE", "DB_PASSWORD_FILE:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestParseRejectsInsecureSecretsOutsideDevelopment(t *testing.T) {
+	strong := "3f9c1a7e5b2d8046c1e9a3b7d5f20864ae1c3b5d7f9062e4a8c0b2d4f6e81357"
+	for name, tc := range map[string]struct {
+		vars map[string]string
+		want string
+	}{
+		"placeholder": {map[string]string{"JWT_SECRET": "your-secret-key-here", "DB_PASSWORD": "x"}, "placeholder"},
+		"weak":        {map[string]string{"JWT_SECRET": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "DB_PASSWORD": "x"}, "too weak"},
+		"missing":     {map[string]string{"DB_PASSWORD": "x"}, "auth.jwt_secret is required"},
+		"db password": {map[string]string{"JWT_SECRET": strong, "DB_PASSWORD": "supplychain123"}, "database.password"},
+	} {
+		tc.vars["APP_ENVIRONMENT"] = "production"
+		_, err := Parse([]byte(sample), "inventory", env(tc.vars))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", name, err, tc.want)
+		}
+
+		// Development only warns.
+		tc.vars["APP_ENVIRONMENT"] = "development"
+		cfg, err := Parse([]byte(sample), "inventory", env(tc.vars))
+		if err != nil {
+			t.Errorf("%s in development: %v", name, err)
+			continue
+		}
+		if len(cfg.Warnings) == 0 || !strings.Contains(cfg.Warnings[0], tc.want) {
+			t.Errorf("%s in development: warnings = %v", name, cfg.Warnings)
+		}
+	}
+
+	cfg, err := Parse([]byte(sample), "inventory", env(map[string]string{
+		"APP_ENVIRONMENT": "production", "JWT_SECRET": strong, "DB_PASSWORD": "x",
+	}))
+	if err != nil {
+		t.Fatalf("strong secret: %v", err)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("warnings = %v", cfg.Warnings)
+	}
+}
+
+func TestSecretBits(t *testing.T) {
+	if b := SecretBits("aaaaaaaa"); b != 0 {
+		t.Errorf("repeated character scored %d bits", b)
+	}
+	if b := SecretBits("your-secret-key-here"); b >= MinSecretBits {
+		t.Errorf("placeholder scored %d bits", b)
+	}
+	if b := SecretBits("3f9c1a7e5b2d8046c1e9a3b7d5f20864ae1c3b5d7f9062e4a8c0b2d4f6e81357"); b < MinSecretBits {
+		t.Errorf("64 hex digits scored %d bits", b)
+	}
+}
+
+func TestDatabaseDSN(t *testing.T) {
+	d := Database{
+		Host:             "db.internal",
+		Port:             5432,
+		User:             "svc",
+		Password:         `it's a \secret`,
+		Name:             "supplychain",
+		SSLMode:          "verify-full",
+		SSLRootCert:      "/certs/ca.pem",
+		StatementTimeout: 1500 * time.Millisecond,
+	}
+	want := `host=db.internal port=5432 user=svc password='it\'s a \\secret' dbname=supplychain ` +
+		`sslmode=verify-full sslrootcert=/certs/ca.pem application_name=inventory-service statement_timeout=1500`
+	if got := d.DSN("inventory-service"); got != want {
+		t.Errorf("DSN =\n%s\nwant\n%s", got, want)
+	}
+
+	d.ApplicationName = "reports"
+	if got := d.DSN("inventory-service"); !strings.Contains(got, "application_name=reports") {
+		t.Errorf("DSN = %s; database.application_name should win", got)
+	}
+}
+
+func TestParseValidatesDatabaseTLS(t *testing.T) {
+	cert := filepath.Join(t.TempDir(), "client.pem")
+	if err := os.WriteFile(cert, []byte("cert"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Parse([]byte(sample), "inventory", env(map[string]string{
+		"FSC_DATABASE_SSL_MODE":          "always",
+		"FSC_DATABASE_SSL_CERT":          cert,
+		"FSC_DATABASE_SSL_ROOT_CERT":     filepath.Join(t.TempDir(), "missing.pem"),
+		"FSC_DATABASE_STATEMENT_TIMEOUT": "-1s",
+	}))
+	if err == nil {
+		t.Fatal("invalid TLS settings accepted")
+	}
+	for _, want := range []string{
+		`database.ssl_mode "always"`,
+		"ssl_cert and database.ssl_key must be set together",
+		"database.ssl_root_cert:",
+		"statement_timeout must not be negative",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+
+	cfg, err := Parse([]byte(sample), "inventory", env(map[string]string{
+		"FSC_DATABASE_SSL_MODE": "require",
+		"FSC_DATABASE_SSL_CERT": cert,
+		"FSC_DATABASE_SSL_KEY":  cert,
+	}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if dsn := cfg.DSN(); !strings.Contains(dsn, "sslmode=require sslcert="+cert+" sslkey="+cert) {
+		t.Errorf("DSN = %s", dsn)
+	}
+}
+
+func TestReplicaDSN(t *testing.T) {
+	cfg, err := Parse([]byte(sample), "shipment", env(map[string]string{
+		"FSC_DATABASE_REPLICAS_HOSTS": "replica-1, replica-2:5444",
+	}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for host, want := range map[string]string{
+		"replica-1":      "host=replica-1 port=5433 ",
+		"replica-2:5444": "host=replica-2 port=5444 ",
+	} {
+		dsn, err := cfg.ReplicaDSN(host)
+		if err != nil {
+			t.Fatalf("ReplicaDSN(%q): %v", host, err)
+		}
+		if !strings.HasPrefix(dsn, want) || !strings.Contains(dsn, "application_name=shipment-service") {
+			t.Errorf("ReplicaDSN(%q) = %s", host, dsn)
+		}
+	}
+
+	_, err = Parse([]byte(sample), "shipment", env(map[string]string{
+		"FSC_DATABASE_REPLICAS_HOSTS":   "replica-1:port",
+		"FSC_DATABASE_REPLICAS_MAX_LAG": "-1s",
+	}))
+	if err == nil || !strings.Contains(err.Error(), `"replica-1:port" is not host:port`) ||
+		!strings.Contains(err.Error(), "database.replicas durations") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// gatewaySample adds the gateway's entry and section to sample.
+var gatewaySample = strings.Replace(sample, "logging:", `  gateway:
+    name: api-gateway
+    port: 3000
+gateway:
+  routes_file: configs/gateway-routes.yaml
+  cors_origin: http://localhost:5173
+  rate_limit:
+    bucket: rate_limits
+  mail:
+    smtp:
+      port: 587
+logging:`, 1)
+
+func TestParseAppliesGatewayEnvironment(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "smtp")
+	if err := os.WriteFile(secret, []byte("relay-pass\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Parse([]byte(gatewaySample), GatewayService, env(map[string]string{
+		"SMTP_HOST":                  "smtp.internal",
+		"SMTP_PASSWORD_FILE":         secret,
+		"SEED_DEMO_USERS":            "false",
+		"MFA_REQUIRED_ROLES":         "admin, manager",
+		"RATE_LIMIT_STORE":           "nats",
+		"OIDC_ISSUER":                "https://idp.example.com",
+		"FSC_GATEWAY_OIDC_CLIENT_ID": "gateway",
+	}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	g := cfg.Gateway
+	if g.Mail.SMTP.Host != "smtp.internal" || g.Mail.SMTP.Password != "relay-pass" {
+		t.Errorf("smtp = %+v", g.Mail.SMTP)
+	}
+	if g.SeedsDemoUsers("development") {
+		t.Error("SEED_DEMO_USERS=false ignored")
+	}
+	if got := g.MFA.RequiredRoles; len(got) != 2 || got[1] != "manager" {
+		t.Errorf("mfa roles = %v", got)
+	}
+	if g.RateLimit.Store != RateLimitNATS || g.OIDC.Issuer != "https://idp.example.com" || g.OIDC.ClientID != "gateway" {
+		t.Errorf("gateway = %+v", g)
+	}
+
+	// Unset, demo seeding follows the environment.
+	if !(Gateway{}).SeedsDemoUsers("development") || (Gateway{}).SeedsDemoUsers("production") {
+		t.Error("default demo seeding not limited to development")
+	}
+}
+
+func TestParseValidatesGatewaySection(t *testing.T) {
+	strong := "3f9c1a7e5b2d8046c1e9a3b7d5f20864ae1c3b5d7f9062e4a8c0b2d4f6e81357"
+	_, err := Parse([]byte(gatewaySample), GatewayService, env(map[string]string{
+		"APP_ENVIRONMENT":   "production",
+		"JWT_SECRET":        strong,
+		"DB_PASSWORD":       "x",
+		"CORS_ALLOW_ORIGIN": "localhost:5173",
+		"RATE_LIMIT_STORE":  "redis",
+		"OIDC_ISSUER":       "https://idp.example.com",
+	}))
+	if err == nil {
+		t.Fatal("invalid gateway section accepted")
+	}
+	for _, want := range []string{
+		"gateway.cors_origin",
+		"gateway.rate_limit.store",
+		"gateway.mail.smtp.host is required",
+		"gateway.oidc.client_id is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+
+	// MAIL_LOG_ONLY allows production without a relay.
+	if _, err := Parse([]byte(gatewaySample), GatewayService, env(map[string]string{
+		"APP_ENVIRONMENT": "production", "JWT_SECRET": strong, "DB_PASSWORD": "x", "MAIL_LOG_ONLY": "true",
+	})); err != nil {
+		t.Errorf("log-only mail: %v", err)
+	}
+
+	// The services don't read the section, so it isn't checked for them.
+	if _, err := Parse([]byte(sample), "inventory", env(map[string]string{"RATE_LIMIT_STORE": "redis"})); err != nil {
+		t.Errorf("inventory: %v", err)
+	}
+}
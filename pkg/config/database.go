@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sslModes are the libpq sslmode values.
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// DSN returns the keyword/value connection string for the database section,
+// naming the connection after the selected service unless
+// database.application_name is set. Every binary connects through it.
+func (c *Config) DSN() string {
+	return c.Database.DSN(c.Service.Name)
+}
+
+// DSN returns the keyword/value connection string for d; applicationName is
+// used when d.ApplicationName is empty.
+func (d Database) DSN(applicationName string) string {
+	if d.ApplicationName != "" {
+		applicationName = d.ApplicationName
+	}
+	var b strings.Builder
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key + "=" + dsnValue(value))
+	}
+	add("host", d.Host)
+	if d.Port != 0 {
+		add("port", fmt.Sprint(d.Port))
+	}
+	add("user", d.User)
+	add("password", d.Password)
+	add("dbname", d.Name)
+	add("sslmode", d.SSLMode)
+	add("sslrootcert", d.SSLRootCert)
+	add("sslcert", d.SSLCert)
+	add("sslkey", d.SSLKey)
+	add("application_name", applicationName)
+	if d.StatementTimeout > 0 {
+		// Sent as a run-time parameter at connection start, in milliseconds.
+		add("statement_timeout", fmt.Sprint(d.StatementTimeout.Milliseconds()))
+	}
+	return b.String()
+}
+
+// ReplicaDSN returns the connection string for a database.replicas.hosts
+// entry.
+func (c *Config) ReplicaDSN(host string) (string, error) {
+	d := c.Database
+	h, port, err := splitHostPort(host, d.Port)
+	if err != nil {
+		return "", err
+	}
+	d.Host, d.Port = h, port
+	return d.DSN(c.Service.Name), nil
+}
+
+func splitHostPort(hostport string, defaultPort int) (string, int, error) {
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// No port.
+		if strings.TrimSpace(hostport) == "" {
+			return "", 0, fmt.Errorf("empty host")
+		}
+		return hostport, defaultPort, nil
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 || host == "" {
+		return "", 0, fmt.Errorf("%q is not host:port", hostport)
+	}
+	return host, port, nil
+}
+
+// dsnValue quotes s for a keyword/value connection string when needed.
+func dsnValue(s string) string {
+	if !strings.ContainsAny(s, ` '\`) {
+		return s
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// validateConnection returns the problems with the database section's TLS,
+// session and replica settings.
+func (d Database) validateConnection() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if d.SSLMode != "" && !contains(sslModes, d.SSLMode) {
+		fail("database.ssl_mode %q must be one of %s", d.SSLMode, strings.Join(sslModes, ", "))
+	}
+	if (d.SSLCert == "") != (d.SSLKey == "") {
+		fail("database.ssl_cert and database.ssl_key must be set together")
+	}
+	if d.SSLMode == "disable" && (d.SSLRootCert != "" || d.SSLCert != "") {
+		fail("database.ssl_root_cert, ssl_cert and ssl_key need an ssl_mode other than disable")
+	}
+	for _, f := range []struct{ key, path string }{
+		{"ssl_root_cert", d.SSLRootCert}, {"ssl_cert", d.SSLCert}, {"ssl_key", d.SSLKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			fail("database.%s: %v", f.key, err)
+		}
+	}
+	for _, h := range d.Replicas.Hosts {
+		if _, _, err := splitHostPort(h, d.Port); err != nil {
+			fail("database.replicas.hosts: %v", err)
+		}
+	}
+	if d.Replicas.CheckInterval < 0 || d.Replicas.MaxLag < 0 {
+		fail("database.replicas durations must not be negative")
+	}
+	if d.StatementTimeout < 0 {
+		fail("database.statement_timeout must not be negative")
+	}
+	return errs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the environment variable of every key path: database.host
+// is FSC_DATABASE_HOST and services.shipment.port is
+// FSC_SERVICES_SHIPMENT_PORT.
+const EnvPrefix = "FSC_"
+
+// legacyEnv maps the variables the deployments used before key-path
+// overrides to their key paths; {service} is the service being loaded. The
+// FSC_ form wins when both are set.
+var legacyEnv = map[string]string{
+	"APP_ENV":                     "app.environment",
+	"SERVER_PORT":                 "services.{service}.port",
+	"PORT":                        "services.{service}.port",
+	"TRUSTED_PROXIES":             "server.trusted_proxies",
+	"CLIENT_IP_HEADER":            "server.client_ip_header",
+	"DB_HOST":                     "database.host",
+	"DB_PORT":                     "database.port",
+	"DB_USER":                     "database.user",
+	"DB_PASSWORD":                 "database.password",
+	"DB_NAME":                     "database.name",
+	"NATS_URL":                    "nats.url",
+	"JWT_SECRET":                  "auth.jwt_secret",
+	"TOKEN_TTL":                   "auth.token_expiry",
+	"LOG_LEVEL":                   "logging.level",
+	"LOG_FORMAT":                  "logging.format",
+	"LOG_OUTPUT":                  "logging.output",
+	"LOG_MAX_SIZE_MB":             "logging.max_size_mb",
+	"LOG_MAX_BACKUPS":             "logging.max_backups",
+	"METRICS_BUCKETS":             "metrics.buckets",
+	"TRACING_EXPORTER":            "tracing.exporter",
+	"OTEL_EXPORTER_OTLP_ENDPOINT": "tracing.otlp_endpoint",
+	"TRACING_SAMPLE_RATIO":        "tracing.sample_ratio",
+	"ROUTES_FILE":                 "gateway.routes_file",
+	"CORS_ALLOW_ORIGIN":           "gateway.cors_origin",
+	"DASHBOARD_TIMEOUT":           "gateway.dashboard_timeout",
+	"SEED_DEMO_USERS":             "gateway.seed_demo_users",
+	"BOOTSTRAP_ADMIN_USERNAME":    "gateway.bootstrap_admin.username",
+	"BOOTSTRAP_ADMIN_EMAIL":       "gateway.bootstrap_admin.email",
+	"BOOTSTRAP_ADMIN_PASSWORD":    "gateway.bootstrap_admin.password",
+	"LOGIN_LOCKOUT_THRESHOLD":     "gateway.login_lockout.threshold",
+	"LOGIN_LOCKOUT_DURATION":      "gateway.login_lockout.duration",
+	"PASSWORD_RESET_URL":          "gateway.password_reset.url",
+	"PASSWORD_RESET_TTL":          "gateway.password_reset.ttl",
+	"MFA_REQUIRED_ROLES":          "gateway.mfa.required_roles",
+	"MFA_ISSUER":                  "gateway.mfa.issuer",
+	"RATE_LIMIT_STORE":            "gateway.rate_limit.store",
+	"RATE_LIMIT_MAX_KEYS":         "gateway.rate_limit.max_keys",
+	"RATE_LIMIT_BUCKET":           "gateway.rate_limit.bucket",
+	"RATE_LIMIT_TTL":              "gateway.rate_limit.ttl",
+	"SMTP_HOST":                   "gateway.mail.smtp.host",
+	"SMTP_PORT":                   "gateway.mail.smtp.port",
+	"SMTP_USERNAME":               "gateway.mail.smtp.username",
+	"SMTP_PASSWORD":               "gateway.mail.smtp.password",
+	"MAIL_FROM":                   "gateway.mail.from",
+	"MAIL_LOG_ONLY":               "gateway.mail.log_only",
+	"MAIL_LOG_FILE":               "gateway.mail.log_file",
+	"OIDC_ISSUER":                 "gateway.oidc.issuer",
+	"OIDC_CLIENT_ID":              "gateway.oidc.client_id",
+	"OIDC_CLIENT_SECRET":          "gateway.oidc.client_secret",
+	"OIDC_REDIRECT_URL":           "gateway.oidc.redirect_url",
+	"OIDC_POST_LOGIN_URL":         "gateway.oidc.post_login_url",
+	"OIDC_GROUPS_CLAIM":           "gateway.oidc.groups_claim",
+	"OIDC_GROUP_ROLES":            "gateway.oidc.group_roles",
+	"OIDC_DEFAULT_ROLE":           "gateway.oidc.default_role",
+}
+
+// ExpandEnv replaces ${VAR} and ${VAR:-default} from the environment; an
+// unset VAR without a default expands to the empty string, which validation
+// then reports.
+func ExpandEnv(s string) string {
+	return expand(s, os.LookupEnv)
+}
+
+func expand(s string, lookup func(string) (string, bool)) string {
+	return os.Expand(s, func(key string) string {
+		name, def, hasDefault := strings.Cut(key, ":-")
+		if v, ok := lookup(name); ok && v != "" {
+			return v
+		}
+		if hasDefault {
+			return def
+		}
+		return ""
+	})
+}
+
+// EnvName returns the FSC_ variable overriding a key path.
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// applyEnv sets every key path that has a legacy or FSC_ variable (or its
+// _FILE variant), returning one error per unreadable or unparsable value.
+func applyEnv(cfg *Config, service string, lookup func(string) (string, bool)) []error {
+	leaves := keyPaths(cfg, service)
+
+	var errs []error
+	set := func(env, path string) {
+		leaf, ok := leaves[path]
+		if !ok {
+			return
+		}
+		v, ok, err := lookupValue(lookup, env)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := leaf.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", env, err))
+		}
+	}
+
+	names := make([]string, 0, len(legacyEnv))
+	for env := range legacyEnv {
+		names = append(names, env)
+	}
+	sort.Strings(names) // PORT before SERVER_PORT, so the latter wins
+	for _, env := range names {
+		set(env, strings.ReplaceAll(legacyEnv[env], "{service}", service))
+	}
+	paths := make([]string, 0, len(leaves))
+	for path := range leaves {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		set(EnvName(path), path)
+	}
+	return errs
+}
+
+// leaf is a settable scalar or list in the configuration.
+type leaf struct {
+	set func(string) error
+}
+
+// keyPaths returns a setter for every key path in cfg, including those of
+// each services: entry and of service, whose entry a variable such as
+// FSC_SERVICES_<NAME>_PORT creates if the file lacks it.
+func keyPaths(cfg *Config, service string) map[string]leaf {
+	out := make(map[string]leaf)
+	walk(reflect.ValueOf(cfg).Elem(), "", out)
+	names := []string{service}
+	for name := range cfg.Services {
+		if name != service {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		name, svc := name, cfg.Services[name]
+		entry := make(map[string]leaf)
+		walk(reflect.ValueOf(&svc).Elem(), "", entry)
+		for path, l := range entry {
+			l := l
+			out["services."+name+"."+path] = leaf{set: func(s string) error {
+				if err := l.set(s); err != nil {
+					return err
+				}
+				cfg.Services[name] = svc
+				return nil
+			}}
+		}
+	}
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func walk(v reflect.Value, prefix string, out map[string]leaf) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			walk(fv, path, out)
+		case fv.Kind() == reflect.Map:
+			// services: entries are handled by keyPaths.
+		default:
+			out[path] = leaf{set: setter(fv)}
+		}
+	}
+}
+
+// setter parses environment strings into v: durations like "30s", comma
+// separated lists, and plain scalars, allocating optional (pointer) ones.
+func setter(v reflect.Value) func(string) error {
+	return func(s string) error {
+		s = strings.TrimSpace(s)
+		switch {
+		case v.Kind() == reflect.Ptr:
+			elem := reflect.New(v.Type().Elem())
+			if err := setter(elem.Elem())(s); err != nil {
+				return err
+			}
+			v.Set(elem)
+		case v.Type() == durationType:
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q", s)
+			}
+			v.SetInt(int64(d))
+		case v.Kind() == reflect.String:
+			v.SetString(s)
+		case v.Kind() == reflect.Int:
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", s)
+			}
+			v.SetInt(int64(n))
+		case v.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", s)
+			}
+			v.SetBool(b)
+		case v.Kind() == reflect.Float64:
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", s)
+			}
+			v.SetFloat(f)
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+			var list []string
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			v.Set(reflect.ValueOf(list))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Float64:
+			var list []float64
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				f, err := strconv.ParseFloat(item, 64)
+				if err != nil {
+					return fmt.Errorf("invalid number %q", item)
+				}
+				list = append(list, f)
+			}
+			v.Set(reflect.ValueOf(list))
+		default:
+			return fmt.Errorf("cannot be set from the environment")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// GatewayService is the services: entry of the API gateway, the only process
+// whose gateway: section is validated.
+const GatewayService = "gateway"
+
+// Rate-limit stores accepted in gateway.rate_limit.store.
+const (
+	RateLimitMemory = "memory"
+	RateLimitNATS   = "nats"
+)
+
+// Gateway configures the API gateway; the services ignore it.
+type Gateway struct {
+	// RoutesFile is the declarative table of proxied routes.
+	RoutesFile string `yaml:"routes_file"`
+	// CORSOrigin is the frontend origin allowed to call the gateway.
+	CORSOrigin string `yaml:"cors_origin"`
+	// DashboardTimeout bounds each upstream call of /dashboard.
+	DashboardTimeout time.Duration `yaml:"dashboard_timeout"`
+	// SeedDemoUsers creates one demo account per built-in role; unset seeds
+	// them in development only.
+	SeedDemoUsers *bool          `yaml:"seed_demo_users"`
+	Bootstrap     BootstrapAdmin `yaml:"bootstrap_admin"`
+	Lockout       LoginLockout   `yaml:"login_lockout"`
+	PasswordReset PasswordReset  `yaml:"password_reset"`
+	MFA           MFA            `yaml:"mfa"`
+	RateLimit     RateLimit      `yaml:"rate_limit"`
+	Mail          Mail           `yaml:"mail"`
+	OIDC          OIDC           `yaml:"oidc"`
+}
+
+// BootstrapAdmin describes the admin created when none exists; an empty
+// password is generated and logged once.
+type BootstrapAdmin struct {
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+}
+
+// LoginLockout locks an account for Duration after Threshold consecutive
+// failed logins.
+type LoginLockout struct {
+	Threshold int           `yaml:"threshold"`
+	Duration  time.Duration `yaml:"duration"`
+}
+
+// PasswordReset configures emailed reset links. An empty URL means the
+// frontend's /reset-password page under cors_origin.
+type PasswordReset struct {
+	URL string        `yaml:"url"`
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// MFA configures two-factor authentication.
+type MFA struct {
+	// RequiredRoles must enroll an authenticator before receiving a token.
+	RequiredRoles []string `yaml:"required_roles"`
+	Issuer        string   `yaml:"issuer"`
+}
+
+// RateLimit selects where the gateway keeps its rate-limit buckets: memory,
+// holding at most MaxKeys clients (0: the store's default), or nats, a
+// JetStream key-value Bucket shared by every replica whose entries expire
+// after TTL.
+type RateLimit struct {
+	Store   string        `yaml:"store"`
+	MaxKeys int           `yaml:"max_keys"`
+	Bucket  string        `yaml:"bucket"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+// Mail delivers password reset emails over SMTP when smtp.host is set.
+// Otherwise mail is only logged (and appended to LogFile, if set), which
+// outside development needs LogOnly.
+type Mail struct {
+	SMTP    SMTP   `yaml:"smtp"`
+	From    string `yaml:"from"`
+	LogOnly bool   `yaml:"log_only"`
+	LogFile string `yaml:"log_file"`
+}
+
+// SMTP is the relay for outgoing mail.
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// OIDC enables single sign-on when Issuer is set. An empty RedirectURL means
+// the gateway's own callback on localhost, and an empty PostLoginURL the
+// frontend's /auth/callback page under cors_origin.
+type OIDC struct {
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+	PostLoginURL string `yaml:"post_login_url"`
+	GroupsClaim  string `yaml:"groups_claim"`
+	// GroupRoles maps IdP groups to roles as "group=role,group=role"; the
+	// first group the user belongs to decides their role, else DefaultRole.
+	GroupRoles  string `yaml:"group_roles"`
+	DefaultRole string `yaml:"default_role"`
+}
+
+// SeedsDemoUsers reports whether the demo accounts are to be created in
+// environment.
+func (g Gateway) SeedsDemoUsers(environment string) bool {
+	if g.SeedDemoUsers != nil {
+		return *g.SeedDemoUsers
+	}
+	return IsDevelopment(environment)
+}
+
+// validate returns the problems with the gateway section in environment.
+func (g Gateway) validate(environment string) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if g.RoutesFile == "" {
+		fail("gateway.routes_file is required")
+	}
+	if err := checkURL(g.CORSOrigin); err != nil {
+		fail("gateway.cors_origin: %v", err)
+	}
+	if g.DashboardTimeout < 0 {
+		fail("gateway.dashboard_timeout must not be negative")
+	}
+	if g.Lockout.Threshold < 0 || g.Lockout.Duration < 0 {
+		fail("gateway.login_lockout values must not be negative")
+	}
+	if g.PasswordReset.URL != "" {
+		if err := checkURL(g.PasswordReset.URL); err != nil {
+			fail("gateway.password_reset.url: %v", err)
+		}
+	}
+	if g.PasswordReset.TTL < 0 {
+		fail("gateway.password_reset.ttl must not be negative")
+	}
+
+	switch g.RateLimit.Store {
+	case "", RateLimitMemory:
+	case RateLimitNATS:
+		if g.RateLimit.Bucket == "" {
+			fail("gateway.rate_limit.bucket is required with the %s store", RateLimitNATS)
+		}
+	default:
+		fail("gateway.rate_limit.store %q must be %s or %s", g.RateLimit.Store, RateLimitMemory, RateLimitNATS)
+	}
+	if g.RateLimit.MaxKeys < 0 || g.RateLimit.TTL < 0 {
+		fail("gateway.rate_limit values must not be negative")
+	}
+
+	if g.Mail.SMTP.Host == "" {
+		if !IsDevelopment(environment) && !g.Mail.LogOnly {
+			fail("gateway.mail.smtp.host is required in the %q environment (SMTP_HOST, or MAIL_LOG_ONLY=true to only log mail)", environment)
+		}
+	} else if g.Mail.SMTP.Port < 1 || g.Mail.SMTP.Port > 65535 {
+		fail("gateway.mail.smtp.port %d must be between 1 and 65535", g.Mail.SMTP.Port)
+	}
+
+	if o := g.OIDC; o.Issuer != "" {
+		if err := checkURL(o.Issuer); err != nil {
+			fail("gateway.oidc.issuer: %v", err)
+		}
+		if o.ClientID == "" {
+			fail("gateway.oidc.client_id is required with an issuer")
+		}
+		for _, f := range []struct{ key, value string }{
+			{"redirect_url", o.RedirectURL}, {"post_login_url", o.PostLoginURL},
+		} {
+			if f.value == "" {
+				continue
+			}
+			if err := checkURL(f.value); err != nil {
+				fail("gateway.oidc.%s: %v", f.key, err)
+			}
+		}
+	}
+	return errs
+}
+
+// checkURL reports whether s is an absolute http or https URL.
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http(s) URL", s)
+	}
+	return nil
+}
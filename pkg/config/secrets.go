@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// FileSuffix marks the variant of a variable that names a file holding its
+// value, as Docker and Kubernetes mount secrets: DB_PASSWORD_FILE or
+// FSC_AUTH_JWT_SECRET_FILE. Trailing newlines are dropped from the file.
+const FileSuffix = "_FILE"
+
+// MinSecretBits is the least estimated entropy accepted for auth.jwt_secret
+// outside development; 64 random hex digits (openssl rand -hex 32) carry
+// about 240.
+const MinSecretBits = 128
+
+// placeholders are the sample secrets shipped in configs/ and deployments/,
+// by key path. Outside development the processes refuse to start with them.
+var placeholders = map[string][]string{
+	"auth.jwt_secret":   {"your-secret-key-here", "change-me-in-production"},
+	"database.password": {"supplychain123"},
+}
+
+// lookupValue returns name's value from the environment or from the file
+// named by name+FileSuffix; setting both is an error.
+func lookupValue(lookup func(string) (string, bool), name string) (string, bool, error) {
+	v, ok := lookup(name)
+	ok = ok && v != ""
+	path, fromFile := lookup(name + FileSuffix)
+	fromFile = fromFile && path != ""
+	switch {
+	case ok && fromFile:
+		return "", false, fmt.Errorf("set only one of %s and %s%s", name, name, FileSuffix)
+	case fromFile:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s%s: %v", name, FileSuffix, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return v, ok, nil
+}
+
+// IsDevelopment reports whether env names a local/development environment,
+// where placeholder and weak secrets are tolerated.
+func IsDevelopment(env string) bool {
+	switch env {
+	case "development", "dev", "local", "test":
+		return true
+	}
+	return false
+}
+
+// SecretBits estimates the entropy of s in bits: its length times the
+// Shannon entropy of its characters. Short or repetitive secrets score low;
+// it's an upper bound, so a passphrase of dictionary words still overrates.
+func SecretBits(s string) int {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var perChar float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+	return int(perChar * float64(n))
+}
+
+// checkSecrets returns one error per placeholder or weak secret.
+func (c *Config) checkSecrets() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	switch {
+	case c.Auth.JWTSecret == "":
+		fail("auth.jwt_secret is required (JWT_SECRET or JWT_SECRET_FILE)")
+	case isPlaceholder("auth.jwt_secret", c.Auth.JWTSecret):
+		fail("auth.jwt_secret is the placeholder %q; set JWT_SECRET or JWT_SECRET_FILE", c.Auth.JWTSecret)
+	default:
+		if bits := SecretBits(c.Auth.JWTSecret); bits < MinSecretBits {
+			fail("auth.jwt_secret is too weak (about %d bits of entropy, need %d; try openssl rand -hex 32)", bits, MinSecretBits)
+		}
+	}
+	if isPlaceholder("database.password", c.Database.Password) {
+		fail("database.password is the placeholder %q; set DB_PASSWORD or DB_PASSWORD_FILE", c.Database.Password)
+	}
+	return errs
+}
+
+func isPlaceholder(path, value string) bool {
+	for _, p := range placeholders[path] {
+		if value == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/httpx"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"
+)
+
+// validate returns one error per problem, named by key path.
+func (c *Config) validate() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if c.App.Name == "" {
+		fail("app.name is required")
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port %d must be between 1 and 65535", c.Server.Port)
+	}
+	if t := c.Server.Timeout; t.Read < 0 || t.Write < 0 || t.Idle < 0 {
+		fail("server.timeout values must not be negative")
+	}
+	if _, err := httpx.ParseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		fail("server.trusted_proxies: %v", err)
+	}
+	switch c.Server.ClientIPHeader {
+	case "", httpx.HeaderXForwardedFor, httpx.HeaderForwarded:
+	default:
+		fail("server.client_ip_header must be %s or %s", httpx.HeaderXForwardedFor, httpx.HeaderForwarded)
+	}
+
+	if c.Database.Host == "" {
+		fail("database.host is required")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		fail("database.port %d must be between 1 and 65535", c.Database.Port)
+	}
+	if c.Database.Name == "" {
+		fail("database.name is required")
+	}
+	if c.Database.User == "" {
+		fail("database.user is required")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+		fail("database pool limits must not be negative")
+	}
+	errs = append(errs, c.Database.validateConnection()...)
+
+	if c.NATS.URL == "" {
+		fail("nats.url is required")
+	}
+
+	if c.Auth.TokenExpiry < 0 || c.Auth.RefreshTokenExpiry < 0 {
+		fail("auth token expiries must not be negative")
+	}
+
+	for name, svc := range c.Services {
+		if svc.Port < 0 || svc.Port > 65535 {
+			fail("services.%s.port %d must be between 1 and 65535", name, svc.Port)
+		}
+	}
+
+	if err := logging.ValidateConfig(c.LoggingConfig()); err != nil {
+		fail("logging: %v", err)
+	}
+
+	if err := metrics.ValidateBuckets(c.Metrics.Buckets); err != nil {
+		fail("metrics.buckets: %v", err)
+	}
+
+	switch c.Tracing.Exporter {
+	case "", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		fail("tracing.exporter %q must be %s, %s or %s", c.Tracing.Exporter, tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterNone)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio %g must be between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	return errs
+}
@@ -0,0 +1,169 @@
+// Package health serves Kubernetes-style liveness and readiness endpoints.
+// Liveness only says the process is serving HTTP; readiness runs the
+// registered dependency checks (database pool, NATS connection, ...)
+// concurrently and reports each one, answering 503 if any fails.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Status values used in reports.
+const (
+	StatusOK   = "ok"
+	StatusDown = "down"
+)
+
+// DefaultTimeout bounds each check when the Checker has no timeout set.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable. It should honour ctx.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check.
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the readiness response body.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// OK reports whether every check passed.
+func (r Report) OK() bool { return r.Status == StatusOK }
+
+// Checker holds the named readiness checks of one process. The zero value is
+// not ready for use; call NewChecker.
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// NewChecker returns a Checker that gives each check up to timeout (zero
+// means DefaultTimeout).
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Add registers a check, replacing any previous check with the same name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Run executes every check concurrently and collects the results.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.runOne(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (c *Checker) runOne(ctx context.Context, check Check) (res Result) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			res = Result{Status: StatusDown, Error: fmt.Sprint("check panicked: ", p)}
+		}
+		res.DurationMS = time.Since(start).Milliseconds()
+	}()
+	if err := check(ctx); err != nil {
+		return Result{Status: StatusDown, Error: err.Error()}
+	}
+	return Result{Status: StatusOK}
+}
+
+// Handler serves the readiness report: 200 when every check passes, 503
+// otherwise.
+func (c *Checker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		WriteJSON(w, status, report)
+	})
+}
+
+// LiveHandler serves liveness. It checks no dependencies, so a database
+// outage makes pods unready rather than restarting them.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+	})
+}
+
+// WriteJSON writes a health response. Health responses are never cached.
+func WriteJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// DB checks that the pool can reach the database.
+func DB(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// NATS checks that the connection is established (not reconnecting or
+// closed).
+func NATS(nc *nats.Conn) Check {
+	return func(ctx context.Context) error {
+		if status := nc.Status(); status != nats.CONNECTED {
+			return fmt.Errorf("nats connection %s", status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadinessReportsEveryCheck(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("nats", func(ctx context.Context) error { return errors.New("nats connection RECONNECTING") })
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != StatusDown || report.Checks["database"].Status != StatusOK {
+		t.Errorf("report = %+v", report)
+	}
+	if r := report.Checks["nats"]; r.Status != StatusDown || r.Error != "nats connection RECONNECTING" {
+		t.Errorf("nats = %+v", r)
+	}
+	if r := report.Checks["slow"]; r.Status != StatusDown || r.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow check not timed out: %+v", r)
+	}
+}
+
+func TestReadinessOKAndLiveness(t *testing.T) {
+	c := NewChecker(0)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("ready status = %d, want 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("live = %d %v", rec.Code, rec.Header())
+	}
+}
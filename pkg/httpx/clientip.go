@@ -0,0 +1,217 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const clientIPKey contextKey = "httpx.client_ip"
+
+// Headers ClientIPConfig can read forwarding chains from.
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+)
+
+// ClientIPConfig says which peers may report the client address on a
+// request's behalf.
+type ClientIPConfig struct {
+	// TrustedProxies are the proxies whose forwarding headers are believed.
+	// Empty means none: the client IP is always the connection's peer.
+	TrustedProxies []netip.Prefix
+	// Header is the forwarding header the trusted proxies maintain:
+	// HeaderXForwardedFor (the default) or HeaderForwarded (RFC 7239). Only
+	// one is read, so a client cannot smuggle an address in the other.
+	Header string
+}
+
+// ParseTrustedProxies parses CIDRs ("10.0.0.0/8") and bare addresses
+// ("192.0.2.1"), reporting every invalid entry. Blank entries are skipped.
+func ParseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	var bad []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				bad = append(bad, entry)
+				continue
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			bad = append(bad, entry)
+			continue
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("invalid trusted proxies: %s", strings.Join(bad, ", "))
+	}
+	return prefixes, nil
+}
+
+// ResolveClientIP returns middleware that resolves the client IP per cfg and
+// stores it in the request context, where ClientIP and ClientIPFrom find it.
+// Install it before Logger so request logs carry the resolved address.
+func ResolveClientIP(cfg ClientIPConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey, cfg.Resolve(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Resolve determines the client IP of r. The forwarding header is only
+// consulted when the connection comes from a trusted proxy, and is walked
+// right to left (nearest hop first) past further trusted proxies: the first
+// untrusted address is the client. Addresses to its left were supplied by
+// the client itself and are ignored. A malformed or obfuscated hop stops the
+// walk at the last trusted proxy, which vouched for nothing further.
+func (c ClientIPConfig) Resolve(r *http.Request) string {
+	peer := peerAddr(r)
+	addr, err := netip.ParseAddr(peer)
+	if err != nil || !c.trusted(addr) {
+		return peer
+	}
+	var hops []string
+	if c.Header == HeaderForwarded {
+		hops = forwardedFor(r.Header.Values(HeaderForwarded))
+	} else {
+		hops = forwardedList(r.Header.Values(HeaderXForwardedFor))
+	}
+	client := addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+		client = hop
+		if !c.trusted(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (c ClientIPConfig) trusted(addr netip.Addr) bool {
+	for _, p := range c.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIPFrom returns the client IP stored by ResolveClientIP, or "" when
+// the middleware did not run.
+func ClientIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+// ClientIP returns the client IP resolved by ResolveClientIP or, without that
+// middleware, the connection's peer address. Forwarding headers are never
+// read here: anyone can send them.
+func ClientIP(r *http.Request) string {
+	if ip := ClientIPFrom(r.Context()); ip != "" {
+		return ip
+	}
+	return peerAddr(r)
+}
+
+// peerAddr is the address of the connection's remote end, unmapped so IPv4
+// peers on dual-stack listeners compare equal to IPv4 prefixes.
+func peerAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().WithZone("").String()
+	}
+	return host
+}
+
+// forwardedList flattens X-Forwarded-For values, which may be repeated and
+// comma-separated, into hops in order.
+func forwardedList(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedFor extracts the for= node of each RFC 7239 Forwarded element, in
+// order. An element without one yields "" so the walk stops there.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range splitQuoted(v, ',') {
+			node := ""
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					node = strings.Trim(strings.TrimSpace(value), `"`)
+				}
+			}
+			hops = append(hops, node)
+		}
+	}
+	return hops
+}
+
+// splitQuoted splits s on sep outside double-quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseHop parses one forwarding hop: a bare address, an IPv4 address with a
+// port, or a bracketed IPv6 address with an optional port. "unknown" and
+// obfuscated identifiers ("_hidden") don't parse.
+func parseHop(hop string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap().WithZone(""), true
+	}
+	if ap, err := netip.ParseAddrPort(hop); err == nil {
+		return ap.Addr().Unmap().WithZone(""), true
+	}
+	if strings.HasPrefix(hop, "[") && strings.HasSuffix(hop, "]") {
+		if addr, err := netip.ParseAddr(hop[1 : len(hop)-1]); err == nil {
+			return addr.Unmap().WithZone(""), true
+		}
+	}
+	return netip.Addr{}, false
+}
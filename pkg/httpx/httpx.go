@@ -1,27 +1,28 @@
 // Package httpx provides reusable net/http middleware compatible with
 // gorilla/mux's router.Use (func(http.Handler) http.Handler). It depends only
-// on the Go standard library and github.com/google/uuid.
+// on the Go standard library, github.com/google/uuid and pkg/logging.
 package httpx
 
 import (
 	"context"
 	"encoding/json"
 	"log/slog"
-	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/logging"
 )
 
 type contextKey string
 
 const requestIDKey contextKey = "httpx.request_id"
 
-// requestIDHeader is the canonical header used to carry a request correlation
+// RequestIDHeader is the canonical header used to carry a request correlation
 // identifier in and out of the service.
-const requestIDHeader = "X-Request-ID"
+const RequestIDHeader = "X-Request-ID"
 
 // RequestIDFrom returns the request ID stored in the context by RequestID, or
 // an empty string if none is present.
@@ -36,11 +37,11 @@ func RequestIDFrom(ctx context.Context) string {
 // is absent), echoes it on the response and stores it in the request context.
 func RequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := strings.TrimSpace(r.Header.Get(requestIDHeader))
+		id := strings.TrimSpace(r.Header.Get(RequestIDHeader))
 		if id == "" {
 			id = uuid.New().String()
 		}
-		w.Header().Set(requestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
 		ctx := context.WithValue(r.Context(), requestIDKey, id)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -72,24 +73,37 @@ func (rec *statusRecorder) Write(b []byte) (int, error) {
 }
 
 // Logger returns middleware that logs one structured line per request with the
-// method, path, status, duration and request ID.
+// method, path, status, duration, request ID and client IP. It also starts the
+// request's logging scope (see logging.NewContext) holding the request ID, so
+// logging.FromContext(r.Context()) in handlers, and this line, also carry the
+// user and tenant that authentication adds to it.
 func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			ctx := logging.NewContext(r.Context(), logger, slog.String("request_id", RequestIDFrom(r.Context())))
 			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
-			next.ServeHTTP(rec, r)
-			logger.LogAttrs(r.Context(), slog.LevelInfo, "http_request",
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "http_request",
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.Int("status", rec.status),
 				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000.0),
-				slog.String("request_id", RequestIDFrom(r.Context())),
+				slog.String("client_ip", ClientIP(r)),
 			)
 		})
 	}
 }
 
+// requestLogger returns the request's scoped logger when Logger is installed,
+// or logger with the request ID otherwise.
+func requestLogger(r *http.Request, logger *slog.Logger) *slog.Logger {
+	if logging.Attrs(r.Context()) != nil {
+		return logging.FromContext(r.Context())
+	}
+	return logger.With(slog.String("request_id", RequestIDFrom(r.Context())))
+}
+
 // Recoverer returns middleware that recovers from panics in downstream
 // handlers, logs the panic value and responds with a 500 JSON error.
 func Recoverer(logger *slog.Logger) func(http.Handler) http.Handler {
@@ -97,10 +111,9 @@ func Recoverer(logger *slog.Logger) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if rec := recover(); rec != nil {
-					logger.LogAttrs(r.Context(), slog.LevelError, "panic_recovered",
+					requestLogger(r, logger).LogAttrs(r.Context(), slog.LevelError, "panic_recovered",
 						slog.Any("panic", rec),
 						slog.String("path", r.URL.Path),
-						slog.String("request_id", RequestIDFrom(r.Context())),
 					)
 					writeJSONError(w, http.StatusInternalServerError, "internal server error")
 				}
@@ -122,21 +135,6 @@ func SecurityHeaders(next http.Handler) http.Handler {
 	})
 }
 
-// clientIP derives the client IP from the request, honouring the first hop of
-// an X-Forwarded-For header when present (e.g. behind the gateway/load balancer).
-func clientIP(r *http.Request) string {
-	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-		if first := strings.TrimSpace(strings.SplitN(fwd, ",", 2)[0]); first != "" {
-			return first
-		}
-	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return host
-}
-
 func writeJSONError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
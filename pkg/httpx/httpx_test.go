@@ -3,7 +3,10 @@ package httpx
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/ratelimit"
 )
 
 func TestRequestIDGeneratesAndEchoes(t *testing.T) {
@@ -19,8 +22,8 @@ func TestRequestIDGeneratesAndEchoes(t *testing.T) {
 	if seen == "" {
 		t.Fatal("request ID was not stored in the context")
 	}
-	if got := rec.Header().Get(requestIDHeader); got != seen {
-		t.Fatalf("response header %q = %q, want %q", requestIDHeader, got, seen)
+	if got := rec.Header().Get(RequestIDHeader); got != seen {
+		t.Fatalf("response header %q = %q, want %q", RequestIDHeader, got, seen)
 	}
 }
 
@@ -32,14 +35,14 @@ func TestRequestIDHonoursInboundHeader(t *testing.T) {
 	}))
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set(requestIDHeader, want)
+	req.Header.Set(RequestIDHeader, want)
 	rec := httptest.NewRecorder()
 	h.ServeHTTP(rec, req)
 
 	if seen != want {
 		t.Fatalf("context request ID = %q, want %q", seen, want)
 	}
-	if got := rec.Header().Get(requestIDHeader); got != want {
+	if got := rec.Header().Get(RequestIDHeader); got != want {
 		t.Fatalf("response header = %q, want %q", got, want)
 	}
 }
@@ -94,3 +97,112 @@ func TestRateLimitIsPerClientIP(t *testing.T) {
 		t.Fatalf("first client repeat status = %d, want 429", got)
 	}
 }
+
+func TestRateLimitWithSetsHeadersAndKeysByCaller(t *testing.T) {
+	h := RateLimitWith(RateLimitConfig{
+		Name:  "test",
+		Limit: ratelimit.Limit{Rate: 0.5, Burst: 2},
+		Key:   func(r *http.Request) string { return r.Header.Get("X-User") },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	doReq := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := doReq("alice")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", rec.Code)
+	}
+	for name, want := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "2",
+		"RateLimit-Policy":    "2;w=4",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	doReq("alice")
+	rec = doReq("alice")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	// Same IP, different caller: separate bucket.
+	if rec := doReq("bob"); rec.Code != http.StatusOK {
+		t.Errorf("other caller status = %d, want 200", rec.Code)
+	}
+}
+
+func TestClientIPResolution(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", " "})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	xff := ClientIPConfig{TrustedProxies: trusted}
+	fwd := ClientIPConfig{TrustedProxies: trusted, Header: HeaderForwarded}
+
+	cases := []struct {
+		name   string
+		cfg    ClientIPConfig
+		remote string
+		header string
+		value  string
+		want   string
+	}{
+		{"untrusted peer ignores header", xff, "203.0.113.9:1", "X-Forwarded-For", "1.2.3.4", "203.0.113.9"},
+		{"no trusted proxies", ClientIPConfig{}, "10.0.0.1:1", "X-Forwarded-For", "1.2.3.4", "10.0.0.1"},
+		{"trusted peer", xff, "10.0.0.1:1", "X-Forwarded-For", "198.51.100.7", "198.51.100.7"},
+		{"spoofed left hop ignored", xff, "10.0.0.1:1", "X-Forwarded-For", "1.2.3.4, 198.51.100.7, 10.1.1.1", "198.51.100.7"},
+		{"all hops trusted", xff, "10.0.0.1:1", "X-Forwarded-For", "10.2.2.2, 192.0.2.1", "10.2.2.2"},
+		{"malformed hop stops at proxy", xff, "10.0.0.1:1", "X-Forwarded-For", "1.2.3.4, garbage", "10.0.0.1"},
+		{"no header", xff, "10.0.0.1:1", "", "", "10.0.0.1"},
+		{"other header ignored", fwd, "10.0.0.1:1", "X-Forwarded-For", "1.2.3.4", "10.0.0.1"},
+		{"forwarded", fwd, "10.0.0.1:1", "Forwarded", `for=1.2.3.4, for="198.51.100.7:4711";proto=https`, "198.51.100.7"},
+		{"forwarded ipv6", fwd, "10.0.0.1:1", "Forwarded", `for="[2001:db8::17]:4711";by=10.0.0.1`, "2001:db8::17"},
+		{"forwarded obfuscated", fwd, "10.0.0.1:1", "Forwarded", "for=_hidden", "10.0.0.1"},
+		{"ipv4-mapped peer", xff, "[::ffff:10.0.0.1]:1", "X-Forwarded-For", "198.51.100.7", "198.51.100.7"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			h := ResolveClientIP(tc.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remote
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tc.want {
+				t.Errorf("client IP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33", "nope"}); err == nil ||
+		!strings.Contains(err.Error(), "10.0.0.0/33, nope") {
+		t.Errorf("invalid entries error = %v", err)
+	}
+}
+
+func TestClientIPWithoutMiddlewareIgnoresHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := ClientIP(req); got != "203.0.113.9" {
+		t.Errorf("client IP = %q, want the peer address", got)
+	}
+}
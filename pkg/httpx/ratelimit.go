@@ -1,83 +1,84 @@
 package httpx
 
 import (
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
-)
-
-// tokenBucket is a single client's token bucket. Tokens refill continuously at
-// rps tokens per second up to burst, and are deducted one per request.
-type tokenBucket struct {
-	tokens   float64
-	lastSeen time.Time
-}
 
-// rateLimiter is a per-client-IP token-bucket limiter guarded by a mutex. It is
-// hand-rolled (no external dependencies) and refills lazily on each request.
-type rateLimiter struct {
-	rps   float64
-	burst float64
-	now   func() time.Time
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/ratelimit"
+)
 
-	mu      sync.Mutex
-	buckets map[string]*tokenBucket
+// RateLimitConfig configures RateLimitWith.
+type RateLimitConfig struct {
+	// Name namespaces the limiter's keys, so limiters sharing a Store keep
+	// separate buckets.
+	Name  string
+	Limit ratelimit.Limit
+	// Store holds the buckets. Nil gives the limiter a private in-memory
+	// store; pass a shared store (e.g. ratelimit.KV) to enforce one limit
+	// across replicas.
+	Store ratelimit.Store
+	// Key identifies the client. Nil, or an empty result, falls back to the
+	// client IP.
+	Key func(*http.Request) string
+	// Logger reports store failures; nil uses the slog default.
+	Logger *slog.Logger
 }
 
-// newRateLimiter builds a limiter allowing rps requests per second per client
-// with a burst capacity. Non-positive values are clamped to sane minimums.
-func newRateLimiter(rps float64, burst int) *rateLimiter {
-	if rps <= 0 {
-		rps = 1
-	}
-	if burst <= 0 {
-		burst = 1
-	}
-	return &rateLimiter{
-		rps:     rps,
-		burst:   float64(burst),
-		now:     time.Now,
-		buckets: make(map[string]*tokenBucket),
-	}
+// RateLimit returns middleware enforcing a per-client-IP token-bucket limit
+// of rps requests per second with the given burst, in a private in-memory
+// store. Apply it to specific routes (e.g. login/register) rather than
+// globally.
+func RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
+	return RateLimitWith(RateLimitConfig{Limit: ratelimit.Limit{Rate: rps, Burst: burst}})
 }
 
-// allow reports whether a request from key may proceed, deducting a token when
-// it does.
-func (l *rateLimiter) allow(key string) bool {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	now := l.now()
-	b, ok := l.buckets[key]
-	if !ok {
-		// New clients start with a full bucket, minus the current request.
-		l.buckets[key] = &tokenBucket{tokens: l.burst - 1, lastSeen: now}
-		return true
-	}
-
-	// Refill based on elapsed time since the bucket was last touched.
-	elapsed := now.Sub(b.lastSeen).Seconds()
-	b.tokens += elapsed * l.rps
-	if b.tokens > l.burst {
-		b.tokens = l.burst
+// RateLimitWith returns token-bucket rate-limiting middleware. Every response
+// carries RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers; a request over the limit gets 429 with
+// Retry-After. If the store fails, the request is counted against a private
+// in-memory fallback, so limits degrade to per-replica rather than vanish.
+func RateLimitWith(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	fallback := ratelimit.NewMemory(0)
+	if cfg.Store == nil {
+		cfg.Store = fallback
 	}
-	b.lastSeen = now
-
-	if b.tokens < 1 {
-		return false
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
 	}
-	b.tokens--
-	return true
-}
-
-// RateLimit returns middleware enforcing a per-client-IP token-bucket limit.
-// On exceeding the limit it responds 429 with a JSON error. Apply it to
-// specific routes (e.g. login/register) rather than globally.
-func RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
-	limiter := newRateLimiter(rps, burst)
+	policy := fmt.Sprintf("%d;w=%d", cfg.Limit.Burst, ceilSeconds(cfg.Limit.Window()))
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !limiter.allow(clientIP(r)) {
+			key := ""
+			if cfg.Key != nil {
+				key = cfg.Key(r)
+			}
+			if key == "" {
+				key = "ip:" + ClientIP(r)
+			}
+			key = cfg.Name + "|" + key
+
+			d, err := cfg.Store.Take(r.Context(), key, cfg.Limit)
+			if err != nil {
+				cfg.Logger.LogAttrs(r.Context(), slog.LevelWarn, "rate_limit_store_failed",
+					slog.String("limiter", cfg.Name), slog.String("error", err.Error()))
+				d, _ = fallback.Take(r.Context(), key, cfg.Limit)
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+			h.Set("RateLimit-Policy", policy)
+			if !d.Allowed {
+				retry := ceilSeconds(d.RetryAfter)
+				if retry < 1 {
+					retry = 1
+				}
+				h.Set("Retry-After", strconv.Itoa(retry))
 				writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
 				return
 			}
@@ -85,3 +86,7 @@ func RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// levelBody is the JSON shape of LevelHandler's requests and responses.
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler serves the current level of v on GET and changes it on PUT or
+// POST with a body like {"level":"debug"}, answering with the level now in
+// effect. Each change is logged with the caller's request attributes, at a
+// level the old setting lets through. Callers must put it behind
+// authentication.
+func LevelHandler(v *slog.LevelVar) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var body levelBody
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&body); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+				return
+			}
+			level, err := ParseLevel(body.Level)
+			if err != nil || strings.TrimSpace(body.Level) == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "level must be debug, info, warn or error"})
+				return
+			}
+			previous := v.Level()
+			FromContext(r.Context()).LogAttrs(r.Context(), max(previous, slog.LevelInfo), "log_level_changed",
+				slog.String("from", levelName(previous)), slog.String("to", levelName(level)))
+			v.Set(level)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, levelBody{Level: levelName(v.Level())})
+	})
+}
+
+// levelName is the lower-case name ParseLevel accepts.
+func levelName(l slog.Level) string {
+	return strings.ToLower(l.String())
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+type contextKey struct{}
+
+// scope is a request's logger and the attributes gathered for it so far. It
+// is mutable so middleware deeper in the chain (authentication, for the user
+// and tenant) can add attributes that the outer request log line sees too.
+type scope struct {
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// NewContext returns a context carrying logger and the given attributes for
+// the duration of a request. FromContext and any logger built by New include
+// them, plus those added later with AddAttrs, in records logged with ctx.
+func NewContext(ctx context.Context, logger *slog.Logger, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, contextKey{}, &scope{logger: logger, attrs: attrs})
+}
+
+// AddAttrs adds attributes to the request scope in ctx, replacing any with
+// the same key. It is a no-op outside NewContext.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+next:
+	for _, a := range attrs {
+		for i := range s.attrs {
+			if s.attrs[i].Key == a.Key {
+				s.attrs[i] = a
+				continue next
+			}
+		}
+		s.attrs = append(s.attrs, a)
+	}
+}
+
+// Attrs returns the request-scoped attributes in ctx.
+func Attrs(ctx context.Context) []slog.Attr {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]slog.Attr(nil), s.attrs...)
+}
+
+// FromContext returns the request's logger with its scoped attributes
+// attached, or slog.Default() outside a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return slog.Default()
+	}
+	attrs := Attrs(ctx)
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
+	// The scope's handler would add them again from ctx; bind them to a
+	// handler that doesn't.
+	return slog.New(unwrap(s.logger.Handler())).With(args...)
+}
+
+// contextHandler adds the request-scoped attributes of the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := Attrs(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func unwrap(h slog.Handler) slog.Handler {
+	if c, ok := h.(contextHandler); ok {
+		return c.Handler
+	}
+	return h
+}
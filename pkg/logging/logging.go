@@ -0,0 +1,132 @@
+// Package logging builds the process-wide slog.Logger from configuration
+// (level, json or text format, stdout, stderr or a rotated file), lets the
+// level change at runtime, and carries request-scoped attributes such as the
+// request ID, user and tenant in the context so every log line written for a
+// request includes them.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Formats and outputs understood by New.
+const (
+	FormatJSON   = "json"
+	FormatText   = "text"
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// Config selects the logger's level, format and destination.
+type Config struct {
+	// Level is debug, info, warn or error; empty means info.
+	Level string
+	// Format is json (the default) or text.
+	Format string
+	// Output is stdout (the default), stderr or a file path.
+	Output string
+	// MaxSizeMB rotates a file output once it reaches this size; zero means
+	// DefaultMaxSizeMB. Ignored for stdout and stderr.
+	MaxSizeMB int
+	// MaxBackups is how many rotated files to keep; zero means
+	// DefaultMaxBackups.
+	MaxBackups int
+}
+
+// Logger is the process logger plus the handles needed to change its level
+// and release its output.
+type Logger struct {
+	*slog.Logger
+	// Level is the logger's minimum level; setting it takes effect at once.
+	Level *slog.LevelVar
+
+	closer io.Closer
+}
+
+// New returns a Logger configured by cfg. Its handler adds the request-scoped
+// attributes carried in the context (see NewContext) to every record logged
+// with a context.
+func New(cfg Config) (*Logger, error) {
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, err
+	}
+	level := new(slog.LevelVar)
+	SetLevel(level, cfg.Level)
+
+	var w io.Writer
+	var closer io.Closer
+	switch cfg.Output {
+	case "", OutputStdout:
+		w = os.Stdout
+	case OutputStderr:
+		w = os.Stderr
+	default:
+		f, err := OpenRotating(cfg.Output, cfg.MaxSizeMB, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = f, f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewJSONHandler(w, opts)
+	if strings.EqualFold(cfg.Format, FormatText) {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return &Logger{Logger: slog.New(contextHandler{h}), Level: level, closer: closer}, nil
+}
+
+// Close releases a file output. It is a no-op for stdout and stderr.
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// ParseLevel parses debug, info, warn or error, case-insensitively. An empty
+// string is info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+}
+
+// SetLevel parses s and stores it in v.
+func SetLevel(v *slog.LevelVar, s string) error {
+	level, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	v.Set(level)
+	return nil
+}
+
+// ValidateConfig reports the first invalid field of cfg, so configuration
+// loaders can reject bad settings before anything is opened.
+func ValidateConfig(cfg Config) error {
+	if _, err := ParseLevel(cfg.Level); err != nil {
+		return err
+	}
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatJSON, FormatText:
+	default:
+		return fmt.Errorf("unknown log format %q (want %s or %s)", cfg.Format, FormatJSON, FormatText)
+	}
+	if cfg.MaxSizeMB < 0 || cfg.MaxBackups < 0 {
+		return fmt.Errorf("log rotation limits must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewValidatesConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Level: "verbose"},
+		{Format: "xml"},
+		{MaxBackups: -1},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) accepted", cfg)
+		}
+	}
+}
+
+func TestNewWritesToRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "svc.log")
+	l, err := New(Config{Level: "warn", Format: "text", Output: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	l.Info("dropped")
+	l.Warn("kept", "k", "v")
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); strings.Contains(got, "dropped") || !strings.Contains(got, "msg=kept k=v") {
+		t.Errorf("log file = %q", got)
+	}
+}
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotating(path, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.maxSize = 10 // bytes, to rotate quickly
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		if got, _ := os.ReadFile(name); string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("kept more backups than configured")
+	}
+}
+
+func TestContextAttrsReachEveryLine(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(contextHandler{slog.NewJSONHandler(&buf, nil)})
+	ctx := NewContext(context.Background(), logger, slog.String("request_id", "r1"))
+	AddAttrs(ctx, slog.String("user", "u1"), slog.String("tenant", "t1"))
+	AddAttrs(ctx, slog.String("user", "u2"))
+
+	logger.InfoContext(ctx, "via handler")
+	FromContext(ctx).InfoContext(ctx, "via FromContext")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	for _, line := range lines {
+		var rec map[string]any
+		json.Unmarshal([]byte(line), &rec)
+		if rec["request_id"] != "r1" || rec["user"] != "u2" || rec["tenant"] != "t1" {
+			t.Errorf("record %s lacks the request scope", line)
+		}
+		if strings.Count(line, `"request_id"`) != 1 {
+			t.Errorf("record %s repeats the request scope", line)
+		}
+	}
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("FromContext outside a request is not the default logger")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	level := new(slog.LevelVar)
+	h := LevelHandler(level)
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body)))
+		return rec
+	}
+	if rec := do(http.MethodGet, ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"level":"info"`) {
+		t.Errorf("GET = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPut, `{"level":"DEBUG"}`); rec.Code != http.StatusOK || level.Level() != slog.LevelDebug {
+		t.Errorf("PUT debug = %d %s, level %v", rec.Code, rec.Body, level.Level())
+	}
+	for _, body := range []string{`{"level":"loud"}`, `{}`, `not json`} {
+		if rec := do(http.MethodPut, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d", body, rec.Code)
+		}
+	}
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE = %d", rec.Code)
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("rejected requests changed the level to %v", level.Level())
+	}
+}
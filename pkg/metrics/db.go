@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBStats returns a Metric reporting db's connection pool from sql.DBStats on
+// every scrape: open, in-use and idle connections, the configured maximum,
+// and how often callers waited for a connection.
+func DBStats(db *sql.DB) Metric {
+	return dbStats{db: db}
+}
+
+type dbStats struct {
+	db *sql.DB
+}
+
+func (dbStats) Name() string { return "db_pool" }
+
+func (d dbStats) Collect(context.Context) ([]Family, error) {
+	s := d.db.Stats()
+	gauge := func(name, help string, v float64) Family {
+		return Family{Name: name, Help: help, Type: TypeGauge, Samples: []Sample{{Value: v}}}
+	}
+	counter := func(name, help string, v float64) Family {
+		return Family{Name: name, Help: help, Type: TypeCounter, Samples: []Sample{{Value: v}}}
+	}
+	return []Family{
+		gauge("db_pool_max_open_connections", "Maximum number of open connections to the database.", float64(s.MaxOpenConnections)),
+		gauge("db_pool_open_connections", "Established connections, both in use and idle.", float64(s.OpenConnections)),
+		gauge("db_pool_in_use_connections", "Connections currently in use.", float64(s.InUse)),
+		gauge("db_pool_idle_connections", "Idle connections.", float64(s.Idle)),
+		counter("db_pool_wait_count_total", "Connections waited for.", float64(s.WaitCount)),
+		counter("db_pool_wait_duration_seconds_total", "Time spent waiting for connections.", s.WaitDuration.Seconds()),
+		counter("db_pool_max_idle_closed_total", "Connections closed due to the idle limit.", float64(s.MaxIdleClosed)),
+		counter("db_pool_max_lifetime_closed_total", "Connections closed due to the lifetime limit.", float64(s.MaxLifetimeClosed)),
+	}, nil
+}
@@ -1,19 +1,24 @@
-// Package metrics provides a tiny, dependency-free request metrics collector
-// and a Prometheus text-exposition handler. It uses only the Go standard
-// library: counters are guarded by a mutex and rendered on demand.
+// Package metrics provides a tiny, dependency-free request metrics collector,
+// a small registry of counters, gauges and histograms, and a Prometheus
+// text-exposition handler. Values are guarded by mutexes and rendered on
+// demand; gauges backed by a database are computed at scrape time.
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
-// Collector records HTTP request metrics and exposes them in Prometheus text
-// exposition format. The zero value is not ready for use; call NewCollector.
+// Collector records HTTP request metrics and exposes them, together with
+// everything in its Registry, in Prometheus text exposition format. The zero
+// value is not ready for use; call NewCollector.
 type Collector struct {
 	mu            sync.Mutex
 	total         int64
@@ -21,11 +26,79 @@ type Collector struct {
 	inFlight      int64
 	durationSum   float64
 	durationCount int64
+
+	requests *Counter
+	latency  *Histogram
+	registry *Registry
+}
+
+// CollectorConfig configures NewCollectorWith.
+type CollectorConfig struct {
+	// Buckets are the upper bounds, in seconds, of the per-route latency
+	// histogram. Nil means DefaultBuckets.
+	Buckets []float64
 }
 
-// NewCollector returns a ready-to-use Collector.
+// NewCollector returns a ready-to-use Collector with DefaultBuckets.
 func NewCollector() *Collector {
-	return &Collector{byStatus: make(map[int]int64)}
+	return NewCollectorWith(CollectorConfig{})
+}
+
+// NewCollectorWith returns a Collector configured by cfg.
+func NewCollectorWith(cfg CollectorConfig) *Collector {
+	return &Collector{
+		byStatus: make(map[int]int64),
+		requests: NewCounter("http_server_requests_total",
+			"HTTP requests by method, route template and status.", "method", "route", "status"),
+		latency: NewHistogram("http_server_request_duration_seconds",
+			"HTTP request latency by method and route template.", cfg.Buckets, "method", "route"),
+		registry: NewRegistry(),
+	}
+}
+
+// Registry returns the registry rendered by Handler after the HTTP metrics,
+// where callers add DB pool, publish and business metrics.
+func (c *Collector) Registry() *Registry {
+	return c.registry
+}
+
+// UnmatchedRoute labels requests that reached Instrument without a mux route.
+const UnmatchedRoute = "unmatched"
+
+type routeKey struct{}
+
+// SetRoute overrides the route label of the request carrying ctx, for
+// handlers that serve many paths under one mux route, like a proxy naming
+// requests after its upstream route. It is a no-op outside Instrument.
+func SetRoute(ctx context.Context, route string) {
+	if p, ok := ctx.Value(routeKey{}).(*string); ok {
+		*p = route
+	}
+}
+
+// routeLabel is the route label for r: an override set with SetRoute, the
+// matched mux route template, or UnmatchedRoute.
+func routeLabel(r *http.Request, override string) string {
+	if override != "" {
+		return override
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return UnmatchedRoute
+}
+
+// methodLabel keeps the method label bounded: anything outside the standard
+// methods is reported as OTHER.
+func methodLabel(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return "OTHER"
 }
 
 // statusRecorder captures the response status code for the duration metric.
@@ -51,18 +124,24 @@ func (rec *statusRecorder) Write(b []byte) (int, error) {
 }
 
 // Instrument wraps next so each request increments the total and per-status
-// counters, tracks the in-flight gauge and accumulates request duration.
+// counters, tracks the in-flight gauge and accumulates request duration, both
+// globally and per method and route template.
 func (c *Collector) Instrument(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.mu.Lock()
 		c.inFlight++
 		c.mu.Unlock()
 
+		var override string
 		start := time.Now()
 		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
-		next.ServeHTTP(rec, r)
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routeKey{}, &override)))
 		elapsed := time.Since(start).Seconds()
 
+		method, route := methodLabel(r.Method), routeLabel(r, override)
+		c.requests.Inc(method, route, strconv.Itoa(rec.status))
+		c.latency.Observe(elapsed, method, route)
+
 		c.mu.Lock()
 		c.inFlight--
 		c.total++
@@ -73,8 +152,8 @@ func (c *Collector) Instrument(next http.Handler) http.Handler {
 	})
 }
 
-// Handler returns an http.Handler that writes the collected metrics in
-// Prometheus text exposition format.
+// Handler returns an http.Handler that writes the collected metrics, followed
+// by the registry's, in Prometheus text exposition format.
 func (c *Collector) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.mu.Lock()
@@ -91,7 +170,7 @@ func (c *Collector) Handler() http.Handler {
 		c.mu.Unlock()
 		sort.Ints(statuses)
 
-		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Content-Type", contentType)
 		w.WriteHeader(http.StatusOK)
 
 		fmt.Fprintln(w, "# HELP http_requests_total Total number of HTTP requests handled.")
@@ -109,5 +188,10 @@ func (c *Collector) Handler() http.Handler {
 		fmt.Fprintln(w, "# TYPE http_request_duration_seconds summary")
 		fmt.Fprintf(w, "http_request_duration_seconds_sum %g\n", durationSum)
 		fmt.Fprintf(w, "http_request_duration_seconds_count %d\n", durationCount)
+
+		requests, _ := c.requests.Collect(r.Context())
+		latency, _ := c.latency.Collect(r.Context())
+		registered, _ := c.registry.Collect(r.Context())
+		WriteText(w, append(append(requests, latency...), registered...))
 	})
 }
@@ -1,10 +1,15 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
 func TestInstrumentAndHandler(t *testing.T) {
@@ -41,3 +46,83 @@ func TestInstrumentAndHandler(t *testing.T) {
 		}
 	}
 }
+
+func scrape(t *testing.T, h http.Handler) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestInstrumentLabelsByRouteTemplate(t *testing.T) {
+	c := NewCollectorWith(CollectorConfig{Buckets: []float64{0.1, 1}})
+	router := mux.NewRouter()
+	router.Use(c.Instrument)
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), "/api/v1/inventory")
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	for _, path := range []string{"/items/1", "/items/2", "/api/v1/inventory/9"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	body := scrape(t, c.Handler())
+	for _, want := range []string{
+		"# TYPE http_server_request_duration_seconds histogram",
+		`http_server_request_duration_seconds_bucket{method="GET",route="/items/{id}",le="0.1"} 2`,
+		`http_server_request_duration_seconds_bucket{method="GET",route="/items/{id}",le="+Inf"} 2`,
+		`http_server_request_duration_seconds_count{method="GET",route="/items/{id}"} 2`,
+		`http_server_requests_total{method="GET",route="/api/v1/inventory",status="502"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q\n---\n%s", want, body)
+		}
+	}
+}
+
+func TestRegistryRendersMetricsAndSkipsFailures(t *testing.T) {
+	c := NewCollector()
+	stock := NewGaugeFunc("inventory_stock_units", "Units in stock.", []string{"location"},
+		func(ctx context.Context, set func(float64, ...string)) error {
+			set(12, `Dock "A"`)
+			return nil
+		})
+	broken := NewGaugeFunc("shipments", "Shipments by status.", []string{"status"},
+		func(context.Context, func(float64, ...string)) error { return errors.New("db down") })
+	pub := NewPublishes(nil)
+	pub.Observe("supply.chain.inventory.alert", time.Now(), nil)
+	pub.Observe("supply.chain.inventory.alert", time.Now(), errors.New("no responders"))
+	c.Registry().Register(stock, broken, pub)
+
+	body := scrape(t, c.Handler())
+	for _, want := range []string{
+		`inventory_stock_units{location="Dock \"A\""} 12`,
+		`nats_publish_total{subject="supply.chain.inventory.alert"} 2`,
+		`events_publish_failures_total{subject="supply.chain.inventory.alert"} 1`,
+		`nats_publish_duration_seconds_count{subject="supply.chain.inventory.alert"} 2`,
+		`metrics_collect_errors_total{metric="shipments"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q\n---\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "# TYPE shipments") {
+		t.Error("failed metric was rendered")
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	got, err := ParseBuckets(" 0.05, 0.5 ,5")
+	if err != nil || len(got) != 3 || got[2] != 5 {
+		t.Fatalf("ParseBuckets = %v, %v", got, err)
+	}
+	if got, err := ParseBuckets(""); err != nil || got != nil {
+		t.Errorf("empty = %v, %v; want nil for the defaults", got, err)
+	}
+	for _, bad := range []string{"0.1,abc", "1,0.5", "1,1", "Inf"} {
+		if _, err := ParseBuckets(bad); err == nil {
+			t.Errorf("ParseBuckets(%q) accepted", bad)
+		}
+	}
+}
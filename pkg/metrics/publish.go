@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"time"
+)
+
+// Publishes records event publishes per subject: attempts, latency and
+// failures. Failures are reported as events_publish_failures_total so alerts
+// can fire on lost events regardless of the transport.
+type Publishes struct {
+	total    *Counter
+	failures *Counter
+	duration *Histogram
+}
+
+// NewPublishes returns publish metrics using buckets for the latency
+// histogram (DefaultBuckets when nil).
+func NewPublishes(buckets []float64) *Publishes {
+	return &Publishes{
+		total:    NewCounter("nats_publish_total", "Events published to NATS.", "subject"),
+		failures: NewCounter("events_publish_failures_total", "Events that could not be published.", "subject"),
+		duration: NewHistogram("nats_publish_duration_seconds", "Time to publish an event and receive the JetStream ack.", buckets, "subject"),
+	}
+}
+
+// Observe records one publish to subject that started at start and failed
+// when err is non-nil. A nil Publishes records nothing.
+func (p *Publishes) Observe(subject string, start time.Time, err error) {
+	if p == nil {
+		return
+	}
+	p.total.Inc(subject)
+	p.duration.Observe(time.Since(start).Seconds(), subject)
+	// Keep a zero series per subject so rate() works before the first failure.
+	var failed float64
+	if err != nil {
+		failed = 1
+	}
+	p.failures.Add(failed, subject)
+}
+
+// Name returns the name reported when collection fails.
+func (*Publishes) Name() string { return "publishes" }
+
+// Collect implements Metric.
+func (p *Publishes) Collect(ctx context.Context) ([]Family, error) {
+	var fams []Family
+	for _, m := range []Metric{p.total, p.failures, p.duration} {
+		f, _ := m.Collect(ctx)
+		fams = append(fams, f...)
+	}
+	return fams, nil
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types as written on a family's # TYPE line.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+)
+
+// Label is one name="value" pair on a sample.
+type Label struct {
+	Name, Value string
+}
+
+// Sample is a single exposition line. Suffix is appended to the family name,
+// so histogram samples use "_bucket", "_sum" and "_count".
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named group of samples sharing one HELP and TYPE line.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Metric is anything that contributes families to a Registry. Collect runs on
+// every scrape with the scrape request's context, so implementations that
+// query a database should respect its deadline. A Metric that fails is left
+// out of that scrape and counted in metrics_collect_errors_total.
+type Metric interface {
+	Collect(ctx context.Context) ([]Family, error)
+}
+
+// Registry is an ordered set of metrics rendered together. The zero value is
+// not ready for use; call NewRegistry.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []Metric
+	errors  *Counter
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		errors: NewCounter("metrics_collect_errors_total",
+			"Scrapes in which a registered metric failed to collect.", "metric"),
+	}
+}
+
+// Register adds metrics to the registry. Families are rendered sorted by
+// name, so registration order does not matter.
+func (r *Registry) Register(ms ...Metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, ms...)
+	r.mu.Unlock()
+}
+
+// Collect gathers every registered metric, so a Registry is itself a Metric
+// and can be nested in another one.
+func (r *Registry) Collect(ctx context.Context) ([]Family, error) {
+	r.mu.Lock()
+	ms := append([]Metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	var fams []Family
+	for _, m := range ms {
+		got, err := m.Collect(ctx)
+		if err != nil {
+			r.errors.Inc(metricName(m))
+			continue
+		}
+		fams = append(fams, got...)
+	}
+	own, _ := r.errors.Collect(ctx)
+	fams = append(fams, own...)
+	sort.SliceStable(fams, func(i, j int) bool { return fams[i].Name < fams[j].Name })
+	return fams, nil
+}
+
+// Handler returns an http.Handler that writes the registry in Prometheus text
+// exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fams, _ := r.Collect(req.Context())
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		WriteText(w, fams)
+	})
+}
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteText writes families in Prometheus text exposition format. Families
+// without samples are skipped.
+func WriteText(w io.Writer, fams []Family) error {
+	for _, f := range fams {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		if f.Help != "" {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n", f.Name, escapeHelp(f.Help)); err != nil {
+				return err
+			}
+		}
+		if f.Type != "" {
+			if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type); err != nil {
+				return err
+			}
+		}
+		for _, s := range f.Samples {
+			if _, err := fmt.Fprintf(w, "%s%s%s %s\n", f.Name, s.Suffix, formatLabels(s.Labels), formatValue(s.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+// metricName labels a failing metric in metrics_collect_errors_total.
+func metricName(m Metric) string {
+	if n, ok := m.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", m)
+}
+
+// ParseBuckets parses a comma-separated list of histogram bucket upper bounds
+// such as "0.01,0.1,1". An empty string returns nil, meaning DefaultBuckets.
+func ParseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid bucket %q", part)
+		}
+		buckets = append(buckets, v)
+	}
+	if err := ValidateBuckets(buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// ValidateBuckets requires histogram upper bounds to be strictly increasing.
+func ValidateBuckets(buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("buckets must be strictly increasing, got %g after %g", buckets[i], buckets[i-1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency upper bounds in seconds, suitable for HTTP
+// requests and queries: 5ms to 10s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// series is one combination of label values.
+type series struct {
+	values []string
+	value  float64
+	counts []uint64 // per bucket, not cumulative; histograms only
+	sum    float64
+	count  uint64
+}
+
+// vec holds the series of one labelled family.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{name: name, help: help, labels: labels, series: make(map[string]*series)}
+}
+
+// Name returns the family name.
+func (v *vec) Name() string { return v.name }
+
+// get returns the series for values, creating it; v.mu must be held. It
+// panics when the number of values doesn't match the label names, which is
+// a programming error like an out-of-range index.
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values; v.mu must be held.
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*series, len(keys))
+	for i, k := range keys {
+		out[i] = v.series[k]
+	}
+	return out
+}
+
+// labelPairs pairs names with values, appending extra.
+func labelPairs(names, values []string, extra ...Label) []Label {
+	out := make([]Label, 0, len(names)+len(extra))
+	for i, n := range names {
+		out = append(out, Label{Name: n, Value: values[i]})
+	}
+	return append(out, extra...)
+}
+
+// Counter is a monotonically increasing value per combination of labels.
+type Counter struct{ vec }
+
+// NewCounter returns a counter family with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newVec(name, help, labels)}
+}
+
+// Inc adds one to the series for labelValues.
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add adds v, which must not be negative, to the series for labelValues.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+	c.mu.Lock()
+	c.get(labelValues).value += v
+	c.mu.Unlock()
+}
+
+// Value returns the current value of the series for labelValues.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(labelValues).value
+}
+
+// Collect implements Metric.
+func (c *Counter) Collect(context.Context) ([]Family, error) {
+	return []Family{c.collectValues(TypeCounter)}, nil
+}
+
+func (v *vec) collectValues(typ string) Family {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	f := Family{Name: v.name, Help: v.help, Type: typ}
+	for _, s := range v.sorted() {
+		f.Samples = append(f.Samples, Sample{Labels: labelPairs(v.labels, s.values), Value: s.value})
+	}
+	return f
+}
+
+// Gauge is a value that can go up and down per combination of labels.
+type Gauge struct{ vec }
+
+// NewGauge returns a gauge family with the given label names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newVec(name, help, labels)}
+}
+
+// Set sets the series for labelValues to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value = v
+	g.mu.Unlock()
+}
+
+// Add adds v, which may be negative, to the series for labelValues.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value += v
+	g.mu.Unlock()
+}
+
+// Collect implements Metric.
+func (g *Gauge) Collect(context.Context) ([]Family, error) {
+	return []Family{g.collectValues(TypeGauge)}, nil
+}
+
+// Histogram counts observations into cumulative buckets per combination of
+// labels, rendered as _bucket, _sum and _count samples.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogram returns a histogram family with the given bucket upper bounds
+// (DefaultBuckets when nil) and label names. It panics if the buckets are not
+// strictly increasing; use ValidateBuckets or ParseBuckets on user input first.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	if err := ValidateBuckets(buckets); err != nil {
+		panic("metrics: " + name + ": " + err.Error())
+	}
+	return &Histogram{vec: newVec(name, help, labels), buckets: append([]float64(nil), buckets...)}
+}
+
+// Observe records v in the series for labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	i := sort.SearchFloat64s(h.buckets, v) // first bucket with bound >= v
+	h.mu.Lock()
+	s := h.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+	h.mu.Unlock()
+}
+
+// Collect implements Metric.
+func (h *Histogram) Collect(context.Context) ([]Family, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			f.Samples = append(f.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: labelPairs(h.labels, s.values, Label{Name: "le", Value: formatValue(bound)}),
+				Value:  float64(cumulative),
+			})
+		}
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: labelPairs(h.labels, s.values, Label{Name: "le", Value: formatValue(math.Inf(1))}), Value: float64(s.count)},
+			Sample{Suffix: "_sum", Labels: labelPairs(h.labels, s.values), Value: s.sum},
+			Sample{Suffix: "_count", Labels: labelPairs(h.labels, s.values), Value: float64(s.count)},
+		)
+	}
+	return []Family{f}, nil
+}
+
+// GaugeFunc is a gauge family computed on every scrape, for values that live
+// elsewhere, such as row counts in a database.
+type GaugeFunc struct {
+	name   string
+	help   string
+	labels []string
+	fn     func(ctx context.Context, set func(v float64, labelValues ...string)) error
+}
+
+// NewGaugeFunc returns a gauge family whose series are produced by fn, which
+// calls set once per series. If fn returns an error the family is left out of
+// that scrape.
+func NewGaugeFunc(name, help string, labels []string, fn func(ctx context.Context, set func(v float64, labelValues ...string)) error) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, labels: labels, fn: fn}
+}
+
+// Name returns the family name.
+func (g *GaugeFunc) Name() string { return g.name }
+
+// Collect implements Metric.
+func (g *GaugeFunc) Collect(ctx context.Context) ([]Family, error) {
+	f := Family{Name: g.name, Help: g.help, Type: TypeGauge}
+	err := g.fn(ctx, func(v float64, labelValues ...string) {
+		if len(labelValues) != len(g.labels) {
+			panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", g.name, len(g.labels), len(labelValues)))
+		}
+		f.Samples = append(f.Samples, Sample{Labels: labelPairs(g.labels, labelValues), Value: v})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []Family{f}, nil
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Usage summarises the arguments Command accepts.
+const Usage = "migrate up | down [n] | status"
+
+// Command runs the migrate subcommand of a binary: "up" applies the pending
+// migrations, "down [n]" reverts the last n (default 1) and "status" lists
+// them. Progress is written to w.
+func Command(ctx context.Context, m *Migrator, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", Usage)
+	}
+	switch cmd, rest := args[0], args[1:]; {
+	case cmd == "up" && len(rest) == 0:
+		done, err := m.Up(ctx)
+		report(w, "applied", done)
+		if err == nil && len(done) == 0 {
+			fmt.Fprintf(w, "%s: already up to date\n", m.component)
+		}
+		return err
+	case cmd == "down" && len(rest) <= 1:
+		steps := 1
+		if len(rest) == 1 {
+			n, err := strconv.Atoi(rest[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down: %q is not a positive number of steps", rest[0])
+			}
+			steps = n
+		}
+		done, err := m.Down(ctx, steps)
+		report(w, "reverted", done)
+		return err
+	case cmd == "status" && len(rest) == 0:
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("usage: %s", Usage)
+}
+
+func report(w io.Writer, verb string, done []Migration) {
+	for _, mig := range done {
+		fmt.Fprintf(w, "%s %04d_%s\n", verb, mig.Version, mig.Name)
+	}
+}
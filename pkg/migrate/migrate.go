@@ -0,0 +1,303 @@
+// Package migrate applies versioned SQL migrations embedded in each binary.
+//
+// Migrations are pairs of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, e.g. 0002_add_carrier_phone.up.sql. Versions are
+// positive integers applied in ascending order. Every component (inventory,
+// shipment, gateway) has its own sequence; all of them record what has been
+// applied in the shared schema_migrations table, keyed by component and
+// version. A Postgres advisory lock serialises migrators, so replicas starting
+// together apply each migration once, and each migration runs in one
+// transaction with its bookkeeping row.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Table records the applied migrations of every component.
+const Table = "schema_migrations"
+
+// lockKey is the advisory lock held while migrating, derived from Table so
+// it doesn't collide with other users of advisory locks.
+var lockKey = func() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(Table))
+	return int64(h.Sum64())
+}()
+
+// ErrPending is returned by Check when migrations haven't been applied.
+var ErrPending = errors.New("database schema is not up to date")
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied, and when.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Parse reads the migrations in the root of fsys, failing on malformed names,
+// duplicate versions and ups without downs (or the reverse).
+func Parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		base, direction, ok := cutDirection(strings.TrimSuffix(name, ".sql"))
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: name must end in .up.sql or .down.sql", name))
+			continue
+		}
+		num, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 || label == "" {
+			errs = append(errs, fmt.Errorf("%s: name must be <version>_<name>", name))
+			continue
+		}
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			errs = append(errs, fmt.Errorf("%s: version %d is already %s", name, version, m.Name))
+			continue
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		switch {
+		case strings.TrimSpace(m.Up) == "":
+			errs = append(errs, fmt.Errorf("migration %04d_%s: missing or empty up file", m.Version, m.Name))
+		case strings.TrimSpace(m.Down) == "":
+			errs = append(errs, fmt.Errorf("migration %04d_%s: missing or empty down file", m.Version, m.Name))
+		}
+		out = append(out, *m)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func cutDirection(s string) (base, direction string, ok bool) {
+	for _, d := range []string{"up", "down"} {
+		if b, found := strings.CutSuffix(s, "."+d); found {
+			return b, d, true
+		}
+	}
+	return "", "", false
+}
+
+// Migrator applies one component's migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	component  string
+	migrations []Migration
+}
+
+// New returns a Migrator for component's migrations in fsys.
+func New(db *sql.DB, component string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Parse(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("%s migrations: %w", component, err)
+	}
+	return &Migrator{db: db, component: component, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in version order and returns those it
+// applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the steps most recently applied migrations and returns those
+// it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		versions := make([]int, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+		for _, v := range versions {
+			mig, ok := m.find(v)
+			if !ok {
+				return fmt.Errorf("%s migration %d is applied but unknown to this binary", m.component, v)
+			}
+			if err := m.apply(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var out []Status
+	err := m.locked(ctx, func(_ *sql.Conn, applied map[int]time.Time) error {
+		for _, mig := range m.migrations {
+			at, ok := applied[mig.Version]
+			out = append(out, Status{Migration: mig, Applied: ok, AppliedAt: at})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Check returns ErrPending, naming the first pending migration, unless the
+// schema is up to date.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			return fmt.Errorf("%w: %s migration %04d_%s is pending", ErrPending, m.component, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// Ensure prepares the schema at startup: it applies pending migrations when
+// apply is set, and otherwise only checks that there are none.
+func (m *Migrator) Ensure(ctx context.Context, apply bool) error {
+	if !apply {
+		return m.Check(ctx)
+	}
+	_, err := m.Up(ctx)
+	return err
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// locked runs fn on a connection holding the migration lock, passing the
+// component's applied versions.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn, map[int]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("migrate: acquire lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+Table+` (
+	component  text        NOT NULL,
+	version    bigint      NOT NULL,
+	name       text        NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (component, version)
+)`); err != nil {
+		return fmt.Errorf("migrate: create %s: %w", Table, err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM "+Table+" WHERE component = $1", m.component)
+	if err != nil {
+		return fmt.Errorf("migrate: read %s: %w", Table, err)
+	}
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			rows.Close()
+			return fmt.Errorf("migrate: read %s: %w", Table, err)
+		}
+		applied[v] = at
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("migrate: read %s: %w", Table, err)
+	}
+	return fn(conn, applied)
+}
+
+// apply runs one migration up or down together with its bookkeeping.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	body, record := mig.Down, "DELETE FROM "+Table+" WHERE component = $1 AND version = $2"
+	args := []interface{}{m.component, mig.Version}
+	if up {
+		body, record = mig.Up, "INSERT INTO "+Table+" (component, version, name) VALUES ($1, $2, $3)"
+		args = append(args, mig.Name)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%s migration %04d_%s: %w", m.component, mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%s migration %04d_%s: record: %w", m.component, mig.Version, mig.Name, err)
+	}
+	return tx.Commit()
+}
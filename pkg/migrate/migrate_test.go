@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func file(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+func TestParseOrdersByVersion(t *testing.T) {
+	migrations, err := Parse(fstest.MapFS{
+		"0010_add_index.up.sql":       file("CREATE INDEX i ON t (c);"),
+		"0010_add_index.down.sql":     file("DROP INDEX i;"),
+		"0002_create_table.up.sql":    file("CREATE TABLE t (c text);"),
+		"0002_create_table.down.sql":  file("DROP TABLE t;"),
+		"README.md":                   file("ignored"),
+		"fixtures/0001_seed.up.sql":   file("ignored: not in the root"),
+		"fixtures/0001_seed.down.sql": file("ignored"),
+	})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	first, second := migrations[0], migrations[1]
+	if first.Version != 2 || first.Name != "create_table" || first.Down != "DROP TABLE t;" {
+		t.Errorf("first = %+v", first)
+	}
+	if second.Version != 10 || second.Name != "add_index" {
+		t.Errorf("second = %+v", second)
+	}
+}
+
+func TestParseReportsEveryProblem(t *testing.T) {
+	_, err := Parse(fstest.MapFS{
+		"0001_ok.up.sql":      file("SELECT 1;"),
+		"0001_ok.down.sql":    file("SELECT 1;"),
+		"0002_no_down.up.sql": file("SELECT 1;"),
+		"0003_empty.up.sql":   file("  \n"),
+		"0003_empty.down.sql": file("SELECT 1;"),
+		"0001_clash.up.sql":   file("SELECT 1;"),
+		"latest.up.sql":       file("SELECT 1;"),
+		"0004_sideways.sql":   file("SELECT 1;"),
+	})
+	if err == nil {
+		t.Fatal("Parse accepted invalid migrations")
+	}
+	for _, want := range []string{
+		"0002_no_down: missing or empty down file",
+		"0003_empty: missing or empty up file",
+		"version 1 is already",
+		"latest.up.sql: name must be <version>_<name>",
+		"0004_sideways.sql: name must end in .up.sql or .down.sql",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestCommandRejectsBadArguments(t *testing.T) {
+	m := &Migrator{component: "test"}
+	for _, args := range [][]string{nil, {"sideways"}, {"up", "2"}, {"down", "0"}, {"down", "x"}, {"status", "now"}} {
+		if err := Command(context.Background(), m, args, &strings.Builder{}); err == nil {
+			t.Errorf("Command(%q) accepted", args)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// APIKey is an admin-issued credential for machine-to-machine clients
+// (scanners, ERP connectors). Only a SHA-256 hash of the key is stored; the
+// plaintext is shown once at creation. Like users, a key whose role is
+// location-scoped only reaches its assigned Locations.
+type APIKey struct {
+	ID         string           `json:"id" gorm:"primaryKey"`
+	Name       string           `json:"name" gorm:"not null"`
+	Prefix     string           `json:"prefix" gorm:"not null"`
+	KeyHash    string           `json:"-" gorm:"uniqueIndex;not null"`
+	Role       string           `json:"role" gorm:"not null"`
+	TenantID   string           `json:"tenant_id,omitempty" gorm:"index"`
+	CreatedBy  string           `json:"created_by"`
+	ExpiresAt  *time.Time       `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time       `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time       `json:"revoked_at,omitempty"`
+	Locations  []APIKeyLocation `json:"locations,omitempty" gorm:"foreignKey:APIKeyID;constraint:OnDelete:CASCADE"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// APIKeyLocation assigns an API key to a location.
+type APIKeyLocation struct {
+	APIKeyID   string `json:"-" gorm:"primaryKey"`
+	LocationID string `json:"location_id" gorm:"primaryKey"`
+}
+
+// LocationIDs returns the key's assigned locations as plain IDs, nil when it
+// has none.
+func (k *APIKey) LocationIDs() []string {
+	if len(k.Locations) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(k.Locations))
+	for _, l := range k.Locations {
+		ids = append(ids, l.LocationID)
+	}
+	return ids
+}
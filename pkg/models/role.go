@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Role is a named set of permissions. The four built-in roles are global
+// (empty TenantID) and read-only; tenants may define additional custom roles.
+type Role struct {
+	ID          string           `json:"id" gorm:"primaryKey"`
+	TenantID    string           `json:"tenant_id,omitempty" gorm:"uniqueIndex:idx_roles_tenant_name"`
+	Name        string           `json:"name" gorm:"not null;uniqueIndex:idx_roles_tenant_name"`
+	Description string           `json:"description"`
+	Builtin     bool             `json:"builtin"`
+	Permissions []RolePermission `json:"-" gorm:"foreignKey:RoleID;constraint:OnDelete:CASCADE"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// RolePermission grants a single permission (e.g. "inventory:adjust") to a role.
+type RolePermission struct {
+	RoleID     string `json:"role_id" gorm:"primaryKey"`
+	Permission string `json:"permission" gorm:"primaryKey"`
+}
+
+// PermissionNames returns the role's permissions as plain strings.
+func (r *Role) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		names = append(names, p.Permission)
+	}
+	return names
+}
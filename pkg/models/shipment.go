@@ -6,18 +6,20 @@ import (
 
 // Shipment represents a shipment in the supply chain
 type Shipment struct {
-	ID               string     `json:"id" gorm:"primaryKey"`
-	OrderID          string     `json:"order_id" gorm:"index;not null"`
-	Status           string     `json:"status" gorm:"not null"` // pending, in_transit, delivered, cancelled
-	Origin           string     `json:"origin" gorm:"not null"`
-	Destination      string     `json:"destination" gorm:"not null"`
-	EstimatedArrival time.Time  `json:"estimated_arrival"`
-	ActualArrival    *time.Time `json:"actual_arrival,omitempty"`
-	CarrierID        string     `json:"carrier_id" gorm:"index"`
-	TrackingNumber   string     `json:"tracking_number"`
-	Notes            string     `json:"notes"`
-	CreatedAt        time.Time  `json:"created_at"`
-	UpdatedAt        time.Time  `json:"updated_at"`
+	ID                    string     `json:"id" gorm:"primaryKey"`
+	OrderID               string     `json:"order_id" gorm:"index;not null"`
+	Status                string     `json:"status" gorm:"not null"` // pending, in_transit, delivered, cancelled
+	Origin                string     `json:"origin" gorm:"not null"`
+	Destination           string     `json:"destination" gorm:"not null"`
+	OriginLocationID      string     `json:"origin_location_id,omitempty" gorm:"index"`      // Location ID, when the origin is one of ours
+	DestinationLocationID string     `json:"destination_location_id,omitempty" gorm:"index"` // Location ID, when the destination is one of ours
+	EstimatedArrival      time.Time  `json:"estimated_arrival"`
+	ActualArrival         *time.Time `json:"actual_arrival,omitempty"`
+	CarrierID             string     `json:"carrier_id" gorm:"index"`
+	TrackingNumber        string     `json:"tracking_number"`
+	Notes                 string     `json:"notes"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
 }
 
 // ShipmentEvent represents events in a shipment's lifecycle
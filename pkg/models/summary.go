@@ -0,0 +1,31 @@
+package models
+
+// InventorySummary is the inventory service's roll-up for the dashboard. The
+// counts cover every inventory record the caller may see; the lists are
+// short previews.
+type InventorySummary struct {
+	Items      int `json:"items"`
+	Products   int `json:"products"`
+	StockOuts  int `json:"stock_outs"` // quantity at or below zero
+	LowStock   int `json:"low_stock"`  // quantity at or below min_quantity
+	OpenAlerts int `json:"open_alerts"`
+
+	LowStockItems []Inventory     `json:"low_stock_items"`
+	ByCategory    []CategoryStock `json:"by_category"`
+}
+
+// CategoryStock is the total quantity held for one product category.
+type CategoryStock struct {
+	Category string `json:"category"`
+	Quantity int    `json:"quantity"`
+}
+
+// ShipmentSummary is the shipment service's roll-up for the dashboard.
+type ShipmentSummary struct {
+	Total      int            `json:"total"`
+	ByStatus   map[string]int `json:"by_status"`
+	Late       int            `json:"late"` // open and past the estimated arrival
+	OpenAlerts int            `json:"open_alerts"`
+
+	Recent []Shipment `json:"recent"`
+}
@@ -5,11 +5,77 @@ import "time"
 // User represents an application account used for authentication. The password
 // is never serialised (hash only, and even that is omitted from JSON).
 type User struct {
-	ID           string    `json:"id" gorm:"primaryKey"`
-	Username     string    `json:"username" gorm:"uniqueIndex;not null"`
-	Email        string    `json:"email" gorm:"uniqueIndex"`
-	PasswordHash string    `json:"-" gorm:"not null"`
-	Role         string    `json:"role" gorm:"not null"`
+	ID           string     `json:"id" gorm:"primaryKey"`
+	Username     string     `json:"username" gorm:"uniqueIndex;not null"`
+	Email        string     `json:"email" gorm:"uniqueIndex"`
+	PasswordHash string     `json:"-" gorm:"not null"`
+	Role         string     `json:"role" gorm:"not null"`
+	TenantID     string     `json:"tenant_id,omitempty" gorm:"index"`
+	Disabled     bool       `json:"disabled" gorm:"not null;default:false"`
+	FailedLogins int        `json:"failed_logins" gorm:"not null;default:0"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	// TOTPSecret holds the authenticator secret, set during enrollment and
+	// active once TOTPEnabled is true. TOTPLastStep is the last accepted time
+	// step, used to reject replayed codes.
+	TOTPSecret   string    `json:"-"`
+	TOTPEnabled  bool      `json:"totp_enabled" gorm:"not null;default:false"`
+	TOTPLastStep int64     `json:"-" gorm:"not null;default:0"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
+
+// UserLocation assigns a user to a location. Users with at least one
+// assignment may only read and change data at their assigned locations.
+type UserLocation struct {
+	UserID     string    `json:"user_id" gorm:"primaryKey"`
+	LocationID string    `json:"location_id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's issuer and subject. Provisioned is set
+// when the identity's first sign-in created the user; only then does the
+// provider own the user's role.
+type UserIdentity struct {
+	Issuer      string    `json:"issuer" gorm:"primaryKey"`
+	Subject     string    `json:"subject" gorm:"primaryKey"`
+	UserID      string    `json:"user_id" gorm:"index;not null"`
+	Email       string    `json:"email,omitempty"`
+	Provisioned bool      `json:"provisioned" gorm:"not null;default:false"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// LoginEvent is an audit record of a single login attempt, successful or not.
+// UserID is empty when the username did not match any account.
+type LoginEvent struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	UserID    string    `json:"user_id,omitempty" gorm:"index"`
+	Username  string    `json:"username" gorm:"index;not null"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"` // bad_password, bad_second_factor, unknown_user, locked, disabled
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// RecoveryCode is a single-use code that substitutes for a TOTP code when the
+// user has lost their authenticator. Only a SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        string     `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"user_id" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordResetToken is a single-use, time-limited token emailed to a user who
+// forgot their password. Only a SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        string     `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"user_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
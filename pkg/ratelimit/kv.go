@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultKVTTL is how long an idle bucket survives in the KV store. It must
+// exceed the longest refill window of any limit using the store; afterwards
+// the bucket would have been full anyway.
+const DefaultKVTTL = time.Hour
+
+// kvAttempts bounds the optimistic-concurrency retries of one Take.
+const kvAttempts = 8
+
+// ErrContention is returned when a key was updated concurrently too many
+// times in a row for Take to commit.
+var ErrContention = errors.New("ratelimit: too much contention on key")
+
+// kvBucket is the subset of nats.KeyValue the store uses.
+type kvBucket interface {
+	Get(key string) (nats.KeyValueEntry, error)
+	Create(key string, value []byte) (uint64, error)
+	Update(key string, value []byte, revision uint64) (uint64, error)
+}
+
+// KV is a Store shared by every process using the same JetStream key-value
+// bucket. Each Take is a read-modify-write guarded by the entry's revision,
+// retried on conflict, so replicas never double-spend a token. Idle buckets
+// expire through the KV bucket's TTL.
+type KV struct {
+	kv  kvBucket
+	now func() time.Time
+}
+
+// NewKV opens (creating if needed) the key-value bucket named bucket and
+// returns a store on it. ttl is applied only when the bucket is created; zero
+// means DefaultKVTTL.
+func NewKV(js nats.JetStreamContext, bucket string, ttl time.Duration) (*KV, error) {
+	if ttl <= 0 {
+		ttl = DefaultKVTTL
+	}
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Rate limiter token buckets",
+			TTL:         ttl,
+			History:     1,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: open key-value bucket %q: %w", bucket, err)
+	}
+	return &KV{kv: kv, now: time.Now}, nil
+}
+
+// Take implements Store.
+func (s *KV) Take(ctx context.Context, key string, limit Limit) (Decision, error) {
+	k := kvKey(key)
+	for attempt := 0; attempt < kvAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return Decision{}, err
+		}
+		var b bucket
+		var revision uint64
+		entry, err := s.kv.Get(k)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(entry.Value(), &b); err != nil {
+				b = bucket{} // unreadable state: treat as a new client
+			}
+			revision = entry.Revision()
+		case errors.Is(err, nats.ErrKeyNotFound), errors.Is(err, nats.ErrKeyDeleted):
+		default:
+			return Decision{}, err
+		}
+
+		d := limit.take(&b, s.now())
+		value, err := json.Marshal(b)
+		if err != nil {
+			return Decision{}, err
+		}
+		if revision == 0 {
+			_, err = s.kv.Create(k, value)
+		} else {
+			_, err = s.kv.Update(k, value, revision)
+		}
+		if err == nil {
+			return d, nil
+		}
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return Decision{}, err
+		}
+		// Another request got there first; re-read and try again.
+	}
+	return Decision{}, ErrContention
+}
+
+// kvKey maps an arbitrary limiter key onto the KV key alphabet.
+func kvKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory defaults.
+const (
+	DefaultMaxKeys    = 100000
+	defaultSweepEvery = time.Minute
+)
+
+// Memory is an in-process Store. Buckets that have refilled completely are
+// evicted, since a full bucket behaves exactly like a missing one, so the map
+// only holds clients seen within roughly one refill window. MaxKeys caps it
+// against floods of distinct keys: at capacity the least recently used bucket
+// makes room, in constant time.
+type Memory struct {
+	maxKeys    int
+	sweepEvery time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*list.Element // of *memoryBucket
+	recent    *list.List               // most recently used first
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	key    string
+	fullAt time.Time
+}
+
+// NewMemory returns an empty in-memory store holding at most maxKeys buckets
+// (zero means DefaultMaxKeys).
+func NewMemory(maxKeys int) *Memory {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &Memory{
+		maxKeys:    maxKeys,
+		sweepEvery: defaultSweepEvery,
+		now:        time.Now,
+		buckets:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// Take implements Store. It never fails.
+func (m *Memory) Take(_ context.Context, key string, limit Limit) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= m.sweepEvery {
+		m.sweep(now)
+	}
+	e, ok := m.buckets[key]
+	if ok {
+		m.recent.MoveToFront(e)
+	} else {
+		if len(m.buckets) >= m.maxKeys {
+			m.evictOne()
+		}
+		e = m.recent.PushFront(&memoryBucket{key: key})
+		m.buckets[key] = e
+	}
+	b := e.Value.(*memoryBucket)
+	d := limit.take(&b.bucket, now)
+	b.fullAt = limit.fullAt(b.bucket)
+	return d, nil
+}
+
+// Len returns the number of buckets held.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
+
+// sweep drops buckets that have refilled completely. It runs at most once per
+// sweepEvery, so its cost is spread over every Take in between.
+func (m *Memory) sweep(now time.Time) {
+	for key, e := range m.buckets {
+		if !e.Value.(*memoryBucket).fullAt.After(now) {
+			m.recent.Remove(e)
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// evictOne makes room when the store is full by dropping the least recently
+// used bucket. That resets the client's bucket, a small leniency preferred to
+// unbounded growth; the client idle longest is the likeliest to have refilled.
+func (m *Memory) evictOne() {
+	if e := m.recent.Back(); e != nil {
+		m.recent.Remove(e)
+		delete(m.buckets, e.Value.(*memoryBucket).key)
+	}
+}
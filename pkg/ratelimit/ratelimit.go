@@ -0,0 +1,97 @@
+// Package ratelimit implements token-bucket rate limiting over a pluggable
+// bucket store: Memory keeps buckets in the process (with eviction), KV keeps
+// them in a NATS JetStream key-value bucket so every replica shares one
+// limit. Both use the same bucket arithmetic.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token-bucket policy: Burst tokens of capacity, refilled
+// continuously at Rate tokens per second. Each request takes one token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// normalised clamps non-positive values to the smallest useful limit.
+func (l Limit) normalised() Limit {
+	if l.Rate <= 0 {
+		l.Rate = 1
+	}
+	if l.Burst <= 0 {
+		l.Burst = 1
+	}
+	return l
+}
+
+// Window is how long an empty bucket takes to refill completely.
+func (l Limit) Window() time.Duration {
+	l = l.normalised()
+	return seconds(float64(l.Burst) / l.Rate)
+}
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Allowed bool
+	// Limit is the bucket capacity and Remaining the whole tokens left after
+	// this request.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again; RetryAfter, for a
+	// refused request, how long until a token is available.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store holds buckets by key. Take must be atomic per key: concurrent callers
+// (in this process or, for shared stores, any replica) never spend the same
+// token twice.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+// bucket is the persisted state of one key.
+type bucket struct {
+	Tokens  float64 `json:"t"`
+	Updated int64   `json:"u"` // unix nanoseconds
+}
+
+// take refills b for the time since it was last updated, spends a token if
+// one is available and reports the outcome. A zero bucket is a new client,
+// which starts full.
+func (l Limit) take(b *bucket, now time.Time) Decision {
+	l = l.normalised()
+	burst := float64(l.Burst)
+	if b.Updated == 0 {
+		b.Tokens = burst
+	} else if elapsed := float64(now.UnixNano()-b.Updated) / float64(time.Second); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed*l.Rate)
+	}
+	b.Updated = now.UnixNano()
+
+	d := Decision{Limit: l.Burst}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.Tokens) / l.Rate)
+	}
+	d.Remaining = int(b.Tokens)
+	d.Reset = seconds((burst - b.Tokens) / l.Rate)
+	return d
+}
+
+// fullAt is when b, last updated under l, will have refilled completely and
+// so be indistinguishable from a new bucket.
+func (l Limit) fullAt(b bucket) time.Time {
+	l = l.normalised()
+	return time.Unix(0, b.Updated).Add(seconds((float64(l.Burst) - b.Tokens) / l.Rate))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestMemoryTakesTokensAndReportsState(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := NewMemory(0)
+	m.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i, want := range []int{1, 0} {
+		d, _ := m.Take(context.Background(), "a", limit)
+		if !d.Allowed || d.Remaining != want || d.Limit != 2 {
+			t.Fatalf("take %d = %+v, want allowed with %d remaining", i, d, want)
+		}
+	}
+	d, _ := m.Take(context.Background(), "a", limit)
+	if d.Allowed || d.RetryAfter != time.Second || d.Reset != 2*time.Second {
+		t.Fatalf("over limit = %+v, want refused, retry in 1s, full in 2s", d)
+	}
+	if d, _ := m.Take(context.Background(), "b", limit); !d.Allowed {
+		t.Error("other key shares the bucket")
+	}
+
+	now = now.Add(time.Second)
+	if d, _ := m.Take(context.Background(), "a", limit); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("after refill = %+v", d)
+	}
+}
+
+func TestMemoryEvictsRefilledAndExcessBuckets(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := NewMemory(3)
+	m.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 5}
+
+	for _, key := range []string{"a", "b", "c"} {
+		m.Take(context.Background(), key, limit)
+	}
+	// A fourth key at capacity evicts the least recently used active bucket
+	// rather than growing.
+	m.Take(context.Background(), "a", limit)
+	m.Take(context.Background(), "d", limit)
+	if m.Len() != 3 {
+		t.Fatalf("len = %d, want 3", m.Len())
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := m.buckets[key]; !ok {
+			t.Errorf("%s evicted, want b (least recently used)", key)
+		}
+	}
+
+	// Once every bucket has refilled, the periodic sweep drops them all.
+	now = now.Add(2 * time.Minute)
+	m.Take(context.Background(), "e", limit)
+	if m.Len() != 1 {
+		t.Errorf("len after sweep = %d, want 1", m.Len())
+	}
+}
+
+// fakeKV is an in-memory kvBucket with revision checks like JetStream's.
+type fakeKV struct {
+	mu       sync.Mutex
+	values   map[string]fakeEntry
+	revision uint64
+}
+
+type fakeEntry struct {
+	nats.KeyValueEntry
+	value    []byte
+	revision uint64
+}
+
+func (e fakeEntry) Value() []byte    { return e.value }
+func (e fakeEntry) Revision() uint64 { return e.revision }
+
+func (f *fakeKV) Get(key string) (nats.KeyValueEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.values[key]
+	if !ok {
+		return nil, nats.ErrKeyNotFound
+	}
+	return e, nil
+}
+
+func (f *fakeKV) Create(key string, value []byte) (uint64, error) {
+	return f.Update(key, value, 0)
+}
+
+func (f *fakeKV) Update(key string, value []byte, revision uint64) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.values[key].revision != revision {
+		return 0, nats.ErrKeyExists
+	}
+	f.revision++
+	f.values[key] = fakeEntry{value: value, revision: f.revision}
+	return f.revision, nil
+}
+
+func TestKVSharesBucketsWithoutDoubleSpending(t *testing.T) {
+	kv := &fakeKV{values: map[string]fakeEntry{}}
+	now := time.Unix(1000, 0)
+	// Two stores on one bucket stand in for two gateway replicas.
+	replicas := []*KV{{kv: kv, now: func() time.Time { return now }}, {kv: kv, now: func() time.Time { return now }}}
+	limit := Limit{Rate: 0.001, Burst: 10}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(s *KV) {
+			defer wg.Done()
+			for {
+				d, err := s.Take(context.Background(), "user:alice", limit)
+				if err == ErrContention {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if d.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+				return
+			}
+		}(replicas[i%2])
+	}
+	wg.Wait()
+	if allowed != 10 {
+		t.Errorf("allowed = %d across replicas, want the burst of 10", allowed)
+	}
+}
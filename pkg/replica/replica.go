@@ -0,0 +1,253 @@
+// Package replica routes read-only queries to PostgreSQL read replicas.
+//
+// A Set holds the primary and any replicas. Reader returns a healthy replica,
+// round robin, for queries that tolerate slightly stale data (lists, reports,
+// tracking); writes, and reads that must see them, keep using the primary. A
+// background checker pings every replica and, when MaxLag is set, compares
+// its replay lag, so a replica that is down or behind stops receiving reads
+// until it recovers. With no healthy replica, Reader returns the primary.
+//
+// A client that has just written can ask for read-your-writes with the
+// X-Read-Consistency: strong header (see Middleware); code can do the same
+// with WithPrimary.
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rahmanazhar/FoodSupplyChain/pkg/metrics"
+)
+
+// Header is the request header asking for reads from the primary.
+const Header = "X-Read-Consistency"
+
+// DefaultCheckInterval is how often replicas are checked when
+// Config.CheckInterval is zero.
+const DefaultCheckInterval = 10 * time.Second
+
+// Replica is one read replica.
+type Replica struct {
+	// Name identifies the replica in logs and metrics, e.g. its host.
+	Name string
+	DB   *gorm.DB
+}
+
+// Config tunes the health checks.
+type Config struct {
+	// CheckInterval is the time between health checks.
+	CheckInterval time.Duration
+	// MaxLag takes a replica out of rotation while its replay lag exceeds
+	// it; zero only checks that the replica answers.
+	MaxLag time.Duration
+	Logger *slog.Logger
+}
+
+type member struct {
+	Replica
+	healthy atomic.Bool
+}
+
+// Set routes reads over a primary and its replicas.
+type Set struct {
+	primary  *gorm.DB
+	replicas []*member
+	cfg      Config
+
+	next atomic.Uint64
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a Set over primary and replicas, checks the replicas once and
+// keeps checking them in the background until Close.
+func New(primary *gorm.DB, replicas []Replica, cfg Config) *Set {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = DefaultCheckInterval
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	s := &Set{primary: primary, cfg: cfg, stop: make(chan struct{})}
+	for _, r := range replicas {
+		s.replicas = append(s.replicas, &member{Replica: r})
+	}
+	if len(s.replicas) == 0 {
+		return s
+	}
+	s.checkAll()
+	s.wg.Add(1)
+	go s.loop()
+	return s
+}
+
+// Primary returns the primary for ctx.
+func (s *Set) Primary(ctx context.Context) *gorm.DB {
+	return s.primary.WithContext(ctx)
+}
+
+// Reader returns a healthy replica for ctx, or the primary when there is
+// none or ctx asks for read-your-writes.
+func (s *Set) Reader(ctx context.Context) *gorm.DB {
+	if len(s.replicas) == 0 || UsesPrimary(ctx) {
+		return s.primary.WithContext(ctx)
+	}
+	healthy := make([]*member, 0, len(s.replicas))
+	for _, m := range s.replicas {
+		if m.healthy.Load() {
+			healthy = append(healthy, m)
+		}
+	}
+	if len(healthy) == 0 {
+		return s.primary.WithContext(ctx)
+	}
+	return healthy[s.next.Add(1)%uint64(len(healthy))].DB.WithContext(ctx)
+}
+
+// Metric reports db_replica_healthy{replica} (1 or 0) for each replica.
+func (s *Set) Metric() metrics.Metric {
+	return metrics.NewGaugeFunc("db_replica_healthy", "Whether a read replica is receiving reads (1) or not (0).",
+		[]string{"replica"}, func(_ context.Context, set func(float64, ...string)) error {
+			for _, m := range s.replicas {
+				v := 0.0
+				if m.healthy.Load() {
+					v = 1
+				}
+				set(v, m.Name)
+			}
+			return nil
+		})
+}
+
+// Close stops the health checks and closes the replicas' connections; the
+// primary is left to its owner.
+func (s *Set) Close() error {
+	if len(s.replicas) == 0 {
+		return nil
+	}
+	close(s.stop)
+	s.wg.Wait()
+	var first error
+	for _, m := range s.replicas {
+		sqlDB, err := m.DB.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s *Set) loop() {
+	defer s.wg.Done()
+	t := time.NewTicker(s.cfg.CheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			s.checkAll()
+		}
+	}
+}
+
+func (s *Set) checkAll() {
+	for _, m := range s.replicas {
+		err := s.check(m)
+		if healthy := err == nil; m.healthy.Swap(healthy) != healthy {
+			if healthy {
+				s.cfg.Logger.Info("read replica healthy", "replica", m.Name)
+			} else {
+				s.cfg.Logger.Warn("read replica unhealthy; reads fall back", "replica", m.Name, "error", err)
+			}
+		}
+	}
+}
+
+// check pings m and, with MaxLag set, measures its replay lag.
+func (s *Set) check(m *member) error {
+	timeout := s.cfg.CheckInterval / 2
+	if timeout > 5*time.Second {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sqlDB, err := m.DB.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	if s.cfg.MaxLag <= 0 {
+		return nil
+	}
+	lag, err := replayLag(ctx, sqlDB)
+	if err != nil {
+		return err
+	}
+	if lag > s.cfg.MaxLag {
+		return &LagError{Lag: lag, Max: s.cfg.MaxLag}
+	}
+	return nil
+}
+
+// replayLag is the time since the last transaction the replica replayed;
+// it reads as zero when the replica has replayed everything it received.
+func replayLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := db.QueryRowContext(ctx, `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+END`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+// LagError reports a replica too far behind the primary.
+type LagError struct {
+	Lag, Max time.Duration
+}
+
+func (e *LagError) Error() string {
+	return fmt.Sprintf("replication lag %v exceeds %v", e.Lag.Round(time.Millisecond), e.Max)
+}
+
+type primaryKey struct{}
+
+// WithPrimary marks ctx so that Reader returns the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary reports whether ctx was marked by WithPrimary.
+func UsesPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// Middleware sends the reads of requests carrying X-Read-Consistency: strong
+// to the primary.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get(Header), "strong") {
+			r = r.WithContext(WithPrimary(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
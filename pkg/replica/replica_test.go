@@ -0,0 +1,84 @@
+package replica
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// open returns a handle to a port nothing listens on; it connects only when
+// used.
+func open(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "host=127.0.0.1 port=1 user=x dbname=x sslmode=disable connect_timeout=1"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestReaderRoundRobinsHealthyReplicas(t *testing.T) {
+	primary, a, b, c := open(t), open(t), open(t), open(t)
+	s := &Set{primary: primary}
+	for _, db := range []*gorm.DB{a, b, c} {
+		s.replicas = append(s.replicas, &member{Replica: Replica{DB: db}})
+	}
+	s.replicas[0].healthy.Store(true)
+	s.replicas[2].healthy.Store(true)
+
+	seen := map[gorm.ConnPool]int{}
+	for i := 0; i < 4; i++ {
+		seen[s.Reader(context.Background()).Statement.ConnPool]++
+	}
+	if seen[a.ConnPool] != 2 || seen[c.ConnPool] != 2 {
+		t.Errorf("reads spread %v; want two each on the healthy replicas", seen)
+	}
+
+	if got := s.Reader(WithPrimary(context.Background())); got.Statement.ConnPool != primary.ConnPool {
+		t.Error("WithPrimary read went to a replica")
+	}
+
+	s.replicas[0].healthy.Store(false)
+	s.replicas[2].healthy.Store(false)
+	if got := s.Reader(context.Background()); got.Statement.ConnPool != primary.ConnPool {
+		t.Error("with no healthy replica, Reader should fall back to the primary")
+	}
+}
+
+func TestNewTakesUnreachableReplicasOutOfRotation(t *testing.T) {
+	primary := open(t)
+	s := New(primary, []Replica{{Name: "down", DB: open(t)}}, Config{
+		CheckInterval: time.Hour,
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	defer s.Close()
+
+	if got := s.Reader(context.Background()); got.Statement.ConnPool != primary.ConnPool {
+		t.Error("read went to a replica that failed its first check")
+	}
+}
+
+func TestMiddlewareHonoursStrongConsistency(t *testing.T) {
+	var primary bool
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primary = UsesPrimary(r.Context())
+	}))
+	for value, want := range map[string]bool{"": false, "eventual": false, "strong": true, "Strong": true} {
+		r := httptest.NewRequest(http.MethodGet, "/shipments", nil)
+		if value != "" {
+			r.Header.Set(Header, value)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if primary != want {
+			t.Errorf("%s: %q -> primary %v, want %v", Header, value, primary, want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]any
+	// Error is the recorded failure, empty for a successful span.
+	Error string
+}
+
+// Exporter ships batches of finished spans somewhere. Export is only called
+// from the tracer's background goroutine.
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Exporter names accepted by NewExporter.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// NewExporter returns the exporter named kind: "otlp" posts to endpoint,
+// "stdout" writes JSON lines to w (normally os.Stdout), and "none" (or "")
+// returns nil, which keeps propagation without recording.
+func NewExporter(kind, endpoint string, w io.Writer) (Exporter, error) {
+	switch kind {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return NewStdoutExporter(w), nil
+	case ExporterOTLP:
+		exp, err := NewOTLPExporter(endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		return exp, nil
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q (want %s, %s or %s)", kind, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+}
+
+// StdoutExporter writes one JSON object per span, for local development.
+type StdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutExporter returns an exporter writing to w.
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	return &StdoutExporter{w: w}
+}
+
+type stdoutSpan struct {
+	Service    string         `json:"service"`
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	Start      time.Time      `json:"start"`
+	DurationMS float64        `json:"duration_ms"`
+	Attrs      map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Export implements Exporter.
+func (e *StdoutExporter) Export(_ context.Context, service string, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		out := stdoutSpan{
+			Service:    service,
+			TraceID:    s.TraceID.String(),
+			SpanID:     s.SpanID.String(),
+			Name:       s.Name,
+			Kind:       s.Kind.String(),
+			Start:      s.Start,
+			DurationMS: float64(s.End.Sub(s.Start).Microseconds()) / 1000.0,
+			Attrs:      s.Attrs,
+			Error:      s.Error,
+		}
+		if s.ParentID.IsValid() {
+			out.ParentID = s.ParentID.String()
+		}
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown implements Exporter.
+func (e *StdoutExporter) Shutdown(context.Context) error { return nil }
+
+// OTLPExporter posts spans to an OpenTelemetry collector using OTLP over
+// HTTP with the JSON encoding (POST <endpoint>/v1/traces).
+type OTLPExporter struct {
+	url    string
+	client *http.Client
+}
+
+// DefaultOTLPEndpoint is the collector's standard OTLP/HTTP address.
+const DefaultOTLPEndpoint = "http://localhost:4318"
+
+// NewOTLPExporter returns an exporter for the collector at endpoint (scheme,
+// host and port; the /v1/traces path is added). A nil client uses one with a
+// 10s timeout.
+func NewOTLPExporter(endpoint string, client *http.Client) (*OTLPExporter, error) {
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("tracing: OTLP endpoint %q must start with http:// or https://", endpoint)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &OTLPExporter{url: url, client: client}, nil
+}
+
+// The OTLP/JSON request body, trimmed to the fields this package produces.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            *otlpStatus    `json:"status,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+// otlpStatusError is STATUS_CODE_ERROR.
+const otlpStatusError = 2
+
+// Export implements Exporter.
+func (e *OTLPExporter) Export(ctx context.Context, service string, spans []SpanData) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/rahmanazhar/FoodSupplyChain/pkg/tracing"}}
+	for _, s := range spans {
+		out := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attrs),
+		}
+		if s.ParentID.IsValid() {
+			out.ParentSpanID = s.ParentID.String()
+		}
+		if s.Error != "" {
+			out.Status = &otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		scope.Spans = append(scope.Spans, out)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": service})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("tracing: export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("tracing: export spans: collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Shutdown implements Exporter.
+func (e *OTLPExporter) Shutdown(context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// otlpAttributes converts attributes to OTLP key/values, sorted by key for
+// stable output.
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		var v map[string]any
+		switch x := attrs[k].(type) {
+		case string:
+			v = map[string]any{"stringValue": x}
+		case bool:
+			v = map[string]any{"boolValue": x}
+		case int:
+			v = map[string]any{"intValue": strconv.Itoa(x)}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, otlpKeyValue{Key: k, Value: v})
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// gormSpanKey is where the plugin keeps a statement's span between its
+// before and after callbacks.
+const gormSpanKey = "tracing:span"
+
+// GORM returns a gorm plugin recording a client span around queries, named
+// after the operation and table ("SELECT inventory"). Only queries whose
+// context (db.WithContext) is part of a trace are recorded, so startup work
+// like migrations and seeding doesn't produce a trace per statement.
+// Register it with db.Use.
+func GORM(t *Tracer) gorm.Plugin {
+	return gormPlugin{tracer: t}
+}
+
+type gormPlugin struct {
+	tracer *Tracer
+}
+
+func (gormPlugin) Name() string { return "tracing" }
+
+func (p gormPlugin) Initialize(db *gorm.DB) error {
+	if p.tracer == nil {
+		return nil
+	}
+	cb := db.Callback()
+	for _, reg := range []struct {
+		op     string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"INSERT", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"SELECT", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"UPDATE", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"DELETE", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"ROW", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"RAW", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	} {
+		if err := reg.before("tracing:before_"+reg.op, p.before(reg.op)); err != nil {
+			return err
+		}
+		if err := reg.after("tracing:after_"+reg.op, p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p gormPlugin) before(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement == nil || db.Statement.Context == nil || !SpanContextFrom(db.Statement.Context).IsValid() {
+			return
+		}
+		name := op
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		_, span := p.tracer.Start(db.Statement.Context, name, KindClient)
+		span.SetAttr("db.system", db.Dialector.Name())
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func (gormPlugin) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, _ := v.(*Span)
+	if db.Statement.Table != "" {
+		span.SetAttr("db.sql.table", db.Statement.Table)
+	}
+	span.SetAttr("db.statement", db.Statement.SQL.String())
+	span.SetAttr("db.rows_affected", db.RowsAffected)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+	}
+	span.End()
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Middleware returns middleware that continues the caller's trace (from its
+// traceparent header) or starts a new one, and records a server span per
+// request named after the matched route, e.g. "GET /inventory/{id}". With a
+// nil tracer it does nothing.
+func Middleware(t *Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if t == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := Extract(r.Context(), r.Header)
+			ctx, span := t.Start(ctx, r.Method, KindServer)
+			defer span.End()
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					span.SetName(r.Method + " " + tmpl)
+					span.SetAttr("http.route", tmpl)
+				}
+			}
+			span.SetAttr("http.request.method", r.Method)
+			span.SetAttr("url.path", r.URL.Path)
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			span.SetAttr("http.response.status_code", rec.status)
+			if rec.status >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("status %d", rec.status))
+			}
+		})
+	}
+}
+
+// statusRecorder captures the response status for the span.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status = code
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush passes through so streaming responses keep working under tracing.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Transport wraps base (nil means http.DefaultTransport) so each outgoing
+// request gets a client span and carries it in its traceparent header. With
+// a nil tracer it returns base unchanged.
+func Transport(t *Tracer, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t == nil {
+		return base
+	}
+	return &transport{tracer: t, base: base}
+}
+
+type transport struct {
+	tracer *Tracer
+	base   http.RoundTripper
+}
+
+func (tr *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tr.tracer.Start(req.Context(), "HTTP "+req.Method, KindClient)
+	defer span.End()
+	span.SetAttr("http.request.method", req.Method)
+	span.SetAttr("server.address", req.URL.Host)
+	span.SetAttr("url.path", req.URL.Path)
+
+	out := req.Clone(ctx)
+	Inject(ctx, out.Header)
+	resp, err := tr.base.RoundTrip(out)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.RecordError(fmt.Errorf("status %d", resp.StatusCode))
+	}
+	return resp, nil
+}
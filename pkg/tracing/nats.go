@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Publish publishes data to subject through JetStream inside a producer span,
+// carrying the trace context in the message headers so consumers can
+// continue the trace (see Handler).
+func (t *Tracer) Publish(ctx context.Context, js nats.JetStreamContext, subject string, data []byte) (*nats.PubAck, error) {
+	ctx, span := t.Start(ctx, "publish "+subject, KindProducer)
+	defer span.End()
+	span.SetAttr("messaging.system", "nats")
+	span.SetAttr("messaging.destination.name", subject)
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	Inject(ctx, msg.Header)
+	ack, err := js.PublishMsg(msg, nats.Context(ctx))
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttr("messaging.nats.stream", ack.Stream)
+	span.SetAttr("messaging.nats.sequence", int64(ack.Sequence))
+	return ack, nil
+}
+
+// Handler adapts a context-aware message handler into a nats.MsgHandler that
+// restores the publisher's trace context from the message headers and runs h
+// inside a consumer span.
+func (t *Tracer) Handler(h func(ctx context.Context, msg *nats.Msg) error) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		ctx := context.Background()
+		if msg.Header != nil {
+			ctx = Extract(ctx, msg.Header)
+		}
+		ctx, span := t.Start(ctx, "process "+msg.Subject, KindConsumer)
+		defer span.End()
+		span.SetAttr("messaging.system", "nats")
+		span.SetAttr("messaging.destination.name", msg.Subject)
+		span.RecordError(h(ctx, msg))
+	}
+}
@@ -0,0 +1,549 @@
+// Package tracing is a small, dependency-free distributed tracer. It
+// propagates W3C Trace Context (traceparent/tracestate) over HTTP and NATS
+// headers, records spans for HTTP handlers and clients, GORM queries and
+// JetStream publishes, and exports them in batches to an OTLP/HTTP collector
+// or to stdout.
+//
+// A nil *Tracer is valid and records nothing; incoming trace context is then
+// passed through untouched by the HTTP helpers.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// W3C Trace Context header names.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether t is not all zeroes, as the spec requires.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether s is not all zeroes, as the spec requires.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// flagSampled is the traceparent trace-flags bit for a sampled trace.
+const flagSampled = 0x01
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// Remote marks a context extracted from an incoming request or message.
+	Remote bool
+}
+
+// IsValid reports whether sc carries usable trace and span IDs.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Sampled reports whether spans in this trace are recorded.
+func (sc SpanContext) Sampled() bool { return sc.Flags&flagSampled != 0 }
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent parses a traceparent header value. Unknown future versions
+// are accepted as long as their first four fields parse, per the spec.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, false
+	}
+	version, err := hex.DecodeString(value[0:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return sc, false
+	}
+	if len(value) > 55 && value[55] != '-' {
+		return sc, false
+	}
+	if !decodeLowerHex(sc.TraceID[:], value[3:35]) || !decodeLowerHex(sc.SpanID[:], value[36:52]) {
+		return sc, false
+	}
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], value[53:55]) {
+		return sc, false
+	}
+	sc.Flags = flags[0]
+	return sc, sc.IsValid()
+}
+
+// decodeLowerHex decodes s into dst, rejecting upper-case digits as the
+// traceparent grammar does.
+func decodeLowerHex(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 'A' && c <= 'F' {
+			return false
+		}
+	}
+	n, err := hex.Decode(dst, []byte(s))
+	return err == nil && n == len(dst)
+}
+
+// Carrier is a header map trace context is read from and written to.
+// http.Header and nats.Header both satisfy it.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// Inject writes the span context of ctx into c. It does nothing when ctx
+// carries no valid span context.
+func Inject(ctx context.Context, c Carrier) {
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	c.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		c.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+// Extract returns ctx carrying the remote span context found in c, if any, as
+// the parent for spans started from it.
+func Extract(ctx context.Context, c Carrier) context.Context {
+	sc, ok := ParseTraceparent(c.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = c.Get(TracestateHeader)
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// SpanFrom returns the span active in ctx, or nil.
+func SpanFrom(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFrom returns the span context active in ctx: the current span's,
+// or else one extracted from a remote caller.
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if s := SpanFrom(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// TraceIDFrom returns the hex trace ID active in ctx, or "" when there is
+// none. It suits log fields and event envelopes.
+func TraceIDFrom(ctx context.Context) string {
+	if sc := SpanContextFrom(ctx); sc.IsValid() {
+		return sc.TraceID.String()
+	}
+	return ""
+}
+
+// SpanKind says which side of an interaction a span describes. The values
+// match OTLP's.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = iota + 1
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	case KindProducer:
+		return "producer"
+	case KindConsumer:
+		return "consumer"
+	default:
+		return "internal"
+	}
+}
+
+// Span is one timed operation. Its methods are safe on a nil *Span, which is
+// what a nil Tracer hands out.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	name   string
+	kind   SpanKind
+	start  time.Time
+
+	mu     sync.Mutex
+	attrs  map[string]any
+	err    string
+	ended  bool
+	endsAt time.Time
+}
+
+// SpanContext returns the span's propagated identity.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttr records a key/value attribute on the span. Values should be
+// strings, bools, integers or floats; anything else is exported as text.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil || !s.sc.Sampled() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// SetName renames the span, for when the best name is only known once the
+// operation has run (e.g. a matched route).
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// RecordError marks the span failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export if sampled. Later calls do
+// nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.endsAt = time.Now()
+	data := SpanData{
+		TraceID:  s.sc.TraceID,
+		SpanID:   s.sc.SpanID,
+		ParentID: s.parent,
+		Name:     s.name,
+		Kind:     s.kind,
+		Start:    s.start,
+		End:      s.endsAt,
+		Attrs:    s.attrs,
+		Error:    s.err,
+	}
+	s.mu.Unlock()
+	if s.sc.Sampled() && s.tracer.exporter != nil {
+		s.tracer.enqueue(data)
+	}
+}
+
+// Config configures a Tracer.
+type Config struct {
+	// ServiceName identifies the process in exported spans.
+	ServiceName string
+	// Exporter receives finished sampled spans. Nil keeps propagating trace
+	// context (and sampling decisions) but records nothing.
+	Exporter Exporter
+	// SampleRatio is the fraction of new traces recorded, from 0 to 1. Traces
+	// started upstream follow the caller's sampling decision.
+	SampleRatio float64
+	// BatchSize and BatchTimeout bound how many spans, and for how long,
+	// are buffered before an export; QueueSize caps the backlog, beyond which
+	// spans are dropped. Zero values use the defaults.
+	BatchSize    int
+	BatchTimeout time.Duration
+	QueueSize    int
+}
+
+// Batching defaults.
+const (
+	DefaultBatchSize    = 256
+	DefaultBatchTimeout = 5 * time.Second
+	DefaultQueueSize    = 4096
+)
+
+// Tracer starts spans and exports the finished ones in the background.
+type Tracer struct {
+	service   string
+	exporter  Exporter
+	threshold uint64 // sample new traces whose ID falls below this
+
+	queue        chan SpanData
+	batchSize    int
+	batchTimeout time.Duration
+	flush        chan chan struct{}
+	done         chan struct{}
+	stopOnce     sync.Once
+	wg           sync.WaitGroup
+
+	mu      sync.Mutex
+	dropped int64
+	lastErr error
+}
+
+// New returns a Tracer exporting through cfg.Exporter. Call Shutdown to flush
+// buffered spans before the process exits.
+func New(cfg Config) *Tracer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.BatchTimeout <= 0 {
+		cfg.BatchTimeout = DefaultBatchTimeout
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	t := &Tracer{
+		service:      cfg.ServiceName,
+		exporter:     cfg.Exporter,
+		threshold:    ratioThreshold(cfg.SampleRatio),
+		queue:        make(chan SpanData, cfg.QueueSize),
+		batchSize:    cfg.BatchSize,
+		batchTimeout: cfg.BatchTimeout,
+		flush:        make(chan chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if t.exporter != nil {
+		t.wg.Add(1)
+		go t.run()
+	}
+	return t
+}
+
+// ratioThreshold maps a sample ratio onto the range of the trace ID's low 64
+// bits, so the decision is the same wherever the trace ID is seen.
+func ratioThreshold(ratio float64) uint64 {
+	switch {
+	case ratio >= 1:
+		return ^uint64(0)
+	case ratio <= 0:
+		return 0
+	default:
+		return uint64(ratio * (1 << 63) * 2)
+	}
+}
+
+// Start begins a span named name as a child of the span (or remote context)
+// in ctx, or as the root of a new trace. It returns ctx carrying the span;
+// the caller must End it.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFrom(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+		if binary.BigEndian.Uint64(sc.TraceID[8:]) < t.threshold || t.threshold == ^uint64(0) {
+			sc.Flags = flagSampled
+		}
+	}
+	s := &Span{tracer: t, sc: sc, parent: parent.SpanID, name: name, kind: kind, start: time.Now()}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *Tracer) enqueue(s SpanData) {
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	select {
+	case t.queue <- s:
+	default:
+		t.mu.Lock()
+		t.dropped++
+		t.mu.Unlock()
+	}
+}
+
+// run batches queued spans and exports them.
+func (t *Tracer) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.batchTimeout)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, t.batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.batchTimeout)
+		err := t.exporter.Export(ctx, t.service, batch)
+		cancel()
+		t.mu.Lock()
+		t.lastErr = err
+		t.mu.Unlock()
+		batch = make([]SpanData, 0, t.batchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-t.queue:
+				batch = append(batch, s)
+				if len(batch) >= t.batchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-t.flush:
+			drain()
+			close(ack)
+		case <-t.done:
+			drain()
+			return
+		}
+	}
+}
+
+// Flush exports every span queued so far, waiting until done or ctx ends.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil || t.exporter == nil {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case t.flush <- ack:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return t.LastError()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops the tracer after exporting what is queued. Spans ended
+// afterwards are discarded.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.done) })
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if t.exporter == nil {
+		return nil
+	}
+	return errors.Join(t.LastError(), t.exporter.Shutdown(ctx))
+}
+
+// LastError returns the outcome of the most recent export.
+func (t *Tracer) LastError() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastErr
+}
+
+// Dropped returns how many spans were discarded because the queue was full.
+func (t *Tracer) Dropped() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// Open builds a Tracer for service from user-facing settings: the exporter
+// name (see NewExporter), its endpoint, and the sample ratio. Stdout spans go
+// to w.
+func Open(service, exporter, endpoint string, sampleRatio float64, w io.Writer) (*Tracer, error) {
+	exp, err := NewExporter(exporter, endpoint, w)
+	if err != nil {
+		return nil, err
+	}
+	return New(Config{ServiceName: service, Exporter: exp, SampleRatio: sampleRatio}), nil
+}
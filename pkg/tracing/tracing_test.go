@@ -0,0 +1,272 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recorder is an Exporter that keeps every span.
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(_ context.Context, _ string, spans []SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *recorder) Shutdown(context.Context) error { return nil }
+
+func (r *recorder) byName(name string) (SpanData, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return SpanData{}, false
+}
+
+func newTestTracer(t *testing.T, ratio float64) (*Tracer, *recorder) {
+	t.Helper()
+	rec := &recorder{}
+	tr := New(Config{ServiceName: "test", Exporter: rec, SampleRatio: ratio})
+	t.Cleanup(func() { tr.Shutdown(context.Background()) })
+	return tr, rec
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(valid)
+	if !ok || !sc.Sampled() || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("parse valid = %+v, %v", sc, ok)
+	}
+	if got := sc.Traceparent(); got != valid {
+		t.Errorf("round trip = %q", got)
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Error("future version with extra fields rejected")
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", // v00 has no extra fields
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",       // zero trace ID
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",       // zero span ID
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",       // upper case
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",       // forbidden version
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+}
+
+func TestTracePropagatesThroughHandlerAndClient(t *testing.T) {
+	tr, rec := newTestTracer(t, 1)
+
+	var downstream string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = r.Header.Get(TraceparentHeader)
+	}))
+	t.Cleanup(backend.Close)
+	client := &http.Client{Transport: Transport(tr, nil)}
+
+	router := mux.NewRouter()
+	router.Use(Middleware(tr))
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, backend.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	})
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set(TraceparentHeader, incoming)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if err := tr.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server, ok := rec.byName("GET /items/{id}")
+	if !ok {
+		t.Fatalf("no server span named after the route in %+v", rec.spans)
+	}
+	if server.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentID.String() != "00f067aa0ba902b7" {
+		t.Errorf("server span did not continue the caller's trace: %+v", server)
+	}
+	client2, ok := rec.byName("HTTP GET")
+	if !ok || client2.ParentID != server.SpanID {
+		t.Fatalf("client span %+v is not a child of the server span", client2)
+	}
+	if want := "00-" + server.TraceID.String() + "-" + client2.SpanID.String() + "-01"; downstream != want {
+		t.Errorf("downstream traceparent = %q, want %q", downstream, want)
+	}
+}
+
+func TestUnsampledTracesPropagateButAreNotExported(t *testing.T) {
+	tr, rec := newTestTracer(t, 0)
+	ctx, span := tr.Start(context.Background(), "root", KindInternal)
+	h := http.Header{}
+	Inject(ctx, h)
+	span.End()
+	tr.Flush(context.Background())
+
+	if got := h.Get(TraceparentHeader); !strings.HasSuffix(got, "-00") {
+		t.Errorf("traceparent = %q, want an unsampled context", got)
+	}
+	if len(rec.spans) != 0 {
+		t.Errorf("exported %d unsampled spans", len(rec.spans))
+	}
+}
+
+func TestNilTracerIsANoop(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "x", KindInternal)
+	span.SetAttr("k", "v")
+	span.RecordError(errors.New("boom"))
+	span.End()
+	if SpanFrom(ctx) != nil || tr.Shutdown(ctx) != nil {
+		t.Error("nil tracer recorded a span")
+	}
+	if Transport(tr, http.DefaultTransport) != http.DefaultTransport {
+		t.Error("nil tracer wrapped the transport")
+	}
+}
+
+func TestNATSHandlerRestoresTraceContext(t *testing.T) {
+	tr, rec := newTestTracer(t, 1)
+	ctx, producer := tr.Start(context.Background(), "publish", KindProducer)
+	msg := nats.NewMsg("supply.chain.inventory.alert")
+	Inject(ctx, msg.Header)
+	producer.End()
+
+	var seen string
+	tr.Handler(func(ctx context.Context, msg *nats.Msg) error {
+		seen = TraceIDFrom(ctx)
+		return errors.New("handler failed")
+	})(msg)
+	tr.Flush(context.Background())
+
+	if seen != producer.SpanContext().TraceID.String() {
+		t.Errorf("consumer trace = %q, want the producer's", seen)
+	}
+	consumer, ok := rec.byName("process supply.chain.inventory.alert")
+	if !ok || consumer.ParentID != producer.SpanContext().SpanID || consumer.Kind != KindConsumer {
+		t.Fatalf("consumer span = %+v", consumer)
+	}
+	if consumer.Error != "handler failed" {
+		t.Errorf("consumer error = %q", consumer.Error)
+	}
+}
+
+func TestOTLPExporterPostsJSON(t *testing.T) {
+	var body map[string]any
+	var path string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	t.Cleanup(collector.Close)
+
+	exp, err := NewOTLPExporter(collector.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, 1000)
+	err = exp.Export(context.Background(), "inventory", []SpanData{{
+		TraceID: TraceID{1}, SpanID: SpanID{2}, Name: "SELECT inventory", Kind: KindClient,
+		Start: start, End: start.Add(time.Millisecond), Attrs: map[string]any{"db.rows_affected": int64(3)},
+		Error: "timeout",
+	}})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if path != "/v1/traces" {
+		t.Errorf("path = %q", path)
+	}
+	raw, _ := json.Marshal(body)
+	for _, want := range []string{
+		`"service.name"`, `"stringValue":"inventory"`,
+		`"traceId":"01000000000000000000000000000000"`, `"spanId":"0200000000000000"`,
+		`"kind":3`, `"startTimeUnixNano":"1000"`, `"endTimeUnixNano":"1001000"`,
+		`"intValue":"3"`, `"status":{"code":2,"message":"timeout"}`,
+	} {
+		if !bytes.Contains(raw, []byte(want)) {
+			t.Errorf("body missing %s:\n%s", want, raw)
+		}
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tr := New(Config{ServiceName: "gateway", Exporter: NewStdoutExporter(&buf), SampleRatio: 1})
+	_, span := tr.Start(context.Background(), "work", KindInternal)
+	span.SetAttr("items", 2)
+	span.End()
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var line struct {
+		Service string         `json:"service"`
+		Name    string         `json:"name"`
+		Attrs   map[string]any `json:"attributes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(&buf, 4096)).Decode(&line); err != nil {
+		t.Fatalf("decode %q: %v", buf.String(), err)
+	}
+	if line.Service != "gateway" || line.Name != "work" || line.Attrs["items"] != float64(2) {
+		t.Errorf("line = %+v", line)
+	}
+}
+
+func TestGORMPluginTracesQueriesInATrace(t *testing.T) {
+	tr, rec := newTestTracer(t, 1)
+	// DryRun builds statements without a server, which is all the callbacks need.
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := db.Use(GORM(tr)); err != nil {
+		t.Fatalf("use: %v", err)
+	}
+	type widget struct{ ID string }
+
+	db.First(&widget{}) // no trace in the context: not recorded
+	ctx, parent := tr.Start(context.Background(), "request", KindServer)
+	db.WithContext(ctx).Where("id = ?", "w1").First(&widget{})
+	parent.End()
+	tr.Flush(context.Background())
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("spans = %+v, want the query and its parent", rec.spans)
+	}
+	query, ok := rec.byName("SELECT widgets")
+	if !ok || query.ParentID != parent.SpanContext().SpanID || query.Kind != KindClient {
+		t.Fatalf("query span = %+v", query)
+	}
+	if stmt, _ := query.Attrs["db.statement"].(string); !strings.Contains(stmt, `FROM "widgets" WHERE id = $1`) {
+		t.Errorf("db.statement = %q", stmt)
+	}
+}
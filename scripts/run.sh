@@ -53,6 +53,10 @@ done
 JWT_SECRET="$(openssl rand -hex 32 2>/dev/null || echo "dev-secret-$$-${RANDOM}${RANDOM}")"
 export JWT_SECRET
 
+# The shipped config defaults to production; local runs are development
+# (demo accounts, mail logged instead of sent).
+export APP_ENV="${APP_ENV:-development}"
+
 PIDS=()
 CLEANED=false
 
@@ -153,7 +157,7 @@ cat <<EOF
 
 $($USE_FRONTEND && echo "  Frontend   http://localhost:$FRONTEND_PORT   <-- open this")
   Gateway    http://localhost:$GATEWAY_PORT
-  Inventory  http://localhost:$INVENTORY_PORT          (no auth)
+  Inventory  http://localhost:$INVENTORY_PORT          (JWT required)
   Shipment   http://localhost:$SHIPMENT_PORT/api/v1     (JWT required)
 
   Sign in from the app's login page (pick a role — no token to paste).